@@ -0,0 +1,54 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package v1
+
+import (
+	"github.com/loadimpact/k6/lib"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Breakpoint is the progress of a breakpoint test.
+type Breakpoint struct {
+	Mode    string               `json:"mode" yaml:"mode"`
+	Steps   []lib.BreakpointStep `json:"steps" yaml:"steps"`
+	Highest null.Int             `json:"highest" yaml:"highest"`
+	Done    bool                 `json:"done" yaml:"done"`
+}
+
+func NewBreakpoint(result lib.BreakpointResult) Breakpoint {
+	return Breakpoint{
+		Mode:    result.Mode,
+		Steps:   result.Steps,
+		Highest: result.Highest,
+		Done:    result.Done,
+	}
+}
+
+func (b Breakpoint) GetName() string {
+	return "breakpoint"
+}
+
+func (b Breakpoint) GetID() string {
+	return "default"
+}
+
+func (b Breakpoint) SetID(id string) error {
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/lib"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestGetBreakpoint(t *testing.T) {
+	t.Run("breakpoint", func(t *testing.T) {
+		config := lib.Breakpoint{Step: null.IntFrom(10), Max: null.IntFrom(100)}
+		ex, err := local.NewBreakpoint(nil, config)
+		require.NoError(t, err)
+		engine, err := core.NewEngine(ex, lib.Options{Breakpoint: &config})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		NewHandler().ServeHTTP(rw, newRequestWithEngine(engine, "GET", "/v1/breakpoint", nil))
+		res := rw.Result()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		var bp Breakpoint
+		assert.NoError(t, jsonapi.Unmarshal(rw.Body.Bytes(), &bp))
+		assert.Equal(t, Breakpoint{Mode: "vus", Steps: []lib.BreakpointStep{}}, bp)
+	})
+	t.Run("no breakpoint", func(t *testing.T) {
+		engine, err := core.NewEngine(nil, lib.Options{})
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+		NewHandler().ServeHTTP(rw, newRequestWithEngine(engine, "GET", "/v1/breakpoint", nil))
+		assert.Equal(t, http.StatusNotFound, rw.Result().StatusCode)
+	})
+}
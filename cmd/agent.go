@@ -0,0 +1,79 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/loadimpact/k6/api"
+	"github.com/loadimpact/k6/core/distributed"
+	"github.com/loadimpact/k6/lib"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/urfave/negroni"
+)
+
+// agentCmd represents the agent command.
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Run parts of distributed tests",
+	Long: `Run parts of distributed tests.
+
+Waits for a controller, started with "k6 run --distributed", to send it a part
+of a test to run, and streams the results back to it.
+
+  Use the global --address flag to specify the address to listen on.`,
+	Example: `
+  # Start two agents on this machine, and run a test split between them.
+  k6 agent -a localhost:6566 &
+  k6 agent -a localhost:6567 &
+  k6 run --distributed localhost:6566,localhost:6567 script.js`[1:],
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runtimeOptions, err := getRuntimeOptions(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		agent := distributed.NewAgent(func(arc *lib.Archive) (lib.Runner, error) {
+			return newRunnerFromArchive(arc, runtimeOptions)
+		})
+
+		mux := http.NewServeMux()
+		mux.Handle("/v1/agent/", agent.Handler())
+		mux.Handle("/ping", api.HandlePing())
+
+		n := negroni.New()
+		n.Use(negroni.NewRecovery())
+		n.UseFunc(api.NewLogger(log.StandardLogger()))
+		n.UseHandler(mux)
+
+		log.WithField("address", address).Info("Agent: Waiting for tests")
+		return http.ListenAndServe(address, n)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(agentCmd)
+
+	agentCmd.Flags().SortFlags = false
+	agentCmd.Flags().AddFlagSet(runtimeOptionFlagSet(false))
+}
@@ -28,19 +28,24 @@ import (
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats/aggregator"
 	"github.com/loadimpact/k6/stats/cloud"
 	"github.com/loadimpact/k6/stats/influxdb"
 	jsonc "github.com/loadimpact/k6/stats/json"
 	"github.com/loadimpact/k6/stats/kafka"
+	"github.com/loadimpact/k6/stats/prometheus"
+	"github.com/loadimpact/k6/stats/statsd"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 )
 
 const (
-	collectorInfluxDB = "influxdb"
-	collectorJSON     = "json"
-	collectorKafka    = "kafka"
-	collectorCloud    = "cloud"
+	collectorInfluxDB   = "influxdb"
+	collectorJSON       = "json"
+	collectorKafka      = "kafka"
+	collectorCloud      = "cloud"
+	collectorPrometheus = "prometheus"
+	collectorStatsD     = "statsd"
 )
 
 func parseCollector(s string) (t, arg string) {
@@ -93,6 +98,32 @@ func newCollector(collectorName, arg string, src *lib.SourceData, conf Config) (
 				config = config.Apply(cmdConfig)
 			}
 			return kafka.New(config)
+		case collectorPrometheus:
+			config := prometheus.NewConfig().Apply(conf.Collectors.Prometheus)
+			if err := envconfig.Process("k6", &config); err != nil {
+				return nil, err
+			}
+			if arg != "" {
+				cmdConfig, err := prometheus.ParseArg(arg)
+				if err != nil {
+					return nil, err
+				}
+				config = config.Apply(cmdConfig)
+			}
+			return prometheus.New(config)
+		case collectorStatsD:
+			config := statsd.NewConfig().Apply(conf.Collectors.StatsD)
+			if err := envconfig.Process("k6", &config); err != nil {
+				return nil, err
+			}
+			if arg != "" {
+				cmdConfig, err := statsd.ParseArg(arg)
+				if err != nil {
+					return nil, err
+				}
+				config = config.Apply(cmdConfig)
+			}
+			return statsd.New(config)
 		default:
 			return nil, errors.Errorf("unknown output type: %s", collectorName)
 		}
@@ -103,6 +134,21 @@ func newCollector(collectorName, arg string, src *lib.SourceData, conf Config) (
 		return collector, err
 	}
 
+	aggrConf := aggregator.NewConfig().Apply(conf.Collectors.Aggregation[collectorName])
+	if err := envconfig.Process("k6_"+collectorName+"_aggregation", &aggrConf); err != nil {
+		return collector, err
+	}
+	if aggrConf.Enabled() {
+		if collectorName == collectorCloud {
+			return collector, errors.New("the cloud output already aggregates its samples on its own")
+		}
+		aggregated, err := aggregator.New(collector, aggrConf)
+		if err != nil {
+			return collector, errors.Wrapf(err, "invalid aggregation for output '%s'", collectorName)
+		}
+		collector = aggregated
+	}
+
 	// Check if all required tags are present
 	missingRequiredTags := []string{}
 	for reqTag := range collector.GetRequiredSystemTags() {
@@ -27,9 +27,12 @@ import (
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats/aggregator"
 	"github.com/loadimpact/k6/stats/cloud"
 	"github.com/loadimpact/k6/stats/influxdb"
 	"github.com/loadimpact/k6/stats/kafka"
+	"github.com/loadimpact/k6/stats/prometheus"
+	"github.com/loadimpact/k6/stats/statsd"
 	"github.com/shibukawa/configdir"
 	"github.com/spf13/afero"
 	"github.com/spf13/pflag"
@@ -56,7 +59,9 @@ func configFlagSet() *pflag.FlagSet {
 	flags.BoolP("linger", "l", false, "keep the API server alive past test end")
 	flags.Bool("no-usage-report", false, "don't send anonymous stats to the developers")
 	flags.Bool("no-thresholds", false, "don't run thresholds")
-	flags.Bool("no-summary", false, "don't show the summary at the end of the test")
+	flags.Bool("no-summary", false, "don't show the summary at the end of the test, nor run handleSummary()")
+	flags.String("summary-export", "", "output the end-of-test summary report to JSON `file`")
+	flags.String("junit-export", "", "output a JUnit XML report of thresholds and checks to `file`")
 	flags.AddFlagSet(configFileFlagSet())
 	return flags
 }
@@ -64,16 +69,23 @@ func configFlagSet() *pflag.FlagSet {
 type Config struct {
 	lib.Options
 
-	Out           []string  `json:"out" envconfig:"out"`
-	Linger        null.Bool `json:"linger" envconfig:"linger"`
-	NoUsageReport null.Bool `json:"noUsageReport" envconfig:"no_usage_report"`
-	NoThresholds  null.Bool `json:"noThresholds" envconfig:"no_thresholds"`
-	NoSummary     null.Bool `json:"noSummary" envconfig:"no_summary"`
+	Out           []string    `json:"out" envconfig:"out"`
+	Linger        null.Bool   `json:"linger" envconfig:"linger"`
+	NoUsageReport null.Bool   `json:"noUsageReport" envconfig:"no_usage_report"`
+	NoThresholds  null.Bool   `json:"noThresholds" envconfig:"no_thresholds"`
+	NoSummary     null.Bool   `json:"noSummary" envconfig:"no_summary"`
+	SummaryExport null.String `json:"summaryExport" envconfig:"summary_export"`
+	JUnitExport   null.String `json:"junitExport" envconfig:"junit_export"`
 
 	Collectors struct {
-		InfluxDB influxdb.Config `json:"influxdb"`
-		Kafka    kafka.Config    `json:"kafka"`
-		Cloud    cloud.Config    `json:"cloud"`
+		InfluxDB   influxdb.Config   `json:"influxdb"`
+		Kafka      kafka.Config      `json:"kafka"`
+		Cloud      cloud.Config      `json:"cloud"`
+		Prometheus prometheus.Config `json:"prometheus"`
+		StatsD     statsd.Config     `json:"statsd"`
+
+		// Per-output aggregation settings, by output type.
+		Aggregation map[string]aggregator.Config `json:"aggregation" ignored:"true"`
 	} `json:"collectors"`
 }
 
@@ -94,9 +106,27 @@ func (c Config) Apply(cfg Config) Config {
 	if cfg.NoSummary.Valid {
 		c.NoSummary = cfg.NoSummary
 	}
+	if cfg.SummaryExport.Valid {
+		c.SummaryExport = cfg.SummaryExport
+	}
+	if cfg.JUnitExport.Valid {
+		c.JUnitExport = cfg.JUnitExport
+	}
 	c.Collectors.InfluxDB = c.Collectors.InfluxDB.Apply(cfg.Collectors.InfluxDB)
 	c.Collectors.Cloud = c.Collectors.Cloud.Apply(cfg.Collectors.Cloud)
 	c.Collectors.Kafka = c.Collectors.Kafka.Apply(cfg.Collectors.Kafka)
+	c.Collectors.Prometheus = c.Collectors.Prometheus.Apply(cfg.Collectors.Prometheus)
+	c.Collectors.StatsD = c.Collectors.StatsD.Apply(cfg.Collectors.StatsD)
+	if len(cfg.Collectors.Aggregation) > 0 {
+		aggregation := make(map[string]aggregator.Config, len(c.Collectors.Aggregation))
+		for name, aggrConf := range c.Collectors.Aggregation {
+			aggregation[name] = aggrConf
+		}
+		for name, aggrConf := range cfg.Collectors.Aggregation {
+			aggregation[name] = aggregation[name].Apply(aggrConf)
+		}
+		c.Collectors.Aggregation = aggregation
+	}
 	return c
 }
 
@@ -117,6 +147,8 @@ func getConfig(flags *pflag.FlagSet) (Config, error) {
 		NoUsageReport: getNullBool(flags, "no-usage-report"),
 		NoThresholds:  getNullBool(flags, "no-thresholds"),
 		NoSummary:     getNullBool(flags, "no-summary"),
+		SummaryExport: getNullString(flags, "summary-export"),
+		JUnitExport:   getNullString(flags, "junit-export"),
 	}, nil
 }
 
@@ -165,6 +197,8 @@ func readEnvConfig() (conf Config, err error) {
 		envconfig.Process("k6", &conf.Collectors.Cloud),
 		envconfig.Process("k6", &conf.Collectors.InfluxDB),
 		envconfig.Process("k6", &conf.Collectors.Kafka),
+		envconfig.Process("k6", &conf.Collectors.Prometheus),
+		envconfig.Process("k6", &conf.Collectors.StatsD),
 	} {
 		return conf, err
 	}
@@ -183,6 +217,8 @@ func getConsolidatedConfig(fs afero.Fs, cliConf Config, runner lib.Runner) (conf
 	cliConf.Collectors.InfluxDB = influxdb.NewConfig().Apply(cliConf.Collectors.InfluxDB)
 	cliConf.Collectors.Cloud = cloud.NewConfig().Apply(cliConf.Collectors.Cloud)
 	cliConf.Collectors.Kafka = kafka.NewConfig().Apply(cliConf.Collectors.Kafka)
+	cliConf.Collectors.Prometheus = prometheus.NewConfig().Apply(cliConf.Collectors.Prometheus)
+	cliConf.Collectors.StatsD = statsd.NewConfig().Apply(cliConf.Collectors.StatsD)
 
 	fileConf, _, err := readDiskConfig(fs)
 	if err != nil {
@@ -23,8 +23,11 @@ package cmd
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats/aggregator"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/guregu/null.v3"
 )
@@ -133,4 +136,26 @@ func TestConfigApply(t *testing.T) {
 		conf = Config{}.Apply(Config{Out: []string{"influxdb", "json"}})
 		assert.Equal(t, []string{"influxdb", "json"}, conf.Out)
 	})
+	t.Run("Aggregation", func(t *testing.T) {
+		base := Config{}
+		base.Collectors.Aggregation = map[string]aggregator.Config{
+			"influxdb": {Interval: types.NullDurationFrom(time.Second), Tags: []string{"name"}},
+			"json":     {Interval: types.NullDurationFrom(time.Second)},
+		}
+		override := Config{}
+		override.Collectors.Aggregation = map[string]aggregator.Config{
+			"influxdb": {Interval: types.NullDurationFrom(5 * time.Second)},
+			"kafka":    {Tags: []string{"status"}},
+		}
+
+		conf := base.Apply(override)
+		assert.Equal(t, map[string]aggregator.Config{
+			"influxdb": {Interval: types.NullDurationFrom(5 * time.Second), Tags: []string{"name"}},
+			"json":     {Interval: types.NullDurationFrom(time.Second)},
+			"kafka":    {Tags: []string{"status"}},
+		}, conf.Collectors.Aggregation)
+		assert.Len(t, base.Collectors.Aggregation, 2, "the applied config shouldn't be modified")
+
+		assert.Equal(t, base.Collectors.Aggregation, base.Apply(Config{}).Collectors.Aggregation)
+	})
 }
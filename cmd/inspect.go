@@ -28,6 +28,7 @@ import (
 
 	"github.com/loadimpact/k6/js"
 	"github.com/loadimpact/k6/lib"
+	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 )
@@ -79,6 +80,13 @@ var inspectCmd = &cobra.Command{
 			opts = b.Options
 		}
 
+		// Report broken stage curves here too, rather than only when the script is run.
+		for i, stage := range opts.Stages {
+			if err := stage.Validate(); err != nil {
+				return errors.Wrapf(err, "stage #%d", i)
+			}
+		}
+
 		data, err := json.MarshalIndent(opts, "", "  ")
 		if err != nil {
 			return err
@@ -48,7 +48,8 @@ func optionFlagSet() *pflag.FlagSet {
 	flags.Int64P("max", "m", 0, "max available virtual users")
 	flags.DurationP("duration", "d", 0, "test duration limit")
 	flags.Int64P("iterations", "i", 0, "script total iteration limit (among all VUs)")
-	flags.StringSliceP("stage", "s", nil, "add a `stage`, as `[duration]:[target]`")
+	flags.StringSliceP("stage", "s", nil, "add a `stage`, as `[duration]:[target]` or `[duration]:[target]:[curve]`")
+	flags.Int64("arrival-rate", 0, "start iterations at this `rate` per second, instead of looping VUs")
 	flags.BoolP("paused", "p", false, "start the test in a paused state")
 	flags.Int64("max-redirects", 10, "follow at most n redirects")
 	flags.Int64("batch", 20, "max parallel batch reqs")
@@ -65,6 +66,7 @@ func optionFlagSet() *pflag.FlagSet {
 	flags.StringSlice("blacklist-ip", nil, "blacklist an `ip range` from being called")
 	flags.StringSlice("summary-trend-stats", nil, "define `stats` for trend metrics (response times), one or more as 'avg,p(95),...'")
 	flags.String("summary-time-unit", "", "define the time unit used to display the trend stats. Possible units are: 's', 'ms' and 'us'")
+	flags.String("trend-sink", "", "how trend metrics store values: 'exact' keeps them all, 'sketch' estimates percentiles within 1% in bounded memory")
 	flags.StringSlice("system-tags", lib.DefaultSystemTagList, "only include these system tags in metrics")
 	flags.StringSlice("tag", nil, "add a `tag` to be applied to all samples, as `[name]=[value]`")
 	flags.Bool("discard-response-bodies", false, "Read but don't process or save HTTP response bodies")
@@ -77,6 +79,7 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		VUsMax:                getNullInt64(flags, "max"),
 		Duration:              getNullDuration(flags, "duration"),
 		Iterations:            getNullInt64(flags, "iterations"),
+		ArrivalRate:           getNullInt64(flags, "arrival-rate"),
 		Paused:                getNullBool(flags, "paused"),
 		MaxRedirects:          getNullInt64(flags, "max-redirects"),
 		Batch:                 getNullInt64(flags, "batch"),
@@ -94,6 +97,9 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		SetupTimeout:    types.NullDuration{Duration: types.Duration(10 * time.Second), Valid: false},
 		TeardownTimeout: types.NullDuration{Duration: types.Duration(10 * time.Second), Valid: false},
 
+		VUSetupTimeout:    types.NullDuration{Duration: types.Duration(10 * time.Second), Valid: false},
+		VUTeardownTimeout: types.NullDuration{Duration: types.Duration(10 * time.Second), Valid: false},
+
 		MetricSamplesBufferSize: null.NewInt(1000, false),
 	}
 
@@ -151,6 +157,17 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		opts.SummaryTimeUnit = null.StringFrom(summaryTimeUnit)
 	}
 
+	trendSink, err := flags.GetString("trend-sink")
+	if err != nil {
+		return opts, err
+	}
+	if trendSink != "" {
+		if trendSink != lib.TrendSinkExact && trendSink != lib.TrendSinkSketch {
+			return opts, errors.New("invalid trend sink. Use: 'exact' or 'sketch'")
+		}
+		opts.TrendSink = null.StringFrom(trendSink)
+	}
+
 	systemTagList, err := flags.GetStringSlice("system-tags")
 	if err != nil {
 		return opts, err
@@ -33,12 +33,14 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/loadimpact/k6/api"
 	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/core/distributed"
 	"github.com/loadimpact/k6/core/local"
 	"github.com/loadimpact/k6/js"
 	"github.com/loadimpact/k6/lib"
@@ -67,6 +69,8 @@ var (
 	runType       = os.Getenv("K6_TYPE")
 	runNoSetup    = os.Getenv("K6_NO_SETUP") != ""
 	runNoTeardown = os.Getenv("K6_NO_TEARDOWN") != ""
+
+	runDistributed []string
 )
 
 // runCmd represents the run command.
@@ -94,7 +98,10 @@ a commandline interface for interacting with it.`,
   k6 run -u 0 -s 10s:100 -s 60s -s 10s:0
 
   # Send metrics to an influxdb server
-  k6 run -o influxdb=http://1.2.3.4:8086/k6`[1:],
+  k6 run -o influxdb=http://1.2.3.4:8086/k6
+
+  # Split 100 VUs between two machines running "k6 agent".
+  k6 run -u 100 -d 10s --distributed 10.0.0.1:6565,10.0.0.2:6565 script.js`[1:],
 	Args: exactArgsWithMsg(1, "arg should either be \"-\", if reading script from stdin, or a path to a script file"),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		_, _ = BannerColor.Fprint(stdout, Banner+"\n\n")
@@ -138,26 +145,46 @@ a commandline interface for interacting with it.`,
 			return err
 		}
 
-		// If -m/--max isn't specified, figure out the max that should be needed.
-		if !conf.VUsMax.Valid {
-			conf.VUsMax = null.NewInt(conf.VUs.Int64, conf.VUs.Valid)
-			for _, stage := range conf.Stages {
-				if stage.Target.Valid && stage.Target.Int64 > conf.VUsMax.Int64 {
-					conf.VUsMax = stage.Target
-				}
+		// Breakpoint tests set their own load levels, and can't be combined with anything else
+		// that does.
+		if conf.Breakpoint != nil {
+			switch {
+			case len(conf.Scenarios) > 0:
+				return errors.New("breakpoint tests can't have scenarios")
+			case len(conf.Stages) > 0:
+				return errors.New("breakpoint tests can't have stages")
+			case len(runDistributed) > 0:
+				return errors.New("breakpoint tests can't be distributed")
 			}
 		}
 
-		// If -d/--duration, -i/--iterations and -s/--stage are all unset, run to one iteration.
-		if !conf.Duration.Valid && !conf.Iterations.Valid && len(conf.Stages) == 0 {
-			conf.Iterations = null.IntFrom(1)
-		}
+		// Scenarios set up their own VUs and end conditions; the global ones are only defaulted
+		// for regular tests.
+		if len(conf.Scenarios) == 0 && conf.Breakpoint == nil {
+			// If -m/--max isn't specified, figure out the max that should be needed.
+			if !conf.VUsMax.Valid {
+				conf.VUsMax = null.NewInt(conf.VUs.Int64, conf.VUs.Valid)
+				// With an arrival rate, stage targets are rates rather than VU counts.
+				if !conf.ArrivalRate.Valid {
+					for _, stage := range conf.Stages {
+						if max := stage.MaxTarget(); max.Valid && max.Int64 > conf.VUsMax.Int64 {
+							conf.VUsMax = max
+						}
+					}
+				}
+			}
+
+			// If -d/--duration, -i/--iterations and -s/--stage are all unset, run to one iteration.
+			if !conf.Duration.Valid && !conf.Iterations.Valid && len(conf.Stages) == 0 {
+				conf.Iterations = null.IntFrom(1)
+			}
 
-		if conf.Iterations.Valid && conf.Iterations.Int64 < conf.VUsMax.Int64 {
-			log.Warnf(
-				"All iterations (%d in this test run) are shared between all VUs, so some of the %d VUs will not execute even a single iteration!",
-				conf.Iterations.Int64, conf.VUsMax.Int64,
-			)
+			if conf.Iterations.Valid && conf.Iterations.Int64 < conf.VUsMax.Int64 {
+				log.Warnf(
+					"All iterations (%d in this test run) are shared between all VUs, so some of the %d VUs will not execute even a single iteration!",
+					conf.Iterations.Int64, conf.VUsMax.Int64,
+				)
+			}
 		}
 
 		// If duration is explicitly set to 0, it means run forever.
@@ -173,9 +200,25 @@ a commandline interface for interacting with it.`,
 		// Write options back to the runner too.
 		r.SetOptions(conf.Options)
 
-		// Create a local executor wrapping the runner.
+		// Create an executor wrapping the runner; a local one, unless the test is distributed.
 		fprintf(stdout, "%s executor\r", initBar.String())
-		ex := local.New(r)
+		var ex lib.Executor
+		switch {
+		case len(runDistributed) > 0:
+			ex = distributed.NewExecutor(r, runDistributed)
+		case len(conf.Scenarios) > 0:
+			if ex, err = local.NewScenarios(r, conf.Scenarios); err != nil {
+				return err
+			}
+		case conf.Breakpoint != nil:
+			if ex, err = local.NewBreakpoint(r, *conf.Breakpoint); err != nil {
+				return err
+			}
+		case conf.ArrivalRate.Valid:
+			ex = local.NewArrivalRate(r)
+		default:
+			ex = local.New(r)
+		}
 		if runNoSetup {
 			ex.SetRunSetup(false)
 		}
@@ -194,8 +237,13 @@ a commandline interface for interacting with it.`,
 		if conf.NoThresholds.Valid {
 			engine.NoThresholds = conf.NoThresholds.Bool
 		}
+		if conf.Breakpoint != nil {
+			// The executor evaluates the thresholds over each step instead.
+			engine.NoThresholds = true
+		}
 		if conf.NoSummary.Valid {
-			engine.NoSummary = conf.NoSummary.Bool
+			// Exporting the summary needs the same data as showing it.
+			engine.NoSummary = conf.NoSummary.Bool && conf.SummaryExport.String == ""
 		}
 
 		// Create a collector and assign it to the engine if requested.
@@ -238,31 +286,66 @@ a commandline interface for interacting with it.`,
 				}
 			}
 
-			fprintf(stdout, "  execution: %s\n", ui.ValueColor.Sprint("local"))
+			execution := "local"
+			if len(runDistributed) > 0 {
+				execution = fmt.Sprintf("distributed (%d agents)", len(runDistributed))
+			}
+			fprintf(stdout, "  execution: %s\n", ui.ValueColor.Sprint(execution))
 			fprintf(stdout, "     output: %s%s\n", ui.ValueColor.Sprint(out), ui.ExtraColor.Sprint(link))
 			fprintf(stdout, "     script: %s\n", ui.ValueColor.Sprint(filename))
 			fprintf(stdout, "\n")
 
-			duration := ui.GrayColor.Sprint("-")
-			iterations := ui.GrayColor.Sprint("-")
-			if conf.Duration.Valid {
-				duration = ui.ValueColor.Sprint(conf.Duration.Duration)
-			}
-			if conf.Iterations.Valid {
-				iterations = ui.ValueColor.Sprint(conf.Iterations.Int64)
-			}
-			vus := ui.ValueColor.Sprint(conf.VUs.Int64)
-			max := ui.ValueColor.Sprint(conf.VUsMax.Int64)
+			if len(conf.Scenarios) > 0 {
+				names := make([]string, 0, len(conf.Scenarios))
+				for name := range conf.Scenarios {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				fprintf(stdout, "   scenarios: %s\n", ui.ValueColor.Sprint(len(names)))
+				for _, name := range names {
+					sc := conf.Scenarios[name]
+					exec := "default"
+					if sc.Exec.Valid {
+						exec = sc.Exec.String
+					}
+					fprintf(stdout, "     * %s: %s, exec: %s, start: %s\n",
+						name, ui.ValueColor.Sprint(sc.GetExecutor()), ui.ValueColor.Sprint(exec),
+						ui.ValueColor.Sprint(time.Duration(sc.StartTime.Duration)),
+					)
+				}
+			} else if conf.Breakpoint != nil {
+				bp := conf.Breakpoint.WithDefaults()
+				fprintf(stdout, "  breakpoint: %s, from %s to %s by %s, %s per step\n",
+					ui.ValueColor.Sprint(bp.GetMode()), ui.ValueColor.Sprint(bp.Start.Int64),
+					ui.ValueColor.Sprint(bp.Max.Int64), ui.ValueColor.Sprint(bp.Step.Int64),
+					ui.ValueColor.Sprint(time.Duration(bp.StepDuration.Duration)),
+				)
+			} else {
+				duration := ui.GrayColor.Sprint("-")
+				iterations := ui.GrayColor.Sprint("-")
+				if conf.Duration.Valid {
+					duration = ui.ValueColor.Sprint(conf.Duration.Duration)
+				}
+				if conf.Iterations.Valid {
+					iterations = ui.ValueColor.Sprint(conf.Iterations.Int64)
+				}
+				vus := ui.ValueColor.Sprint(conf.VUs.Int64)
+				max := ui.ValueColor.Sprint(conf.VUsMax.Int64)
 
-			leftWidth := ui.StrWidth(duration)
-			if l := ui.StrWidth(vus); l > leftWidth {
-				leftWidth = l
-			}
-			durationPad := strings.Repeat(" ", leftWidth-ui.StrWidth(duration))
-			vusPad := strings.Repeat(" ", leftWidth-ui.StrWidth(vus))
+				leftWidth := ui.StrWidth(duration)
+				if l := ui.StrWidth(vus); l > leftWidth {
+					leftWidth = l
+				}
+				durationPad := strings.Repeat(" ", leftWidth-ui.StrWidth(duration))
+				vusPad := strings.Repeat(" ", leftWidth-ui.StrWidth(vus))
 
-			fprintf(stdout, "    duration: %s,%s iterations: %s\n", duration, durationPad, iterations)
-			fprintf(stdout, "         vus: %s,%s max: %s\n", vus, vusPad, max)
+				fprintf(stdout, "    duration: %s,%s iterations: %s\n", duration, durationPad, iterations)
+				fprintf(stdout, "         vus: %s,%s max: %s\n", vus, vusPad, max)
+				if conf.ArrivalRate.Valid {
+					fprintf(stdout, "        rate: %s\n", ui.ValueColor.Sprintf("%d/s", conf.ArrivalRate.Int64))
+				}
+			}
 			fprintf(stdout, "\n")
 		}
 
@@ -324,18 +407,25 @@ a commandline interface for interacting with it.`,
 				}
 				precision := 100 * time.Millisecond
 				atT := engine.Executor.GetTime()
-				stagesEndT := lib.SumStages(engine.Executor.GetStages())
+				stages := engine.Executor.GetStages()
+				stagesEndT := lib.SumStages(stages)
 				endT := engine.Executor.GetEndTime()
 				if !endT.Valid || (stagesEndT.Valid && endT.Duration > stagesEndT.Duration) {
 					endT = stagesEndT
 				}
+
+				// Stages don't have to be linear, so show where their curves are at.
+				var vus string
+				if len(stages) > 0 {
+					vus = fmt.Sprintf("%d VUs, ", engine.Executor.GetVUs())
+				}
 				if endT.Valid {
-					return fmt.Sprintf("%s / %s",
+					return fmt.Sprintf("%s%s / %s", vus,
 						(atT/precision)*precision,
 						(time.Duration(endT.Duration)/precision)*precision,
 					)
 				}
-				return ((atT / precision) * precision).String()
+				return vus + ((atT / precision) * precision).String()
 			},
 		}
 
@@ -434,25 +524,55 @@ a commandline interface for interacting with it.`,
 		}
 
 		// Print the end-of-test summary.
-		if !quiet && !conf.NoSummary.Bool {
+		summaryData := ui.SummaryData{
+			Opts:    conf.Options,
+			Root:    engine.Executor.GetRunner().GetDefaultGroup(),
+			Metrics: engine.Metrics,
+			Time:    engine.Executor.GetTime(),
+
+			Warnings: engine.GetGeneratorWarnings(),
+		}
+		if bp, ok := engine.Executor.(lib.BreakpointReporter); ok {
+			result := bp.GetBreakpointResult()
+			summaryData.Breakpoint = &result
+		}
+		handled := false
+		if !conf.NoSummary.Bool {
+			var err error
+			if handled, err = handleSummary(fs, engine.Executor.GetRunner(), summaryData); err != nil {
+				log.WithError(err).Error("Couldn't handle the summary")
+			}
+		}
+		if !quiet && !conf.NoSummary.Bool && !handled {
 			fprintf(stdout, "\n")
-			ui.Summarize(stdout, "", ui.SummaryData{
-				Opts:    conf.Options,
-				Root:    engine.Executor.GetRunner().GetDefaultGroup(),
-				Metrics: engine.Metrics,
-				Time:    engine.Executor.GetTime(),
-			})
+			ui.Summarize(stdout, "", summaryData)
 			fprintf(stdout, "\n")
 		}
+		if conf.SummaryExport.String != "" {
+			if err := exportSummary(fs, conf.SummaryExport.String, summaryData, ui.ExportSummary); err != nil {
+				log.WithError(err).Error("Couldn't export the summary")
+			}
+		}
+		if conf.JUnitExport.String != "" {
+			if err := exportSummary(fs, conf.JUnitExport.String, summaryData, ui.ExportJUnit); err != nil {
+				log.WithError(err).Error("Couldn't export the JUnit report")
+			}
+		}
 
 		if conf.Linger.Bool {
 			log.Info("Linger set; waiting for Ctrl+C...")
 			<-sigC
 		}
 
+		if code := engine.GetAbortExitCode(); code != 0 {
+			return ExitCode{errors.New("the test was aborted"), code}
+		}
 		if engine.IsTainted() {
 			return ExitCode{errors.New("some thresholds have failed"), thresholdHaveFailedErroCode}
 		}
+		if summaryData.Breakpoint != nil && !summaryData.Breakpoint.Highest.Valid {
+			return ExitCode{errors.New("no breakpoint level passed the thresholds"), thresholdHaveFailedErroCode}
+		}
 		return nil
 	},
 }
@@ -467,6 +587,59 @@ func init() {
 	runCmd.Flags().StringVarP(&runType, "type", "t", runType, "override file `type`, \"js\" or \"archive\"")
 	runCmd.Flags().BoolVar(&runNoSetup, "no-setup", runNoSetup, "don't run setup()")
 	runCmd.Flags().BoolVar(&runNoTeardown, "no-teardown", runNoTeardown, "don't run teardown()")
+	runCmd.Flags().StringSliceVar(&runDistributed, "distributed", nil, "run the test on the agents at these `addresses`, rather than locally")
+}
+
+// Writes the end-of-test summary to a file, in a format given by an export function.
+func exportSummary(
+	fs afero.Fs, filename string, data ui.SummaryData, export func(io.Writer, ui.SummaryData) error,
+) error {
+	f, err := fs.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := export(f, data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Runs the script's handleSummary() callback, if the runner supports it and the script exports
+// one, and writes the reports it returns. Returns whether the summary was handled.
+func handleSummary(fs afero.Fs, runner lib.Runner, data ui.SummaryData) (bool, error) {
+	handler, ok := runner.(lib.SummaryHandler)
+	if !ok {
+		return false, nil
+	}
+	summary, err := json.Marshal(ui.NewScriptSummary(data))
+	if err != nil {
+		return false, err
+	}
+	reports, err := handler.HandleSummary(context.Background(), summary)
+	if err != nil || reports == nil {
+		return false, err
+	}
+
+	dests := make([]string, 0, len(reports))
+	for dest := range reports {
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+	for _, dest := range dests {
+		switch dest {
+		case "stdout":
+			_, err = stdout.Write(reports[dest])
+		case "stderr":
+			_, err = stderr.Write(reports[dest])
+		default:
+			err = afero.WriteFile(fs, dest, reports[dest], 0644)
+		}
+		if err != nil {
+			return true, errors.Wrapf(err, "couldn't write the summary to '%s'", dest)
+		}
+	}
+	return true, nil
 }
 
 // Reads a source file from any supported destination.
@@ -497,17 +670,22 @@ func newRunner(src *lib.SourceData, typ string, fs afero.Fs, rtOpts lib.RuntimeO
 		if err != nil {
 			return nil, err
 		}
-		switch arc.Type {
-		case typeJS:
-			return js.NewFromArchive(arc, rtOpts)
-		default:
-			return nil, errors.Errorf("archive requests unsupported runner: %s", arc.Type)
-		}
+		return newRunnerFromArchive(arc, rtOpts)
 	default:
 		return nil, errors.Errorf("unknown -t/--type: %s", typ)
 	}
 }
 
+// Creates a new runner for an archive.
+func newRunnerFromArchive(arc *lib.Archive, rtOpts lib.RuntimeOptions) (lib.Runner, error) {
+	switch arc.Type {
+	case typeJS:
+		return js.NewFromArchive(arc, rtOpts)
+	default:
+		return nil, errors.Errorf("archive requests unsupported runner: %s", arc.Type)
+	}
+}
+
 func detectType(data []byte) string {
 	if _, err := tar.NewReader(bytes.NewReader(data)).Next(); err == nil {
 		return typeArchive
@@ -0,0 +1,430 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/loadimpact/k6/core/generator"
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// FlushRate is how often agents send collected samples to the controller.
+const FlushRate = 50 * time.Millisecond
+
+// GeneratorRate is how often agents measure their own resource usage, same as the Engine does.
+const GeneratorRate = 1 * time.Second
+
+// A RunnerFactory creates a Runner for an archived test.
+type RunnerFactory func(arc *lib.Archive) (lib.Runner, error)
+
+// An Agent runs segments of distributed tests on behalf of a controller, one at a time.
+type Agent struct {
+	NewRunner RunnerFactory
+	Logger    *log.Logger
+
+	// Lock for: executor, cancel
+	lock sync.Mutex
+
+	// Executor for the prepared or running test, nil if there's none.
+	executor lib.Executor
+
+	// The prepared test's segment.
+	segment lib.ExecutionSegment
+
+	// Stops the running test, nil if there's none.
+	cancel context.CancelFunc
+}
+
+// NewAgent creates an agent that creates runners for received tests with the given factory.
+func NewAgent(newRunner RunnerFactory) *Agent {
+	return &Agent{NewRunner: newRunner, Logger: log.StandardLogger()}
+}
+
+// Handler returns an http.Handler for the agent's API.
+func (a *Agent) Handler() http.Handler {
+	router := httprouter.New()
+	router.POST("/v1/agent/prepare", a.handlePrepare)
+	router.POST("/v1/agent/start", a.handleStart)
+	router.POST("/v1/agent/stop", a.handleStop)
+	router.GET("/v1/agent/status", a.handleGetStatus)
+	router.PATCH("/v1/agent/status", a.handlePatchStatus)
+	return router
+}
+
+// Prepare loads a test and initializes its VUs, so it's ready to start.
+func (a *Agent) Prepare(req PrepareRequest) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.cancel != nil {
+		return errors.New("a test is already running")
+	}
+
+	arc, err := lib.ReadArchive(bytes.NewReader(req.Archive))
+	if err != nil {
+		return err
+	}
+	r, err := a.NewRunner(arc)
+	if err != nil {
+		return err
+	}
+	if len(req.SetupData) > 0 {
+		r.SetSetupData(req.SetupData)
+	}
+
+	ex, err := newExecutor(r, arc.Options)
+	if err != nil {
+		return err
+	}
+	ex.SetLogger(a.Logger)
+
+	a.Logger.WithFields(log.Fields{
+		"vus":    ex.GetVUs(),
+		"vusMax": ex.GetVUsMax(),
+	}).Info("Agent: Test prepared")
+	a.executor = ex
+	a.segment = lib.ExecutionSegment{Index: req.Segment, Count: req.Segments}
+	if req.Segments == 0 {
+		a.segment = lib.ExecutionSegment{Index: 0, Count: 1}
+	}
+	return nil
+}
+
+// Creates and configures an executor for a segment of a test, the same way `k6 run` would, except
+// setup and teardown are left to the controller.
+func newExecutor(r lib.Runner, o lib.Options) (lib.Executor, error) {
+	var ex lib.Executor
+	switch {
+	case len(o.Scenarios) > 0:
+		sex, err := local.NewScenarios(r, o.Scenarios)
+		if err != nil {
+			return nil, err
+		}
+		ex = sex
+	case o.ArrivalRate.Valid:
+		ex = local.NewArrivalRate(r)
+	default:
+		ex = local.New(r)
+	}
+	ex.SetRunSetup(false)
+	ex.SetRunTeardown(false)
+
+	if len(o.Scenarios) == 0 {
+		if err := ex.SetVUsMax(o.VUsMax.Int64); err != nil {
+			return nil, err
+		}
+		if err := ex.SetVUs(o.VUs.Int64); err != nil {
+			return nil, err
+		}
+		ex.SetStages(o.Stages)
+		ex.SetEndIterations(o.Iterations)
+	}
+	ex.SetPaused(o.Paused.Bool)
+	ex.SetEndTime(o.Duration)
+	return ex, nil
+}
+
+// Run runs the prepared test, calling flush with collected samples every FlushRate, and once more
+// with done set when the test has finished. It returns the error the test ended with.
+func (a *Agent) Run(ctx context.Context, flush func(msg StreamMessage) error) error {
+	ex, ctx, cancel, err := a.claim(ctx)
+	if err != nil {
+		return err
+	}
+	return a.run(ctx, cancel, ex, flush)
+}
+
+// Marks the prepared test as running, so it can't be started twice, and returns its executor
+// along with the context to run it in.
+func (a *Agent) claim(ctx context.Context) (lib.Executor, context.Context, context.CancelFunc, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	ex := a.executor
+	if ex == nil || a.cancel != nil {
+		return nil, nil, nil, errors.New("no test is prepared")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	ctx = lib.WithExecutionSegment(ctx, a.segment)
+	a.cancel = cancel
+	return ex, ctx, cancel, nil
+}
+
+func (a *Agent) run(
+	ctx context.Context, cancel context.CancelFunc, ex lib.Executor, flush func(msg StreamMessage) error,
+) error {
+	defer func() {
+		cancel()
+		a.lock.Lock()
+		a.executor = nil
+		a.cancel = nil
+		a.lock.Unlock()
+	}()
+
+	// The executor stops the test itself when it's aborted, this only passes it on.
+	aborts := &abortTracker{logger: a.Logger}
+	ctx = lib.WithTestAbort(ctx, aborts.abort)
+
+	opts := ex.GetRunner().GetOptions()
+	samples := make(chan stats.SampleContainer, opts.MetricSamplesBufferSize.Int64)
+	errC := make(chan error, 1)
+	go func() { errC <- ex.Run(ctx, samples) }()
+
+	a.Logger.Info("Agent: Test started")
+	ticker := time.NewTicker(FlushRate)
+	defer ticker.Stop()
+	generatorTicker := time.NewTicker(GeneratorRate)
+	defer generatorTicker.Stop()
+
+	group := ex.GetRunner().GetDefaultGroup()
+	checks := checkTracker{}
+	var monitor generator.Monitor
+	var containers [][]Sample
+	var generatorStats *GeneratorStats
+	for {
+		select {
+		case sc := <-samples:
+			containers = append(containers, encodeContainer(sc))
+		case t := <-generatorTicker.C:
+			if generatorStats == nil {
+				generatorStats = &GeneratorStats{}
+			}
+			s := monitor.Samples(t, opts.RunTags, len(samples), cap(samples))
+			generatorStats.Samples = append(generatorStats.Samples, encodeContainer(stats.Samples(s))...)
+			generatorStats.Maxima = monitor.Maxima()
+		case <-ticker.C:
+			status := a.status(ex)
+			msg := StreamMessage{
+				Containers: containers,
+				Checks:     checks.deltas(group),
+				Status:     &status,
+				Abort:      aborts.take(),
+				Generator:  generatorStats,
+			}
+			if err := flush(msg); err != nil {
+				cancel()
+				<-errC
+				return err
+			}
+			containers = nil
+			generatorStats = nil
+		case err := <-errC:
+			// The executor has returned, so nothing will be added to the channel anymore.
+			for len(samples) > 0 {
+				containers = append(containers, encodeContainer(<-samples))
+			}
+			status := a.status(ex)
+			status.Running = false
+			msg := StreamMessage{
+				Containers: containers,
+				Checks:     checks.deltas(group),
+				Status:     &status,
+				Abort:      aborts.take(),
+				Generator:  generatorStats,
+				Done:       true,
+			}
+			if err != nil {
+				msg.Error = err.Error()
+			}
+			a.Logger.WithError(err).Info("Agent: Test finished")
+			if ferr := flush(msg); ferr != nil && err == nil {
+				err = ferr
+			}
+			return err
+		}
+	}
+}
+
+// Keeps track of the first time a test was aborted on the agent, until it's sent to the controller.
+type abortTracker struct {
+	logger *log.Logger
+
+	lock    sync.Mutex
+	pending *TestAbort
+	aborted bool
+}
+
+func (t *abortTracker) abort(reason string, exitCode int) {
+	t.logger.WithFields(log.Fields{"reason": reason, "exit_code": exitCode}).Info("Agent: Test aborted")
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.aborted {
+		t.aborted = true
+		t.pending = &TestAbort{Reason: reason, ExitCode: exitCode}
+	}
+}
+
+// Returns the abort that hasn't been sent yet, if any.
+func (t *abortTracker) take() *TestAbort {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	pending := t.pending
+	t.pending = nil
+	return pending
+}
+
+// Stop stops the running test, if any.
+func (a *Agent) Stop() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+}
+
+// Status returns the status of the prepared or running test; it's empty if there's none.
+func (a *Agent) Status() AgentStatus {
+	a.lock.Lock()
+	ex := a.executor
+	a.lock.Unlock()
+	if ex == nil {
+		return AgentStatus{}
+	}
+	return a.status(ex)
+}
+
+func (a *Agent) status(ex lib.Executor) AgentStatus {
+	return AgentStatus{
+		Paused:     null.BoolFrom(ex.IsPaused()),
+		VUs:        null.IntFrom(ex.GetVUs()),
+		VUsMax:     null.IntFrom(ex.GetVUsMax()),
+		Running:    ex.IsRunning(),
+		Iterations: ex.GetIterations(),
+		Time:       types.NullDurationFrom(ex.GetTime()),
+	}
+}
+
+// SetStatus changes the VUs of the prepared or running test, or pauses it.
+func (a *Agent) SetStatus(status AgentStatus) error {
+	a.lock.Lock()
+	ex := a.executor
+	a.lock.Unlock()
+	if ex == nil {
+		return errors.New("no test is prepared")
+	}
+
+	if status.VUsMax.Valid {
+		if err := ex.SetVUsMax(status.VUsMax.Int64); err != nil {
+			return err
+		}
+	}
+	if status.VUs.Valid {
+		if err := ex.SetVUs(status.VUs.Int64); err != nil {
+			return err
+		}
+	}
+	if status.Paused.Valid {
+		ex.SetPaused(status.Paused.Bool)
+	}
+	return nil
+}
+
+func (a *Agent) handlePrepare(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var req PrepareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		agentError(rw, err, http.StatusBadRequest)
+		return
+	}
+	if err := a.Prepare(req); err != nil {
+		agentError(rw, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(rw, a.Status())
+}
+
+func (a *Agent) handleStart(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		agentError(rw, errors.New("streaming isn't supported"), http.StatusInternalServerError)
+		return
+	}
+
+	ex, ctx, cancel, err := a.claim(r.Context())
+	if err != nil {
+		agentError(rw, err, http.StatusBadRequest)
+		return
+	}
+
+	// The controller starts all agents at once, and waits for the response headers to know
+	// this one has started, so they're sent right away rather than with the first samples.
+	rw.Header().Set("Content-Type", "application/x-ndjson")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(rw)
+	_ = a.run(ctx, cancel, ex, func(msg StreamMessage) error {
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
+
+func (a *Agent) handleStop(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	a.Stop()
+	writeJSON(rw, a.Status())
+}
+
+func (a *Agent) handleGetStatus(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writeJSON(rw, a.Status())
+}
+
+func (a *Agent) handlePatchStatus(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var status AgentStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		agentError(rw, err, http.StatusBadRequest)
+		return
+	}
+	if err := a.SetStatus(status); err != nil {
+		agentError(rw, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(rw, a.Status())
+}
+
+// An agentErrorResponse is returned by the agent's API when a request fails.
+type agentErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func agentError(rw http.ResponseWriter, err error, status int) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(agentErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(v)
+}
@@ -0,0 +1,287 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package distributed runs a test across several machines. Each of them runs an Agent, which
+// accepts a test over HTTP, runs it with a local executor and streams the samples back; the
+// controller is an Executor that splits the test between the agents, and feeds their samples to
+// an Engine, which aggregates them and evaluates thresholds as if the test was running locally.
+//
+// The protocol between the two is:
+//
+//   POST  /v1/agent/prepare  Load an archive with this agent's segment of the test, and
+//                            initialize its VUs. The body is a PrepareRequest.
+//   POST  /v1/agent/start    Start the test; the response is a stream of newline-delimited
+//                            StreamMessages, the last one having Done set.
+//   POST  /v1/agent/stop     Stop the test; the stream will end shortly after.
+//   GET   /v1/agent/status   Get an AgentStatus.
+//   PATCH /v1/agent/status   Change the VUs or pause the test; the body is an AgentStatus,
+//                            with only the fields to change set.
+package distributed
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/loadimpact/k6/core/generator"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// A PrepareRequest asks an agent to get ready to run a test.
+type PrepareRequest struct {
+	// The archived test, with options for the agent's segment of it.
+	Archive []byte `json:"archive"`
+
+	// Setup data, from running setup() on the controller.
+	SetupData json.RawMessage `json:"setupData"`
+
+	// Which segment of the test this is, out of how many, so that eg. unique test data can be
+	// partitioned between agents.
+	Segment  int `json:"segment"`
+	Segments int `json:"segments"`
+}
+
+// An AgentStatus describes the state of the test running on an agent.
+type AgentStatus struct {
+	Paused null.Bool `json:"paused"`
+	VUs    null.Int  `json:"vus"`
+	VUsMax null.Int  `json:"vusMax"`
+
+	// Readonly.
+	Running    bool               `json:"running"`
+	Iterations int64              `json:"iterations"`
+	Time       types.NullDuration `json:"time"`
+}
+
+// A StreamMessage is sent by an agent while a test is running, with the samples collected and the
+// changes to check counters since the last one, and its current status.
+type StreamMessage struct {
+	Containers [][]Sample   `json:"containers,omitempty"`
+	Checks     []CheckDelta `json:"checks,omitempty"`
+	Status     *AgentStatus `json:"status,omitempty"`
+
+	// Set once, on the first message after the test was aborted on the agent, eg. by a script
+	// calling execution.abort(); the controller then aborts the whole test.
+	Abort *TestAbort `json:"abort,omitempty"`
+
+	// The agent's own resource usage, if it was measured since the last message.
+	Generator *GeneratorStats `json:"generator,omitempty"`
+
+	// Set on the last message, with the error the test ended with, if any.
+	Done  bool   `json:"done,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// A TestAbort is why a test was aborted, and the exit code k6 should end with.
+type TestAbort struct {
+	Reason   string `json:"reason"`
+	ExitCode int    `json:"exitCode,omitempty"`
+}
+
+// GeneratorStats are samples of an agent's resource usage, like the Engine takes of its own, and
+// the highest CPU usage and sample backlog it's seen so far. The controller tags the samples with
+// the agent's address, and warns about overloaded agents at the end of the test.
+type GeneratorStats struct {
+	Samples []Sample         `json:"samples"`
+	Maxima  generator.Maxima `json:"maxima"`
+}
+
+// A CheckDelta is how many more times a check has passed and failed on an agent since the last
+// StreamMessage. Check counters are kept in the group tree rather than in samples, so they're
+// merged into the controller's one, where checks are looked up by their group's path and name.
+type CheckDelta struct {
+	Group  string `json:"group"`
+	Name   string `json:"name"`
+	Passes int64  `json:"passes,omitempty"`
+	Fails  int64  `json:"fails,omitempty"`
+}
+
+// Tracks the check counters an agent has sent so far, to send only what changed since.
+type checkTracker map[*lib.Check]CheckDelta
+
+// Returns the changes to the counters of all checks in root since the last call.
+func (t checkTracker) deltas(root *lib.Group) []CheckDelta {
+	var res []CheckDelta
+	root.VisitChecks(func(check *lib.Check) {
+		passes, fails := atomic.LoadInt64(&check.Passes), atomic.LoadInt64(&check.Fails)
+		last := t[check]
+		if passes == last.Passes && fails == last.Fails {
+			return
+		}
+		res = append(res, CheckDelta{
+			Group:  check.Group.Path,
+			Name:   check.Name,
+			Passes: passes - last.Passes,
+			Fails:  fails - last.Fails,
+		})
+		t[check] = CheckDelta{Passes: passes, Fails: fails}
+	})
+	return res
+}
+
+// Adds check counter changes to the checks in root, creating any missing groups and checks.
+func mergeChecks(root *lib.Group, deltas []CheckDelta) error {
+	for _, d := range deltas {
+		group := root
+		if d.Group != root.Path {
+			path := strings.TrimPrefix(d.Group, root.Path+lib.GroupSeparator)
+			for _, name := range strings.Split(path, lib.GroupSeparator) {
+				var err error
+				if group, err = group.Group(name); err != nil {
+					return err
+				}
+			}
+		}
+		check, err := group.Check(d.Name)
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&check.Passes, d.Passes)
+		atomic.AddInt64(&check.Fails, d.Fails)
+	}
+	return nil
+}
+
+// A Sample is a stats.Sample, with its metric referred to by name. Metrics are recreated from
+// these on the controller, which only looks at their names anyway.
+type Sample struct {
+	Metric   string            `json:"metric"`
+	Type     stats.MetricType  `json:"type"`
+	Contains stats.ValueType   `json:"contains"`
+	Time     time.Time         `json:"time"`
+	Value    float64           `json:"value"`
+	Tags     *stats.SampleTags `json:"tags"`
+}
+
+// Converts a sample container into its wire format. Samples aren't sent as their original
+// containers (eg. HTTP trails), but samples that go together are kept together.
+func encodeContainer(sc stats.SampleContainer) []Sample {
+	samples := sc.GetSamples()
+	res := make([]Sample, len(samples))
+	for i, s := range samples {
+		res[i] = Sample{
+			Metric:   s.Metric.Name,
+			Type:     s.Metric.Type,
+			Contains: s.Metric.Contains,
+			Time:     s.Time,
+			Value:    s.Value,
+			Tags:     s.Tags,
+		}
+	}
+	return res
+}
+
+// Splits an integer into n parts, as evenly as possible, and returns the ith. The parts are
+// monotonic, so eg. a VU count will never be split into more than the VU cap is.
+func splitInt(v int64, i, n int) int64 {
+	return (v + int64(n-i-1)) / int64(n)
+}
+
+func splitNullInt(v null.Int, i, n int) null.Int {
+	if !v.Valid {
+		return v
+	}
+	return null.IntFrom(splitInt(v.Int64, i, n))
+}
+
+func splitStages(stages []lib.Stage, i, n int) []lib.Stage {
+	if stages == nil {
+		return nil
+	}
+	res := make([]lib.Stage, len(stages))
+	for j, stage := range stages {
+		stage.Target = splitNullInt(stage.Target, i, n)
+		if stage.Points != nil {
+			points := make([]lib.StagePoint, len(stage.Points))
+			for k, p := range stage.Points {
+				points[k] = lib.StagePoint{At: p.At, Target: splitInt(p.Target, i, n)}
+			}
+			stage.Points = points
+		}
+		res[j] = stage
+	}
+	return res
+}
+
+// SegmentOptions returns the options for the ith of n agents running a test: VUs, iterations,
+// stage targets and arrival rates are split between them, as evenly as possible, and everything
+// else is the same for all of them. Scenarios are split individually, with their defaults taken
+// into account first; scenarios that this agent has no share of are left out.
+func SegmentOptions(opts lib.Options, i, n int) lib.Options {
+	opts.VUs = splitNullInt(opts.VUs, i, n)
+	opts.VUsMax = splitNullInt(opts.VUsMax, i, n)
+	opts.Iterations = splitNullInt(opts.Iterations, i, n)
+	opts.Stages = splitStages(opts.Stages, i, n)
+	opts.ArrivalRate = splitNullInt(opts.ArrivalRate, i, n)
+
+	if opts.Scenarios != nil {
+		scenarios := make(map[string]lib.Scenario, len(opts.Scenarios))
+		for name, sc := range opts.Scenarios {
+			sc = sc.WithDefaults()
+			sc.VUs = splitNullInt(sc.VUs, i, n)
+			sc.VUsMax = splitNullInt(sc.VUsMax, i, n)
+			sc.Iterations = splitNullInt(sc.Iterations, i, n)
+			sc.Stages = splitStages(sc.Stages, i, n)
+			sc.ArrivalRate = splitNullInt(sc.ArrivalRate, i, n)
+			if !isEmptySegment(sc.GetExecutor() == lib.ScenarioExecutorArrivalRate,
+				sc.VUsMax, sc.Iterations, sc.Stages, sc.ArrivalRate) {
+				scenarios[name] = sc
+			}
+		}
+		opts.Scenarios = scenarios
+	}
+	return opts
+}
+
+// IsEmptySegment returns whether the given segment options wouldn't run any iterations at all,
+// in which case there's no point in sending them to an agent.
+func IsEmptySegment(opts lib.Options) bool {
+	if opts.Scenarios != nil {
+		return len(opts.Scenarios) == 0
+	}
+	return isEmptySegment(opts.ArrivalRate.Valid, opts.VUsMax, opts.Iterations, opts.Stages, opts.ArrivalRate)
+}
+
+func isEmptySegment(arrivalRate bool, vusMax, iterations null.Int, stages []lib.Stage, rate null.Int) bool {
+	if vusMax.Int64 == 0 || (iterations.Valid && iterations.Int64 == 0) {
+		return true
+	}
+	if !arrivalRate {
+		return false
+	}
+	if rate.Int64 > 0 {
+		return false
+	}
+	for _, stage := range stages {
+		if stage.Target.Int64 > 0 {
+			return false
+		}
+		for _, p := range stage.Points {
+			if p.Target > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
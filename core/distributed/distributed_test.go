@@ -0,0 +1,172 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package distributed
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/stretchr/testify/assert"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestSplitInt(t *testing.T) {
+	testdata := map[int64][]int64{
+		0:  {0, 0, 0},
+		1:  {1, 0, 0},
+		2:  {1, 1, 0},
+		3:  {1, 1, 1},
+		10: {4, 3, 3},
+		11: {4, 4, 3},
+	}
+	for v, parts := range testdata {
+		t.Run(fmt.Sprint(v), func(t *testing.T) {
+			var sum int64
+			for i, part := range parts {
+				assert.Equal(t, part, splitInt(v, i, len(parts)), "part %d", i)
+				sum += part
+			}
+			assert.Equal(t, v, sum)
+		})
+	}
+}
+
+func TestSegmentOptions(t *testing.T) {
+	t.Run("VUs", func(t *testing.T) {
+		opts := lib.Options{
+			VUs:        null.IntFrom(5),
+			VUsMax:     null.IntFrom(10),
+			Iterations: null.IntFrom(100),
+			Duration:   types.NullDurationFrom(10 * time.Second),
+			Stages: []lib.Stage{
+				{Duration: types.NullDurationFrom(1 * time.Second), Target: null.IntFrom(10)},
+				{Duration: types.NullDurationFrom(1 * time.Second)},
+			},
+		}
+		seg0, seg1 := SegmentOptions(opts, 0, 2), SegmentOptions(opts, 1, 2)
+		assert.Equal(t, null.IntFrom(3), seg0.VUs)
+		assert.Equal(t, null.IntFrom(2), seg1.VUs)
+		assert.Equal(t, null.IntFrom(5), seg0.VUsMax)
+		assert.Equal(t, null.IntFrom(5), seg1.VUsMax)
+		assert.Equal(t, null.IntFrom(50), seg0.Iterations)
+		assert.Equal(t, null.IntFrom(50), seg1.Iterations)
+		assert.Equal(t, opts.Duration, seg0.Duration)
+		assert.Equal(t, []lib.Stage{
+			{Duration: types.NullDurationFrom(1 * time.Second), Target: null.IntFrom(5)},
+			{Duration: types.NullDurationFrom(1 * time.Second)},
+		}, seg1.Stages)
+		assert.False(t, seg0.ArrivalRate.Valid)
+
+		// The original options are left alone.
+		assert.Equal(t, null.IntFrom(10), opts.Stages[0].Target)
+	})
+	t.Run("Curves", func(t *testing.T) {
+		opts := lib.Options{
+			VUsMax: null.IntFrom(20),
+			Stages: []lib.Stage{
+				{Duration: types.NullDurationFrom(10 * time.Second), Target: null.IntFrom(10), Curve: lib.StageCurveStep},
+				{Duration: types.NullDurationFrom(10 * time.Second), Target: null.IntFrom(20), Curve: lib.StageCurveExponential},
+				{
+					Duration: types.NullDurationFrom(1 * time.Minute), Target: null.IntFrom(5),
+					Curve: lib.StageCurveSine, Period: types.Duration(20 * time.Second),
+				},
+				{
+					Duration: types.NullDurationFrom(10 * time.Second), Curve: lib.StageCurvePoints,
+					Points: []lib.StagePoint{
+						{At: types.Duration(2 * time.Second), Target: 15},
+						{At: types.Duration(6 * time.Second), Target: 3},
+					},
+				},
+			},
+		}
+		seg0, seg1 := SegmentOptions(opts, 0, 2), SegmentOptions(opts, 1, 2)
+		assert.Equal(t, []lib.Stage{
+			{Duration: types.NullDurationFrom(10 * time.Second), Target: null.IntFrom(5), Curve: lib.StageCurveStep},
+			{Duration: types.NullDurationFrom(10 * time.Second), Target: null.IntFrom(10), Curve: lib.StageCurveExponential},
+			{
+				Duration: types.NullDurationFrom(1 * time.Minute), Target: null.IntFrom(3),
+				Curve: lib.StageCurveSine, Period: types.Duration(20 * time.Second),
+			},
+			{
+				Duration: types.NullDurationFrom(10 * time.Second), Curve: lib.StageCurvePoints,
+				Points: []lib.StagePoint{
+					{At: types.Duration(2 * time.Second), Target: 8},
+					{At: types.Duration(6 * time.Second), Target: 2},
+				},
+			},
+		}, seg0.Stages)
+		assert.Equal(t, null.IntFrom(2), seg1.Stages[2].Target)
+		assert.Equal(t, []lib.StagePoint{
+			{At: types.Duration(2 * time.Second), Target: 7},
+			{At: types.Duration(6 * time.Second), Target: 1},
+		}, seg1.Stages[3].Points)
+
+		// The original options are left alone.
+		assert.Equal(t, int64(15), opts.Stages[3].Points[0].Target)
+	})
+	t.Run("Empty", func(t *testing.T) {
+		opts := lib.Options{VUs: null.IntFrom(1), VUsMax: null.IntFrom(1), Iterations: null.IntFrom(1)}
+		assert.False(t, IsEmptySegment(SegmentOptions(opts, 0, 2)))
+		assert.True(t, IsEmptySegment(SegmentOptions(opts, 1, 2)))
+
+		opts = lib.Options{VUsMax: null.IntFrom(4), ArrivalRate: null.IntFrom(1)}
+		assert.False(t, IsEmptySegment(SegmentOptions(opts, 0, 2)))
+		assert.True(t, IsEmptySegment(SegmentOptions(opts, 1, 2)))
+
+		opts.Stages = []lib.Stage{{Duration: types.NullDurationFrom(1 * time.Second), Target: null.IntFrom(2)}}
+		assert.False(t, IsEmptySegment(SegmentOptions(opts, 1, 2)))
+
+		opts.Stages = []lib.Stage{{
+			Duration: types.NullDurationFrom(1 * time.Second), Curve: lib.StageCurvePoints,
+			Points: []lib.StagePoint{{At: types.Duration(500 * time.Millisecond), Target: 2}},
+		}}
+		assert.False(t, IsEmptySegment(SegmentOptions(opts, 1, 2)))
+	})
+	t.Run("Scenarios", func(t *testing.T) {
+		opts := lib.Options{Scenarios: map[string]lib.Scenario{
+			"once": {},
+			"many": {VUs: null.IntFrom(4), Duration: types.NullDurationFrom(1 * time.Second)},
+			"rate": {
+				Executor:    null.StringFrom(lib.ScenarioExecutorArrivalRate),
+				ArrivalRate: null.IntFrom(10),
+				VUsMax:      null.IntFrom(6),
+				Duration:    types.NullDurationFrom(1 * time.Second),
+			},
+		}}
+		seg0, seg1 := SegmentOptions(opts, 0, 2), SegmentOptions(opts, 1, 2)
+		assert.Equal(t, lib.Scenario{
+			VUs: null.IntFrom(1), VUsMax: null.IntFrom(1), Iterations: null.IntFrom(1),
+		}, seg0.Scenarios["once"])
+		assert.NotContains(t, seg1.Scenarios, "once")
+		assert.Equal(t, null.IntFrom(2), seg1.Scenarios["many"].VUs)
+		assert.Equal(t, null.IntFrom(2), seg1.Scenarios["many"].VUsMax)
+		assert.Equal(t, null.IntFrom(5), seg1.Scenarios["rate"].ArrivalRate)
+		assert.Equal(t, null.IntFrom(3), seg1.Scenarios["rate"].VUsMax)
+		assert.False(t, IsEmptySegment(seg1))
+
+		assert.True(t, IsEmptySegment(SegmentOptions(lib.Options{
+			Scenarios: map[string]lib.Scenario{"once": {}},
+		}, 1, 2)))
+	})
+}
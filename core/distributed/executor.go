@@ -0,0 +1,752 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package distributed
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/loadimpact/k6/core/generator"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	null "gopkg.in/guregu/null.v3"
+)
+
+var _ lib.Executor = &Executor{}
+var _ lib.GeneratorWarner = &Executor{}
+
+// StopTimeout is how long to wait for agents to send their last samples after a test is stopped.
+const StopTimeout = 10 * time.Second
+
+// An agentClient talks to a single agent.
+type agentClient struct {
+	Addr   string
+	Client *http.Client
+
+	// Last status and generator maxima received from the agent.
+	statusLock sync.RWMutex
+	status     AgentStatus
+	generator  generator.Maxima
+}
+
+func (c *agentClient) url(path string) string {
+	if strings.Contains(c.Addr, "://") {
+		return c.Addr + path
+	}
+	return "http://" + c.Addr + path
+}
+
+// Makes a request with a JSON body, and returns the response if it was successful.
+func (c *agentClient) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.url(path), bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 {
+		defer func() { _ = res.Body.Close() }()
+		var errRes agentErrorResponse
+		if err := json.NewDecoder(res.Body).Decode(&errRes); err != nil {
+			return nil, errors.Errorf("agent returned status %d", res.StatusCode)
+		}
+		return nil, errors.New(errRes.Error)
+	}
+	return res, nil
+}
+
+// Makes a request, and decodes the returned status.
+func (c *agentClient) call(ctx context.Context, method, path string, body interface{}) error {
+	res, err := c.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	var status AgentStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return err
+	}
+	c.setStatus(status)
+	return nil
+}
+
+func (c *agentClient) getStatus() AgentStatus {
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+	return c.status
+}
+
+func (c *agentClient) setStatus(status AgentStatus) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	c.status = status
+}
+
+func (c *agentClient) getGeneratorMaxima() generator.Maxima {
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+	return c.generator
+}
+
+func (c *agentClient) setGeneratorMaxima(max generator.Maxima) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	c.generator = max
+}
+
+// An Executor controls a test running on a set of agents. It splits the test between them with
+// SegmentOptions(), starts them all at the same time once they're all ready, and funnels their
+// samples to the Engine. Setup and teardown are run locally, by the Executor itself.
+type Executor struct {
+	Runner lib.Runner
+	Logger *log.Logger
+
+	runLock sync.Mutex
+	agents  []*agentClient
+
+	runSetup    bool
+	runTeardown bool
+
+	// Lock for: stages, vus, vusMax, active
+	lock   sync.RWMutex
+	stages []lib.Stage
+	vus    int64
+	vusMax int64
+
+	// Agents taking part in the current test.
+	active []*agentClient
+
+	iters    int64 // Completed iterations, reported by agents.
+	endIters int64 // End test at this many iterations.
+
+	time    int64 // Current time.
+	endTime int64 // End test at this timestamp.
+
+	pauseLock sync.RWMutex
+	pause     chan interface{}
+
+	// Metrics recreated from received samples, by name.
+	metricsLock sync.Mutex
+	metrics     map[string]*stats.Metric
+
+	// Lock for: ctx
+	ctxLock sync.RWMutex
+
+	// Current context, nil if a test isn't running right now.
+	ctx context.Context
+}
+
+// NewExecutor creates an Executor that runs the given runner's test on agents at the given
+// addresses ("host:port" or URLs).
+func NewExecutor(r lib.Runner, addrs []string) *Executor {
+	agents := make([]*agentClient, len(addrs))
+	for i, addr := range addrs {
+		agents[i] = &agentClient{Addr: strings.TrimSuffix(addr, "/"), Client: &http.Client{}}
+	}
+	return &Executor{
+		Runner:      r,
+		Logger:      log.StandardLogger(),
+		agents:      agents,
+		runSetup:    true,
+		runTeardown: true,
+		endIters:    -1,
+		endTime:     -1,
+		metrics:     make(map[string]*stats.Metric),
+	}
+}
+
+// Returns the options for the whole test, as configured on the Executor.
+func (e *Executor) options() lib.Options {
+	opts := e.Runner.GetOptions()
+
+	e.lock.RLock()
+	opts.VUs = null.IntFrom(e.vus)
+	opts.VUsMax = null.IntFrom(e.vusMax)
+	opts.Stages = e.stages
+	e.lock.RUnlock()
+
+	opts.Iterations = e.GetEndIterations()
+	opts.Duration = e.GetEndTime()
+	opts.Paused = null.BoolFrom(e.IsPaused())
+	return opts
+}
+
+func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleContainer) (reterr error) {
+	e.runLock.Lock()
+	defer e.runLock.Unlock()
+
+	if e.runSetup {
+		if err := e.Runner.Setup(parent, engineOut); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+
+	// A test aborted on one agent is aborted everywhere: stopping the test stops all agents.
+	outerAbort := lib.GetTestAbort(parent)
+	abort := func(reason string, exitCode int) {
+		if outerAbort != nil {
+			outerAbort(reason, exitCode)
+		} else {
+			e.Logger.WithField("reason", reason).Info("Test aborted")
+		}
+		cancel()
+	}
+
+	e.ctxLock.Lock()
+	e.ctx = ctx
+	e.ctxLock.Unlock()
+
+	// Streams outlive the test's context a little, so agents can send their last samples.
+	streamCtx, streamCancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		e.stopAgents()
+
+		streamsDone := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(streamsDone)
+		}()
+		select {
+		case <-streamsDone:
+		case <-time.After(StopTimeout):
+			e.Logger.Warn("Distributed: Timed out waiting for agents to stop")
+		}
+		streamCancel()
+		wg.Wait()
+
+		if e.runTeardown {
+			err := e.Runner.Teardown(parent, engineOut)
+			if reterr == nil {
+				reterr = err
+			} else if err != nil {
+				reterr = fmt.Errorf("Teardown error %#v\nPrevious error: %#v", err, reterr)
+			}
+		}
+
+		e.ctxLock.Lock()
+		e.ctx = nil
+		e.ctxLock.Unlock()
+	}()
+
+	active, err := e.prepareAgents(ctx)
+	if err != nil {
+		return err
+	}
+	e.lock.Lock()
+	e.active = active
+	e.lock.Unlock()
+
+	// Start everything at once, now that all agents are ready. Agents start running as soon as
+	// they get the request, so they're all sent in parallel.
+	errC := make(chan error, len(active))
+	startErrs := make([]error, len(active))
+	var started sync.WaitGroup
+	for i, agent := range active {
+		started.Add(1)
+		wg.Add(1)
+		go func(i int, agent *agentClient) {
+			defer wg.Done()
+			res, err := agent.do(streamCtx, "POST", "/v1/agent/start", nil)
+			if err != nil {
+				startErrs[i] = errors.Wrapf(err, "agent %s", agent.Addr)
+				started.Done()
+				return
+			}
+			started.Done()
+			errC <- errors.Wrapf(e.readStream(res.Body, agent, engineOut, abort), "agent %s", agent.Addr)
+		}(i, agent)
+	}
+	started.Wait()
+	for _, err := range startErrs {
+		if err != nil {
+			return err
+		}
+	}
+	e.Logger.WithField("agents", len(active)).Debug("Distributed: Started")
+
+	running := len(active)
+	ticker := time.NewTicker(1 * time.Millisecond)
+	defer ticker.Stop()
+
+	lastTick := time.Now()
+	for running > 0 {
+		// Keep the time the same way agents do, so it lines up with theirs while paused.
+		e.pauseLock.RLock()
+		pause := e.pause
+		e.pauseLock.RUnlock()
+		if pause != nil {
+			leftovers := time.Since(lastTick)
+			select {
+			case <-pause:
+				lastTick = time.Now().Add(-leftovers)
+			case <-ctx.Done():
+				e.Logger.Debug("Distributed: Terminated while in paused state")
+				return nil
+			}
+		}
+
+		select {
+		case t := <-ticker.C:
+			d := t.Sub(lastTick)
+			lastTick = t
+			atomic.AddInt64(&e.time, int64(d))
+		case err := <-errC:
+			running--
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			e.Logger.Debug("Distributed: Exiting with context")
+			return nil
+		}
+	}
+	e.Logger.Debug("Distributed: All agents finished")
+	return nil
+}
+
+// Sends every agent its segment of the test, and waits for them to be ready. If some agents would
+// have nothing to do, the test is split between fewer of them instead, so that changes made while
+// it's running, like SetVUs(), can be split between the same agents in the same way.
+func (e *Executor) prepareAgents(ctx context.Context) ([]*agentClient, error) {
+	if len(e.agents) == 0 {
+		return nil, errors.New("no agents to run the test on")
+	}
+
+	var setupData json.RawMessage
+	if data := e.Runner.GetSetupData(); len(data) > 0 {
+		setupData = data
+	}
+
+	// Later segments are never bigger than earlier ones, so the empty ones are always at the end.
+	opts := e.options()
+	n := len(e.agents)
+	var segments []lib.Options
+	for {
+		segments = segments[:0]
+		for i := 0; i < n; i++ {
+			segment := SegmentOptions(opts, i, n)
+			if IsEmptySegment(segment) {
+				break
+			}
+			segments = append(segments, segment)
+		}
+		if len(segments) == n {
+			break
+		}
+		n = len(segments)
+	}
+	for _, agent := range e.agents[n:] {
+		e.Logger.WithField("agent", agent.Addr).Debug("Distributed: Nothing for agent to do")
+	}
+
+	active := e.agents[:n]
+	reqs := make([]PrepareRequest, n)
+	for i, segment := range segments {
+		arc := e.Runner.MakeArchive()
+		if arc == nil {
+			return nil, errors.New("the test can't be archived")
+		}
+		arc.Options = segment
+		var buf bytes.Buffer
+		if err := arc.Write(&buf); err != nil {
+			return nil, err
+		}
+
+		reqs[i] = PrepareRequest{
+			Archive:   buf.Bytes(),
+			SetupData: setupData,
+			Segment:   i,
+			Segments:  n,
+		}
+	}
+
+	errs := make([]error, len(active))
+	var wg sync.WaitGroup
+	for i, agent := range active {
+		wg.Add(1)
+		go func(i int, agent *agentClient) {
+			defer wg.Done()
+			e.Logger.WithField("agent", agent.Addr).Debug("Distributed: Preparing agent")
+			errs[i] = agent.call(ctx, "POST", "/v1/agent/prepare", reqs[i])
+		}(i, agent)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, errors.Wrapf(err, "agent %s", active[i].Addr)
+		}
+	}
+	return active, nil
+}
+
+// Reads samples, check counters and statuses streamed by an agent, until the end of its test.
+// If the test was aborted on the agent, abort is called with its reason and exit code.
+func (e *Executor) readStream(
+	body io.ReadCloser, agent *agentClient, engineOut chan<- stats.SampleContainer, abort lib.TestAbortFunc,
+) error {
+	defer func() { _ = body.Close() }()
+
+	dec := json.NewDecoder(bufio.NewReader(body))
+	for {
+		var msg StreamMessage
+		if err := dec.Decode(&msg); err != nil {
+			return errors.Wrap(err, "stream interrupted")
+		}
+		for _, samples := range msg.Containers {
+			if sc := e.decodeContainer(samples); sc != nil {
+				engineOut <- sc
+			}
+		}
+		if msg.Generator != nil {
+			if sc := e.decodeContainer(tagAgent(msg.Generator.Samples, agent)); sc != nil {
+				engineOut <- sc
+			}
+			agent.setGeneratorMaxima(msg.Generator.Maxima)
+		}
+		if err := mergeChecks(e.Runner.GetDefaultGroup(), msg.Checks); err != nil {
+			e.Logger.WithError(err).WithField("agent", agent.Addr).Warn("Couldn't merge checks")
+		}
+		if msg.Status != nil {
+			agent.setStatus(*msg.Status)
+			e.updateIterations()
+		}
+		if msg.Abort != nil {
+			e.Logger.WithField("agent", agent.Addr).Debug("Distributed: Test aborted on agent")
+			abort(msg.Abort.Reason, msg.Abort.ExitCode)
+		}
+		if msg.Done {
+			if msg.Error != "" {
+				return errors.New(msg.Error)
+			}
+			return nil
+		}
+	}
+}
+
+// Tags samples received from an agent with its address, so that eg. each agent's resource usage
+// can be told apart from the others'.
+func tagAgent(samples []Sample, agent *agentClient) []Sample {
+	for i, s := range samples {
+		tags := s.Tags.CloneTags()
+		tags["agent"] = agent.Addr
+		samples[i].Tags = stats.IntoSampleTags(&tags)
+	}
+	return samples
+}
+
+// Converts samples received from an agent back into a container, with metrics looked up by name.
+func (e *Executor) decodeContainer(samples []Sample) stats.SampleContainer {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	e.metricsLock.Lock()
+	res := make([]stats.Sample, len(samples))
+	for i, s := range samples {
+		m, ok := e.metrics[s.Metric]
+		if !ok {
+			m = stats.New(s.Metric, s.Type, s.Contains)
+			e.metrics[s.Metric] = m
+		}
+		res[i] = stats.Sample{Metric: m, Time: s.Time, Value: s.Value, Tags: s.Tags}
+	}
+	e.metricsLock.Unlock()
+
+	if len(res) == 1 {
+		return res[0]
+	}
+	return stats.ConnectedSamples{Samples: res, Tags: res[0].Tags, Time: res[0].Time}
+}
+
+func (e *Executor) updateIterations() {
+	var iters int64
+	for _, agent := range e.getActive() {
+		iters += agent.getStatus().Iterations
+	}
+	atomic.StoreInt64(&e.iters, iters)
+}
+
+// Tells all active agents to stop.
+func (e *Executor) stopAgents() {
+	var wg sync.WaitGroup
+	for _, agent := range e.getActive() {
+		wg.Add(1)
+		go func(agent *agentClient) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), StopTimeout)
+			defer cancel()
+			// The response isn't kept as the agent's status: the test may already be gone, and the
+			// last status it streamed is more useful than an empty one.
+			res, err := agent.do(ctx, "POST", "/v1/agent/stop", nil)
+			if err != nil {
+				e.Logger.WithError(err).WithField("agent", agent.Addr).Warn("Couldn't stop agent")
+				return
+			}
+			_ = res.Body.Close()
+		}(agent)
+	}
+	wg.Wait()
+}
+
+// Sends a status change to all active agents.
+func (e *Executor) patchAgents(f func(i, n int) AgentStatus) error {
+	active := e.getActive()
+	errs := make([]error, len(active))
+	var wg sync.WaitGroup
+	for i, agent := range active {
+		wg.Add(1)
+		go func(i int, agent *agentClient) {
+			defer wg.Done()
+			errs[i] = agent.call(context.Background(), "PATCH", "/v1/agent/status", f(i, len(active)))
+		}(i, agent)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return errors.Wrapf(err, "agent %s", active[i].Addr)
+		}
+	}
+	return nil
+}
+
+// GetGeneratorWarnings returns warnings about agents having been overloaded during the test, eg.
+// CPU-bound, each prefixed with the agent's address.
+func (e *Executor) GetGeneratorWarnings() []string {
+	var warnings []string
+	for _, agent := range e.getActive() {
+		for _, w := range agent.getGeneratorMaxima().Warnings() {
+			warnings = append(warnings, "agent "+agent.Addr+": "+w)
+		}
+	}
+	return warnings
+}
+
+func (e *Executor) getActive() []*agentClient {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.active
+}
+
+func (e *Executor) IsRunning() bool {
+	e.ctxLock.RLock()
+	defer e.ctxLock.RUnlock()
+	return e.ctx != nil
+}
+
+func (e *Executor) GetRunner() lib.Runner {
+	return e.Runner
+}
+
+func (e *Executor) SetLogger(l *log.Logger) {
+	e.Logger = l
+}
+
+func (e *Executor) GetLogger() *log.Logger {
+	return e.Logger
+}
+
+func (e *Executor) GetStages() []lib.Stage {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.stages
+}
+
+// SetStages sets the stages to split between agents; it has no effect on a running test.
+func (e *Executor) SetStages(s []lib.Stage) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.stages = s
+}
+
+// GetIterations returns the number of iterations completed by all agents, as of the last
+// status they sent.
+func (e *Executor) GetIterations() int64 {
+	return atomic.LoadInt64(&e.iters)
+}
+
+func (e *Executor) GetEndIterations() null.Int {
+	v := atomic.LoadInt64(&e.endIters)
+	if v < 0 {
+		return null.Int{}
+	}
+	return null.IntFrom(v)
+}
+
+// SetEndIterations sets the iterations to split between agents; it has no effect on a running
+// test.
+func (e *Executor) SetEndIterations(i null.Int) {
+	if !i.Valid {
+		i.Int64 = -1
+	}
+	atomic.StoreInt64(&e.endIters, i.Int64)
+}
+
+func (e *Executor) GetTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&e.time))
+}
+
+func (e *Executor) GetEndTime() types.NullDuration {
+	v := atomic.LoadInt64(&e.endTime)
+	if v < 0 {
+		return types.NullDuration{}
+	}
+	return types.NullDurationFrom(time.Duration(v))
+}
+
+// SetEndTime sets the duration of the test on every agent; it has no effect on a running test.
+func (e *Executor) SetEndTime(t types.NullDuration) {
+	if !t.Valid {
+		t.Duration = -1
+	}
+	atomic.StoreInt64(&e.endTime, int64(t.Duration))
+}
+
+func (e *Executor) IsPaused() bool {
+	e.pauseLock.RLock()
+	defer e.pauseLock.RUnlock()
+	return e.pause != nil
+}
+
+// SetPaused pauses or resumes the test on all agents.
+func (e *Executor) SetPaused(paused bool) {
+	e.pauseLock.Lock()
+	if paused && e.pause == nil {
+		e.pause = make(chan interface{})
+	} else if !paused && e.pause != nil {
+		close(e.pause)
+		e.pause = nil
+	}
+	e.pauseLock.Unlock()
+
+	err := e.patchAgents(func(i, n int) AgentStatus {
+		return AgentStatus{Paused: null.BoolFrom(paused)}
+	})
+	if err != nil {
+		e.Logger.WithError(err).Warn("Couldn't pause or resume agents")
+	}
+}
+
+// GetVUs returns the number of active VUs on all agents, or the number that will be, if the test
+// isn't running.
+func (e *Executor) GetVUs() int64 {
+	active := e.getActive()
+	if len(active) == 0 {
+		e.lock.RLock()
+		defer e.lock.RUnlock()
+		return e.vus
+	}
+	var vus int64
+	for _, agent := range active {
+		vus += agent.getStatus().VUs.Int64
+	}
+	return vus
+}
+
+// SetVUs sets the number of VUs, split between the agents running the test.
+func (e *Executor) SetVUs(vus int64) error {
+	if vus < 0 {
+		return errors.New("vu count can't be negative")
+	}
+	e.lock.Lock()
+	if vus > e.vusMax {
+		e.lock.Unlock()
+		return errors.Errorf("can't raise vu count (to %d) above vu cap (%d)", vus, e.vusMax)
+	}
+	e.vus = vus
+	e.lock.Unlock()
+
+	return e.patchAgents(func(i, n int) AgentStatus {
+		return AgentStatus{VUs: null.IntFrom(splitInt(vus, i, n))}
+	})
+}
+
+// GetVUsMax returns the number of allocated VUs on all agents, or the number that will be, if the
+// test isn't running.
+func (e *Executor) GetVUsMax() int64 {
+	active := e.getActive()
+	if len(active) == 0 {
+		e.lock.RLock()
+		defer e.lock.RUnlock()
+		return e.vusMax
+	}
+	var vusMax int64
+	for _, agent := range active {
+		vusMax += agent.getStatus().VUsMax.Int64
+	}
+	return vusMax
+}
+
+// SetVUsMax sets the number of allocated VUs, split between the agents running the test.
+func (e *Executor) SetVUsMax(max int64) error {
+	if max < 0 {
+		return errors.New("vu cap can't be negative")
+	}
+	e.lock.Lock()
+	if max < e.vus {
+		e.lock.Unlock()
+		return errors.Errorf("can't lower vu cap (to %d) below vu count (%d)", max, e.vus)
+	}
+	e.vusMax = max
+	e.lock.Unlock()
+
+	return e.patchAgents(func(i, n int) AgentStatus {
+		return AgentStatus{VUsMax: null.IntFrom(splitInt(max, i, n))}
+	})
+}
+
+func (e *Executor) SetRunSetup(r bool) {
+	e.runSetup = r
+}
+
+func (e *Executor) SetRunTeardown(r bool) {
+	e.runTeardown = r
+}
@@ -0,0 +1,491 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package distributed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/core/generator"
+	"github.com/loadimpact/k6/js"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// A MiniRunner that can be archived, so it can be sent to agents.
+type archivableRunner struct {
+	*lib.MiniRunner
+}
+
+func (r archivableRunner) MakeArchive() *lib.Archive {
+	return &lib.Archive{Type: "mini", Filename: "/script.js", Pwd: "/", Options: r.Options}
+}
+
+// Starts n agents on localhost, which create runners with fn; returns their addresses. The
+// servers are left running, as closing them would block on streams of failed tests.
+func startAgents(t *testing.T, n int, fn RunnerFactory) []string {
+	addrs := make([]string, n)
+	for i := range addrs {
+		addrs[i] = httptest.NewServer(NewAgent(fn).Handler()).URL
+	}
+	return addrs
+}
+
+func TestExecutorRun(t *testing.T) {
+	var iterations, agentsUsed int64
+	addrs := startAgents(t, 3, func(arc *lib.Archive) (lib.Runner, error) {
+		atomic.AddInt64(&agentsUsed, 1)
+		return &lib.MiniRunner{
+			Options: arc.Options,
+			Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				atomic.AddInt64(&iterations, 1)
+				return nil
+			},
+		}, nil
+	})
+
+	var setups, teardowns int64
+	r := archivableRunner{&lib.MiniRunner{
+		SetupFn: func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error) {
+			atomic.AddInt64(&setups, 1)
+			return []byte(`{"a":1}`), nil
+		},
+		TeardownFn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			atomic.AddInt64(&teardowns, 1)
+			return nil
+		},
+	}}
+
+	e := NewExecutor(r, addrs)
+	require.NoError(t, e.SetVUsMax(4))
+	require.NoError(t, e.SetVUs(4))
+	e.SetEndIterations(null.IntFrom(20))
+
+	samples := make(chan stats.SampleContainer, 1000)
+	require.NoError(t, e.Run(context.Background(), samples))
+	assert.False(t, e.IsRunning())
+
+	assert.Equal(t, int64(3), atomic.LoadInt64(&agentsUsed))
+	assert.Equal(t, int64(20), atomic.LoadInt64(&iterations))
+	assert.Equal(t, int64(20), e.GetIterations())
+	assert.Equal(t, int64(1), atomic.LoadInt64(&setups))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&teardowns))
+	assert.Equal(t, int64(4), e.GetVUsMax())
+
+	n := 0
+	for _, sc := range stats.GetBufferedSamples(samples) {
+		for _, s := range sc.GetSamples() {
+			if s.Metric.Name == metrics.Iterations.Name {
+				n++
+			}
+		}
+	}
+	assert.Equal(t, 20, n)
+}
+
+func TestExecutorSynchronizedStart(t *testing.T) {
+	var lock sync.Mutex
+	var first, last time.Time
+	addrs := startAgents(t, 5, func(arc *lib.Archive) (lib.Runner, error) {
+		return &lib.MiniRunner{
+			Options: arc.Options,
+			Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				now := time.Now()
+				lock.Lock()
+				if first.IsZero() || now.Before(first) {
+					first = now
+				}
+				if now.After(last) {
+					last = now
+				}
+				lock.Unlock()
+				// Long enough for agents to flush samples while they're running.
+				time.Sleep(3 * FlushRate)
+				return nil
+			},
+		}, nil
+	})
+
+	e := NewExecutor(archivableRunner{&lib.MiniRunner{}}, addrs)
+	require.NoError(t, e.SetVUsMax(5))
+	require.NoError(t, e.SetVUs(5))
+	e.SetEndIterations(null.IntFrom(5))
+	require.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)))
+	assert.Equal(t, int64(5), e.GetIterations())
+
+	// Agents used to be started one after the other, each one only once the previous one had
+	// flushed its first samples, so the last one started at least 4*FlushRate after the first.
+	assert.True(t, last.Sub(first) < 2*FlushRate, "agents started %s apart", last.Sub(first))
+}
+
+func TestExecutorEmptySegments(t *testing.T) {
+	var agentsUsed int64
+	addrs := startAgents(t, 3, func(arc *lib.Archive) (lib.Runner, error) {
+		atomic.AddInt64(&agentsUsed, 1)
+		return &lib.MiniRunner{Options: arc.Options}, nil
+	})
+
+	e := NewExecutor(archivableRunner{&lib.MiniRunner{}}, addrs)
+	require.NoError(t, e.SetVUsMax(1))
+	require.NoError(t, e.SetVUs(1))
+	e.SetEndIterations(null.IntFrom(1))
+	require.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)))
+
+	// Only one agent has anything to do.
+	assert.Equal(t, int64(1), atomic.LoadInt64(&agentsUsed))
+	assert.Equal(t, int64(1), e.GetIterations())
+
+	t.Run("Resplit", func(t *testing.T) {
+		var lock sync.Mutex
+		var segments []lib.Options
+		addrs := startAgents(t, 3, func(arc *lib.Archive) (lib.Runner, error) {
+			lock.Lock()
+			segments = append(segments, arc.Options)
+			lock.Unlock()
+			return &lib.MiniRunner{Options: arc.Options}, nil
+		})
+
+		// Split between 3 agents, the third would get 1 VU but no iterations; the test is split
+		// between the other two instead, like changes to the VUs made while it's running are.
+		e := NewExecutor(archivableRunner{&lib.MiniRunner{}}, addrs)
+		require.NoError(t, e.SetVUsMax(4))
+		require.NoError(t, e.SetVUs(4))
+		e.SetEndIterations(null.IntFrom(2))
+		require.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)))
+		assert.Len(t, e.getActive(), 2)
+		require.Len(t, segments, 2)
+		for _, segment := range segments {
+			assert.Equal(t, null.IntFrom(2), segment.VUs)
+			assert.Equal(t, null.IntFrom(1), segment.Iterations)
+		}
+	})
+}
+
+func TestExecutorSegmentContext(t *testing.T) {
+	var segments sync.Map
+	addrs := startAgents(t, 2, func(arc *lib.Archive) (lib.Runner, error) {
+		return &lib.MiniRunner{
+			Options: arc.Options,
+			Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				segments.Store(lib.GetExecutionSegment(ctx), true)
+				return nil
+			},
+		}, nil
+	})
+
+	e := NewExecutor(archivableRunner{&lib.MiniRunner{}}, addrs)
+	require.NoError(t, e.SetVUsMax(2))
+	require.NoError(t, e.SetVUs(2))
+	e.SetEndIterations(null.IntFrom(10))
+	require.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 1000)))
+
+	var seen []lib.ExecutionSegment
+	segments.Range(func(k, v interface{}) bool {
+		seen = append(seen, k.(lib.ExecutionSegment))
+		return true
+	})
+	assert.ElementsMatch(t, []lib.ExecutionSegment{{Index: 0, Count: 2}, {Index: 1, Count: 2}}, seen)
+}
+
+func TestExecutorStopAndScale(t *testing.T) {
+	addrs := startAgents(t, 2, func(arc *lib.Archive) (lib.Runner, error) {
+		return &lib.MiniRunner{
+			Options: arc.Options,
+			Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				select {
+				case <-time.After(10 * time.Millisecond):
+				case <-ctx.Done():
+				}
+				return nil
+			},
+		}, nil
+	})
+
+	e := NewExecutor(archivableRunner{&lib.MiniRunner{}}, addrs)
+	require.NoError(t, e.SetVUsMax(10))
+	require.NoError(t, e.SetVUs(2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	samples := make(chan stats.SampleContainer, 10000)
+	go func() { errC <- e.Run(ctx, samples) }()
+
+	// Wait for the agents to report in.
+	for e.GetIterations() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, e.IsRunning())
+	assert.Equal(t, int64(2), e.GetVUs())
+	assert.Equal(t, int64(10), e.GetVUsMax())
+
+	require.NoError(t, e.SetVUs(7))
+	assert.Equal(t, int64(7), e.GetVUs())
+	assert.EqualError(t, e.SetVUs(11), "can't raise vu count (to 11) above vu cap (10)")
+
+	e.SetPaused(true)
+	assert.True(t, e.IsPaused())
+	for _, agent := range e.getActive() {
+		assert.True(t, agent.getStatus().Paused.Bool)
+	}
+	e.SetPaused(false)
+
+	cancel()
+	select {
+	case err := <-errC:
+		assert.NoError(t, err)
+	case <-time.After(StopTimeout):
+		t.Fatal("test didn't stop")
+	}
+	assert.False(t, e.IsRunning())
+}
+
+func TestExecutorErrors(t *testing.T) {
+	t.Run("NoAgents", func(t *testing.T) {
+		e := NewExecutor(archivableRunner{&lib.MiniRunner{}}, nil)
+		assert.EqualError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)),
+			"no agents to run the test on")
+	})
+	t.Run("Prepare", func(t *testing.T) {
+		addrs := startAgents(t, 1, func(arc *lib.Archive) (lib.Runner, error) {
+			return nil, assert.AnError
+		})
+		e := NewExecutor(archivableRunner{&lib.MiniRunner{}}, addrs)
+		require.NoError(t, e.SetVUsMax(1))
+		err := e.Run(context.Background(), make(chan stats.SampleContainer, 100))
+		assert.EqualError(t, err, "agent "+addrs[0]+": "+assert.AnError.Error())
+	})
+	t.Run("StreamInterrupted", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/agent/start" {
+				_, _ = rw.Write([]byte(`{"status":{"running":true}}` + "\n"))
+				return
+			}
+			_, _ = rw.Write([]byte(`{}`))
+		}))
+		defer srv.Close()
+
+		e := NewExecutor(archivableRunner{&lib.MiniRunner{}}, []string{srv.URL})
+		require.NoError(t, e.SetVUsMax(1))
+		require.NoError(t, e.SetVUs(1))
+		err := e.Run(context.Background(), make(chan stats.SampleContainer, 100))
+		assert.EqualError(t, err, "agent "+srv.URL+": stream interrupted: EOF")
+	})
+}
+
+func TestExecutorEngineIntegration(t *testing.T) {
+	r, err := js.New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			import { Counter } from "k6/metrics";
+			let calls = new Counter("calls");
+			export let options = {
+				thresholds: { calls: ["count == 30"], iterations: ["count < 15"] },
+			};
+			export function setup() { return { value: 2 }; }
+			export default function(data) { calls.add(data.value); }
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	addrs := startAgents(t, 2, func(arc *lib.Archive) (lib.Runner, error) {
+		return js.NewFromArchive(arc, lib.RuntimeOptions{})
+	})
+
+	opts := r.GetOptions().Apply(lib.Options{
+		VUs:                     null.IntFrom(3),
+		VUsMax:                  null.IntFrom(3),
+		Iterations:              null.IntFrom(15),
+		MetricSamplesBufferSize: null.IntFrom(100),
+		SetupTimeout:            types.NullDurationFrom(10 * time.Second),
+		TeardownTimeout:         types.NullDurationFrom(10 * time.Second),
+	})
+	r.SetOptions(opts)
+
+	engine, err := core.NewEngine(NewExecutor(r, addrs), opts)
+	require.NoError(t, err)
+	require.NoError(t, engine.Run(context.Background()))
+
+	// Samples from all agents end up in the same metrics, and thresholds are evaluated on them.
+	calls := engine.Metrics["calls"]
+	require.NotNil(t, calls)
+	assert.Equal(t, 30.0, calls.Sink.(*stats.CounterSink).Value)
+	assert.False(t, calls.Tainted.Bool)
+	assert.Equal(t, 15.0, engine.Metrics["iterations"].Sink.(*stats.CounterSink).Value)
+	assert.True(t, engine.Metrics["iterations"].Tainted.Bool)
+	assert.True(t, engine.IsTainted())
+	assert.Equal(t, int64(15), engine.Executor.GetIterations())
+	assert.Equal(t, types.NullDuration{}, engine.Executor.GetEndTime())
+}
+
+func TestExecutorChecks(t *testing.T) {
+	r, err := js.New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			import { check, group } from "k6";
+			export default function() {
+				check(null, { "root": () => true });
+				group("outer", function() {
+					group("inner", function() {
+						check(__ITER, { "even": (i) => i % 2 == 0 });
+					});
+				});
+			}
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	addrs := startAgents(t, 2, func(arc *lib.Archive) (lib.Runner, error) {
+		return js.NewFromArchive(arc, lib.RuntimeOptions{})
+	})
+
+	opts := r.GetOptions().Apply(lib.Options{
+		VUs:        null.IntFrom(2),
+		VUsMax:     null.IntFrom(2),
+		Iterations: null.IntFrom(8),
+	})
+	r.SetOptions(opts)
+
+	e := NewExecutor(r, addrs)
+	require.NoError(t, e.SetVUsMax(2))
+	require.NoError(t, e.SetVUs(2))
+	e.SetEndIterations(null.IntFrom(8))
+	require.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 1000)))
+
+	// Checks that ran on the agents end up in the controller's group tree, with their groups.
+	root := r.GetDefaultGroup()
+	require.Contains(t, root.Checks, "root")
+	assert.Equal(t, int64(8), root.Checks["root"].Passes)
+	assert.Equal(t, int64(0), root.Checks["root"].Fails)
+
+	require.Contains(t, root.Groups, "outer")
+	require.Contains(t, root.Groups["outer"].Groups, "inner")
+	inner := root.Groups["outer"].Groups["inner"]
+	assert.Equal(t, "::outer::inner", inner.Path)
+	require.Contains(t, inner.Checks, "even")
+	assert.Equal(t, int64(4), inner.Checks["even"].Passes)
+	assert.Equal(t, int64(4), inner.Checks["even"].Fails)
+}
+
+func TestExecutorAbort(t *testing.T) {
+	// The first agent aborts the test, which should stop the other one too, and end the whole
+	// test with the agent's reason and exit code.
+	addrs := startAgents(t, 2, func(arc *lib.Archive) (lib.Runner, error) {
+		return &lib.MiniRunner{
+			Options: arc.Options,
+			Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				if lib.GetExecutionSegment(ctx).Index == 0 {
+					lib.GetTestAbort(ctx)("enough", 42)
+					return nil
+				}
+				select {
+				case <-time.After(10 * time.Millisecond):
+				case <-ctx.Done():
+				}
+				return nil
+			},
+		}, nil
+	})
+
+	e := NewExecutor(archivableRunner{&lib.MiniRunner{}}, addrs)
+	require.NoError(t, e.SetVUsMax(2))
+	require.NoError(t, e.SetVUs(2))
+
+	var reason string
+	var exitCode int
+	ctx := lib.WithTestAbort(context.Background(), func(r string, code int) { reason, exitCode = r, code })
+	errC := make(chan error, 1)
+	go func() { errC <- e.Run(ctx, make(chan stats.SampleContainer, 10000)) }()
+	select {
+	case err := <-errC:
+		assert.NoError(t, err)
+	case <-time.After(StopTimeout):
+		t.Fatal("test didn't stop")
+	}
+	assert.Equal(t, "enough", reason)
+	assert.Equal(t, 42, exitCode)
+	for _, agent := range e.getActive() {
+		assert.False(t, agent.getStatus().Running, agent.Addr)
+	}
+}
+
+func TestExecutorGeneratorStats(t *testing.T) {
+	// Agents measure their own resource usage, which is tagged with their address.
+	addrs := startAgents(t, 2, func(arc *lib.Archive) (lib.Runner, error) {
+		return &lib.MiniRunner{
+			Options: arc.Options,
+			Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				select {
+				case <-time.After(10 * time.Millisecond):
+				case <-ctx.Done():
+				}
+				return nil
+			},
+		}, nil
+	})
+
+	r := archivableRunner{&lib.MiniRunner{Options: lib.Options{
+		RunTags: stats.IntoSampleTags(&map[string]string{"foo": "bar"}),
+	}}}
+	e := NewExecutor(r, addrs)
+	require.NoError(t, e.SetVUsMax(2))
+	require.NoError(t, e.SetVUs(2))
+	e.SetEndTime(types.NullDurationFrom(GeneratorRate + 300*time.Millisecond))
+
+	samples := make(chan stats.SampleContainer, 10000)
+	require.NoError(t, e.Run(context.Background(), samples))
+
+	heap := map[string]int{}
+	for _, sc := range stats.GetBufferedSamples(samples) {
+		for _, s := range sc.GetSamples() {
+			if s.Metric.Name != metrics.GeneratorHeap.Name {
+				continue
+			}
+			assert.True(t, s.Value > 0)
+			foo, _ := s.Tags.Get("foo")
+			assert.Equal(t, "bar", foo)
+			agent, _ := s.Tags.Get("agent")
+			heap[agent]++
+		}
+	}
+	assert.Equal(t, map[string]int{addrs[0]: 1, addrs[1]: 1}, heap)
+
+	// Warnings are about the agents that were overloaded, which can't be relied on here.
+	active := e.getActive()
+	require.Len(t, active, 2)
+	active[0].setGeneratorMaxima(generator.Maxima{CPU: 95.2})
+	active[1].setGeneratorMaxima(generator.Maxima{Backlog: 0.5})
+	assert.Equal(t, []string{
+		"agent " + active[0].Addr + ": the load generator was CPU-bound, using up to 95% of its CPU; " +
+			"results may reflect the limits of this machine rather than the system under test",
+	}, e.GetGeneratorWarnings())
+}
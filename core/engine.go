@@ -22,14 +22,17 @@ package core
 
 import (
 	"context"
-	"strings"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/loadimpact/k6/core/generator"
 	"github.com/loadimpact/k6/core/local"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/guregu/null.v3"
 )
@@ -62,12 +65,21 @@ type Engine struct {
 
 	Samples chan stats.SampleContainer
 
-	// Assigned to metrics upon first received sample.
-	thresholds map[string]stats.Thresholds
-	submetrics map[string][]*stats.Submetric
+	// Creates the metrics and submetrics samples are aggregated in, with their thresholds.
+	aggregator *lib.MetricAggregator
+
+	// Metric sinks are split into shards, which are updated in parallel.
+	shards  []*sampleShard
+	sharded map[string]shardedMetric
 
 	// Are thresholds tainted?
 	thresholdsTainted bool
+
+	// The exit code a script aborted the test with, if any.
+	abortExitCode int64
+
+	// Keeps an eye on the resources used by k6 itself.
+	generator generator.Monitor
 }
 
 func NewEngine(ex lib.Executor, o lib.Options) (*Engine, error) {
@@ -80,30 +92,39 @@ func NewEngine(ex lib.Executor, o lib.Options) (*Engine, error) {
 		Options:  o,
 		Metrics:  make(map[string]*stats.Metric),
 		Samples:  make(chan stats.SampleContainer, o.MetricSamplesBufferSize.Int64),
+		shards:   newSampleShards(runtime.GOMAXPROCS(0)),
+		sharded:  make(map[string]shardedMetric),
 	}
 	e.SetLogger(log.StandardLogger())
 
-	if err := ex.SetVUsMax(o.VUsMax.Int64); err != nil {
-		return nil, err
+	switch o.TrendSink.String {
+	case "", lib.TrendSinkExact, lib.TrendSinkSketch:
+	default:
+		return nil, errors.Errorf("invalid trend sink '%s', must be '%s' or '%s'",
+			o.TrendSink.String, lib.TrendSinkExact, lib.TrendSinkSketch)
 	}
-	if err := ex.SetVUs(o.VUs.Int64); err != nil {
-		return nil, err
+
+	// With scenarios, each one is configured by its own executor, and breakpoint tests set their
+	// own load levels; the global duration, if any, is still honored as a limit for the whole test.
+	if len(o.Scenarios) == 0 && o.Breakpoint == nil {
+		if err := ex.SetVUsMax(o.VUsMax.Int64); err != nil {
+			return nil, err
+		}
+		if err := ex.SetVUs(o.VUs.Int64); err != nil {
+			return nil, err
+		}
+		for i, stage := range o.Stages {
+			if err := stage.Validate(); err != nil {
+				return nil, errors.Wrapf(err, "stage #%d", i)
+			}
+		}
+		ex.SetStages(o.Stages)
+		ex.SetEndIterations(o.Iterations)
 	}
 	ex.SetPaused(o.Paused.Bool)
-	ex.SetStages(o.Stages)
 	ex.SetEndTime(o.Duration)
-	ex.SetEndIterations(o.Iterations)
-
-	e.thresholds = o.Thresholds
-	e.submetrics = make(map[string][]*stats.Submetric)
-	for name := range e.thresholds {
-		if !strings.Contains(name, "{") {
-			continue
-		}
 
-		parent, sm := stats.NewSubmetric(name)
-		e.submetrics[parent] = append(e.submetrics[parent], sm)
-	}
+	e.aggregator = lib.NewMetricAggregator(o.Thresholds, o.TrendSink.String)
 
 	return e, nil
 }
@@ -128,6 +149,9 @@ func (e *Engine) Run(ctx context.Context) error {
 		if st.Target.Valid {
 			fields["tgt"] = st.Target.Int64
 		}
+		if st.Curve != "" {
+			fields["curve"] = st.Curve
+		}
 		if st.Duration.Valid {
 			fields["d"] = st.Duration.Duration
 		}
@@ -180,7 +204,7 @@ func (e *Engine) Run(ctx context.Context) error {
 	errC := make(chan error)
 	subwg.Add(1)
 	go func() {
-		errC <- e.Executor.Run(subctx, e.Samples)
+		errC <- e.Executor.Run(lib.WithTestAbort(subctx, e.abortTest), e.Samples)
 		e.logger.Debug("Engine: Executor terminated")
 		subwg.Done()
 	}()
@@ -252,6 +276,20 @@ func (e *Engine) IsTainted() bool {
 	return e.thresholdsTainted
 }
 
+// GetAbortExitCode returns the exit code a script aborted the test with, or 0 if it didn't.
+func (e *Engine) GetAbortExitCode() int {
+	return int(atomic.LoadInt64(&e.abortExitCode))
+}
+
+// Logs that the test was aborted, and keeps track of the exit code; stopping it is up to the
+// executor, which calls this first.
+func (e *Engine) abortTest(reason string, exitCode int) {
+	e.logger.WithFields(log.Fields{"reason": reason, "exit_code": exitCode}).Info("Test aborted")
+	if exitCode != 0 {
+		atomic.StoreInt64(&e.abortExitCode, int64(exitCode))
+	}
+}
+
 func (e *Engine) SetLogger(l *log.Logger) {
 	e.logger = l
 	e.Executor.SetLogger(l)
@@ -293,6 +331,21 @@ func (e *Engine) emitMetrics() {
 		Tags: e.Options.RunTags,
 		Time: t,
 	}})
+
+	e.processSamples([]stats.SampleContainer{stats.Samples(
+		e.generator.Samples(t, e.Options.RunTags, len(e.Samples), cap(e.Samples)),
+	)})
+}
+
+// GetGeneratorWarnings returns warnings about the load generator having been overloaded during the
+// test, eg. CPU-bound, which may have skewed the results. If the executor runs the test on other
+// load generators, their warnings are included too.
+func (e *Engine) GetGeneratorWarnings() []string {
+	warnings := e.generator.Maxima().Warnings()
+	if gw, ok := e.Executor.(lib.GeneratorWarner); ok {
+		warnings = append(warnings, gw.GetGeneratorWarnings()...)
+	}
+	return warnings
 }
 
 func (e *Engine) runThresholds(ctx context.Context, abort func()) {
@@ -344,7 +397,11 @@ func (e *Engine) processThresholds(abort func()) {
 	}
 }
 
+// Sorts the samples into the shards of the metrics they belong to, then updates the sinks of all
+// shards in parallel. Metrics are spread over the shards in the order they're first seen, and a
+// metric's submetrics are always in the same shard as it is.
 func (e *Engine) processSamplesForMetrics(sampleCointainers []stats.SampleContainer) {
+	e.aggregator.NoThresholds = e.NoThresholds
 	for _, sampleCointainer := range sampleCointainers {
 		samples := sampleCointainer.GetSamples()
 
@@ -353,29 +410,27 @@ func (e *Engine) processSamplesForMetrics(sampleCointainers []stats.SampleContai
 		}
 
 		for _, sample := range samples {
-			m, ok := e.Metrics[sample.Metric.Name]
+			sh, ok := e.sharded[sample.Metric.Name]
 			if !ok {
-				m = stats.New(sample.Metric.Name, sample.Metric.Type, sample.Metric.Contains)
-				m.Thresholds = e.thresholds[m.Name]
-				m.Submetrics = e.submetrics[m.Name]
-				e.Metrics[m.Name] = m
+				m, exists := e.Metrics[sample.Metric.Name]
+				if !exists {
+					m = e.aggregator.NewMetric(sample.Metric)
+					e.Metrics[m.Name] = m
+				}
+				sh = shardedMetric{metric: m, shard: e.shards[len(e.sharded)%len(e.shards)]}
+				e.sharded[m.Name] = sh
 			}
-			m.Sink.Add(sample)
+			sh.shard.samples = append(sh.shard.samples, shardSample{metric: sh.metric, sample: sample})
+		}
+	}
 
-			for _, sm := range m.Submetrics {
-				if !sample.Tags.Contains(sm.Tags) {
-					continue
-				}
+	processSampleShards(e, e.shards)
 
-				if sm.Metric == nil {
-					sm.Metric = stats.New(sm.Name, sample.Metric.Type, sample.Metric.Contains)
-					sm.Metric.Sub = *sm
-					sm.Metric.Thresholds = e.thresholds[sm.Name]
-					e.Metrics[sm.Name] = sm.Metric
-				}
-				sm.Metric.Sink.Add(sample)
-			}
+	for _, shard := range e.shards {
+		for _, m := range shard.added {
+			e.Metrics[m.Name] = m
 		}
+		shard.added = shard.added[:0]
 	}
 }
 
@@ -384,18 +439,23 @@ func (e *Engine) processSamples(sampleCointainers []stats.SampleContainer) {
 		return
 	}
 
-	// TODO: optimize this...
 	e.MetricsLock.Lock()
 	defer e.MetricsLock.Unlock()
 
-	// TODO: run this and the below code in goroutines?
-	if !(e.NoSummary && e.NoThresholds) {
-		e.processSamplesForMetrics(sampleCointainers)
+	// Collectors only buffer the samples, so they can do that while the sinks are updated.
+	var wg sync.WaitGroup
+	if len(e.Collectors) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, collector := range e.Collectors {
+				collector.Collect(sampleCointainers)
+			}
+		}()
 	}
 
-	if len(e.Collectors) > 0 {
-		for _, collector := range e.Collectors {
-			collector.Collect(sampleCointainers)
-		}
+	if !(e.NoSummary && e.NoThresholds) {
+		e.processSamplesForMetrics(sampleCointainers)
 	}
+	wg.Wait()
 }
@@ -204,7 +204,7 @@ func TestNewEngineOptions(t *testing.T) {
 			},
 		})
 		assert.NoError(t, err)
-		assert.Contains(t, e.thresholds, "my_metric")
+		assert.Contains(t, e.aggregator.Thresholds, "my_metric")
 
 		t.Run("submetrics", func(t *testing.T) {
 			e, err, _ := newTestEngine(nil, lib.Options{
@@ -213,8 +213,8 @@ func TestNewEngineOptions(t *testing.T) {
 				},
 			})
 			assert.NoError(t, err)
-			assert.Contains(t, e.thresholds, "my_metric{tag:value}")
-			assert.Contains(t, e.submetrics, "my_metric")
+			assert.Contains(t, e.aggregator.Thresholds, "my_metric{tag:value}")
+			assert.Contains(t, e.aggregator.Submetrics, "my_metric")
 		})
 	})
 }
@@ -242,6 +242,22 @@ func TestEngineRun(t *testing.T) {
 		assert.NoError(t, e.Run(context.Background()))
 		assert.Equal(t, int64(100), e.Executor.GetIterations())
 	})
+	t.Run("aborted by a VU", func(t *testing.T) {
+		e, err, hook := newTestEngine(LF(func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			lib.GetTestAbort(ctx)("enough", 42)
+			return nil
+		}), lib.Options{
+			VUs:    null.IntFrom(1),
+			VUsMax: null.IntFrom(1),
+		})
+		require.NoError(t, err)
+		assert.NoError(t, e.Run(context.Background()))
+		assert.Equal(t, 42, e.GetAbortExitCode())
+		if assert.NotNil(t, hook.LastEntry()) {
+			assert.Equal(t, "Test aborted", hook.LastEntry().Message)
+			assert.Equal(t, "enough", hook.LastEntry().Data["reason"])
+		}
+	})
 
 	// Make sure samples are discarded after context close (using "cutoff" timestamp in local.go)
 	t.Run("collects samples", func(t *testing.T) {
@@ -359,7 +375,7 @@ func TestEngine_processSamples(t *testing.T) {
 		})
 		assert.NoError(t, err)
 
-		sms := e.submetrics["my_metric"]
+		sms := e.aggregator.Submetrics["my_metric"]
 		assert.Len(t, sms, 1)
 		assert.Equal(t, "my_metric{a:1}", sms[0].Name)
 		assert.EqualValues(t, map[string]string{"a": "1"}, sms[0].Tags.CloneTags())
@@ -371,6 +387,57 @@ func TestEngine_processSamples(t *testing.T) {
 		assert.IsType(t, &stats.GaugeSink{}, e.Metrics["my_metric"].Sink)
 		assert.IsType(t, &stats.GaugeSink{}, e.Metrics["my_metric{a:1}"].Sink)
 	})
+	t.Run("no thresholds", func(t *testing.T) {
+		ths, err := stats.NewThresholds([]string{`count over 1m < 1`})
+		assert.NoError(t, err)
+
+		e, err, _ := newTestEngine(nil, lib.Options{
+			Thresholds: map[string]stats.Thresholds{"my_metric": ths},
+		})
+		assert.NoError(t, err)
+		e.NoThresholds = true
+
+		e.processSamples(
+			[]stats.SampleContainer{stats.Sample{Metric: metric, Time: time.Now(), Value: 1.25}},
+		)
+
+		// Nothing was kept for the window, so it's skipped rather than failed.
+		m := e.Metrics["my_metric"]
+		succ, err := m.Thresholds.Run(m.Sink, time.Second)
+		assert.NoError(t, err)
+		assert.True(t, succ)
+	})
+	t.Run("trend sink", func(t *testing.T) {
+		trend := stats.New("my_trend", stats.Trend)
+		ths, err := stats.NewThresholds([]string{`1+1==2`})
+		assert.NoError(t, err)
+
+		for name, sketch := range map[string]bool{"": false, "exact": false, "sketch": true} {
+			t.Run(name, func(t *testing.T) {
+				e, err, _ := newTestEngine(nil, lib.Options{
+					TrendSink:  null.NewString(name, name != ""),
+					Thresholds: map[string]stats.Thresholds{"my_trend{a:1}": ths},
+				})
+				assert.NoError(t, err)
+
+				e.processSamples(
+					[]stats.SampleContainer{stats.Sample{Metric: trend, Value: 1.25, Tags: stats.IntoSampleTags(&map[string]string{"a": "1"})}},
+				)
+
+				for _, name := range []string{"my_trend", "my_trend{a:1}"} {
+					sink, ok := e.Metrics[name].Sink.(*stats.TrendSink)
+					if assert.True(t, ok, name) {
+						assert.Equal(t, sketch, sink.Sketch != nil, name)
+						assert.Equal(t, 1.25, sink.P(0.95), name)
+					}
+				}
+			})
+		}
+		t.Run("invalid", func(t *testing.T) {
+			_, err, _ := newTestEngine(nil, lib.Options{TrendSink: null.StringFrom("nope")})
+			assert.EqualError(t, err, "invalid trend sink 'nope', must be 'exact' or 'sketch'")
+		})
+	})
 }
 
 func TestEngine_runThresholds(t *testing.T) {
@@ -482,6 +549,29 @@ func TestEngine_processThresholds(t *testing.T) {
 	}
 }
 
+func TestEngine_processThresholdsWindowed(t *testing.T) {
+	metric := stats.New("my_metric", stats.Trend)
+	ths, err := stats.NewThresholds([]string{"max over 1m < 500", "max < 1000"})
+	require.NoError(t, err)
+	e, err, _ := newTestEngine(nil, lib.Options{Thresholds: map[string]stats.Thresholds{"my_metric": ths}})
+	require.NoError(t, err)
+
+	now := time.Now()
+	e.processSamples([]stats.SampleContainer{
+		stats.Sample{Metric: metric, Time: now.Add(-2 * time.Minute), Value: 700},
+		stats.Sample{Metric: metric, Time: now, Value: 100},
+	})
+	e.processThresholds(nil)
+	assert.False(t, e.IsTainted(), "the spike is outside of the window")
+
+	e.processSamples([]stats.SampleContainer{stats.Sample{Metric: metric, Time: now, Value: 600}})
+	e.processThresholds(nil)
+	assert.True(t, e.IsTainted())
+	worst := e.Metrics["my_metric"].Thresholds.Thresholds[0].Worst
+	require.NotNil(t, worst)
+	assert.Equal(t, []stats.ObservedValue{{Expr: "max", Value: 600}}, worst.Values)
+}
+
 func getMetricSum(collector *dummy.Collector, name string) (result float64) {
 	for _, sc := range collector.SampleContainers {
 		for _, s := range sc.GetSamples() {
@@ -736,6 +826,8 @@ func TestRunTags(t *testing.T) {
 	systemMetrics := []*stats.Metric{
 		metrics.VUs, metrics.VUsMax, metrics.Iterations, metrics.IterationDuration,
 		metrics.GroupDuration, metrics.DataSent, metrics.DataReceived,
+		metrics.GeneratorCPU, metrics.GeneratorRSS, metrics.GeneratorHeap, metrics.GeneratorGCPause,
+		metrics.GeneratorGoroutines, metrics.GeneratorOpenFDs, metrics.GeneratorSampleBacklog,
 	}
 
 	getExpectedOverVal := func(metricName string) string {
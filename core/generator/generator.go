@@ -0,0 +1,153 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package generator measures the resources used by the load generator, ie. the k6 process itself,
+// so that a saturated k6 machine can be told apart from a saturated system under test. It's used
+// by the Engine and, in distributed tests, by every agent for its own machine.
+package generator
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+const (
+	// CPUBound is the CPU usage, as a percentage of all cores, above which the load generator is
+	// considered to be CPU-bound.
+	CPUBound = 90.0
+
+	// BufferBound is the fraction of the sample buffer that has to be filled up for the load
+	// generator to be considered buffer-bound, ie. not processing samples fast enough.
+	BufferBound = 0.9
+)
+
+// Resource usage of the k6 process, as reported by the OS.
+type processStats struct {
+	CPUTime time.Duration
+	RSS     int64
+	OpenFDs int
+}
+
+// A Monitor measures the resources used by the load generator. It keeps track of the highest CPU
+// usage and sample backlog it's seen, to warn about them at the end of the test. The zero value
+// is ready to use.
+type Monitor struct {
+	lock sync.Mutex
+
+	// Values at the previous measurement, that the next one is relative to.
+	lastTime  time.Time
+	lastCPU   time.Duration
+	lastNumGC uint32
+
+	max Maxima
+}
+
+// Maxima are the highest CPU usage and sample backlog a Monitor has seen.
+type Maxima struct {
+	// Percentage of all CPU cores.
+	CPU float64 `json:"cpu"`
+	// Fraction of the sample buffer.
+	Backlog float64 `json:"backlog"`
+}
+
+// Samples returns samples of the load generator's current resource usage, given how many samples
+// are waiting to be processed, and how many can be buffered.
+func (m *Monitor) Samples(t time.Time, tags *stats.SampleTags, backlog, capacity int) []stats.Sample {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	samples := []stats.Sample{
+		{Time: t, Metric: metrics.GeneratorHeap, Value: float64(mem.HeapAlloc), Tags: tags},
+		{Time: t, Metric: metrics.GeneratorGoroutines, Value: float64(runtime.NumGoroutine()), Tags: tags},
+		{Time: t, Metric: metrics.GeneratorSampleBacklog, Value: float64(backlog), Tags: tags},
+	}
+
+	// Every GC pause since the last measurement; the runtime only remembers the last 256.
+	if !m.lastTime.IsZero() {
+		numGC := mem.NumGC - m.lastNumGC
+		if numGC > uint32(len(mem.PauseNs)) {
+			numGC = uint32(len(mem.PauseNs))
+		}
+		for i := uint32(0); i < numGC; i++ {
+			pause := mem.PauseNs[(mem.NumGC-i+uint32(len(mem.PauseNs))-1)%uint32(len(mem.PauseNs))]
+			samples = append(samples, stats.Sample{
+				Time: t, Metric: metrics.GeneratorGCPause, Value: stats.D(time.Duration(pause)), Tags: tags,
+			})
+		}
+	}
+	m.lastNumGC = mem.NumGC
+
+	if capacity > 0 {
+		if fill := float64(backlog) / float64(capacity); fill > m.max.Backlog {
+			m.max.Backlog = fill
+		}
+	}
+
+	// Not every platform can tell us about the process, in which case there's just less to go on.
+	if ps, err := readProcessStats(); err == nil {
+		samples = append(samples,
+			stats.Sample{Time: t, Metric: metrics.GeneratorRSS, Value: float64(ps.RSS), Tags: tags},
+			stats.Sample{Time: t, Metric: metrics.GeneratorOpenFDs, Value: float64(ps.OpenFDs), Tags: tags},
+		)
+		if !m.lastTime.IsZero() && t.After(m.lastTime) {
+			cpu := 100 * float64(ps.CPUTime-m.lastCPU) / float64(t.Sub(m.lastTime)) / float64(runtime.NumCPU())
+			samples = append(samples, stats.Sample{Time: t, Metric: metrics.GeneratorCPU, Value: cpu, Tags: tags})
+			if cpu > m.max.CPU {
+				m.max.CPU = cpu
+			}
+		}
+		m.lastCPU = ps.CPUTime
+	}
+	m.lastTime = t
+
+	return samples
+}
+
+// Maxima returns the highest CPU usage and sample backlog seen so far.
+func (m *Monitor) Maxima() Maxima {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.max
+}
+
+// Warnings returns warnings about the load generator having been overloaded, if it was.
+func (mx Maxima) Warnings() (warnings []string) {
+	if mx.CPU >= CPUBound {
+		warnings = append(warnings, fmt.Sprintf(
+			"the load generator was CPU-bound, using up to %.0f%% of its CPU; "+
+				"results may reflect the limits of this machine rather than the system under test",
+			mx.CPU))
+	}
+	if mx.Backlog >= BufferBound {
+		warnings = append(warnings, fmt.Sprintf(
+			"the load generator couldn't keep up with processing samples, filling up to %.0f%% of its buffer; "+
+				"consider raising metricSamplesBufferSize or using fewer VUs per machine",
+			100*mx.Backlog))
+	}
+	return warnings
+}
@@ -0,0 +1,69 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package generator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Reads the process' CPU time from getrusage(2), and its RSS and open files from /proc.
+func readProcessStats() (ps processStats, err error) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return ps, err
+	}
+	ps.CPUTime = time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+
+	// The second field of statm is the number of resident pages.
+	statm, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return ps, err
+	}
+	fields := bytes.Fields(statm)
+	if len(fields) < 2 {
+		return ps, errors.Errorf("invalid /proc/self/statm: %q", statm)
+	}
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return ps, err
+	}
+	ps.RSS = pages * int64(os.Getpagesize())
+
+	// Reading the directory opens a descriptor of its own, which shouldn't be counted.
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return ps, err
+	}
+	defer func() { _ = dir.Close() }()
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return ps, err
+	}
+	ps.OpenFDs = len(names) - 1
+	return ps, nil
+}
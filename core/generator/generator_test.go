@@ -0,0 +1,95 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package generator
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns the value of the given metric's first sample, and how many samples it has.
+func findGeneratorSample(samples []stats.Sample, m *stats.Metric) (value float64, n int) {
+	for _, s := range samples {
+		if s.Metric == m {
+			if n == 0 {
+				value = s.Value
+			}
+			n++
+		}
+	}
+	return value, n
+}
+
+func TestMonitor(t *testing.T) {
+	tags := stats.IntoSampleTags(&map[string]string{"foo": "bar"})
+	var m Monitor
+
+	samples := m.Samples(time.Now(), tags, 10, 100)
+	for _, s := range samples {
+		assert.Equal(t, tags, s.Tags)
+	}
+	backlog, _ := findGeneratorSample(samples, metrics.GeneratorSampleBacklog)
+	assert.Equal(t, 10.0, backlog)
+	heap, _ := findGeneratorSample(samples, metrics.GeneratorHeap)
+	assert.True(t, heap > 0)
+	goroutines, _ := findGeneratorSample(samples, metrics.GeneratorGoroutines)
+	assert.True(t, goroutines > 0)
+
+	// CPU usage and GC pauses are measured between samples, so the first ones have neither.
+	_, n := findGeneratorSample(samples, metrics.GeneratorCPU)
+	assert.Equal(t, 0, n)
+	_, n = findGeneratorSample(samples, metrics.GeneratorGCPause)
+	assert.Equal(t, 0, n)
+
+	runtime.GC()
+	runtime.GC()
+	samples = m.Samples(time.Now(), tags, 95, 100)
+	_, n = findGeneratorSample(samples, metrics.GeneratorGCPause)
+	assert.True(t, n >= 2, "%d GC pauses", n)
+
+	if runtime.GOOS == "linux" {
+		rss, _ := findGeneratorSample(samples, metrics.GeneratorRSS)
+		assert.True(t, rss > 0)
+		fds, _ := findGeneratorSample(samples, metrics.GeneratorOpenFDs)
+		assert.True(t, fds > 0)
+		cpu, n := findGeneratorSample(samples, metrics.GeneratorCPU)
+		assert.Equal(t, 1, n)
+		assert.True(t, cpu >= 0)
+	}
+
+	// The backlog hit 95% of the buffer, but the CPU usage can't be relied on here.
+	assert.Equal(t, 0.95, m.Maxima().Backlog)
+	m.max.CPU = 50
+	assert.Equal(t, []string{
+		"the load generator couldn't keep up with processing samples, filling up to 95% of its buffer; " +
+			"consider raising metricSamplesBufferSize or using fewer VUs per machine",
+	}, m.Maxima().Warnings())
+	assert.Empty(t, Maxima{CPU: 89, Backlog: 0.89}.Warnings())
+	assert.Equal(t, []string{
+		"the load generator was CPU-bound, using up to 97% of its CPU; " +
+			"results may reflect the limits of this machine rather than the system under test",
+	}, Maxima{CPU: 97.4, Backlog: 0.1}.Warnings())
+}
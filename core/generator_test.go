@@ -0,0 +1,57 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"testing"
+
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineEmitsGeneratorMetrics(t *testing.T) {
+	e, err, _ := newTestEngine(nil, lib.Options{})
+	require.NoError(t, err)
+	e.emitMetrics()
+	for _, m := range []*stats.Metric{metrics.GeneratorHeap, metrics.GeneratorGoroutines, metrics.GeneratorSampleBacklog} {
+		assert.Contains(t, e.Metrics, m.Name)
+	}
+	assert.Empty(t, e.GetGeneratorWarnings())
+}
+
+// An executor that runs the test on other load generators, which were overloaded.
+type overloadedExecutor struct {
+	lib.Executor
+}
+
+func (overloadedExecutor) GetGeneratorWarnings() []string {
+	return []string{"agent a: overloaded"}
+}
+
+func TestEngineGeneratorWarningsFromExecutor(t *testing.T) {
+	e, err, _ := newTestEngine(overloadedExecutor{local.New(nil)}, lib.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"agent a: overloaded"}, e.GetGeneratorWarnings())
+}
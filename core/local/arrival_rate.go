@@ -0,0 +1,613 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	null "gopkg.in/guregu/null.v3"
+)
+
+var _ lib.Executor = &ArrivalRateExecutor{}
+
+// An ArrivalRateExecutor starts new iterations at a configured rate (iterations per second),
+// regardless of how long the previous ones take to finish. This is an "open" model, as opposed
+// to the Executor's "closed" one, where a fixed number of VUs loop over the script as fast as
+// they can, and the request rate collapses when the system under test slows down.
+//
+// VUs are preallocated up to VUsMax and handed out to iterations as they're started. If an
+// iteration is due but all VUs are busy, it's dropped and a dropped_iterations sample emitted.
+// If stages are set, their targets are interpreted as rates rather than VU counts.
+type ArrivalRateExecutor struct {
+	Runner lib.Runner
+	Logger *log.Logger
+
+	runLock sync.Mutex
+	wg      sync.WaitGroup
+
+	runSetup    bool
+	runTeardown bool
+
+	// Preallocated VUs; free ones are kept in a stack that iterations pop from and push back to.
+	vusLock   sync.Mutex
+	vus       []lib.VU
+	freeVUs   []lib.VU
+	numVUs    int64 // VUs currently running an iteration
+	numVUsMax int64
+	nextVUID  int64
+
+	rate int64 // Iterations started per second
+
+	iters     int64 // Completed iterations
+	partIters int64 // Started iterations, including ones that are still running
+	endIters  int64 // End test at this many iterations
+
+	setupFails setupFailures
+
+	time    int64 // Current time
+	endTime int64 // End test at this timestamp
+
+	pauseLock sync.RWMutex
+	pause     chan interface{}
+
+	stages []lib.Stage
+
+	// Lock for: ctx, vuOut
+	lock sync.RWMutex
+
+	// Current context, nil if a test isn't running right now.
+	ctx context.Context
+
+	// Output channel to which VUs send samples.
+	vuOut chan stats.SampleContainer
+
+	// Channel on which iterations signal that they're completed.
+	iterDone chan struct{}
+
+	// Channel on which iterations signal that they were interrupted, and why.
+	iterInterrupted chan string
+}
+
+// NewArrivalRate creates an ArrivalRateExecutor wrapping the given runner. The initial rate is
+// taken from the runner's arrivalRate option, if it's set.
+func NewArrivalRate(r lib.Runner) *ArrivalRateExecutor {
+	var bufferSize, rate int64
+	if r != nil {
+		opts := r.GetOptions()
+		bufferSize = opts.MetricSamplesBufferSize.Int64
+		rate = opts.ArrivalRate.Int64
+	}
+
+	return &ArrivalRateExecutor{
+		Runner:      r,
+		Logger:      log.StandardLogger(),
+		runSetup:    true,
+		runTeardown: true,
+		rate:        rate,
+		endIters:    -1,
+		endTime:     -1,
+		vuOut:       make(chan stats.SampleContainer, bufferSize),
+		iterDone:    make(chan struct{}),
+
+		iterInterrupted: make(chan string),
+	}
+}
+
+func (e *ArrivalRateExecutor) Run(parent context.Context, engineOut chan<- stats.SampleContainer) (reterr error) {
+	e.runLock.Lock()
+	defer e.runLock.Unlock()
+
+	parent = withExecutionInfo(parent, e)
+	if e.Runner != nil && e.runSetup {
+		if err := e.Runner.Setup(parent, engineOut); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	ctx = withTestAbort(ctx, e.Logger, cancel)
+	e.lock.Lock()
+	vuOut := e.vuOut
+	iterDone := e.iterDone
+	interrupted := e.iterInterrupted
+	e.ctx = ctx
+	e.lock.Unlock()
+
+	var tags *stats.SampleTags
+	if e.Runner != nil {
+		tags = e.Runner.GetOptions().RunTags
+	}
+
+	var cutoff time.Time
+	defer func() {
+		// Interrupt all in-flight iterations, and keep forwarding their samples until they're
+		// done; anything produced past the cutoff point is excluded.
+		cancel()
+
+		wait := make(chan interface{})
+		go func() {
+			e.wg.Wait()
+			close(wait)
+		}()
+
+	drain:
+		for {
+			select {
+			case <-iterDone:
+			case cause := <-interrupted:
+				engineOut <- interruptedIteration(tags, cause)
+			case sc := <-vuOut:
+				forwardBeforeCutoff(engineOut, sc, cutoff)
+			case <-wait:
+				break drain
+			}
+		}
+		for _, sc := range stats.GetBufferedSamples(vuOut) {
+			forwardBeforeCutoff(engineOut, sc, cutoff)
+		}
+		e.teardownVUs(engineOut)
+
+		if e.Runner != nil && e.runTeardown {
+			err := e.Runner.Teardown(parent, engineOut)
+			if reterr == nil {
+				reterr = err
+			} else if err != nil {
+				reterr = fmt.Errorf("Teardown error %#v\nPrevious error: %#v", err, reterr)
+			}
+		}
+
+		e.lock.Lock()
+		e.ctx = nil
+		e.lock.Unlock()
+	}()
+
+	startRate := atomic.LoadInt64(&e.rate)
+
+	ticker := time.NewTicker(1 * time.Millisecond)
+	defer ticker.Stop()
+
+	// Fractional number of iterations that are due, but haven't been started yet.
+	var due float64
+
+	lastTick := time.Now()
+	for {
+		// If the test is paused, sleep until either the pause or the test ends.
+		// Also shift the last tick to omit time spent paused, but not partial ticks.
+		e.pauseLock.RLock()
+		pause := e.pause
+		e.pauseLock.RUnlock()
+		if pause != nil {
+			e.Logger.Debug("ArrivalRate: Pausing!")
+			leftovers := time.Since(lastTick)
+			select {
+			case <-pause:
+				e.Logger.Debug("ArrivalRate: No longer paused")
+				lastTick = time.Now().Add(-leftovers)
+			case <-ctx.Done():
+				e.Logger.Debug("ArrivalRate: Terminated while in paused state")
+				return nil
+			}
+		}
+
+		select {
+		case t := <-ticker.C:
+			// Every tick, increment the clock, see if we passed the end point, process stages and
+			// start however many iterations have become due since the last tick.
+			d := t.Sub(lastTick)
+			lastTick = t
+
+			end := time.Duration(atomic.LoadInt64(&e.endTime))
+			at := time.Duration(atomic.AddInt64(&e.time, int64(d)))
+			if end >= 0 && at >= end {
+				e.Logger.WithFields(log.Fields{"at": at, "end": end}).Debug("ArrivalRate: Hit time limit")
+				e.waitForIterations(ctx, engineOut, vuOut, iterDone, interrupted, tags)
+				cutoff = time.Now()
+				return nil
+			}
+
+			rate := atomic.LoadInt64(&e.rate)
+			if stages := e.stages; len(stages) > 0 {
+				r, keepRunning := ProcessStages(startRate, stages, at)
+				if !keepRunning {
+					e.Logger.WithField("at", at).Debug("ArrivalRate: Ran out of stages")
+					e.waitForIterations(ctx, engineOut, vuOut, iterDone, interrupted, tags)
+					cutoff = time.Now()
+					return nil
+				}
+				if r.Valid {
+					rate = r.Int64
+					atomic.StoreInt64(&e.rate, rate)
+				}
+			}
+
+			due += float64(rate) * d.Seconds()
+			for ; due >= 1; due-- {
+				endIters := atomic.LoadInt64(&e.endIters)
+				if endIters >= 0 && atomic.LoadInt64(&e.partIters) >= endIters {
+					due = 0
+					break
+				}
+				if !e.startIteration(ctx, iterDone, interrupted) {
+					engineOut <- stats.Sample{
+						Time:   t,
+						Metric: metrics.DroppedIterations,
+						Value:  1,
+						Tags:   tags,
+					}
+				}
+			}
+		case sampleContainer := <-vuOut:
+			engineOut <- sampleContainer
+		case <-iterDone:
+			end := atomic.LoadInt64(&e.endIters)
+			at := e.iterationDone(engineOut, tags)
+			if end >= 0 && at >= end {
+				e.Logger.WithFields(log.Fields{"at": at, "end": end}).Debug("ArrivalRate: Hit iteration limit")
+				return nil
+			}
+		case cause := <-interrupted:
+			engineOut <- interruptedIteration(tags, cause)
+		case <-ctx.Done():
+			e.Logger.Debug("ArrivalRate: Exiting with context")
+			cutoff = time.Now()
+			return nil
+		}
+	}
+}
+
+// Runs the vuTeardown() hooks of all VUs, concurrently; VUs that never ran an iteration skip it.
+func (e *ArrivalRateExecutor) teardownVUs(engineOut chan<- stats.SampleContainer) {
+	e.vusLock.Lock()
+	vus := e.vus
+	e.vusLock.Unlock()
+
+	var wg sync.WaitGroup
+	for _, vu := range vus {
+		vu, ok := vu.(lib.VUTeardowner)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := vu.TeardownVU(context.Background(), engineOut); err != nil {
+				logVUError(e.Logger, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Counts a completed iteration, returning the new total.
+func (e *ArrivalRateExecutor) iterationDone(engineOut chan<- stats.SampleContainer, tags *stats.SampleTags) int64 {
+	engineOut <- stats.Sample{
+		Time:   time.Now(),
+		Metric: metrics.Iterations,
+		Value:  1,
+		Tags:   tags,
+	}
+	return atomic.AddInt64(&e.iters, 1)
+}
+
+// When the test ends, lets in-flight iterations finish for up to the gracefulStop timeout, while
+// still forwarding their samples; no new iterations are started in the meantime.
+func (e *ArrivalRateExecutor) waitForIterations(
+	ctx context.Context, engineOut chan<- stats.SampleContainer, vuOut <-chan stats.SampleContainer,
+	iterDone <-chan struct{}, interrupted <-chan string, tags *stats.SampleTags,
+) {
+	timeout, _ := gracePeriods(e.Runner)
+	if timeout <= 0 || atomic.LoadInt64(&e.numVUs) == 0 {
+		return
+	}
+	e.Logger.WithField("timeout", timeout).Debug("ArrivalRate: Waiting for iterations to finish")
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(1 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&e.numVUs) > 0 {
+		select {
+		case sc := <-vuOut:
+			engineOut <- sc
+		case <-iterDone:
+			e.iterationDone(engineOut, tags)
+		case cause := <-interrupted:
+			engineOut <- interruptedIteration(tags, cause)
+		case <-ticker.C:
+		case <-deadline.C:
+			e.Logger.Debug("ArrivalRate: Graceful stop timed out")
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Starts an iteration on a free VU, returning false if there isn't one.
+func (e *ArrivalRateExecutor) startIteration(
+	ctx context.Context, iterDone chan<- struct{}, interrupted chan<- string,
+) bool {
+	e.vusLock.Lock()
+	n := len(e.freeVUs)
+	if n == 0 {
+		e.vusLock.Unlock()
+		return false
+	}
+	vu := e.freeVUs[n-1]
+	e.freeVUs = e.freeVUs[:n-1]
+	e.vusLock.Unlock()
+
+	atomic.AddInt64(&e.partIters, 1)
+	atomic.AddInt64(&e.numVUs, 1)
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+
+		var err error
+		if vu != nil {
+			err = vu.RunOnce(ctx)
+		}
+
+		e.vusLock.Lock()
+		e.freeVUs = append(e.freeVUs, vu)
+		e.vusLock.Unlock()
+		defer atomic.AddInt64(&e.numVUs, -1)
+
+		setupFailed := e.setupFails.track(ctx, err)
+		select {
+		case <-ctx.Done():
+			// Don't log errors or emit iterations metrics from cancelled iterations, only count
+			// them as interrupted.
+			if vu != nil && !setupFailed {
+				interrupted <- interruptedByTestEnd
+			}
+		default:
+			if err != nil {
+				logVUError(e.Logger, err)
+			}
+			// No iteration was run if the VU couldn't be set up, so it doesn't count.
+			if setupFailed {
+				atomic.AddInt64(&e.partIters, -1)
+			} else {
+				iterDone <- struct{}{}
+			}
+		}
+	}()
+	return true
+}
+
+// Forwards a sample container produced by a VU, leaving out any samples past the cutoff point.
+func forwardBeforeCutoff(out chan<- stats.SampleContainer, sc stats.SampleContainer, cutoff time.Time) {
+	if cutoff.IsZero() {
+		out <- sc
+	} else if csc, ok := sc.(stats.ConnectedSampleContainer); ok && csc.GetTime().Before(cutoff) {
+		out <- sc
+	} else {
+		for _, s := range sc.GetSamples() {
+			if s.Time.Before(cutoff) {
+				out <- s
+			}
+		}
+	}
+}
+
+func (e *ArrivalRateExecutor) IsRunning() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.ctx != nil
+}
+
+func (e *ArrivalRateExecutor) GetRunner() lib.Runner {
+	return e.Runner
+}
+
+func (e *ArrivalRateExecutor) SetLogger(l *log.Logger) {
+	e.Logger = l
+}
+
+func (e *ArrivalRateExecutor) GetLogger() *log.Logger {
+	return e.Logger
+}
+
+func (e *ArrivalRateExecutor) GetStages() []lib.Stage {
+	return e.stages
+}
+
+func (e *ArrivalRateExecutor) SetStages(s []lib.Stage) {
+	e.stages = s
+}
+
+// GetRate returns the current arrival rate, in iterations per second.
+func (e *ArrivalRateExecutor) GetRate() int64 {
+	return atomic.LoadInt64(&e.rate)
+}
+
+// SetRate sets the arrival rate, in iterations per second. If stages are set, they will override
+// this on the next tick, same as they would a VU count set with Executor.SetVUs().
+func (e *ArrivalRateExecutor) SetRate(rate int64) error {
+	if rate < 0 {
+		return errors.New("arrival rate can't be negative")
+	}
+	e.Logger.WithField("rate", rate).Debug("ArrivalRate: Setting rate")
+	atomic.StoreInt64(&e.rate, rate)
+	return nil
+}
+
+func (e *ArrivalRateExecutor) GetIterations() int64 {
+	return atomic.LoadInt64(&e.iters)
+}
+
+func (e *ArrivalRateExecutor) GetEndIterations() null.Int {
+	v := atomic.LoadInt64(&e.endIters)
+	if v < 0 {
+		return null.Int{}
+	}
+	return null.IntFrom(v)
+}
+
+func (e *ArrivalRateExecutor) SetEndIterations(i null.Int) {
+	if !i.Valid {
+		i.Int64 = -1
+	}
+	e.Logger.WithField("i", i.Int64).Debug("ArrivalRate: Setting end iterations")
+	atomic.StoreInt64(&e.endIters, i.Int64)
+}
+
+func (e *ArrivalRateExecutor) GetTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&e.time))
+}
+
+func (e *ArrivalRateExecutor) GetEndTime() types.NullDuration {
+	v := atomic.LoadInt64(&e.endTime)
+	if v < 0 {
+		return types.NullDuration{}
+	}
+	return types.NullDurationFrom(time.Duration(v))
+}
+
+func (e *ArrivalRateExecutor) SetEndTime(t types.NullDuration) {
+	if !t.Valid {
+		t.Duration = -1
+	}
+	e.Logger.WithField("d", t.Duration).Debug("ArrivalRate: Setting end time")
+	atomic.StoreInt64(&e.endTime, int64(t.Duration))
+}
+
+func (e *ArrivalRateExecutor) IsPaused() bool {
+	e.pauseLock.RLock()
+	defer e.pauseLock.RUnlock()
+	return e.pause != nil
+}
+
+func (e *ArrivalRateExecutor) SetPaused(paused bool) {
+	e.Logger.WithField("paused", paused).Debug("ArrivalRate: Setting paused")
+	e.pauseLock.Lock()
+	defer e.pauseLock.Unlock()
+
+	if paused && e.pause == nil {
+		e.pause = make(chan interface{})
+	} else if !paused && e.pause != nil {
+		close(e.pause)
+		e.pause = nil
+	}
+}
+
+// GetVUs returns the number of VUs that are currently running an iteration.
+func (e *ArrivalRateExecutor) GetVUs() int64 {
+	return atomic.LoadInt64(&e.numVUs)
+}
+
+// SetVUs only validates the given number against the VU cap; how many VUs are active at any
+// given time is driven by the arrival rate and the duration of iterations.
+func (e *ArrivalRateExecutor) SetVUs(num int64) error {
+	if num < 0 {
+		return errors.New("vu count can't be negative")
+	}
+	if numVUsMax := atomic.LoadInt64(&e.numVUsMax); num > numVUsMax {
+		return errors.Errorf("can't raise vu count (to %d) above vu cap (%d)", num, numVUsMax)
+	}
+	return nil
+}
+
+func (e *ArrivalRateExecutor) GetVUsMax() int64 {
+	return atomic.LoadInt64(&e.numVUsMax)
+}
+
+// SetVUsMax sets the size of the VU pool. VUs can only be removed from the pool while they're
+// not running an iteration.
+func (e *ArrivalRateExecutor) SetVUsMax(max int64) error {
+	e.Logger.WithField("max", max).Debug("ArrivalRate: Setting max VUs")
+	if max < 0 {
+		return errors.New("vu cap can't be negative")
+	}
+
+	e.vusLock.Lock()
+	defer e.vusLock.Unlock()
+
+	numVUsMax := int64(len(e.vus))
+	if numVUsMax == max {
+		return nil
+	}
+
+	if max < numVUsMax {
+		busy := numVUsMax - int64(len(e.freeVUs))
+		if max < busy {
+			return errors.Errorf("can't lower vu cap (to %d) below active vu count (%d)", max, busy)
+		}
+		remove := make(map[lib.VU]bool, numVUsMax-max)
+		for _, vu := range e.freeVUs[int64(len(e.freeVUs))-(numVUsMax-max):] {
+			remove[vu] = true
+		}
+		e.freeVUs = e.freeVUs[:int64(len(e.freeVUs))-(numVUsMax-max)]
+
+		vus := make([]lib.VU, 0, max)
+		for _, vu := range e.vus {
+			if vu != nil && remove[vu] {
+				continue
+			}
+			vus = append(vus, vu)
+		}
+		e.vus = vus[:max]
+		atomic.StoreInt64(&e.numVUsMax, max)
+		return nil
+	}
+
+	e.lock.RLock()
+	vuOut := e.vuOut
+	e.lock.RUnlock()
+
+	for i := numVUsMax; i < max; i++ {
+		var vu lib.VU
+		if e.Runner != nil {
+			var err error
+			if vu, err = e.Runner.NewVU(vuOut); err != nil {
+				return err
+			}
+			if err := vu.Reconfigure(atomic.AddInt64(&e.nextVUID, 1)); err != nil {
+				return err
+			}
+		}
+		e.vus = append(e.vus, vu)
+		e.freeVUs = append(e.freeVUs, vu)
+	}
+
+	atomic.StoreInt64(&e.numVUsMax, max)
+	return nil
+}
+
+func (e *ArrivalRateExecutor) SetRunSetup(r bool) {
+	e.runSetup = r
+}
+
+func (e *ArrivalRateExecutor) SetRunTeardown(r bool) {
+	e.runTeardown = r
+}
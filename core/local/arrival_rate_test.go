@@ -0,0 +1,254 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package local
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func countSamples(samples chan stats.SampleContainer, m *stats.Metric) (n int) {
+	for _, sc := range stats.GetBufferedSamples(samples) {
+		for _, s := range sc.GetSamples() {
+			if s.Metric == m {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestArrivalRateExecutorRun(t *testing.T) {
+	e := NewArrivalRate(nil)
+	assert.NoError(t, e.SetVUsMax(10))
+	assert.NoError(t, e.SetRate(100))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := make(chan error, 1)
+	go func() { err <- e.Run(ctx, make(chan stats.SampleContainer, 100)) }()
+	cancel()
+	assert.NoError(t, <-err)
+}
+
+func TestArrivalRateExecutorRate(t *testing.T) {
+	var count int64
+	e := NewArrivalRate(&lib.MiniRunner{Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		atomic.AddInt64(&count, 1)
+		return nil
+	}})
+	assert.NoError(t, e.SetVUsMax(5))
+	assert.NoError(t, e.SetRate(200))
+	e.SetEndTime(types.NullDurationFrom(500 * time.Millisecond))
+
+	samples := make(chan stats.SampleContainer, 1000)
+	assert.NoError(t, e.Run(context.Background(), samples))
+
+	// 200 iterations per second over half a second, give or take a few for timer jitter.
+	assert.InDelta(t, 100, atomic.LoadInt64(&count), 10)
+	assert.Equal(t, 0, countSamples(samples, metrics.DroppedIterations))
+}
+
+func TestArrivalRateExecutorSlowIterations(t *testing.T) {
+	var count int64
+	e := NewArrivalRate(&lib.MiniRunner{Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		atomic.AddInt64(&count, 1)
+		select {
+		case <-time.After(1 * time.Second):
+		case <-ctx.Done():
+		}
+		return nil
+	}})
+	assert.NoError(t, e.SetVUsMax(2))
+	assert.NoError(t, e.SetRate(100))
+	e.SetEndTime(types.NullDurationFrom(200 * time.Millisecond))
+
+	samples := make(chan stats.SampleContainer, 1000)
+	assert.NoError(t, e.Run(context.Background(), samples))
+
+	// Iterations keep arriving even though both VUs are busy; the ones that can't be started are
+	// dropped instead of slowing the rate down.
+	assert.Equal(t, int64(2), atomic.LoadInt64(&count))
+	assert.InDelta(t, 18, countSamples(samples, metrics.DroppedIterations), 3)
+}
+
+func TestArrivalRateExecutorGracefulStop(t *testing.T) {
+	for name, gracefulStop := range map[string]types.NullDuration{
+		"unset":  {},
+		"finish": types.NullDurationFrom(2 * time.Second),
+	} {
+		t.Run(name, func(t *testing.T) {
+			e := NewArrivalRate(slowIterationRunner(300*time.Millisecond, lib.Options{GracefulStop: gracefulStop}))
+			assert.NoError(t, e.SetVUsMax(2))
+			assert.NoError(t, e.SetRate(100))
+			e.SetEndTime(types.NullDurationFrom(100 * time.Millisecond))
+
+			samples := make(chan stats.SampleContainer, 1000)
+			assert.NoError(t, e.Run(context.Background(), samples))
+			iterations, interrupted := countIterations(samples)
+			if gracefulStop.Valid {
+				assert.Equal(t, 2, iterations)
+				assert.Empty(t, interrupted)
+			} else {
+				assert.Equal(t, 0, iterations)
+				assert.Equal(t, map[string]int{"test_end": 2}, interrupted)
+			}
+		})
+	}
+}
+
+func TestArrivalRateExecutorVUTeardown(t *testing.T) {
+	metric := stats.New("vu_teardown", stats.Counter)
+	r := slowIterationRunner(10*time.Millisecond, lib.Options{})
+	r.VUTeardownFn = func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		out <- stats.Sample{Time: time.Now(), Metric: metric, Value: 1}
+		return nil
+	}
+	e := NewArrivalRate(r)
+	assert.NoError(t, e.SetVUsMax(2))
+	assert.NoError(t, e.SetRate(100))
+	e.SetEndTime(types.NullDurationFrom(100 * time.Millisecond))
+
+	samples := make(chan stats.SampleContainer, 1000)
+	assert.NoError(t, e.Run(context.Background(), samples))
+	assert.Equal(t, 2, countSamples(samples, metric))
+}
+
+func TestArrivalRateExecutorEndIterations(t *testing.T) {
+	var count int64
+	e := NewArrivalRate(&lib.MiniRunner{Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		atomic.AddInt64(&count, 1)
+		return nil
+	}})
+	assert.NoError(t, e.SetVUsMax(5))
+	assert.NoError(t, e.SetRate(1000))
+	e.SetEndIterations(null.IntFrom(50))
+
+	samples := make(chan stats.SampleContainer, 1000)
+	assert.NoError(t, e.Run(context.Background(), samples))
+	assert.Equal(t, int64(50), e.GetIterations())
+	assert.Equal(t, int64(50), atomic.LoadInt64(&count))
+	assert.Equal(t, 50, countSamples(samples, metrics.Iterations))
+}
+
+func TestArrivalRateExecutorVUSetupError(t *testing.T) {
+	var calls int64
+	e := NewArrivalRate(&lib.MiniRunner{Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		// Every other call fails to set up the VU, and doesn't count as an iteration.
+		if atomic.AddInt64(&calls, 1)%2 == 1 {
+			return lib.VUSetupError{Err: errors.New("nope")}
+		}
+		return nil
+	}})
+	logger, hook := logtest.NewNullLogger()
+	e.SetLogger(logger)
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.NoError(t, e.SetRate(1000))
+	e.SetEndIterations(null.IntFrom(10))
+
+	samples := make(chan stats.SampleContainer, 1000)
+	assert.NoError(t, e.Run(context.Background(), samples))
+	assert.Equal(t, int64(10), e.GetIterations())
+	assert.Equal(t, int64(20), atomic.LoadInt64(&calls))
+	assert.Equal(t, 10, countSamples(samples, metrics.Iterations))
+	require.NotEmpty(t, hook.Entries)
+	assert.Equal(t, "nope", hook.LastEntry().Message)
+}
+
+func TestArrivalRateExecutorVUSetupAlwaysFails(t *testing.T) {
+	// A test that's only bounded by iterations is aborted if VUs keep failing to set up.
+	var calls int64
+	e := NewArrivalRate(&lib.MiniRunner{Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		atomic.AddInt64(&calls, 1)
+		return lib.VUSetupError{Err: errors.New("nope")}
+	}})
+	logger, _ := logtest.NewNullLogger()
+	e.SetLogger(logger)
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.NoError(t, e.SetRate(1000))
+	e.SetEndIterations(null.IntFrom(10))
+
+	var reason string
+	var exitCode int
+	ctx := lib.WithTestAbort(context.Background(), func(r string, code int) { reason, exitCode = r, code })
+	samples := make(chan stats.SampleContainer, 1000)
+	done := make(chan error)
+	go func() { done <- e.Run(ctx, samples) }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the test never ended")
+	}
+	assert.Equal(t, int64(0), e.GetIterations())
+	assert.True(t, atomic.LoadInt64(&calls) >= lib.MaxVUSetupFailures)
+	assert.Equal(t, "VUs failed to set up 100 times in a row", reason)
+	assert.Equal(t, lib.VUSetupErrorExitCode, exitCode)
+}
+
+func TestArrivalRateExecutorStages(t *testing.T) {
+	e := NewArrivalRate(nil)
+	assert.NoError(t, e.SetVUsMax(10))
+	e.SetStages([]lib.Stage{
+		{Duration: types.NullDurationFrom(100 * time.Millisecond), Target: null.IntFrom(50)},
+		{Duration: types.NullDurationFrom(100 * time.Millisecond), Target: null.IntFrom(50)},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := make(chan error, 1)
+	go func() { err <- e.Run(ctx, make(chan stats.SampleContainer, 1000)) }()
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, int64(50), e.GetRate())
+	assert.NoError(t, <-err)
+	assert.False(t, e.IsRunning())
+}
+
+func TestArrivalRateExecutorSetVUsMax(t *testing.T) {
+	e := NewArrivalRate(&lib.MiniRunner{})
+	require.NoError(t, e.SetVUsMax(10))
+	assert.Equal(t, int64(10), e.GetVUsMax())
+	assert.Len(t, e.freeVUs, 10)
+
+	assert.NoError(t, e.SetVUs(10))
+	assert.EqualError(t, e.SetVUs(11), "can't raise vu count (to 11) above vu cap (10)")
+	assert.EqualError(t, e.SetVUsMax(-1), "vu cap can't be negative")
+
+	require.NoError(t, e.SetVUsMax(4))
+	assert.Equal(t, int64(4), e.GetVUsMax())
+	assert.Len(t, e.freeVUs, 4)
+	assert.Len(t, e.vus, 4)
+	assert.Equal(t, int64(0), e.GetVUs())
+
+	assert.EqualError(t, e.SetRate(-1), "arrival rate can't be negative")
+}
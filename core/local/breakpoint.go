@@ -0,0 +1,307 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	null "gopkg.in/guregu/null.v3"
+)
+
+var _ lib.Executor = &BreakpointExecutor{}
+var _ lib.BreakpointReporter = &BreakpointExecutor{}
+
+// ErrBreakpointNoScaling is returned when trying to change the VU counts of a breakpoint test.
+var ErrBreakpointNoScaling = errors.New("VUs can't be changed for breakpoint tests")
+
+// How often a BreakpointExecutor checks whether the current step is over.
+const breakpointTickRate = 10 * time.Millisecond
+
+// A BreakpointExecutor runs a breakpoint test (see lib.Breakpoint), by wrapping an Executor or an
+// ArrivalRateExecutor and changing its VUs or rate at the start of every step.
+//
+// The thresholds are evaluated at the end of each step, over the samples emitted during it; the
+// test itself is only over once the search is, or if it's stopped or runs out of time.
+type BreakpointExecutor struct {
+	lib.Executor
+
+	// The thresholds evaluated over each step, and the kind of sink for trend metrics (see
+	// lib.Options.TrendSink); taken from the runner's options.
+	Thresholds map[string]stats.Thresholds
+	TrendSink  string
+
+	config   lib.Breakpoint
+	setLevel func(int64) error
+
+	resultLock sync.RWMutex
+	result     lib.BreakpointResult
+}
+
+// NewBreakpoint creates a BreakpointExecutor for the given runner and breakpoint test. In
+// arrival-rate mode, as many VUs as the runner's vusMax option are preallocated; if it's not
+// set, one for every iteration per second of the highest level.
+func NewBreakpoint(r lib.Runner, config lib.Breakpoint) (*BreakpointExecutor, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "breakpoint")
+	}
+	config = config.WithDefaults()
+
+	e := &BreakpointExecutor{
+		config: config,
+		result: lib.BreakpointResult{Mode: config.GetMode(), Steps: []lib.BreakpointStep{}},
+	}
+	var opts lib.Options
+	if r != nil {
+		opts = r.GetOptions()
+		e.Thresholds = opts.Thresholds
+		e.TrendSink = opts.TrendSink.String
+	}
+	if _, err := newStepMetrics(e.Thresholds, e.TrendSink); err != nil {
+		return nil, err
+	}
+
+	switch config.GetMode() {
+	case lib.BreakpointModeArrivalRate:
+		ex := NewArrivalRate(r)
+		vusMax := config.Max.Int64
+		if opts.VUsMax.Valid {
+			vusMax = opts.VUsMax.Int64
+		}
+		if err := ex.SetVUsMax(vusMax); err != nil {
+			return nil, err
+		}
+		if err := ex.SetVUs(vusMax); err != nil {
+			return nil, err
+		}
+		e.Executor, e.setLevel = ex, ex.SetRate
+	default:
+		ex := New(r)
+		if err := ex.SetVUsMax(config.Max.Int64); err != nil {
+			return nil, err
+		}
+		e.Executor, e.setLevel = ex, ex.SetVUs
+	}
+	if err := e.setLevel(config.Start.Int64); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *BreakpointExecutor) Run(ctx context.Context, engineOut chan<- stats.SampleContainer) error {
+	ctx = withExecutionInfo(ctx, e)
+	out := make(chan stats.SampleContainer, cap(engineOut))
+	errC := make(chan error, 1)
+	go func() { errC <- e.Executor.Run(ctx, out) }()
+
+	search := breakpointSearch{
+		step:      e.config.Step.Int64,
+		max:       e.config.Max.Int64,
+		precision: e.config.Precision.Int64,
+	}
+	stepDuration := time.Duration(e.config.StepDuration.Duration)
+	level, start := e.config.Start.Int64, time.Duration(0)
+	step, err := newStepMetrics(e.Thresholds, e.TrendSink)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(breakpointTickRate)
+	defer ticker.Stop()
+	for {
+		select {
+		case sc := <-out:
+			if step != nil {
+				step.add(sc)
+			}
+			engineOut <- sc
+		case <-ticker.C:
+			at := e.Executor.GetTime()
+			if step == nil || at-start < stepDuration {
+				continue
+			}
+
+			failed := step.evaluate(at-start, e.GetLogger())
+			next, done := search.next(level, len(failed) == 0)
+			e.resultLock.Lock()
+			e.result.Steps = append(e.result.Steps, lib.BreakpointStep{
+				Level:            level,
+				StartTime:        types.Duration(start),
+				Duration:         types.Duration(at - start),
+				Passed:           len(failed) == 0,
+				FailedThresholds: failed,
+			})
+			if search.passed > 0 {
+				e.result.Highest = null.IntFrom(search.passed)
+			}
+			e.result.Done = done
+			e.resultLock.Unlock()
+			e.GetLogger().WithField("level", level).WithField("passed", len(failed) == 0).Debug("Breakpoint: Step done")
+
+			if done {
+				// Let the wrapped executor end on its own, so it still runs teardown.
+				e.Executor.SetEndTime(types.NullDurationFrom(at))
+				step = nil
+				continue
+			}
+			if err := e.setLevel(next); err != nil {
+				return err
+			}
+			level, start = next, at
+			if step, err = newStepMetrics(e.Thresholds, e.TrendSink); err != nil {
+				return err
+			}
+		case err := <-errC:
+			for _, sc := range stats.GetBufferedSamples(out) {
+				engineOut <- sc
+			}
+			return err
+		}
+	}
+}
+
+// GetBreakpointResult returns the progress of the breakpoint test.
+func (e *BreakpointExecutor) GetBreakpointResult() lib.BreakpointResult {
+	e.resultLock.RLock()
+	defer e.resultLock.RUnlock()
+
+	result := e.result
+	result.Steps = append([]lib.BreakpointStep{}, e.result.Steps...)
+	return result
+}
+
+// SetStages does nothing, load levels are set by the breakpoint test.
+func (e *BreakpointExecutor) SetStages(s []lib.Stage) {}
+
+// SetVUs always returns ErrBreakpointNoScaling.
+func (e *BreakpointExecutor) SetVUs(vus int64) error {
+	return ErrBreakpointNoScaling
+}
+
+// SetVUsMax always returns ErrBreakpointNoScaling.
+func (e *BreakpointExecutor) SetVUsMax(max int64) error {
+	return ErrBreakpointNoScaling
+}
+
+// The state of a breakpoint search: levels are increased by a step for as long as they pass, then
+// bisected between the highest passing and the lowest failing ones.
+type breakpointSearch struct {
+	step, max, precision int64
+
+	passed int64 // The highest level that passed, 0 if none did.
+	failed int64 // The lowest level that failed, 0 if none did.
+}
+
+// Records the result of a level, and returns the next one to try, or true if the search is over.
+func (s *breakpointSearch) next(level int64, passed bool) (int64, bool) {
+	if passed {
+		if level > s.passed {
+			s.passed = level
+		}
+	} else if s.failed == 0 || level < s.failed {
+		s.failed = level
+	}
+
+	if s.failed == 0 {
+		if s.passed >= s.max {
+			return 0, true
+		}
+		next := s.passed + s.step
+		if next > s.max {
+			next = s.max
+		}
+		return next, false
+	}
+	if s.failed-s.passed <= s.precision {
+		return 0, true
+	}
+	return s.passed + (s.failed-s.passed)/2, false
+}
+
+// The metrics of a single breakpoint step, with fresh copies of the thresholds to evaluate over
+// them; metrics and submetrics are aggregated the same way the Engine does.
+type stepMetrics struct {
+	metrics    map[string]*stats.Metric
+	aggregator *lib.MetricAggregator
+	added      []*stats.Metric
+}
+
+func newStepMetrics(thresholds map[string]stats.Thresholds, trendSink string) (*stepMetrics, error) {
+	fresh := make(map[string]stats.Thresholds, len(thresholds))
+	for name, ths := range thresholds {
+		data, err := json.Marshal(ths)
+		if err != nil {
+			return nil, err
+		}
+		var ths stats.Thresholds
+		if err := json.Unmarshal(data, &ths); err != nil {
+			return nil, errors.Wrapf(err, "thresholds for %s", name)
+		}
+		fresh[name] = ths
+	}
+	return &stepMetrics{
+		metrics:    make(map[string]*stats.Metric),
+		aggregator: lib.NewMetricAggregator(fresh, trendSink),
+	}, nil
+}
+
+func (s *stepMetrics) add(sc stats.SampleContainer) {
+	for _, sample := range sc.GetSamples() {
+		m, ok := s.metrics[sample.Metric.Name]
+		if !ok {
+			m = s.aggregator.NewMetric(sample.Metric)
+			s.metrics[m.Name] = m
+		}
+		s.added = s.aggregator.Add(m, sample, s.added[:0])
+		for _, sm := range s.added {
+			s.metrics[sm.Name] = sm
+		}
+	}
+}
+
+// Evaluates the thresholds over the step, which lasted for d, and returns the ones that failed,
+// eg. "http_req_duration: p(95)<500". Metrics without any samples in the step are left out.
+func (s *stepMetrics) evaluate(d time.Duration, logger *log.Logger) []string {
+	failed := []string{}
+	for name, m := range s.metrics {
+		if len(m.Thresholds.Thresholds) == 0 {
+			continue
+		}
+		if _, err := m.Thresholds.Run(m.Sink, d); err != nil {
+			logger.WithField("m", name).WithError(err).Error("Threshold error")
+			continue
+		}
+		for _, th := range m.Thresholds.Thresholds {
+			if th.LastFailed {
+				failed = append(failed, name+": "+th.Source)
+			}
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
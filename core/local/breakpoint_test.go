@@ -0,0 +1,184 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package local
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestBreakpointSearch(t *testing.T) {
+	// Searches for a capacity of 45, recording the levels tried.
+	s := breakpointSearch{step: 10, max: 100, precision: 2}
+	levels := []int64{}
+	level, done := int64(10), false
+	for !done {
+		levels = append(levels, level)
+		level, done = s.next(level, level <= 45)
+	}
+	assert.Equal(t, []int64{10, 20, 30, 40, 50, 45, 47}, levels)
+	assert.Equal(t, int64(45), s.passed)
+
+	t.Run("Max", func(t *testing.T) {
+		s := breakpointSearch{step: 40, max: 100, precision: 1}
+		levels := []int64{}
+		level, done := int64(40), false
+		for !done {
+			levels = append(levels, level)
+			level, done = s.next(level, true)
+		}
+		assert.Equal(t, []int64{40, 80, 100}, levels)
+		assert.Equal(t, int64(100), s.passed)
+	})
+	t.Run("NonePassed", func(t *testing.T) {
+		s := breakpointSearch{step: 10, max: 100, precision: 1}
+		levels := []int64{}
+		level, done := int64(4), false
+		for !done {
+			levels = append(levels, level)
+			level, done = s.next(level, false)
+		}
+		assert.Equal(t, []int64{4, 2, 1}, levels)
+		assert.Equal(t, int64(0), s.passed)
+	})
+}
+
+func TestNewBreakpoint(t *testing.T) {
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := NewBreakpoint(&lib.MiniRunner{}, lib.Breakpoint{Step: null.IntFrom(10)})
+		assert.EqualError(t, err, "breakpoint: the breakpoint max must be positive")
+	})
+	t.Run("VUs", func(t *testing.T) {
+		e, err := NewBreakpoint(&lib.MiniRunner{}, lib.Breakpoint{Step: null.IntFrom(10), Max: null.IntFrom(50)})
+		require.NoError(t, err)
+		assert.IsType(t, &Executor{}, e.Executor)
+		assert.Equal(t, int64(50), e.GetVUsMax())
+		assert.Equal(t, int64(10), e.GetVUs())
+		assert.Equal(t, ErrBreakpointNoScaling, e.SetVUs(20))
+		assert.Equal(t, ErrBreakpointNoScaling, e.SetVUsMax(20))
+	})
+	t.Run("ArrivalRate", func(t *testing.T) {
+		e, err := NewBreakpoint(&lib.MiniRunner{Options: lib.Options{VUsMax: null.IntFrom(5)}}, lib.Breakpoint{
+			Mode: null.StringFrom(lib.BreakpointModeArrivalRate), Start: null.IntFrom(20),
+			Step: null.IntFrom(10), Max: null.IntFrom(50),
+		})
+		require.NoError(t, err)
+		require.IsType(t, &ArrivalRateExecutor{}, e.Executor)
+		assert.Equal(t, int64(20), e.Executor.(*ArrivalRateExecutor).GetRate())
+		assert.Equal(t, int64(5), e.GetVUsMax())
+	})
+	t.Run("InvalidThresholds", func(t *testing.T) {
+		ths := stats.Thresholds{Thresholds: []*stats.Threshold{{Source: "="}}}
+		_, err := NewBreakpoint(&lib.MiniRunner{Options: lib.Options{
+			Thresholds: map[string]stats.Thresholds{"my_metric": ths},
+		}}, lib.Breakpoint{Step: null.IntFrom(10), Max: null.IntFrom(50)})
+		assert.Error(t, err)
+	})
+}
+
+func TestBreakpointExecutorRun(t *testing.T) {
+	// Every iteration emits the current VU count, and the thresholds fail from 35 VUs on.
+	metric := stats.New("my_metric", stats.Trend)
+	ths, err := stats.NewThresholds([]string{"max<35"})
+	require.NoError(t, err)
+
+	var e *BreakpointExecutor
+	r := &lib.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			out <- stats.Sample{Metric: metric, Time: time.Now(), Value: float64(e.GetVUs())}
+			select {
+			case <-ctx.Done():
+			case <-time.After(1 * time.Millisecond):
+			}
+			return nil
+		},
+		Options: lib.Options{Thresholds: map[string]stats.Thresholds{"my_metric": ths}},
+	}
+	e, err = NewBreakpoint(r, lib.Breakpoint{
+		Step:         null.IntFrom(10),
+		Max:          null.IntFrom(100),
+		Precision:    null.IntFrom(5),
+		StepDuration: types.NullDurationFrom(100 * time.Millisecond),
+	})
+	require.NoError(t, err)
+
+	samples := make(chan stats.SampleContainer, 1000)
+	go func() {
+		for range samples {
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, e.Run(ctx, samples))
+	close(samples)
+
+	result := e.GetBreakpointResult()
+	assert.True(t, result.Done)
+	assert.Equal(t, null.IntFrom(30), result.Highest)
+	assert.Equal(t, "vus", result.Mode)
+
+	levels := make([]int64, len(result.Steps))
+	for i, step := range result.Steps {
+		levels[i] = step.Level
+		assert.True(t, step.Duration >= types.Duration(100*time.Millisecond))
+		if step.Level < 35 {
+			assert.True(t, step.Passed, step.Level)
+			assert.Empty(t, step.FailedThresholds)
+		} else {
+			assert.False(t, step.Passed, step.Level)
+			assert.Equal(t, []string{"my_metric: max<35"}, step.FailedThresholds)
+		}
+	}
+	assert.Equal(t, []int64{10, 20, 30, 40, 35}, levels)
+	assert.Equal(t, types.Duration(0), result.Steps[0].StartTime)
+	assert.Equal(t, result.Steps[0].Duration, result.Steps[1].StartTime)
+}
+
+func TestStepMetricsTrendSink(t *testing.T) {
+	trend := stats.New("my_trend", stats.Trend)
+	ths, err := stats.NewThresholds([]string{"p(95)<500"})
+	require.NoError(t, err)
+	thresholds := map[string]stats.Thresholds{"my_trend{a:1}": ths}
+
+	for name, sketch := range map[string]bool{"": false, lib.TrendSinkExact: false, lib.TrendSinkSketch: true} {
+		t.Run(name, func(t *testing.T) {
+			s, err := newStepMetrics(thresholds, name)
+			require.NoError(t, err)
+			s.add(stats.Sample{Metric: trend, Value: 600, Tags: stats.IntoSampleTags(&map[string]string{"a": "1"})})
+
+			for _, name := range []string{"my_trend", "my_trend{a:1}"} {
+				sink, ok := s.metrics[name].Sink.(*stats.TrendSink)
+				if assert.True(t, ok, name) {
+					assert.Equal(t, sketch, sink.Sketch != nil, name)
+				}
+			}
+			assert.Equal(t, []string{"my_trend{a:1}: p(95)<500"}, s.evaluate(time.Second, log.StandardLogger()))
+		})
+	}
+}
@@ -49,13 +49,33 @@ type vuHandle struct {
 	vu     lib.VU
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// The VU's current run; it outlives ctx and cancel if the VU is ramped down mid-iteration.
+	current *vuRun
 }
 
-func (h *vuHandle) run(logger *log.Logger, flow <-chan int64, iterDone chan<- struct{}) {
-	h.RLock()
-	ctx := h.ctx
-	h.RUnlock()
+// A vuRun is one stretch of a VU being scaled up, from starting its goroutine to it exiting.
+// Everything but cancel and done is guarded by the vuHandle's lock.
+type vuRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Whether an iteration is in progress, and whether one ever was; a VU that ran any needs
+	// its vuTeardown() hook run once it stops.
+	busy, iterated bool
+
+	// Set if the VU was ramped down mid-iteration; it stops once that iteration is done, or
+	// interrupts it if the grace period runs out first.
+	stopTimer *time.Timer
 
+	// Why the run's context was cancelled, if it was the executor that did it.
+	cause string
+}
+
+func (h *vuHandle) run(
+	logger *log.Logger, run *vuRun, ctx context.Context, busyVUs, partIters *int64,
+	setupFails *setupFailures, flow <-chan int64, iterDone chan<- struct{}, interrupted chan<- string,
+) {
 	for {
 		select {
 		case _, ok := <-flow:
@@ -67,19 +87,57 @@ func (h *vuHandle) run(logger *log.Logger, flow <-chan int64, iterDone chan<- st
 		}
 
 		if h.vu != nil {
+			// Don't start anything if the VU was ramped down while waiting.
+			h.Lock()
+			if ctx.Err() != nil {
+				h.Unlock()
+				return
+			}
+			run.busy = true
+			run.iterated = true
+			h.Unlock()
+			atomic.AddInt64(busyVUs, 1)
+
 			err := h.vu.RunOnce(ctx)
+
+			h.Lock()
+			run.busy = false
+			stopping := run.stopTimer != nil
+			if stopping {
+				run.stopTimer.Stop()
+				run.stopTimer = nil
+			}
+			cause := run.cause
+			h.Unlock()
+
+			setupFailed := setupFails.track(ctx, err)
 			select {
 			case <-ctx.Done():
-			// Don't log errors or emit iterations metrics from cancelled iterations
+				// Don't log errors or emit iterations metrics from cancelled iterations, only
+				// count them as interrupted.
+				if !setupFailed {
+					if cause == "" {
+						cause = interruptedByTestEnd
+					}
+					interrupted <- cause
+				}
 			default:
 				if err != nil {
-					if s, ok := err.(fmt.Stringer); ok {
-						logger.Error(s.String())
-					} else {
-						logger.Error(err.Error())
-					}
+					logVUError(logger, err)
 				}
-				iterDone <- struct{}{}
+				// No iteration was run if the VU couldn't be set up, so it doesn't count.
+				if setupFailed {
+					atomic.AddInt64(partIters, -1)
+				} else {
+					iterDone <- struct{}{}
+				}
+			}
+			atomic.AddInt64(busyVUs, -1)
+
+			// A VU that was ramped down mid-iteration is done now.
+			if stopping {
+				run.cancel()
+				return
 			}
 		} else {
 			iterDone <- struct{}{}
@@ -106,6 +164,9 @@ type Executor struct {
 	iters     int64 // Completed iterations
 	partIters int64 // Partial, incomplete iterations
 	endIters  int64 // End test at this many iterations
+	busyVUs   int64 // VUs in the middle of an iteration
+
+	setupFails setupFailures
 
 	time    int64 // Current time
 	endTime int64 // End test at this timestamp
@@ -115,7 +176,7 @@ type Executor struct {
 
 	stages []lib.Stage
 
-	// Lock for: ctx, flow, out
+	// Lock for: ctx, flow, vuOut, engineOut
 	lock sync.RWMutex
 
 	// Current context, nil if a test isn't running right now.
@@ -124,9 +185,16 @@ type Executor struct {
 	// Output channel to which VUs send samples.
 	vuOut chan stats.SampleContainer
 
+	// The channel Run() was called with; VUs' vuTeardown() hooks send samples straight to it,
+	// since they run past the end of the test.
+	engineOut chan<- stats.SampleContainer
+
 	// Channel on which VUs sigal that iterations are completed
 	iterDone chan struct{}
 
+	// Channel on which VUs signal that iterations were interrupted, and why
+	iterInterrupted chan string
+
 	// Flow control for VUs; iterations are run only after reading from this channel.
 	flow chan int64
 }
@@ -146,6 +214,8 @@ func New(r lib.Runner) *Executor {
 		endTime:     -1,
 		vuOut:       make(chan stats.SampleContainer, bufferSize),
 		iterDone:    make(chan struct{}),
+
+		iterInterrupted: make(chan string),
 	}
 }
 
@@ -153,6 +223,7 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 	e.runLock.Lock()
 	defer e.runLock.Unlock()
 
+	parent = withExecutionInfo(parent, e)
 	if e.Runner != nil && e.runSetup {
 		if err := e.Runner.Setup(parent, engineOut); err != nil {
 			return err
@@ -160,44 +231,42 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 	}
 
 	ctx, cancel := context.WithCancel(parent)
+	ctx = withTestAbort(ctx, e.Logger, cancel)
 	vuFlow := make(chan int64)
 	e.lock.Lock()
 	vuOut := e.vuOut
 	iterDone := e.iterDone
+	interrupted := e.iterInterrupted
 	e.ctx = ctx
 	e.flow = vuFlow
+	e.engineOut = engineOut
 	e.lock.Unlock()
 
+	var tags *stats.SampleTags
+	if e.Runner != nil {
+		tags = e.Runner.GetOptions().RunTags
+	}
+
 	var cutoff time.Time
 	defer func() {
-		if e.Runner != nil && e.runTeardown {
-			err := e.Runner.Teardown(parent, engineOut)
-			if reterr == nil {
-				reterr = err
-			} else if err != nil {
-				reterr = fmt.Errorf("Teardown error %#v\nPrevious error: %#v", err, reterr)
-			}
-		}
-
 		close(vuFlow)
 		cancel()
 
-		e.lock.Lock()
-		e.ctx = nil
-		e.vuOut = nil
-		e.flow = nil
-		e.lock.Unlock()
-
+		// Wait for all VUs to stop, and run their vuTeardown() hooks, before the teardown.
 		wait := make(chan interface{})
 		go func() {
 			e.wg.Wait()
 			close(wait)
 		}()
 
+	drain:
 		for {
 			select {
 			case <-iterDone:
 				// Spool through all remaining iterations, do not emit stats since the Run() is over
+			case cause := <-interrupted:
+				// ...but do count the ones that were cut short, whenever that happened
+				engineOut <- interruptedIteration(tags, cause)
 			case newSampleContainer := <-vuOut:
 				if cutoff.IsZero() {
 					engineOut <- newSampleContainer
@@ -214,11 +283,27 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 			}
 			select {
 			case <-wait:
-				close(vuOut)
-				return
+				break drain
 			default:
 			}
 		}
+
+		if e.Runner != nil && e.runTeardown {
+			err := e.Runner.Teardown(parent, engineOut)
+			if reterr == nil {
+				reterr = err
+			} else if err != nil {
+				reterr = fmt.Errorf("Teardown error %#v\nPrevious error: %#v", err, reterr)
+			}
+		}
+
+		e.lock.Lock()
+		e.ctx = nil
+		e.vuOut = nil
+		e.flow = nil
+		e.engineOut = nil
+		e.lock.Unlock()
+		close(vuOut)
 	}()
 
 	startVUs := atomic.LoadInt64(&e.numVUs)
@@ -274,6 +359,7 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 			at := time.Duration(atomic.AddInt64(&e.time, int64(d)))
 			if end >= 0 && at >= end {
 				e.Logger.WithFields(log.Fields{"at": at, "end": end}).Debug("Local: Hit time limit")
+				e.waitForIterations(ctx, engineOut, vuOut, iterDone, interrupted, tags)
 				cutoff = time.Now()
 				return nil
 			}
@@ -283,6 +369,7 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 				vus, keepRunning := ProcessStages(startVUs, stages, at)
 				if !keepRunning {
 					e.Logger.WithField("at", at).Debug("Local: Ran out of stages")
+					e.waitForIterations(ctx, engineOut, vuOut, iterDone, interrupted, tags)
 					cutoff = time.Now()
 					return nil
 				}
@@ -297,23 +384,14 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 		case <-iterDone:
 			// Every iteration ends with a write to iterDone. Check if we've hit the end point.
 			// If not, make sure to include an Iterations bump in the list!
-			var tags *stats.SampleTags
-			if e.Runner != nil {
-				tags = e.Runner.GetOptions().RunTags
-			}
-			engineOut <- stats.Sample{
-				Time:   time.Now(),
-				Metric: metrics.Iterations,
-				Value:  1,
-				Tags:   tags,
-			}
-
 			end := atomic.LoadInt64(&e.endIters)
-			at := atomic.AddInt64(&e.iters, 1)
+			at := e.iterationDone(engineOut, tags)
 			if end >= 0 && at >= end {
 				e.Logger.WithFields(log.Fields{"at": at, "end": end}).Debug("Local: Hit iteration limit")
 				return nil
 			}
+		case cause := <-interrupted:
+			engineOut <- interruptedIteration(tags, cause)
 		case <-ctx.Done():
 			// If the test is cancelled, just set the cutoff point to now and proceed down the same
 			// logic as if the time limit was hit.
@@ -324,6 +402,52 @@ func (e *Executor) Run(parent context.Context, engineOut chan<- stats.SampleCont
 	}
 }
 
+// Counts a completed iteration, returning the new total.
+func (e *Executor) iterationDone(engineOut chan<- stats.SampleContainer, tags *stats.SampleTags) int64 {
+	engineOut <- stats.Sample{
+		Time:   time.Now(),
+		Metric: metrics.Iterations,
+		Value:  1,
+		Tags:   tags,
+	}
+	return atomic.AddInt64(&e.iters, 1)
+}
+
+// When the test ends, lets in-flight iterations finish for up to the gracefulStop timeout, while
+// still forwarding their samples; no new iterations are started in the meantime.
+func (e *Executor) waitForIterations(
+	ctx context.Context, engineOut chan<- stats.SampleContainer, vuOut <-chan stats.SampleContainer,
+	iterDone <-chan struct{}, interrupted <-chan string, tags *stats.SampleTags,
+) {
+	timeout, _ := gracePeriods(e.Runner)
+	if timeout <= 0 || atomic.LoadInt64(&e.busyVUs) == 0 {
+		return
+	}
+	e.Logger.WithField("timeout", timeout).Debug("Local: Waiting for iterations to finish")
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(1 * time.Millisecond)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&e.busyVUs) > 0 {
+		select {
+		case sampleContainer := <-vuOut:
+			engineOut <- sampleContainer
+		case <-iterDone:
+			e.iterationDone(engineOut, tags)
+		case cause := <-interrupted:
+			engineOut <- interruptedIteration(tags, cause)
+		case <-ticker.C:
+		case <-deadline.C:
+			e.Logger.Debug("Local: Graceful stop timed out")
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func (e *Executor) scale(ctx context.Context, num int64) error {
 	e.Logger.WithField("num", num).Debug("Local: Scaling...")
 
@@ -333,39 +457,31 @@ func (e *Executor) scale(ctx context.Context, num int64) error {
 	e.lock.RLock()
 	flow := e.flow
 	iterDone := e.iterDone
+	interrupted := e.iterInterrupted
+	engineOut := e.engineOut
 	e.lock.RUnlock()
 
+	// The test is ending; there's no point starting anything, or stopping what's left.
+	if ctx.Err() != nil {
+		atomic.StoreInt64(&e.numVUs, num)
+		return nil
+	}
+
+	_, rampDown := gracePeriods(e.Runner)
 	for i, handle := range e.vus {
 		handle := handle
-		handle.RLock()
-		cancel := handle.cancel
-		handle.RUnlock()
-
+		handle.Lock()
+		var err error
 		if i < int(num) {
-			if cancel == nil {
-				vuctx, cancel := context.WithCancel(ctx)
-				handle.Lock()
-				handle.ctx = vuctx
-				handle.cancel = cancel
-				handle.Unlock()
-
-				if handle.vu != nil {
-					if err := handle.vu.Reconfigure(atomic.AddInt64(&e.nextVUID, 1)); err != nil {
-						return err
-					}
-				}
-
-				e.wg.Add(1)
-				go func() {
-					handle.run(e.Logger, flow, iterDone)
-					e.wg.Done()
-				}()
+			if handle.cancel == nil {
+				err = e.startVU(ctx, handle, flow, iterDone, interrupted, engineOut)
 			}
-		} else if cancel != nil {
-			handle.Lock()
-			handle.cancel()
-			handle.cancel = nil
-			handle.Unlock()
+		} else if handle.cancel != nil {
+			stopVU(handle, rampDown)
+		}
+		handle.Unlock()
+		if err != nil {
+			return err
 		}
 	}
 
@@ -373,6 +489,94 @@ func (e *Executor) scale(ctx context.Context, num int64) error {
 	return nil
 }
 
+// Starts running a VU; must be called with the handle locked.
+func (e *Executor) startVU(
+	ctx context.Context, handle *vuHandle, flow <-chan int64, iterDone chan<- struct{}, interrupted chan<- string,
+	engineOut chan<- stats.SampleContainer,
+) error {
+	// A VU that was ramped down, but is still finishing an iteration, can just keep going.
+	prev := handle.current
+	if prev != nil && prev.stopTimer != nil && prev.stopTimer.Stop() {
+		prev.stopTimer = nil
+		handle.cancel = prev.cancel
+		return nil
+	}
+
+	vuctx, cancel := context.WithCancel(ctx)
+	run := &vuRun{cancel: cancel, done: make(chan struct{})}
+	handle.ctx = vuctx
+	handle.cancel = cancel
+	handle.current = run
+
+	// If the previous run is still being interrupted or torn down, the VU is only free once it's
+	// done.
+	var prevDone chan struct{}
+	if prev != nil && (prev.busy || (prev.iterated && !isClosed(prev.done))) {
+		prevDone = prev.done
+	} else if handle.vu != nil {
+		if err := handle.vu.Reconfigure(atomic.AddInt64(&e.nextVUID, 1)); err != nil {
+			return err
+		}
+	}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer close(run.done)
+		if prevDone != nil {
+			<-prevDone
+			if handle.vu != nil {
+				if err := handle.vu.Reconfigure(atomic.AddInt64(&e.nextVUID, 1)); err != nil {
+					e.Logger.WithError(err).Error("Couldn't reconfigure VU")
+					return
+				}
+			}
+		}
+		handle.run(e.Logger, run, vuctx, &e.busyVUs, &e.partIters, &e.setupFails, flow, iterDone, interrupted)
+
+		handle.RLock()
+		iterated := run.iterated
+		handle.RUnlock()
+		if vu, ok := handle.vu.(lib.VUTeardowner); ok && iterated {
+			if err := vu.TeardownVU(context.Background(), engineOut); err != nil {
+				logVUError(e.Logger, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Returns whether the channel is closed, without blocking.
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// Ramps down a VU, letting an iteration in progress finish for up to the given grace period;
+// must be called with the handle locked.
+func stopVU(handle *vuHandle, grace time.Duration) {
+	run := handle.current
+	handle.cancel = nil
+	if run == nil {
+		return
+	}
+	if !run.busy || grace <= 0 {
+		run.cause = interruptedByRampDown
+		run.cancel()
+		return
+	}
+	run.stopTimer = time.AfterFunc(grace, func() {
+		handle.Lock()
+		run.cause = interruptedByRampDown
+		handle.Unlock()
+		run.cancel()
+	})
+}
+
 func (e *Executor) IsRunning() bool {
 	e.lock.RLock()
 	defer e.lock.RUnlock()
@@ -136,6 +136,184 @@ func TestExecutorSetupTeardownRun(t *testing.T) {
 	})
 }
 
+func TestExecutorTestAbort(t *testing.T) {
+	var iterations int64
+	teardownC := make(chan struct{})
+	e := New(&lib.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			if atomic.AddInt64(&iterations, 1) == 5 {
+				lib.GetTestAbort(ctx)("enough", 0)
+			}
+			return nil
+		},
+		TeardownFn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			close(teardownC)
+			return nil
+		},
+	})
+	logger, hook := logtest.NewNullLogger()
+	e.SetLogger(logger)
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.NoError(t, e.SetVUs(1))
+
+	assert.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)))
+	<-teardownC
+	assert.Equal(t, int64(5), atomic.LoadInt64(&iterations))
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, "Test aborted", hook.LastEntry().Message)
+		assert.Equal(t, "enough", hook.LastEntry().Data["reason"])
+	}
+}
+
+// Counts completed iterations, and interrupted ones by cause.
+func countIterations(samples chan stats.SampleContainer) (iterations int, interrupted map[string]int) {
+	interrupted = make(map[string]int)
+	for _, sc := range stats.GetBufferedSamples(samples) {
+		for _, s := range sc.GetSamples() {
+			switch s.Metric {
+			case metrics.Iterations:
+				iterations++
+			case metrics.InterruptedIterations:
+				cause, _ := s.Tags.Get("cause")
+				interrupted[cause]++
+			}
+		}
+	}
+	return iterations, interrupted
+}
+
+// Returns a runner whose iterations take the given time, unless they're interrupted.
+func slowIterationRunner(d time.Duration, opts lib.Options) *lib.MiniRunner {
+	return &lib.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			select {
+			case <-time.After(d):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+		Options: opts,
+	}
+}
+
+func TestExecutorGracefulStop(t *testing.T) {
+	testdata := map[string]struct {
+		GracefulStop types.NullDuration
+		Iterations   int
+		Interrupted  map[string]int
+	}{
+		"unset":   {types.NullDuration{}, 0, map[string]int{"test_end": 2}},
+		"finish":  {types.NullDurationFrom(2 * time.Second), 2, map[string]int{}},
+		"timeout": {types.NullDurationFrom(50 * time.Millisecond), 0, map[string]int{"test_end": 2}},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			e := New(slowIterationRunner(300*time.Millisecond, lib.Options{GracefulStop: data.GracefulStop}))
+			assert.NoError(t, e.SetVUsMax(2))
+			assert.NoError(t, e.SetVUs(2))
+			e.SetEndTime(types.NullDurationFrom(100 * time.Millisecond))
+
+			samples := make(chan stats.SampleContainer, 100)
+			assert.NoError(t, e.Run(context.Background(), samples))
+			iterations, interrupted := countIterations(samples)
+			assert.Equal(t, data.Iterations, iterations)
+			assert.Equal(t, data.Interrupted, interrupted)
+		})
+	}
+}
+
+func TestExecutorGracefulRampDown(t *testing.T) {
+	stages := []lib.Stage{
+		{Duration: types.NullDurationFrom(100 * time.Millisecond), Target: null.IntFrom(2), Curve: lib.StageCurveStep},
+		{Duration: types.NullDurationFrom(500 * time.Millisecond), Target: null.IntFrom(0), Curve: lib.StageCurveStep},
+	}
+	testdata := map[string]struct {
+		GracefulRampDown types.NullDuration
+		Iterations       int
+		Interrupted      map[string]int
+	}{
+		"unset":  {types.NullDuration{}, 0, map[string]int{"ramp_down": 2}},
+		"finish": {types.NullDurationFrom(2 * time.Second), 2, map[string]int{}},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			e := New(slowIterationRunner(300*time.Millisecond, lib.Options{GracefulRampDown: data.GracefulRampDown}))
+			assert.NoError(t, e.SetVUsMax(2))
+			e.SetStages(stages)
+
+			samples := make(chan stats.SampleContainer, 100)
+			assert.NoError(t, e.Run(context.Background(), samples))
+			iterations, interrupted := countIterations(samples)
+			assert.Equal(t, data.Iterations, iterations)
+			assert.Equal(t, data.Interrupted, interrupted)
+			assert.Equal(t, int64(0), e.GetVUs())
+		})
+	}
+
+	t.Run("scale back up", func(t *testing.T) {
+		// A VU that's brought back while finishing its iteration just keeps going.
+		e := New(slowIterationRunner(time.Second, lib.Options{GracefulRampDown: types.NullDurationFrom(time.Minute)}))
+		assert.NoError(t, e.SetVUsMax(1))
+		assert.NoError(t, e.SetVUs(1))
+		e.SetEndIterations(null.IntFrom(1))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		err := make(chan error, 1)
+		go func() { err <- e.Run(ctx, make(chan stats.SampleContainer, 100)) }()
+		for atomic.LoadInt64(&e.busyVUs) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		assert.NoError(t, e.SetVUs(0))
+		assert.NoError(t, e.SetVUs(1))
+		e.vus[0].RLock()
+		assert.Nil(t, e.vus[0].current.stopTimer)
+		assert.Equal(t, int64(1), e.vus[0].vu.(*lib.MiniRunnerVU).ID)
+		e.vus[0].RUnlock()
+		assert.NoError(t, <-err)
+		assert.Equal(t, int64(1), e.GetIterations())
+	})
+}
+
+func TestExecutorVUTeardown(t *testing.T) {
+	metric := stats.New("vu_teardown", stats.Counter)
+	newRunner := func(opts lib.Options) *lib.MiniRunner {
+		r := slowIterationRunner(10*time.Millisecond, opts)
+		r.VUTeardownFn = func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			out <- stats.Sample{Time: time.Now(), Metric: metric, Value: 1}
+			return nil
+		}
+		return r
+	}
+
+	t.Run("test end", func(t *testing.T) {
+		// VUs that never ran an iteration aren't torn down.
+		e := New(newRunner(lib.Options{}))
+		assert.NoError(t, e.SetVUsMax(3))
+		assert.NoError(t, e.SetVUs(2))
+		e.SetEndTime(types.NullDurationFrom(100 * time.Millisecond))
+
+		samples := make(chan stats.SampleContainer, 1000)
+		assert.NoError(t, e.Run(context.Background(), samples))
+		assert.Equal(t, 2, countSamples(samples, metric))
+	})
+	t.Run("ramp down", func(t *testing.T) {
+		e := New(newRunner(lib.Options{GracefulRampDown: types.NullDurationFrom(time.Second)}))
+		assert.NoError(t, e.SetVUsMax(2))
+		e.SetStages([]lib.Stage{
+			{Duration: types.NullDurationFrom(100 * time.Millisecond), Target: null.IntFrom(2), Curve: lib.StageCurveStep},
+			{Duration: types.NullDurationFrom(100 * time.Millisecond), Target: null.IntFrom(0), Curve: lib.StageCurveStep},
+			{Duration: types.NullDurationFrom(100 * time.Millisecond), Target: null.IntFrom(1), Curve: lib.StageCurveStep},
+		})
+
+		samples := make(chan stats.SampleContainer, 1000)
+		assert.NoError(t, e.Run(context.Background(), samples))
+		assert.Equal(t, 3, countSamples(samples, metric))
+	})
+}
+
 func TestExecutorSetLogger(t *testing.T) {
 	logger, _ := logtest.NewNullLogger()
 	e := New(nil)
@@ -288,6 +466,61 @@ func TestExecutorEndIterations(t *testing.T) {
 	}
 }
 
+func TestExecutorVUSetupError(t *testing.T) {
+	var calls int64
+	e := New(&lib.MiniRunner{Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		// Every other call fails to set up the VU, and doesn't count as an iteration.
+		if atomic.AddInt64(&calls, 1)%2 == 1 {
+			return lib.VUSetupError{Err: errors.New("nope")}
+		}
+		return nil
+	}})
+	logger, hook := logtest.NewNullLogger()
+	e.SetLogger(logger)
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.NoError(t, e.SetVUs(1))
+	e.SetEndIterations(null.IntFrom(10))
+
+	samples := make(chan stats.SampleContainer, 100)
+	assert.NoError(t, e.Run(context.Background(), samples))
+	assert.Equal(t, int64(10), e.GetIterations())
+	assert.Equal(t, int64(20), atomic.LoadInt64(&calls))
+	assert.Equal(t, 10, countSamples(samples, metrics.Iterations))
+	require.NotEmpty(t, hook.Entries)
+	assert.Equal(t, "nope", hook.LastEntry().Message)
+}
+
+func TestExecutorVUSetupAlwaysFails(t *testing.T) {
+	// A test that's only bounded by iterations is aborted if VUs keep failing to set up.
+	var calls int64
+	e := New(&lib.MiniRunner{Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		atomic.AddInt64(&calls, 1)
+		return lib.VUSetupError{Err: errors.New("nope")}
+	}})
+	logger, _ := logtest.NewNullLogger()
+	e.SetLogger(logger)
+	assert.NoError(t, e.SetVUsMax(1))
+	assert.NoError(t, e.SetVUs(1))
+	e.SetEndIterations(null.IntFrom(10))
+
+	var reason string
+	var exitCode int
+	ctx := lib.WithTestAbort(context.Background(), func(r string, code int) { reason, exitCode = r, code })
+	samples := make(chan stats.SampleContainer, 1000)
+	done := make(chan error)
+	go func() { done <- e.Run(ctx, samples) }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the test never ended")
+	}
+	assert.Equal(t, int64(0), e.GetIterations())
+	assert.True(t, atomic.LoadInt64(&calls) >= lib.MaxVUSetupFailures)
+	assert.Equal(t, "VUs failed to set up 100 times in a row", reason)
+	assert.Equal(t, lib.VUSetupErrorExitCode, exitCode)
+}
+
 func TestExecutorIsRunning(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	e := New(nil)
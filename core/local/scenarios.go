@@ -0,0 +1,411 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package local
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	null "gopkg.in/guregu/null.v3"
+)
+
+var _ lib.Executor = &ScenariosExecutor{}
+
+// ErrScenariosNoScaling is returned when trying to change the VU counts of a multi-scenario test.
+var ErrScenariosNoScaling = errors.New("VUs can't be changed for tests with multiple scenarios")
+
+// A scenarioRunner wraps a Runner so that it spawns VUs for a specific scenario, and reports
+// options adjusted for it (with the scenario's tags and arrival rate).
+type scenarioRunner struct {
+	lib.Runner
+	name     string
+	scenario lib.Scenario
+}
+
+func (r scenarioRunner) NewVU(out chan<- stats.SampleContainer) (lib.VU, error) {
+	return r.Runner.NewScenarioVU(r.name, r.scenario, out)
+}
+
+func (r scenarioRunner) GetOptions() lib.Options {
+	return r.scenario.Options(r.name, r.Runner.GetOptions())
+}
+
+type scenarioExecutor struct {
+	lib.Executor
+	name      string
+	startTime time.Duration
+}
+
+// A ScenariosExecutor runs several named scenarios concurrently, each with its own executor.
+// Setup and teardown are run once for the whole test, by the ScenariosExecutor itself.
+//
+// Because every scenario has its own VUs and timeline, the global VU count and stages can't be
+// changed; SetVUs() and SetVUsMax() always return an error, and SetStages() does nothing.
+type ScenariosExecutor struct {
+	Runner lib.Runner
+	Logger *log.Logger
+
+	runLock sync.Mutex
+
+	runSetup    bool
+	runTeardown bool
+
+	// Sorted by start time.
+	scenarios []*scenarioExecutor
+
+	time    int64 // Current time
+	endTime int64 // End test at this timestamp
+
+	pauseLock sync.RWMutex
+	pause     chan interface{}
+
+	// Lock for: ctx
+	lock sync.RWMutex
+
+	// Current context, nil if a test isn't running right now.
+	ctx context.Context
+}
+
+// NewScenarios creates a ScenariosExecutor for the given runner and scenarios. Each scenario gets
+// its own Executor or ArrivalRateExecutor, configured the same way an Engine configures the
+// executor for a test without scenarios.
+func NewScenarios(r lib.Runner, scenarios map[string]lib.Scenario) (*ScenariosExecutor, error) {
+	e := &ScenariosExecutor{
+		Runner:      r,
+		Logger:      log.StandardLogger(),
+		runSetup:    true,
+		runTeardown: true,
+		endTime:     -1,
+	}
+
+	for name, sc := range scenarios {
+		if err := sc.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "scenario '%s'", name)
+		}
+		sr := scenarioRunner{Runner: r, name: name, scenario: sc}
+
+		var ex lib.Executor
+		switch sc.GetExecutor() {
+		case lib.ScenarioExecutorArrivalRate:
+			ex = NewArrivalRate(sr)
+		default:
+			ex = New(sr)
+		}
+
+		sc = sc.WithDefaults()
+		if err := ex.SetVUsMax(sc.VUsMax.Int64); err != nil {
+			return nil, errors.Wrapf(err, "scenario '%s'", name)
+		}
+		if err := ex.SetVUs(sc.VUs.Int64); err != nil {
+			return nil, errors.Wrapf(err, "scenario '%s'", name)
+		}
+		ex.SetStages(sc.Stages)
+		ex.SetEndTime(sc.Duration)
+		ex.SetEndIterations(sc.Iterations)
+		ex.SetRunSetup(false)
+		ex.SetRunTeardown(false)
+
+		e.scenarios = append(e.scenarios, &scenarioExecutor{
+			Executor:  ex,
+			name:      name,
+			startTime: time.Duration(sc.StartTime.Duration),
+		})
+	}
+	sort.Slice(e.scenarios, func(i, j int) bool {
+		if e.scenarios[i].startTime == e.scenarios[j].startTime {
+			return e.scenarios[i].name < e.scenarios[j].name
+		}
+		return e.scenarios[i].startTime < e.scenarios[j].startTime
+	})
+
+	return e, nil
+}
+
+// GetScenarioExecutor returns the executor for the named scenario, or nil if there's none.
+func (e *ScenariosExecutor) GetScenarioExecutor(name string) lib.Executor {
+	for _, s := range e.scenarios {
+		if s.name == name {
+			return s.Executor
+		}
+	}
+	return nil
+}
+
+func (e *ScenariosExecutor) Run(parent context.Context, engineOut chan<- stats.SampleContainer) (reterr error) {
+	e.runLock.Lock()
+	defer e.runLock.Unlock()
+
+	parent = withExecutionInfo(parent, e)
+	if e.Runner != nil && e.runSetup {
+		if err := e.Runner.Setup(parent, engineOut); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	ctx = withTestAbort(ctx, e.Logger, cancel)
+	e.lock.Lock()
+	e.ctx = ctx
+	e.lock.Unlock()
+
+	var wg sync.WaitGroup
+	errC := make(chan error, len(e.scenarios))
+	defer func() {
+		cancel()
+		wg.Wait()
+
+		if e.Runner != nil && e.runTeardown {
+			err := e.Runner.Teardown(parent, engineOut)
+			if reterr == nil {
+				reterr = err
+			} else if err != nil {
+				reterr = fmt.Errorf("Teardown error %#v\nPrevious error: %#v", err, reterr)
+			}
+		}
+
+		e.lock.Lock()
+		e.ctx = nil
+		e.lock.Unlock()
+	}()
+
+	pending := e.scenarios
+	running := 0
+
+	ticker := time.NewTicker(1 * time.Millisecond)
+	defer ticker.Stop()
+
+	lastTick := time.Now()
+	for {
+		// Start all scenarios that are due.
+		at := time.Duration(atomic.LoadInt64(&e.time))
+		for len(pending) > 0 && pending[0].startTime <= at {
+			s := pending[0]
+			pending = pending[1:]
+			e.Logger.WithFields(log.Fields{"scenario": s.name, "at": at}).Debug("Scenarios: Starting")
+
+			running++
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.Run(ctx, engineOut)
+				errC <- errors.Wrapf(err, "scenario '%s'", s.name)
+			}()
+		}
+		if running == 0 && len(pending) == 0 {
+			e.Logger.Debug("Scenarios: All scenarios finished")
+			return nil
+		}
+
+		// If the test is paused, sleep until either the pause or the test ends. The scenarios
+		// are paused as well, so they don't need to be told about it.
+		e.pauseLock.RLock()
+		pause := e.pause
+		e.pauseLock.RUnlock()
+		if pause != nil {
+			e.Logger.Debug("Scenarios: Pausing!")
+			leftovers := time.Since(lastTick)
+			select {
+			case <-pause:
+				e.Logger.Debug("Scenarios: No longer paused")
+				lastTick = time.Now().Add(-leftovers)
+			case <-ctx.Done():
+				e.Logger.Debug("Scenarios: Terminated while in paused state")
+				return nil
+			}
+		}
+
+		select {
+		case t := <-ticker.C:
+			d := t.Sub(lastTick)
+			lastTick = t
+
+			end := time.Duration(atomic.LoadInt64(&e.endTime))
+			at := time.Duration(atomic.AddInt64(&e.time, int64(d)))
+			if end >= 0 && at >= end {
+				e.Logger.WithFields(log.Fields{"at": at, "end": end}).Debug("Scenarios: Hit time limit")
+				return nil
+			}
+		case err := <-errC:
+			running--
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			e.Logger.Debug("Scenarios: Exiting with context")
+			return nil
+		}
+	}
+}
+
+func (e *ScenariosExecutor) IsRunning() bool {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.ctx != nil
+}
+
+func (e *ScenariosExecutor) GetRunner() lib.Runner {
+	return e.Runner
+}
+
+func (e *ScenariosExecutor) SetLogger(l *log.Logger) {
+	e.Logger = l
+	for _, s := range e.scenarios {
+		s.SetLogger(l)
+	}
+}
+
+func (e *ScenariosExecutor) GetLogger() *log.Logger {
+	return e.Logger
+}
+
+// GetStages always returns nil; every scenario has its own stages.
+func (e *ScenariosExecutor) GetStages() []lib.Stage {
+	return nil
+}
+
+// SetStages does nothing; every scenario has its own stages.
+func (e *ScenariosExecutor) SetStages(s []lib.Stage) {}
+
+// GetIterations returns the number of iterations completed by all scenarios.
+func (e *ScenariosExecutor) GetIterations() (iters int64) {
+	for _, s := range e.scenarios {
+		iters += s.GetIterations()
+	}
+	return iters
+}
+
+// GetEndIterations returns the total number of iterations the test will run for, if every
+// scenario is bound by an iteration count alone.
+func (e *ScenariosExecutor) GetEndIterations() null.Int {
+	var total int64
+	for _, s := range e.scenarios {
+		end := s.GetEndIterations()
+		if !end.Valid || s.GetEndTime().Valid || len(s.GetStages()) > 0 {
+			return null.Int{}
+		}
+		total += end.Int64
+	}
+	return null.IntFrom(total)
+}
+
+// SetEndIterations does nothing; every scenario has its own iteration count.
+func (e *ScenariosExecutor) SetEndIterations(i null.Int) {}
+
+func (e *ScenariosExecutor) GetTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&e.time))
+}
+
+// GetEndTime returns when the test will end: either the time limit set with SetEndTime(), or
+// when the last scenario is scheduled to end, if all of them have a known duration.
+func (e *ScenariosExecutor) GetEndTime() types.NullDuration {
+	if v := atomic.LoadInt64(&e.endTime); v >= 0 {
+		return types.NullDurationFrom(time.Duration(v))
+	}
+
+	var end time.Duration
+	for _, s := range e.scenarios {
+		d := s.GetEndTime()
+		if stagesEnd := lib.SumStages(s.GetStages()); !d.Valid || (stagesEnd.Valid && stagesEnd.Duration < d.Duration) {
+			d = stagesEnd
+		}
+		if !d.Valid {
+			return types.NullDuration{}
+		}
+		if sEnd := s.startTime + time.Duration(d.Duration); sEnd > end {
+			end = sEnd
+		}
+	}
+	return types.NullDurationFrom(end)
+}
+
+// SetEndTime sets a time limit for the whole test, on top of the scenarios' own.
+func (e *ScenariosExecutor) SetEndTime(t types.NullDuration) {
+	if !t.Valid {
+		t.Duration = -1
+	}
+	e.Logger.WithField("d", t.Duration).Debug("Scenarios: Setting end time")
+	atomic.StoreInt64(&e.endTime, int64(t.Duration))
+}
+
+func (e *ScenariosExecutor) IsPaused() bool {
+	e.pauseLock.RLock()
+	defer e.pauseLock.RUnlock()
+	return e.pause != nil
+}
+
+func (e *ScenariosExecutor) SetPaused(paused bool) {
+	e.Logger.WithField("paused", paused).Debug("Scenarios: Setting paused")
+	e.pauseLock.Lock()
+	defer e.pauseLock.Unlock()
+
+	if paused && e.pause == nil {
+		e.pause = make(chan interface{})
+	} else if !paused && e.pause != nil {
+		close(e.pause)
+		e.pause = nil
+	}
+	for _, s := range e.scenarios {
+		s.SetPaused(paused)
+	}
+}
+
+// GetVUs returns the number of active VUs across all scenarios.
+func (e *ScenariosExecutor) GetVUs() (vus int64) {
+	for _, s := range e.scenarios {
+		vus += s.GetVUs()
+	}
+	return vus
+}
+
+// SetVUs always returns ErrScenariosNoScaling.
+func (e *ScenariosExecutor) SetVUs(vus int64) error {
+	return ErrScenariosNoScaling
+}
+
+// GetVUsMax returns the number of allocated VUs across all scenarios.
+func (e *ScenariosExecutor) GetVUsMax() (max int64) {
+	for _, s := range e.scenarios {
+		max += s.GetVUsMax()
+	}
+	return max
+}
+
+// SetVUsMax always returns ErrScenariosNoScaling.
+func (e *ScenariosExecutor) SetVUsMax(max int64) error {
+	return ErrScenariosNoScaling
+}
+
+func (e *ScenariosExecutor) SetRunSetup(r bool) {
+	e.runSetup = r
+}
+
+func (e *ScenariosExecutor) SetRunTeardown(r bool) {
+	e.runTeardown = r
+}
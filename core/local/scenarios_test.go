@@ -0,0 +1,155 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package local
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestNewScenarios(t *testing.T) {
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := NewScenarios(&lib.MiniRunner{}, map[string]lib.Scenario{
+			"bad": {Executor: null.StringFrom("nope")},
+		})
+		assert.EqualError(t, err, "scenario 'bad': unknown executor: nope")
+	})
+	t.Run("Defaults", func(t *testing.T) {
+		e, err := NewScenarios(&lib.MiniRunner{}, map[string]lib.Scenario{
+			"once": {},
+			"ramp": {Stages: []lib.Stage{
+				{Duration: types.NullDurationFrom(1 * time.Second), Target: null.IntFrom(5)},
+			}},
+			"rate": {
+				Executor:    null.StringFrom(lib.ScenarioExecutorArrivalRate),
+				ArrivalRate: null.IntFrom(10),
+				VUsMax:      null.IntFrom(3),
+				Duration:    types.NullDurationFrom(2 * time.Second),
+				StartTime:   types.NullDurationFrom(1 * time.Second),
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1+5+3), e.GetVUsMax())
+
+		once := e.GetScenarioExecutor("once")
+		require.NotNil(t, once)
+		assert.Equal(t, null.IntFrom(1), once.GetEndIterations())
+		assert.IsType(t, &ArrivalRateExecutor{}, e.GetScenarioExecutor("rate"))
+		assert.Nil(t, e.GetScenarioExecutor("nope"))
+
+		// Neither is known up front, since "once" is bound by iterations and the others by time.
+		assert.False(t, e.GetEndIterations().Valid)
+		assert.False(t, e.GetEndTime().Valid)
+	})
+	t.Run("EndTime", func(t *testing.T) {
+		e, err := NewScenarios(&lib.MiniRunner{}, map[string]lib.Scenario{
+			"ramp": {Stages: []lib.Stage{
+				{Duration: types.NullDurationFrom(1 * time.Second), Target: null.IntFrom(5)},
+			}},
+			"rate": {
+				Executor:    null.StringFrom(lib.ScenarioExecutorArrivalRate),
+				ArrivalRate: null.IntFrom(10),
+				Duration:    types.NullDurationFrom(2 * time.Second),
+				StartTime:   types.NullDurationFrom(1 * time.Second),
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, types.NullDurationFrom(3*time.Second), e.GetEndTime())
+	})
+}
+
+func TestScenariosExecutorRun(t *testing.T) {
+	var count, setups, teardowns int64
+	r := &lib.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			atomic.AddInt64(&count, 1)
+			return nil
+		},
+		SetupFn: func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error) {
+			atomic.AddInt64(&setups, 1)
+			return nil, nil
+		},
+		TeardownFn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			atomic.AddInt64(&teardowns, 1)
+			return nil
+		},
+	}
+	e, err := NewScenarios(r, map[string]lib.Scenario{
+		"first":  {VUs: null.IntFrom(2), Iterations: null.IntFrom(10)},
+		"second": {Iterations: null.IntFrom(5), StartTime: types.NullDurationFrom(50 * time.Millisecond)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, null.IntFrom(15), e.GetEndIterations())
+
+	start := time.Now()
+	assert.NoError(t, e.Run(context.Background(), make(chan stats.SampleContainer, 100)))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	assert.False(t, e.IsRunning())
+
+	assert.Equal(t, int64(15), atomic.LoadInt64(&count))
+	assert.Equal(t, int64(15), e.GetIterations())
+	assert.Equal(t, int64(1), atomic.LoadInt64(&setups))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&teardowns))
+}
+
+func TestScenariosExecutorEndTime(t *testing.T) {
+	e, err := NewScenarios(&lib.MiniRunner{}, map[string]lib.Scenario{
+		"forever": {Duration: types.NullDurationFrom(1 * time.Hour)},
+	})
+	require.NoError(t, err)
+	e.SetEndTime(types.NullDurationFrom(100 * time.Millisecond))
+	assert.Equal(t, types.NullDurationFrom(100*time.Millisecond), e.GetEndTime())
+
+	// Iterations are instant, so keep the samples flowing.
+	samples := make(chan stats.SampleContainer, 100)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-samples:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	assert.NoError(t, e.Run(context.Background(), samples))
+	assert.True(t, time.Since(start) < 1*time.Second)
+}
+
+func TestScenariosExecutorSetVUs(t *testing.T) {
+	e, err := NewScenarios(&lib.MiniRunner{}, map[string]lib.Scenario{"s": {}})
+	require.NoError(t, err)
+	assert.Equal(t, ErrScenariosNoScaling, e.SetVUs(10))
+	assert.Equal(t, ErrScenariosNoScaling, e.SetVUsMax(10))
+	assert.Equal(t, int64(1), e.GetVUsMax())
+}
@@ -21,22 +21,112 @@
 package local
 
 import (
+	"context"
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	log "github.com/sirupsen/logrus"
 	"gopkg.in/guregu/null.v3"
 )
 
+// Lets VUs abort the test by cancelling the executor's context, which ends it the same way as
+// reaching its duration does, teardown included. If the context already has a TestAbortFunc, it's
+// called first, and left to log the abort: that's an enclosing executor, eg. for scenarios, which
+// aborts the whole test, or whatever runs the executor and wants to know about it.
+func withTestAbort(ctx context.Context, logger *log.Logger, cancel context.CancelFunc) context.Context {
+	outer := lib.GetTestAbort(ctx)
+	return lib.WithTestAbort(ctx, func(reason string, exitCode int) {
+		if outer != nil {
+			outer(reason, exitCode)
+		} else {
+			logger.WithField("reason", reason).Info("Test aborted")
+		}
+		cancel()
+	})
+}
+
+// Tells VUs about the test they're running. If the context already has an ExecutionInfo, it's from
+// an enclosing executor, eg. for scenarios, which is the one running the whole test.
+func withExecutionInfo(ctx context.Context, e lib.Executor) context.Context {
+	info := lib.ExecutionInfo{Test: e, StartTime: time.Now(), Current: e}
+	if outer := lib.GetExecutionInfo(ctx); outer != nil {
+		info.Test, info.StartTime = outer.Test, outer.StartTime
+	}
+	return lib.WithExecutionInfo(ctx, info)
+}
+
+// Counts vuSetup() failures in a row, across all of an executor's VUs, and aborts the test when
+// there are too many; a successful RunOnce resets the count.
+type setupFailures struct {
+	n int64
+}
+
+// Records the outcome of a RunOnce call, returning whether the VU failed to set up.
+func (f *setupFailures) track(ctx context.Context, err error) bool {
+	if _, ok := err.(lib.VUSetupError); !ok {
+		atomic.StoreInt64(&f.n, 0)
+		return false
+	}
+	if atomic.AddInt64(&f.n, 1) == lib.MaxVUSetupFailures {
+		if abort := lib.GetTestAbort(ctx); abort != nil {
+			abort(fmt.Sprintf("VUs failed to set up %d times in a row", lib.MaxVUSetupFailures), lib.VUSetupErrorExitCode)
+		}
+	}
+	return true
+}
+
+// Logs an error returned by a VU, preferring its String() if it has one, eg. for JS exceptions.
+func logVUError(logger *log.Logger, err error) {
+	if s, ok := err.(fmt.Stringer); ok {
+		logger.Error(s.String())
+	} else {
+		logger.Error(err.Error())
+	}
+}
+
+// Causes of interrupted iterations, used as the "cause" tag of interrupted_iterations samples.
+const (
+	interruptedByTestEnd  = "test_end"
+	interruptedByRampDown = "ramp_down"
+)
+
+// Returns a sample counting an iteration that was interrupted for the given cause.
+func interruptedIteration(runTags *stats.SampleTags, cause string) stats.Sample {
+	tags := runTags.CloneTags()
+	tags["cause"] = cause
+	return stats.Sample{
+		Time:   time.Now(),
+		Metric: metrics.InterruptedIterations,
+		Value:  1,
+		Tags:   stats.IntoSampleTags(&tags),
+	}
+}
+
+// Returns how long in-flight iterations get to finish when the test ends, and when their VU is
+// ramped down, according to the runner's gracefulStop and gracefulRampDown options.
+func gracePeriods(r lib.Runner) (stop, rampDown time.Duration) {
+	if r == nil {
+		return 0, 0
+	}
+	opts := r.GetOptions()
+	return time.Duration(opts.GracefulStop.Duration), time.Duration(opts.GracefulRampDown.Duration)
+}
+
 // Returns the VU count and whether to keep going at the specified time.
 func ProcessStages(startVUs int64, stages []lib.Stage, t time.Duration) (null.Int, bool) {
 	vus := null.NewInt(startVUs, false)
 
 	var start time.Duration
 	for _, stage := range stages {
-		// Infinite stages keep running forever, with the last valid end point, or its own target.
+		// Infinite stages keep running forever, following their curve from the last valid end
+		// point; for anything but a sine, that means going straight to its target.
 		if !stage.Duration.Valid {
-			if stage.Target.Valid {
-				vus = stage.Target
+			if v, ok := stage.ValueAt(vus.Int64, t-start); ok {
+				vus = null.IntFrom(v)
 			}
 			return vus, true
 		}
@@ -44,17 +134,16 @@ func ProcessStages(startVUs int64, stages []lib.Stage, t time.Duration) (null.In
 		// If the stage has already ended, still record the end VU count for interpolation.
 		end := start + time.Duration(stage.Duration.Duration)
 		if end < t {
-			if stage.Target.Valid {
-				vus = stage.Target
+			if v, ok := stage.ValueAt(vus.Int64, time.Duration(stage.Duration.Duration)); ok {
+				vus = null.IntFrom(v)
 			}
 			start = end
 			continue
 		}
 
-		// If there's a VU target, use linear interpolation to reach it.
-		if stage.Target.Valid {
-			prog := lib.Clampf(float64(t-start)/float64(stage.Duration.Duration), 0.0, 1.0)
-			vus = null.IntFrom(lib.Lerp(vus.Int64, stage.Target.Int64, prog))
+		// If there's a VU target, follow the stage's curve to reach it.
+		if v, ok := stage.ValueAt(vus.Int64, t-start); ok {
+			vus = null.IntFrom(v)
 		}
 
 		// We found a stage, so keep running.
@@ -21,15 +21,52 @@
 package local
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/types"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	null "gopkg.in/guregu/null.v3"
 )
 
+func TestWithTestAbort(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	outerCtx, outerCancel := context.WithCancel(context.Background())
+	defer outerCancel()
+	outerCtx = withTestAbort(outerCtx, logger, outerCancel)
+	ctx, cancel := context.WithCancel(outerCtx)
+	defer cancel()
+	ctx = withTestAbort(ctx, logger, cancel)
+
+	lib.GetTestAbort(ctx)("enough", 3)
+	assert.Error(t, outerCtx.Err())
+	assert.Error(t, ctx.Err())
+	if assert.Len(t, hook.Entries, 1) {
+		assert.Equal(t, "Test aborted", hook.LastEntry().Message)
+		assert.Equal(t, "enough", hook.LastEntry().Data["reason"])
+	}
+}
+
+func TestWithExecutionInfo(t *testing.T) {
+	outer, inner := New(nil), New(nil)
+	ctx := withExecutionInfo(context.Background(), outer)
+	info := lib.GetExecutionInfo(ctx)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, outer, info.Test)
+		assert.Equal(t, outer, info.Current)
+	}
+
+	innerInfo := lib.GetExecutionInfo(withExecutionInfo(ctx, inner))
+	if assert.NotNil(t, innerInfo) {
+		assert.Equal(t, outer, innerInfo.Test)
+		assert.Equal(t, info.StartTime, innerInfo.StartTime)
+		assert.Equal(t, inner, innerInfo.Current)
+	}
+}
+
 func TestProcessStages(t *testing.T) {
 	type checkpoint struct {
 		D    time.Duration
@@ -278,6 +315,43 @@ func TestProcessStages(t *testing.T) {
 				{365 * 24 * time.Hour, true, null.NewInt(0, false)},
 			},
 		},
+		"curves": {
+			0,
+			[]lib.Stage{
+				{Duration: types.NullDurationFrom(10 * time.Second), Target: null.IntFrom(100), Curve: lib.StageCurveStep},
+				{Duration: types.NullDurationFrom(10 * time.Second), Target: null.IntFrom(200), Curve: lib.StageCurveExponential},
+				{Duration: types.NullDurationFrom(20 * time.Second), Target: null.IntFrom(300), Curve: lib.StageCurveSine},
+				{
+					Duration: types.NullDurationFrom(10 * time.Second), Target: null.IntFrom(0), Curve: lib.StageCurvePoints,
+					Points: []lib.StagePoint{{At: types.Duration(5 * time.Second), Target: 50}},
+				},
+			},
+			[]checkpoint{
+				{0 * time.Second, true, null.NewInt(100, true)},
+				{10 * time.Second, true, null.NewInt(100, true)},
+				{15 * time.Second, true, null.NewInt(124, true)},
+				{20 * time.Second, true, null.NewInt(200, true)},
+				{25 * time.Second, true, null.NewInt(250, true)},
+				{30 * time.Second, true, null.NewInt(300, true)},
+				{40 * time.Second, true, null.NewInt(200, true)},
+				{42500 * time.Millisecond, true, null.NewInt(125, true)},
+				{45 * time.Second, true, null.NewInt(50, true)},
+				{47500 * time.Millisecond, true, null.NewInt(25, true)},
+				{50 * time.Second, true, null.NewInt(0, true)},
+				{51 * time.Second, false, null.NewInt(0, true)},
+			},
+		},
+		"infinite/sine": {
+			0,
+			[]lib.Stage{{Target: null.IntFrom(10), Curve: lib.StageCurveSine, Period: types.Duration(4 * time.Second)}},
+			[]checkpoint{
+				{0 * time.Second, true, null.NewInt(0, true)},
+				{1 * time.Second, true, null.NewInt(5, true)},
+				{2 * time.Second, true, null.NewInt(10, true)},
+				{4 * time.Second, true, null.NewInt(0, true)},
+				{1 * time.Hour, true, null.NewInt(0, true)},
+			},
+		},
 	}
 	for name, data := range testdata {
 		t.Run(name, func(t *testing.T) {
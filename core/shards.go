@@ -0,0 +1,96 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package core
+
+import (
+	"sync"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// A sampleShard owns the sinks of a subset of the engine's metrics. Every metric belongs to a
+// single shard, so its sink and thresholds are only ever updated by one goroutine at a time, in
+// the order the samples came in, while different shards are updated in parallel.
+type sampleShard struct {
+	samples []shardSample
+
+	// Submetrics that received their first sample in the current batch; they're created by the
+	// shard, but only added to the engine's metrics once all shards are done.
+	added []*stats.Metric
+}
+
+// A sample along with the engine-side metric it's aggregated into.
+type shardSample struct {
+	metric *stats.Metric
+	sample stats.Sample
+}
+
+// Where the samples of a metric are aggregated.
+type shardedMetric struct {
+	metric *stats.Metric
+	shard  *sampleShard
+}
+
+func newSampleShards(n int) []*sampleShard {
+	if n < 1 {
+		n = 1
+	}
+	shards := make([]*sampleShard, n)
+	for i := range shards {
+		shards[i] = &sampleShard{}
+	}
+	return shards
+}
+
+// Aggregates the queued samples, then empties the queue, keeping its memory for the next batch.
+func (s *sampleShard) process(e *Engine) {
+	for _, ss := range s.samples {
+		s.added = e.aggregator.Add(ss.metric, ss.sample, s.added)
+	}
+
+	for i := range s.samples {
+		s.samples[i] = shardSample{}
+	}
+	s.samples = s.samples[:0]
+}
+
+// Processes all shards with queued samples in parallel, and waits for them to finish.
+func processSampleShards(e *Engine, shards []*sampleShard) {
+	var wg sync.WaitGroup
+	var last *sampleShard
+	for _, s := range shards {
+		if len(s.samples) == 0 {
+			continue
+		}
+		if last != nil {
+			wg.Add(1)
+			go func(s *sampleShard) {
+				defer wg.Done()
+				s.process(e)
+			}(last)
+		}
+		last = s
+	}
+	// No need for another goroutine for the last one, we'd just be waiting for it anyway.
+	if last != nil {
+		last.process(e)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,164 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Generates the samples a batch of HTTP requests would emit.
+func getRequestSamples(count int, seed int64) []stats.SampleContainer {
+	r := rand.New(rand.NewSource(seed))
+	trends := []*stats.Metric{
+		metrics.HTTPReqDuration, metrics.HTTPReqBlocked, metrics.HTTPReqConnecting,
+		metrics.HTTPReqTLSHandshaking, metrics.HTTPReqSending, metrics.HTTPReqWaiting,
+		metrics.HTTPReqReceiving,
+	}
+	statuses := []string{"200", "200", "200", "404", "500"}
+
+	containers := make([]stats.SampleContainer, count)
+	now := time.Now()
+	for i := range containers {
+		tags := stats.IntoSampleTags(&map[string]string{
+			"method": "GET",
+			"url":    fmt.Sprintf("https://example.com/%d", i%10),
+			"status": statuses[r.Intn(len(statuses))],
+		})
+		samples := []stats.Sample{
+			{Metric: metrics.HTTPReqs, Time: now, Tags: tags, Value: 1},
+			{Metric: metrics.DataSent, Time: now, Tags: tags, Value: float64(r.Intn(1000))},
+			{Metric: metrics.DataReceived, Time: now, Tags: tags, Value: float64(r.Intn(100000))},
+		}
+		for _, m := range trends {
+			samples = append(samples, stats.Sample{Metric: m, Time: now, Tags: tags, Value: r.Float64() * 1000})
+		}
+		containers[i] = stats.ConnectedSamples{Samples: samples, Tags: tags, Time: now}
+	}
+	return containers
+}
+
+func newShardedTestEngine(tb testing.TB, shards int) *Engine {
+	thresholds := map[string]stats.Thresholds{}
+	for _, name := range []string{
+		"http_req_duration", "http_req_duration{status:200}", "http_req_waiting{status:500}",
+		"http_reqs{status:404}", "data_received{url:https://example.com/3}",
+	} {
+		ths, err := stats.NewThresholds([]string{"p(95)<900"})
+		require.NoError(tb, err)
+		thresholds[name] = ths
+	}
+
+	e, err, _ := newTestEngine(nil, lib.Options{Thresholds: thresholds})
+	require.NoError(tb, err)
+	e.shards = newSampleShards(shards)
+	return e
+}
+
+// How samples were processed before they were split into shards: every metric in turn, on the
+// calling goroutine. It's only kept as a reference to compare the shards against.
+func processSamplesUnsharded(e *Engine, sampleContainers []stats.SampleContainer) {
+	e.MetricsLock.Lock()
+	defer e.MetricsLock.Unlock()
+
+	var added []*stats.Metric
+	for _, sc := range sampleContainers {
+		for _, sample := range sc.GetSamples() {
+			m, ok := e.Metrics[sample.Metric.Name]
+			if !ok {
+				m = e.aggregator.NewMetric(sample.Metric)
+				e.Metrics[m.Name] = m
+			}
+			added = e.aggregator.Add(m, sample, added[:0])
+			for _, sm := range added {
+				e.Metrics[sm.Name] = sm
+			}
+		}
+	}
+}
+
+func TestProcessSamplesSharded(t *testing.T) {
+	batches := [][]stats.SampleContainer{}
+	for i := int64(0); i < 5; i++ {
+		batches = append(batches, getRequestSamples(200, i))
+	}
+
+	summarize := func(shards int) map[string]string {
+		e := newShardedTestEngine(t, shards)
+		for _, batch := range batches {
+			if shards == 0 {
+				processSamplesUnsharded(e, batch)
+			} else {
+				e.processSamples(batch)
+			}
+		}
+		e.processThresholds(nil)
+
+		summary := map[string]string{}
+		for name, m := range e.Metrics {
+			summary[name] = fmt.Sprintf("%v tainted=%v", m.Sink.Format(time.Second), m.Tainted)
+		}
+		return summary
+	}
+
+	// The results are the same as without shards, however many there are.
+	expected := summarize(0)
+	assert.Len(t, expected, 14)
+	assert.Contains(t, expected, "http_req_duration{status:200}")
+	for _, shards := range []int{1, 2, 3, 4, 16} {
+		assert.Equal(t, expected, summarize(shards), "%d shards", shards)
+	}
+}
+
+func BenchmarkProcessSamples(b *testing.B) {
+	shardCounts := []int{1, 2, 4}
+	if n := runtime.GOMAXPROCS(0); n > 4 {
+		shardCounts = append(shardCounts, n)
+	}
+
+	for _, count := range []int{100, 1000, 5000} {
+		batch := getRequestSamples(count, 1)
+		b.Run(fmt.Sprintf("%d-requests-unsharded", count), func(b *testing.B) {
+			e := newShardedTestEngine(b, 1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				processSamplesUnsharded(e, batch)
+			}
+		})
+		for _, shards := range shardCounts {
+			b.Run(fmt.Sprintf("%d-requests-%d-shards", count, shards), func(b *testing.B) {
+				e := newShardedTestEngine(b, shards)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					e.processSamples(batch)
+				}
+			})
+		}
+	}
+}
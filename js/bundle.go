@@ -24,6 +24,7 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"time"
 
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
@@ -35,6 +36,10 @@ import (
 	"github.com/spf13/afero"
 )
 
+// How long the init code's timers and asynchronous operations have to finish, so that eg. an
+// interval that's never cleared fails the script instead of hanging it. It's a variable for tests.
+var initTimeout = 1 * time.Minute
+
 // A Bundle is a self-contained bundle of scripts and resources.
 // You can use this to produce identical BundleInstance objects.
 type Bundle struct {
@@ -53,6 +58,10 @@ type BundleInstance struct {
 	Runtime *goja.Runtime
 	Context *context.Context
 	Default goja.Callable
+
+	// The instance's event loop, and the timers that use it.
+	Loop   *common.EventLoop
+	Timers *Timers
 }
 
 // NewBundle creates a new bundle from a source file and a filesystem.
@@ -84,7 +93,7 @@ func NewBundle(src *lib.SourceData, fs afero.Fs, rtOpts lib.RuntimeOptions) (*Bu
 		BaseInitContext: NewInitContext(rt, compiler, new(context.Context), cachedFS, loader.Dir(src.Filename)),
 		Env:             rtOpts.Env,
 	}
-	if err := bundle.instantiate(rt, bundle.BaseInitContext); err != nil {
+	if err := bundle.instantiate(rt, NewTimers(common.NewEventLoop()), bundle.BaseInitContext, bundle.Env); err != nil {
 		return nil, err
 	}
 
@@ -95,20 +104,17 @@ func NewBundle(src *lib.SourceData, fs afero.Fs, rtOpts lib.RuntimeOptions) (*Bu
 	}
 	exports := exportsV.ToObject(rt)
 
-	// Validate the default function.
-	def := exports.Get("default")
-	if def == nil || goja.IsNull(def) || goja.IsUndefined(def) {
-		return nil, errors.New("script must export a default function")
-	}
-	if _, ok := goja.AssertFunction(def); !ok {
-		return nil, errors.New("default export must be a function")
-	}
-
-	// Extract/validate other exports.
+	// Extract/validate exports.
 	for _, k := range exports.Keys() {
 		v := exports.Get(k)
 		switch k {
-		case "default": // Already checked above.
+		case "default":
+			if v == nil || goja.IsNull(v) || goja.IsUndefined(v) {
+				continue // Checked below, it's only required if there are no scenarios.
+			}
+			if _, ok := goja.AssertFunction(v); !ok {
+				return nil, errors.New("default export must be a function")
+			}
 		case "options":
 			data, err := json.Marshal(v.Export())
 			if err != nil {
@@ -125,8 +131,31 @@ func NewBundle(src *lib.SourceData, fs afero.Fs, rtOpts lib.RuntimeOptions) (*Bu
 			if _, ok := goja.AssertFunction(v); !ok {
 				return nil, errors.New("exported 'teardown' must be a function")
 			}
+		case "vuSetup", "vuTeardown":
+			if _, ok := goja.AssertFunction(v); !ok {
+				return nil, errors.Errorf("exported '%s' must be a function", k)
+			}
+		case "handleSummary":
+			if _, ok := goja.AssertFunction(v); !ok {
+				return nil, errors.New("exported 'handleSummary' must be a function")
+			}
+		}
+	}
+
+	// The default function may only be omitted if all scenarios run other exported functions.
+	needsDefault := len(bundle.Options.Scenarios) == 0
+	for name, sc := range bundle.Options.Scenarios {
+		if !sc.Exec.Valid {
+			needsDefault = true
+			continue
+		}
+		if _, ok := goja.AssertFunction(exports.Get(sc.Exec.String)); !ok {
+			return nil, errors.Errorf("scenario '%s': exported function '%s' not found", name, sc.Exec.String)
 		}
 	}
+	if def := exports.Get("default"); needsDefault && (def == nil || goja.IsNull(def) || goja.IsUndefined(def)) {
+		return nil, errors.New("script must export a default function")
+	}
 
 	return &bundle, nil
 }
@@ -197,7 +226,24 @@ func (b *Bundle) makeArchive() *lib.Archive {
 }
 
 // Instantiate creates a new runtime from this bundle.
-func (b *Bundle) Instantiate() (bi *BundleInstance, instErr error) {
+func (b *Bundle) Instantiate() (*BundleInstance, error) {
+	return b.InstantiateWithEnv(nil)
+}
+
+// InstantiateWithEnv creates a new runtime from this bundle, with the given environment variables
+// added to (and overriding) the bundle's own.
+func (b *Bundle) InstantiateWithEnv(extraEnv map[string]string) (bi *BundleInstance, instErr error) {
+	env := b.Env
+	if len(extraEnv) > 0 {
+		env = make(map[string]string, len(b.Env)+len(extraEnv))
+		for k, v := range b.Env {
+			env[k] = v
+		}
+		for k, v := range extraEnv {
+			env[k] = v
+		}
+	}
+
 	// Placeholder for a real context.
 	ctxPtr := new(context.Context)
 
@@ -205,16 +251,15 @@ func (b *Bundle) Instantiate() (bi *BundleInstance, instErr error) {
 	// runtime, but no state, to allow module-provided types to function within the init context.
 	rt := goja.New()
 	init := newBoundInitContext(b.BaseInitContext, ctxPtr, rt)
-	if err := b.instantiate(rt, init); err != nil {
+	timers := NewTimers(common.NewEventLoop())
+	if err := b.instantiate(rt, timers, init, env); err != nil {
 		return nil, err
 	}
 
-	// Grab the default function; type is already checked in NewBundle().
+	// Grab the default function; type is already checked in NewBundle(), but it may be missing
+	// if all scenarios run other functions.
 	exports := rt.Get("exports").ToObject(rt)
-	def, ok := goja.AssertFunction(exports.Get("default"))
-	if !ok || def == nil {
-		panic("exported default is not a function")
-	}
+	def, _ := goja.AssertFunction(exports.Get("default"))
 
 	jsOptions := rt.Get("options")
 	var jsOptionsObj *goja.Object
@@ -234,18 +279,27 @@ func (b *Bundle) Instantiate() (bi *BundleInstance, instErr error) {
 		Runtime: rt,
 		Context: ctxPtr,
 		Default: def,
+		Loop:    timers.loop,
+		Timers:  timers,
 	}, instErr
 }
 
 // Instantiates the bundle into an existing runtime. Not public because it also messes with a bunch
 // of other things, will potentially thrash data and makes a mess in it if the operation fails.
-func (b *Bundle) instantiate(rt *goja.Runtime, init *InitContext) error {
+// The init code runs in the timers' event loop, so any async work it starts is done by the end,
+// unless it takes longer than initTimeout.
+func (b *Bundle) instantiate(rt *goja.Runtime, timers *Timers, init *InitContext, env map[string]string) error {
 	rt.SetFieldNameMapper(common.FieldNameMapper{})
 	rt.SetRandSource(common.NewRandSource())
 
+	// Timers go first, so core-js' Promise schedules its callbacks with setImmediate().
+	common.BindToGlobal(rt, timers.Exports(rt))
 	if _, err := rt.RunProgram(jslib.GetCoreJS()); err != nil {
 		return err
 	}
+	if _, err := rt.RunProgram(jslib.GetRegeneratorRuntime()); err != nil {
+		return err
+	}
 
 	exports := rt.NewObject()
 	rt.Set("exports", exports)
@@ -253,11 +307,23 @@ func (b *Bundle) instantiate(rt *goja.Runtime, init *InitContext) error {
 	_ = module.Set("exports", exports)
 	rt.Set("module", module)
 
-	rt.Set("__ENV", b.Env)
+	rt.Set("__ENV", env)
 
-	*init.ctxPtr = common.WithRuntime(context.Background(), rt)
+	ctx := common.WithFileOpener(common.WithRuntime(context.Background(), rt), init.readFile)
+	ctx = common.WithEventLoop(ctx, timers.loop)
+	*init.ctxPtr = common.WithSharedObjects(ctx, init.sharedObjects)
 	unbindInit := common.BindToGlobal(rt, common.Bind(rt, init, init.ctxPtr))
-	if _, err := rt.RunProgram(b.Program); err != nil {
+	loopCtx, cancel := context.WithTimeout(context.Background(), initTimeout)
+	defer cancel()
+	if err := timers.loop.Run(loopCtx, func() error {
+		_, err := rt.RunProgram(b.Program)
+		return err
+	}); err != nil {
+		timers.reset()
+		if err == context.DeadlineExceeded {
+			return errors.Errorf("the init code's timers and asynchronous operations didn't finish "+
+				"within %s; intervals started there must be cleared", initTimeout)
+		}
 		return err
 	}
 	unbindInit()
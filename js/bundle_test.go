@@ -78,6 +78,27 @@ func TestNewBundle(t *testing.T) {
 		_, err := getSimpleBundle("/script.js", `export default function() {};`)
 		assert.NoError(t, err)
 	})
+	t.Run("ScenariosWithoutDefault", func(t *testing.T) {
+		_, err := getSimpleBundle("/script.js", `
+			export let options = { scenarios: { s: { exec: "fn" } } };
+			export function fn() {};
+		`)
+		assert.NoError(t, err)
+	})
+	t.Run("ScenariosNeedDefault", func(t *testing.T) {
+		_, err := getSimpleBundle("/script.js", `
+			export let options = { scenarios: { s: { exec: "fn" }, t: {} } };
+			export function fn() {};
+		`)
+		assert.EqualError(t, err, "script must export a default function")
+	})
+	t.Run("ScenarioExecMissing", func(t *testing.T) {
+		_, err := getSimpleBundle("/script.js", `
+			export let options = { scenarios: { s: { exec: "nope" } } };
+			export default function() {};
+		`)
+		assert.EqualError(t, err, "scenario 's': exported function 'nope' not found")
+	})
 	t.Run("stdin", func(t *testing.T) {
 		b, err := getSimpleBundle("-", `export default function() {};`)
 		if assert.NoError(t, err) {
@@ -434,6 +455,31 @@ func TestBundleInstantiate(t *testing.T) {
 	})
 }
 
+func TestBundleInitTimers(t *testing.T) {
+	defer func(d time.Duration) { initTimeout = d }(initTimeout)
+	initTimeout = 100 * time.Millisecond
+
+	t.Run("Cleared", func(t *testing.T) {
+		_, err := getSimpleBundle("/script.js", `
+			let ticks = 0;
+			let interval = setInterval(() => { if (++ticks == 3) { clearInterval(interval); } }, 1);
+			new Promise(() => {});
+			export default function() { if (ticks != 3) { throw new Error("ticks: " + ticks); } }
+		`)
+		assert.NoError(t, err)
+	})
+	t.Run("Interval", func(t *testing.T) {
+		start := time.Now()
+		_, err := getSimpleBundle("/script.js", `
+			setInterval(() => {}, 1);
+			export default function() {}
+		`)
+		assert.EqualError(t, err, "the init code's timers and asynchronous operations didn't finish "+
+			"within 100ms; intervals started there must be cleared")
+		assert.True(t, time.Since(start) < 10*time.Second)
+	})
+}
+
 func TestBundleEnv(t *testing.T) {
 	rtOpts := lib.RuntimeOptions{Env: map[string]string{
 		"TEST_A": "1",
@@ -475,3 +521,65 @@ func TestBundleEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestBundleSharedArray(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, afero.WriteFile(fs, "/accounts.json", []byte(`[{"user": "a"}, {"user": "b"}]`), 0644))
+
+	b1, err := NewBundle(
+		&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+				import { SharedArray } from "k6/data";
+				let created = false;
+				let accounts = new SharedArray("accounts", function() {
+					created = true;
+					return JSON.parse(open("./accounts.json"));
+				});
+				export default function() {
+					let users = [];
+					for (let account of accounts) { users.push(account.user); }
+					return [created, accounts.length, accounts.get(1).user, users.join("")].join();
+				}
+			`),
+		},
+		fs, lib.RuntimeOptions{},
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	arc := b1.makeArchive()
+	assert.Equal(t, `[{"user": "a"}, {"user": "b"}]`, string(arc.Files["/accounts.json"]))
+	b2, err := NewBundleFromArchive(arc, lib.RuntimeOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	bundles := map[string]*Bundle{"Source": b1, "Archive": b2}
+	for name, b := range bundles {
+		t.Run(name, func(t *testing.T) {
+			// Bundles created from sources make the data while they're initialized, those created
+			// from archives when the first VU is; every other VU just shares it
+			created := 0
+			if name == "Source" {
+				created++
+			}
+			for i := 0; i < 3; i++ {
+				bi, err := b.Instantiate()
+				if !assert.NoError(t, err) {
+					return
+				}
+				v, err := bi.Default(goja.Undefined())
+				if assert.NoError(t, err) {
+					if v.Export() == "true,2,b,ab" {
+						created++
+					} else {
+						assert.Equal(t, "false,2,b,ab", v.Export())
+					}
+				}
+			}
+			assert.Equal(t, 1, created)
+		})
+	}
+}
@@ -31,8 +31,15 @@ type ctxKey int
 const (
 	ctxKeyState ctxKey = iota
 	ctxKeyRuntime
+	ctxKeyFileOpener
+	ctxKeySharedObjects
+	ctxKeyEventLoop
 )
 
+// A FileOpener reads a file the same way open() does in the init context: relative to the
+// current script, and cached, so that the file ends up in archives.
+type FileOpener func(name string) ([]byte, error)
+
 func WithState(ctx context.Context, state *State) context.Context {
 	return context.WithValue(ctx, ctxKeyState, state)
 }
@@ -56,3 +63,45 @@ func GetRuntime(ctx context.Context) *goja.Runtime {
 	}
 	return v.(*goja.Runtime)
 }
+
+// WithFileOpener returns a context with a FileOpener; only set in the init context.
+func WithFileOpener(ctx context.Context, open FileOpener) context.Context {
+	return context.WithValue(ctx, ctxKeyFileOpener, open)
+}
+
+// GetFileOpener returns the context's FileOpener, or nil outside of the init context.
+func GetFileOpener(ctx context.Context) FileOpener {
+	v := ctx.Value(ctxKeyFileOpener)
+	if v == nil {
+		return nil
+	}
+	return v.(FileOpener)
+}
+
+// WithSharedObjects returns a context with the test's SharedObjects; only set in the init context.
+func WithSharedObjects(ctx context.Context, shared *SharedObjects) context.Context {
+	return context.WithValue(ctx, ctxKeySharedObjects, shared)
+}
+
+// GetSharedObjects returns the context's SharedObjects, or nil outside of the init context.
+func GetSharedObjects(ctx context.Context) *SharedObjects {
+	v := ctx.Value(ctxKeySharedObjects)
+	if v == nil {
+		return nil
+	}
+	return v.(*SharedObjects)
+}
+
+// WithEventLoop returns a context with the VU's EventLoop.
+func WithEventLoop(ctx context.Context, loop *EventLoop) context.Context {
+	return context.WithValue(ctx, ctxKeyEventLoop, loop)
+}
+
+// GetEventLoop returns the context's EventLoop, or nil if it has none.
+func GetEventLoop(ctx context.Context) *EventLoop {
+	v := ctx.Value(ctxKeyEventLoop)
+	if v == nil {
+		return nil
+	}
+	return v.(*EventLoop)
+}
@@ -45,3 +45,14 @@ func TestContextRuntime(t *testing.T) {
 func TestContextRuntimeNil(t *testing.T) {
 	assert.Nil(t, GetRuntime(context.Background()))
 }
+
+func TestContextFileOpener(t *testing.T) {
+	open := func(name string) ([]byte, error) { return []byte(name), nil }
+	data, err := GetFileOpener(WithFileOpener(context.Background(), open))("file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("file.txt"), data)
+}
+
+func TestContextFileOpenerNil(t *testing.T) {
+	assert.Nil(t, GetFileOpener(context.Background()))
+}
@@ -0,0 +1,139 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package common
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// EventLoop runs the callbacks of a VU's timers and asynchronous operations. Callbacks always run
+// on the goroutine that called Run, since the runtime isn't safe for concurrent use; operations
+// that run in the background reserve a callback when they start, and queue it once they're done.
+type EventLoop struct {
+	lock     sync.Mutex
+	queue    []func() error
+	reserved int
+	wakeup   chan struct{}
+
+	// Incremented whenever the loop is abandoned, so callbacks reserved before then are dropped.
+	generation int
+}
+
+// NewEventLoop returns an empty EventLoop.
+func NewEventLoop() *EventLoop {
+	return &EventLoop{wakeup: make(chan struct{}, 1)}
+}
+
+// Reserve tells the loop to wait for a callback that will be queued later, eg. when a timer fires
+// or a request completes, and returns the function to queue it with. That function may be called
+// from any goroutine, and must be called once; calling it with nil just releases the reservation.
+func (l *EventLoop) Reserve() func(func() error) {
+	l.lock.Lock()
+	l.reserved++
+	generation := l.generation
+	l.lock.Unlock()
+
+	var once sync.Once
+	return func(fn func() error) {
+		once.Do(func() {
+			l.lock.Lock()
+			if l.generation != generation {
+				l.lock.Unlock()
+				return
+			}
+			l.reserved--
+			if fn != nil {
+				l.queue = append(l.queue, fn)
+			}
+			l.lock.Unlock()
+
+			select {
+			case l.wakeup <- struct{}{}:
+			default:
+			}
+		})
+	}
+}
+
+// Run calls fn, then runs queued callbacks until none are left or reserved. If fn or a callback
+// returns an error, or ctx is done first, the loop is abandoned: callbacks that are queued or
+// reserved are dropped, and the error is returned.
+func (l *EventLoop) Run(ctx context.Context, fn func() error) error {
+	err := fn()
+	for err == nil {
+		l.lock.Lock()
+		queue, reserved := l.queue, l.reserved
+		l.queue = nil
+		l.lock.Unlock()
+
+		if len(queue) == 0 {
+			if reserved == 0 {
+				return nil
+			}
+			select {
+			case <-l.wakeup:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			continue
+		}
+
+		for _, callback := range queue {
+			if err = callback(); err != nil {
+				break
+			}
+		}
+	}
+
+	l.lock.Lock()
+	l.queue = nil
+	l.reserved = 0
+	l.generation++
+	l.lock.Unlock()
+	return err
+}
+
+// A program that returns a new promise, along with its resolve and reject functions.
+var newPromiseProgram = goja.MustCompile("newPromise", `(function() {
+	var resolve, reject;
+	var promise = new Promise(function(res, rej) { resolve = res; reject = rej; });
+	return [promise, resolve, reject];
+})()`, true)
+
+// NewPromise returns a new Promise, along with functions to resolve and reject it. Those must be
+// called on the runtime's goroutine, typically from an EventLoop callback.
+func NewPromise(rt *goja.Runtime) (promise *goja.Object, resolve, reject func(interface{}) error, err error) {
+	v, err := rt.RunProgram(newPromiseProgram)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	parts := v.ToObject(rt)
+	settle := func(name string) func(interface{}) error {
+		fn, _ := goja.AssertFunction(parts.Get(name))
+		return func(v interface{}) error {
+			_, err := fn(goja.Undefined(), rt.ToValue(v))
+			return err
+		}
+	}
+	return parts.Get("0").ToObject(rt), settle("1"), settle("2"), nil
+}
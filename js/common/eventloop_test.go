@@ -0,0 +1,141 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	jslib "github.com/loadimpact/k6/js/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLoop(t *testing.T) {
+	t.Run("Callbacks", func(t *testing.T) {
+		loop := NewEventLoop()
+		var calls []string
+		err := loop.Run(context.Background(), func() error {
+			calls = append(calls, "fn")
+			for _, delay := range []time.Duration{20 * time.Millisecond, 0} {
+				queue := loop.Reserve()
+				delay := delay
+				go func() {
+					time.Sleep(delay)
+					queue(func() error {
+						calls = append(calls, delay.String())
+						if delay == 0 {
+							// Callbacks can queue more callbacks.
+							loop.Reserve()(func() error {
+								calls = append(calls, "nested")
+								return nil
+							})
+						}
+						return nil
+					})
+				}()
+			}
+			loop.Reserve()(nil)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"fn", "0s", "nested", "20ms"}, calls)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		loop := NewEventLoop()
+		ran := false
+		err := loop.Run(context.Background(), func() error {
+			loop.Reserve()(func() error { return errors.New("oops") })
+			loop.Reserve()(func() error {
+				ran = true
+				return nil
+			})
+			loop.Reserve()
+			return nil
+		})
+		assert.EqualError(t, err, "oops")
+		assert.False(t, ran)
+
+		// Everything left is dropped, so the loop can be reused.
+		assert.NoError(t, loop.Run(context.Background(), func() error { return nil }))
+		assert.False(t, ran)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		loop := NewEventLoop()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		var queue func(func() error)
+		err := loop.Run(ctx, func() error {
+			queue = loop.Reserve()
+			return nil
+		})
+		assert.Equal(t, context.DeadlineExceeded, err)
+
+		// Callbacks reserved before the loop was abandoned are ignored.
+		ran := false
+		queue(func() error {
+			ran = true
+			return nil
+		})
+		assert.NoError(t, loop.Run(context.Background(), func() error { return nil }))
+		assert.False(t, ran)
+	})
+}
+
+func TestNewPromise(t *testing.T) {
+	rt := goja.New()
+	loop := NewEventLoop()
+	rt.Set("setImmediate", func(fn goja.Callable) {
+		loop.Reserve()(func() error {
+			_, err := fn(goja.Undefined())
+			return err
+		})
+	})
+	rt.Set("clearImmediate", func() {})
+	_, err := rt.RunProgram(jslib.GetCoreJS())
+	require.NoError(t, err)
+
+	for name, settle := range map[string]func(resolve, reject func(interface{}) error) error{
+		"resolved 1":          func(resolve, reject func(interface{}) error) error { return resolve(1) },
+		"rejected GoError: x": func(resolve, reject func(interface{}) error) error { return reject(rt.NewGoError(errors.New("x"))) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			promise, resolve, reject, err := NewPromise(rt)
+			require.NoError(t, err)
+			rt.Set("promise", promise)
+			err = loop.Run(context.Background(), func() error {
+				if _, err := rt.RunString(`
+				var result;
+				promise.then(function(v) { result = "resolved " + v; }, function(e) { result = "rejected " + e; });
+				`); err != nil {
+					return err
+				}
+				return settle(resolve, reject)
+			})
+			require.NoError(t, err)
+			assert.Equal(t, name, rt.Get("result").String())
+		})
+	}
+}
@@ -0,0 +1,59 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package common
+
+import (
+	"sync"
+)
+
+// SharedObjects holds objects that are created once per test and shared between all VUs, such as
+// read-only test data. Objects must be safe for concurrent use once they've been created.
+type SharedObjects struct {
+	mutex   sync.Mutex
+	objects map[string]*sharedObject
+}
+
+type sharedObject struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+// NewSharedObjects returns an empty store.
+func NewSharedObjects() *SharedObjects {
+	return &SharedObjects{objects: make(map[string]*sharedObject)}
+}
+
+// GetOrCreate returns the object with the given name, calling create to make it if this is the
+// first time it's requested. Concurrent callers wait for the first call to create to finish;
+// if it failed, they all get its error.
+func (s *SharedObjects) GetOrCreate(name string, create func() (interface{}, error)) (interface{}, error) {
+	s.mutex.Lock()
+	obj, ok := s.objects[name]
+	if !ok {
+		obj = &sharedObject{}
+		s.objects[name] = obj
+	}
+	s.mutex.Unlock()
+
+	obj.once.Do(func() { obj.value, obj.err = create() })
+	return obj.value, obj.err
+}
@@ -61,4 +61,8 @@ type State struct {
 	BPool *bpool.BufferPool
 
 	Vu, Iteration int64
+
+	// The iteration's number among all of the test's, across VUs; -1 outside of iterations, eg.
+	// in setup() or vuSetup().
+	GlobalIteration int64
 }
@@ -54,6 +54,9 @@ type InitContext struct {
 	// Cache of loaded programs and files.
 	programs map[string]programWithSource
 	files    map[string][]byte
+
+	// Objects shared between all VUs, see k6/data.
+	sharedObjects *common.SharedObjects
 }
 
 func NewInitContext(rt *goja.Runtime, compiler *compiler.Compiler, ctxPtr *context.Context, fs afero.Fs, pwd string) *InitContext {
@@ -66,6 +69,8 @@ func NewInitContext(rt *goja.Runtime, compiler *compiler.Compiler, ctxPtr *conte
 
 		programs: make(map[string]programWithSource),
 		files:    make(map[string][]byte),
+
+		sharedObjects: common.NewSharedObjects(),
 	}
 }
 
@@ -80,6 +85,8 @@ func newBoundInitContext(base *InitContext, ctxPtr *context.Context, rt *goja.Ru
 
 		programs: base.programs,
 		files:    base.files,
+
+		sharedObjects: base.sharedObjects,
 	}
 }
 
@@ -164,6 +171,19 @@ func (i *InitContext) compileImport(src, filename string) (*goja.Program, error)
 }
 
 func (i *InitContext) Open(name string, args ...string) (goja.Value, error) {
+	data, err := i.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) > 0 && args[0] == "b" {
+		return i.runtime.ToValue(data), nil
+	}
+	return i.runtime.ToValue(string(data)), nil
+}
+
+// Reads a file for open(), or for modules through common.GetFileOpener().
+func (i *InitContext) readFile(name string) ([]byte, error) {
 	filename := loader.Resolve(i.pwd, name)
 	data, ok := i.files[filename]
 	if !ok {
@@ -174,9 +194,5 @@ func (i *InitContext) Open(name string, args ...string) (goja.Value, error) {
 		i.files[filename] = data_.Data
 		data = data_.Data
 	}
-
-	if len(args) > 0 && args[0] == "b" {
-		return i.runtime.ToValue(data), nil
-	}
-	return i.runtime.ToValue(string(data)), nil
+	return data, nil
 }
@@ -34,3 +34,13 @@ func GetCoreJS() *goja.Program {
 		true,
 	)
 }
+
+// GetRegeneratorRuntime returns the runtime for generator and async functions, which Babel
+// compiles into calls to a global regeneratorRuntime.
+func GetRegeneratorRuntime() *goja.Program {
+	return goja.MustCompile(
+		"regenerator/runtime.js",
+		rice.MustFindBox("regenerator").MustString("runtime.js"),
+		true,
+	)
+}
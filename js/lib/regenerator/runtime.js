@@ -0,0 +1,408 @@
+/**
+ * A runtime for generator functions, as compiled by Babel's regenerator transform. The runtime
+ * doesn't support generators natively, and async functions are compiled into them, so scripts
+ * need this to use either; it implements the same API as facebook/regenerator's runtime.
+ */
+(function(global) {
+	"use strict";
+
+	var hasOwn = Object.prototype.hasOwnProperty;
+	var iteratorSymbol = typeof Symbol === "function" && Symbol.iterator || "@@iterator";
+	var toStringTagSymbol = typeof Symbol === "function" && Symbol.toStringTag || "@@toStringTag";
+
+	var StateSuspendedStart = "suspendedStart";
+	var StateSuspendedYield = "suspendedYield";
+	var StateExecuting = "executing";
+	var StateCompleted = "completed";
+
+	// Returned by context methods to make the generator's dispatch loop continue.
+	var ContinueSentinel = {};
+
+	function Generator() {}
+	function GeneratorFunction() {}
+	function GeneratorFunctionPrototype() {}
+
+	var IteratorPrototype = {};
+	IteratorPrototype[iteratorSymbol] = function() { return this; };
+
+	var Gp = Object.create(IteratorPrototype);
+	Generator.prototype = GeneratorFunctionPrototype.prototype = Gp;
+	GeneratorFunction.prototype = Gp.constructor = GeneratorFunctionPrototype;
+	GeneratorFunctionPrototype.constructor = GeneratorFunction;
+	GeneratorFunctionPrototype[toStringTagSymbol] = GeneratorFunction.displayName = "GeneratorFunction";
+	Gp[toStringTagSymbol] = "Generator";
+	Gp.toString = function() { return "[object Generator]"; };
+	["next", "throw", "return"].forEach(function(method) {
+		Gp[method] = function(arg) { return this._invoke(method, arg); };
+	});
+
+	function mark(genFun) {
+		if (Object.setPrototypeOf) {
+			Object.setPrototypeOf(genFun, GeneratorFunctionPrototype);
+		} else {
+			genFun.__proto__ = GeneratorFunctionPrototype;
+		}
+		genFun.prototype = Object.create(Gp);
+		return genFun;
+	}
+
+	function isGeneratorFunction(genFun) {
+		var ctor = typeof genFun === "function" && genFun.constructor;
+		return ctor ? ctor === GeneratorFunction || (ctor.displayName || ctor.name) === "GeneratorFunction" : false;
+	}
+
+	function wrap(innerFn, outerFn, self, tryLocsList) {
+		var proto = outerFn && outerFn.prototype instanceof Generator ? outerFn.prototype : Gp;
+		var generator = Object.create(proto);
+		generator._invoke = makeInvokeMethod(innerFn, self, new Context(tryLocsList || []));
+		return generator;
+	}
+
+	function tryCatch(fn, obj, arg) {
+		try {
+			return { type: "normal", arg: fn.call(obj, arg) };
+		} catch (err) {
+			return { type: "throw", arg: err };
+		}
+	}
+
+	function makeInvokeMethod(innerFn, self, context) {
+		var state = StateSuspendedStart;
+
+		return function invoke(method, arg) {
+			if (state === StateExecuting) {
+				throw new Error("Generator is already running");
+			}
+			if (state === StateCompleted) {
+				if (method === "throw") {
+					throw arg;
+				}
+				return doneResult();
+			}
+
+			context.method = method;
+			context.arg = arg;
+			while (true) {
+				if (context.delegate) {
+					var delegateResult = invokeDelegate(context.delegate, context);
+					if (delegateResult === ContinueSentinel) {
+						continue;
+					}
+					if (delegateResult) {
+						return delegateResult;
+					}
+				}
+
+				if (context.method === "next") {
+					context.sent = context._sent = context.arg;
+				} else if (context.method === "throw") {
+					if (state === StateSuspendedStart) {
+						state = StateCompleted;
+						throw context.arg;
+					}
+					context.dispatchException(context.arg);
+				} else if (context.method === "return") {
+					context.abrupt("return", context.arg);
+				}
+
+				state = StateExecuting;
+				var record = tryCatch(innerFn, self, context);
+				if (record.type === "normal") {
+					state = context.done ? StateCompleted : StateSuspendedYield;
+					if (record.arg === ContinueSentinel) {
+						continue;
+					}
+					return { value: record.arg, done: context.done };
+				}
+				state = StateCompleted;
+				context.method = "throw";
+				context.arg = record.arg;
+			}
+		};
+	}
+
+	// Forwards the current method call to the iterator of a yield* expression. Returns the
+	// iterator's result if it yielded, or ContinueSentinel if the generator should carry on.
+	function invokeDelegate(delegate, context) {
+		var method = delegate.iterator[context.method];
+		if (method === undefined) {
+			context.delegate = null;
+			if (context.method === "throw") {
+				if (delegate.iterator["return"]) {
+					context.method = "return";
+					context.arg = undefined;
+					invokeDelegate(delegate, context);
+					if (context.method === "throw") {
+						return ContinueSentinel;
+					}
+				}
+				context.method = "throw";
+				context.arg = new TypeError("The iterator does not provide a 'throw' method");
+			}
+			return ContinueSentinel;
+		}
+
+		var record = tryCatch(method, delegate.iterator, context.arg);
+		if (record.type === "throw") {
+			context.method = "throw";
+			context.arg = record.arg;
+			context.delegate = null;
+			return ContinueSentinel;
+		}
+
+		var info = record.arg;
+		if (!info) {
+			context.method = "throw";
+			context.arg = new TypeError("iterator result is not an object");
+			context.delegate = null;
+			return ContinueSentinel;
+		}
+		if (!info.done) {
+			return info;
+		}
+
+		context[delegate.resultName] = info.value;
+		context.next = delegate.nextLoc;
+		if (context.method !== "return") {
+			context.method = "next";
+			context.arg = undefined;
+		}
+		context.delegate = null;
+		return ContinueSentinel;
+	}
+
+	function pushTryEntry(locs) {
+		var entry = { tryLoc: locs[0] };
+		if (1 in locs) {
+			entry.catchLoc = locs[1];
+		}
+		if (2 in locs) {
+			entry.finallyLoc = locs[2];
+			entry.afterLoc = locs[3];
+		}
+		this.tryEntries.push(entry);
+	}
+
+	function resetTryEntry(entry) {
+		var record = entry.completion || {};
+		record.type = "normal";
+		delete record.arg;
+		entry.completion = record;
+	}
+
+	// The state of a running generator; the compiled function body drives it through prev and
+	// next, which are locations in its dispatch loop, and the methods below.
+	function Context(tryLocsList) {
+		this.tryEntries = [{ tryLoc: "root" }];
+		tryLocsList.forEach(pushTryEntry, this);
+		this.reset(true);
+	}
+
+	Context.prototype = {
+		constructor: Context,
+
+		reset: function(skipTempReset) {
+			this.prev = 0;
+			this.next = 0;
+			this.sent = this._sent = undefined;
+			this.done = false;
+			this.delegate = null;
+			this.method = "next";
+			this.arg = undefined;
+			this.tryEntries.forEach(resetTryEntry);
+			if (!skipTempReset) {
+				for (var name in this) {
+					if (name.charAt(0) === "t" && hasOwn.call(this, name) && !isNaN(+name.slice(1))) {
+						this[name] = undefined;
+					}
+				}
+			}
+		},
+
+		stop: function() {
+			this.done = true;
+			var rootRecord = this.tryEntries[0].completion;
+			if (rootRecord.type === "throw") {
+				throw rootRecord.arg;
+			}
+			return this.rval;
+		},
+
+		dispatchException: function(exception) {
+			if (this.done) {
+				throw exception;
+			}
+
+			var context = this;
+			function handle(entry, loc, caught) {
+				entry.completion.type = "throw";
+				entry.completion.arg = exception;
+				context.next = loc;
+				if (caught) {
+					context.method = "next";
+					context.arg = undefined;
+				}
+				return !!caught;
+			}
+
+			for (var i = this.tryEntries.length - 1; i >= 0; --i) {
+				var entry = this.tryEntries[i];
+				if (entry.tryLoc === "root") {
+					return handle(entry, "end");
+				}
+				if (entry.tryLoc <= this.prev) {
+					var hasCatch = hasOwn.call(entry, "catchLoc");
+					var hasFinally = hasOwn.call(entry, "finallyLoc");
+					if (hasCatch && this.prev < entry.catchLoc) {
+						return handle(entry, entry.catchLoc, true);
+					}
+					if (hasFinally && this.prev < entry.finallyLoc) {
+						return handle(entry, entry.finallyLoc);
+					}
+					if (!hasCatch && !hasFinally) {
+						throw new Error("try statement without catch or finally");
+					}
+				}
+			}
+		},
+
+		abrupt: function(type, arg) {
+			var finallyEntry = null;
+			for (var i = this.tryEntries.length - 1; i >= 0; --i) {
+				var entry = this.tryEntries[i];
+				if (entry.tryLoc <= this.prev && hasOwn.call(entry, "finallyLoc") && this.prev < entry.finallyLoc) {
+					finallyEntry = entry;
+					break;
+				}
+			}
+			// Jumps within the try statement don't need to run its finally block.
+			if (finallyEntry && (type === "break" || type === "continue") &&
+				finallyEntry.tryLoc <= arg && arg <= finallyEntry.finallyLoc) {
+				finallyEntry = null;
+			}
+
+			var record = finallyEntry ? finallyEntry.completion : {};
+			record.type = type;
+			record.arg = arg;
+			if (finallyEntry) {
+				this.method = "next";
+				this.next = finallyEntry.finallyLoc;
+				return ContinueSentinel;
+			}
+			return this.complete(record);
+		},
+
+		complete: function(record, afterLoc) {
+			if (record.type === "throw") {
+				throw record.arg;
+			}
+			if (record.type === "break" || record.type === "continue") {
+				this.next = record.arg;
+			} else if (record.type === "return") {
+				this.rval = this.arg = record.arg;
+				this.method = "return";
+				this.next = "end";
+			} else if (record.type === "normal" && afterLoc) {
+				this.next = afterLoc;
+			}
+			return ContinueSentinel;
+		},
+
+		finish: function(finallyLoc) {
+			for (var i = this.tryEntries.length - 1; i >= 0; --i) {
+				var entry = this.tryEntries[i];
+				if (entry.finallyLoc === finallyLoc) {
+					this.complete(entry.completion, entry.afterLoc);
+					resetTryEntry(entry);
+					return ContinueSentinel;
+				}
+			}
+		},
+
+		"catch": function(tryLoc) {
+			for (var i = this.tryEntries.length - 1; i >= 0; --i) {
+				var entry = this.tryEntries[i];
+				if (entry.tryLoc === tryLoc) {
+					var thrown;
+					if (entry.completion.type === "throw") {
+						thrown = entry.completion.arg;
+						resetTryEntry(entry);
+					}
+					return thrown;
+				}
+			}
+			throw new Error("illegal catch attempt");
+		},
+
+		delegateYield: function(iterable, resultName, nextLoc) {
+			this.delegate = { iterator: values(iterable), resultName: resultName, nextLoc: nextLoc };
+			if (this.method === "next") {
+				this.arg = undefined;
+			}
+			return ContinueSentinel;
+		}
+	};
+
+	// Returns an iterator over an iterable or array-like object.
+	function values(iterable) {
+		if (iterable) {
+			var iteratorMethod = iterable[iteratorSymbol];
+			if (iteratorMethod) {
+				return iteratorMethod.call(iterable);
+			}
+			if (typeof iterable.next === "function") {
+				return iterable;
+			}
+			if (!isNaN(iterable.length)) {
+				var i = -1;
+				var next = function next() {
+					while (++i < iterable.length) {
+						if (hasOwn.call(iterable, i)) {
+							next.value = iterable[i];
+							next.done = false;
+							return next;
+						}
+					}
+					next.value = undefined;
+					next.done = true;
+					return next;
+				};
+				return next.next = next;
+			}
+		}
+		return { next: doneResult };
+	}
+
+	// Returns a function that iterates over an object's keys, for for-in loops in generators.
+	function keys(object) {
+		var list = [];
+		for (var key in object) {
+			list.push(key);
+		}
+		list.reverse();
+		return function next() {
+			while (list.length) {
+				var key = list.pop();
+				if (key in object) {
+					next.value = key;
+					next.done = false;
+					return next;
+				}
+			}
+			next.done = true;
+			return next;
+		};
+	}
+
+	function doneResult() {
+		return { value: undefined, done: true };
+	}
+
+	global.regeneratorRuntime = {
+		mark: mark,
+		wrap: wrap,
+		isGeneratorFunction: isGeneratorFunction,
+		keys: keys,
+		values: values
+	};
+})(this);
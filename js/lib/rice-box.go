@@ -39,3 +39,38 @@ func init() {
 		},
 	})
 }
+
+func init() {
+
+	// define files
+	file4 := &embedded.EmbeddedFile{
+		Filename:    "runtime.js",
+		FileModTime: time.Unix(1539760000, 0),
+		Content:     string("/**\n * A runtime for generator functions, as compiled by Babel's regenerator transform. The runtime\n * doesn't support generators natively, and async functions are compiled into them, so scripts\n * need this to use either; it implements the same API as facebook/regenerator's runtime.\n */\n(function(global) {\n\t\"use strict\";\n\n\tvar hasOwn = Object.prototype.hasOwnProperty;\n\tvar iteratorSymbol = typeof Symbol === \"function\" && Symbol.iterator || \"@@iterator\";\n\tvar toStringTagSymbol = typeof Symbol === \"function\" && Symbol.toStringTag || \"@@toStringTag\";\n\n\tvar StateSuspendedStart = \"suspendedStart\";\n\tvar StateSuspendedYield = \"suspendedYield\";\n\tvar StateExecuting = \"executing\";\n\tvar StateCompleted = \"completed\";\n\n\t// Returned by context methods to make the generator's dispatch loop continue.\n\tvar ContinueSentinel = {};\n\n\tfunction Generator() {}\n\tfunction GeneratorFunction() {}\n\tfunction GeneratorFunctionPrototype() {}\n\n\tvar IteratorPrototype = {};\n\tIteratorPrototype[iteratorSymbol] = function() { return this; };\n\n\tvar Gp = Object.create(IteratorPrototype);\n\tGenerator.prototype = GeneratorFunctionPrototype.prototype = Gp;\n\tGeneratorFunction.prototype = Gp.constructor = GeneratorFunctionPrototype;\n\tGeneratorFunctionPrototype.constructor = GeneratorFunction;\n\tGeneratorFunctionPrototype[toStringTagSymbol] = GeneratorFunction.displayName = \"GeneratorFunction\";\n\tGp[toStringTagSymbol] = \"Generator\";\n\tGp.toString = function() { return \"[object Generator]\"; };\n\t[\"next\", \"throw\", \"return\"].forEach(function(method) {\n\t\tGp[method] = function(arg) { return this._invoke(method, arg); };\n\t});\n\n\tfunction mark(genFun) {\n\t\tif (Object.setPrototypeOf) {\n\t\t\tObject.setPrototypeOf(genFun, GeneratorFunctionPrototype);\n\t\t} else {\n\t\t\tgenFun.__proto__ = GeneratorFunctionPrototype;\n\t\t}\n\t\tgenFun.prototype = Object.create(Gp);\n\t\treturn genFun;\n\t}\n\n\tfunction isGeneratorFunction(genFun) {\n\t\tvar ctor = typeof genFun === \"function\" && genFun.constructor;\n\t\treturn ctor ? ctor === GeneratorFunction || (ctor.displayName || ctor.name) === \"GeneratorFunction\" : false;\n\t}\n\n\tfunction wrap(innerFn, outerFn, self, tryLocsList) {\n\t\tvar proto = outerFn && outerFn.prototype instanceof Generator ? outerFn.prototype : Gp;\n\t\tvar generator = Object.create(proto);\n\t\tgenerator._invoke = makeInvokeMethod(innerFn, self, new Context(tryLocsList || []));\n\t\treturn generator;\n\t}\n\n\tfunction tryCatch(fn, obj, arg) {\n\t\ttry {\n\t\t\treturn { type: \"normal\", arg: fn.call(obj, arg) };\n\t\t} catch (err) {\n\t\t\treturn { type: \"throw\", arg: err };\n\t\t}\n\t}\n\n\tfunction makeInvokeMethod(innerFn, self, context) {\n\t\tvar state = StateSuspendedStart;\n\n\t\treturn function invoke(method, arg) {\n\t\t\tif (state === StateExecuting) {\n\t\t\t\tthrow new Error(\"Generator is already running\");\n\t\t\t}\n\t\t\tif (state === StateCompleted) {\n\t\t\t\tif (method === \"throw\") {\n\t\t\t\t\tthrow arg;\n\t\t\t\t}\n\t\t\t\treturn doneResult();\n\t\t\t}\n\n\t\t\tcontext.method = method;\n\t\t\tcontext.arg = arg;\n\t\t\twhile (true) {\n\t\t\t\tif (context.delegate) {\n\t\t\t\t\tvar delegateResult = invokeDelegate(context.delegate, context);\n\t\t\t\t\tif (delegateResult === ContinueSentinel) {\n\t\t\t\t\t\tcontinue;\n\t\t\t\t\t}\n\t\t\t\t\tif (delegateResult) {\n\t\t\t\t\t\treturn delegateResult;\n\t\t\t\t\t}\n\t\t\t\t}\n\n\t\t\t\tif (context.method === \"next\") {\n\t\t\t\t\tcontext.sent = context._sent = context.arg;\n\t\t\t\t} else if (context.method === \"throw\") {\n\t\t\t\t\tif (state === StateSuspendedStart) {\n\t\t\t\t\t\tstate = StateCompleted;\n\t\t\t\t\t\tthrow context.arg;\n\t\t\t\t\t}\n\t\t\t\t\tcontext.dispatchException(context.arg);\n\t\t\t\t} else if (context.method === \"return\") {\n\t\t\t\t\tcontext.abrupt(\"return\", context.arg);\n\t\t\t\t}\n\n\t\t\t\tstate = StateExecuting;\n\t\t\t\tvar record = tryCatch(innerFn, self, context);\n\t\t\t\tif (record.type === \"normal\") {\n\t\t\t\t\tstate = context.done ? StateCompleted : StateSuspendedYield;\n\t\t\t\t\tif (record.arg === ContinueSentinel) {\n\t\t\t\t\t\tcontinue;\n\t\t\t\t\t}\n\t\t\t\t\treturn { value: record.arg, done: context.done };\n\t\t\t\t}\n\t\t\t\tstate = StateCompleted;\n\t\t\t\tcontext.method = \"throw\";\n\t\t\t\tcontext.arg = record.arg;\n\t\t\t}\n\t\t};\n\t}\n\n\t// Forwards the current method call to the iterator of a yield* expression. Returns the\n\t// iterator's result if it yielded, or ContinueSentinel if the generator should carry on.\n\tfunction invokeDelegate(delegate, context) {\n\t\tvar method = delegate.iterator[context.method];\n\t\tif (method === undefined) {\n\t\t\tcontext.delegate = null;\n\t\t\tif (context.method === \"throw\") {\n\t\t\t\tif (delegate.iterator[\"return\"]) {\n\t\t\t\t\tcontext.method = \"return\";\n\t\t\t\t\tcontext.arg = undefined;\n\t\t\t\t\tinvokeDelegate(delegate, context);\n\t\t\t\t\tif (context.method === \"throw\") {\n\t\t\t\t\t\treturn ContinueSentinel;\n\t\t\t\t\t}\n\t\t\t\t}\n\t\t\t\tcontext.method = \"throw\";\n\t\t\t\tcontext.arg = new TypeError(\"The iterator does not provide a 'throw' method\");\n\t\t\t}\n\t\t\treturn ContinueSentinel;\n\t\t}\n\n\t\tvar record = tryCatch(method, delegate.iterator, context.arg);\n\t\tif (record.type === \"throw\") {\n\t\t\tcontext.method = \"throw\";\n\t\t\tcontext.arg = record.arg;\n\t\t\tcontext.delegate = null;\n\t\t\treturn ContinueSentinel;\n\t\t}\n\n\t\tvar info = record.arg;\n\t\tif (!info) {\n\t\t\tcontext.method = \"throw\";\n\t\t\tcontext.arg = new TypeError(\"iterator result is not an object\");\n\t\t\tcontext.delegate = null;\n\t\t\treturn ContinueSentinel;\n\t\t}\n\t\tif (!info.done) {\n\t\t\treturn info;\n\t\t}\n\n\t\tcontext[delegate.resultName] = info.value;\n\t\tcontext.next = delegate.nextLoc;\n\t\tif (context.method !== \"return\") {\n\t\t\tcontext.method = \"next\";\n\t\t\tcontext.arg = undefined;\n\t\t}\n\t\tcontext.delegate = null;\n\t\treturn ContinueSentinel;\n\t}\n\n\tfunction pushTryEntry(locs) {\n\t\tvar entry = { tryLoc: locs[0] };\n\t\tif (1 in locs) {\n\t\t\tentry.catchLoc = locs[1];\n\t\t}\n\t\tif (2 in locs) {\n\t\t\tentry.finallyLoc = locs[2];\n\t\t\tentry.afterLoc = locs[3];\n\t\t}\n\t\tthis.tryEntries.push(entry);\n\t}\n\n\tfunction resetTryEntry(entry) {\n\t\tvar record = entry.completion || {};\n\t\trecord.type = \"normal\";\n\t\tdelete record.arg;\n\t\tentry.completion = record;\n\t}\n\n\t// The state of a running generator; the compiled function body drives it through prev and\n\t// next, which are locations in its dispatch loop, and the methods below.\n\tfunction Context(tryLocsList) {\n\t\tthis.tryEntries = [{ tryLoc: \"root\" }];\n\t\ttryLocsList.forEach(pushTryEntry, this);\n\t\tthis.reset(true);\n\t}\n\n\tContext.prototype = {\n\t\tconstructor: Context,\n\n\t\treset: function(skipTempReset) {\n\t\t\tthis.prev = 0;\n\t\t\tthis.next = 0;\n\t\t\tthis.sent = this._sent = undefined;\n\t\t\tthis.done = false;\n\t\t\tthis.delegate = null;\n\t\t\tthis.method = \"next\";\n\t\t\tthis.arg = undefined;\n\t\t\tthis.tryEntries.forEach(resetTryEntry);\n\t\t\tif (!skipTempReset) {\n\t\t\t\tfor (var name in this) {\n\t\t\t\t\tif (name.charAt(0) === \"t\" && hasOwn.call(this, name) && !isNaN(+name.slice(1))) {\n\t\t\t\t\t\tthis[name] = undefined;\n\t\t\t\t\t}\n\t\t\t\t}\n\t\t\t}\n\t\t},\n\n\t\tstop: function() {\n\t\t\tthis.done = true;\n\t\t\tvar rootRecord = this.tryEntries[0].completion;\n\t\t\tif (rootRecord.type === \"throw\") {\n\t\t\t\tthrow rootRecord.arg;\n\t\t\t}\n\t\t\treturn this.rval;\n\t\t},\n\n\t\tdispatchException: function(exception) {\n\t\t\tif (this.done) {\n\t\t\t\tthrow exception;\n\t\t\t}\n\n\t\t\tvar context = this;\n\t\t\tfunction handle(entry, loc, caught) {\n\t\t\t\tentry.completion.type = \"throw\";\n\t\t\t\tentry.completion.arg = exception;\n\t\t\t\tcontext.next = loc;\n\t\t\t\tif (caught) {\n\t\t\t\t\tcontext.method = \"next\";\n\t\t\t\t\tcontext.arg = undefined;\n\t\t\t\t}\n\t\t\t\treturn !!caught;\n\t\t\t}\n\n\t\t\tfor (var i = this.tryEntries.length - 1; i >= 0; --i) {\n\t\t\t\tvar entry = this.tryEntries[i];\n\t\t\t\tif (entry.tryLoc === \"root\") {\n\t\t\t\t\treturn handle(entry, \"end\");\n\t\t\t\t}\n\t\t\t\tif (entry.tryLoc <= this.prev) {\n\t\t\t\t\tvar hasCatch = hasOwn.call(entry, \"catchLoc\");\n\t\t\t\t\tvar hasFinally = hasOwn.call(entry, \"finallyLoc\");\n\t\t\t\t\tif (hasCatch && this.prev < entry.catchLoc) {\n\t\t\t\t\t\treturn handle(entry, entry.catchLoc, true);\n\t\t\t\t\t}\n\t\t\t\t\tif (hasFinally && this.prev < entry.finallyLoc) {\n\t\t\t\t\t\treturn handle(entry, entry.finallyLoc);\n\t\t\t\t\t}\n\t\t\t\t\tif (!hasCatch && !hasFinally) {\n\t\t\t\t\t\tthrow new Error(\"try statement without catch or finally\");\n\t\t\t\t\t}\n\t\t\t\t}\n\t\t\t}\n\t\t},\n\n\t\tabrupt: function(type, arg) {\n\t\t\tvar finallyEntry = null;\n\t\t\tfor (var i = this.tryEntries.length - 1; i >= 0; --i) {\n\t\t\t\tvar entry = this.tryEntries[i];\n\t\t\t\tif (entry.tryLoc <= this.prev && hasOwn.call(entry, \"finallyLoc\") && this.prev < entry.finallyLoc) {\n\t\t\t\t\tfinallyEntry = entry;\n\t\t\t\t\tbreak;\n\t\t\t\t}\n\t\t\t}\n\t\t\t// Jumps within the try statement don't need to run its finally block.\n\t\t\tif (finallyEntry && (type === \"break\" || type === \"continue\") &&\n\t\t\t\tfinallyEntry.tryLoc <= arg && arg <= finallyEntry.finallyLoc) {\n\t\t\t\tfinallyEntry = null;\n\t\t\t}\n\n\t\t\tvar record = finallyEntry ? finallyEntry.completion : {};\n\t\t\trecord.type = type;\n\t\t\trecord.arg = arg;\n\t\t\tif (finallyEntry) {\n\t\t\t\tthis.method = \"next\";\n\t\t\t\tthis.next = finallyEntry.finallyLoc;\n\t\t\t\treturn ContinueSentinel;\n\t\t\t}\n\t\t\treturn this.complete(record);\n\t\t},\n\n\t\tcomplete: function(record, afterLoc) {\n\t\t\tif (record.type === \"throw\") {\n\t\t\t\tthrow record.arg;\n\t\t\t}\n\t\t\tif (record.type === \"break\" || record.type === \"continue\") {\n\t\t\t\tthis.next = record.arg;\n\t\t\t} else if (record.type === \"return\") {\n\t\t\t\tthis.rval = this.arg = record.arg;\n\t\t\t\tthis.method = \"return\";\n\t\t\t\tthis.next = \"end\";\n\t\t\t} else if (record.type === \"normal\" && afterLoc) {\n\t\t\t\tthis.next = afterLoc;\n\t\t\t}\n\t\t\treturn ContinueSentinel;\n\t\t},\n\n\t\tfinish: function(finallyLoc) {\n\t\t\tfor (var i = this.tryEntries.length - 1; i >= 0; --i) {\n\t\t\t\tvar entry = this.tryEntries[i];\n\t\t\t\tif (entry.finallyLoc === finallyLoc) {\n\t\t\t\t\tthis.complete(entry.completion, entry.afterLoc);\n\t\t\t\t\tresetTryEntry(entry);\n\t\t\t\t\treturn ContinueSentinel;\n\t\t\t\t}\n\t\t\t}\n\t\t},\n\n\t\t\"catch\": function(tryLoc) {\n\t\t\tfor (var i = this.tryEntries.length - 1; i >= 0; --i) {\n\t\t\t\tvar entry = this.tryEntries[i];\n\t\t\t\tif (entry.tryLoc === tryLoc) {\n\t\t\t\t\tvar thrown;\n\t\t\t\t\tif (entry.completion.type === \"throw\") {\n\t\t\t\t\t\tthrown = entry.completion.arg;\n\t\t\t\t\t\tresetTryEntry(entry);\n\t\t\t\t\t}\n\t\t\t\t\treturn thrown;\n\t\t\t\t}\n\t\t\t}\n\t\t\tthrow new Error(\"illegal catch attempt\");\n\t\t},\n\n\t\tdelegateYield: function(iterable, resultName, nextLoc) {\n\t\t\tthis.delegate = { iterator: values(iterable), resultName: resultName, nextLoc: nextLoc };\n\t\t\tif (this.method === \"next\") {\n\t\t\t\tthis.arg = undefined;\n\t\t\t}\n\t\t\treturn ContinueSentinel;\n\t\t}\n\t};\n\n\t// Returns an iterator over an iterable or array-like object.\n\tfunction values(iterable) {\n\t\tif (iterable) {\n\t\t\tvar iteratorMethod = iterable[iteratorSymbol];\n\t\t\tif (iteratorMethod) {\n\t\t\t\treturn iteratorMethod.call(iterable);\n\t\t\t}\n\t\t\tif (typeof iterable.next === \"function\") {\n\t\t\t\treturn iterable;\n\t\t\t}\n\t\t\tif (!isNaN(iterable.length)) {\n\t\t\t\tvar i = -1;\n\t\t\t\tvar next = function next() {\n\t\t\t\t\twhile (++i < iterable.length) {\n\t\t\t\t\t\tif (hasOwn.call(iterable, i)) {\n\t\t\t\t\t\t\tnext.value = iterable[i];\n\t\t\t\t\t\t\tnext.done = false;\n\t\t\t\t\t\t\treturn next;\n\t\t\t\t\t\t}\n\t\t\t\t\t}\n\t\t\t\t\tnext.value = undefined;\n\t\t\t\t\tnext.done = true;\n\t\t\t\t\treturn next;\n\t\t\t\t};\n\t\t\t\treturn next.next = next;\n\t\t\t}\n\t\t}\n\t\treturn { next: doneResult };\n\t}\n\n\t// Returns a function that iterates over an object's keys, for for-in loops in generators.\n\tfunction keys(object) {\n\t\tvar list = [];\n\t\tfor (var key in object) {\n\t\t\tlist.push(key);\n\t\t}\n\t\tlist.reverse();\n\t\treturn function next() {\n\t\t\twhile (list.length) {\n\t\t\t\tvar key = list.pop();\n\t\t\t\tif (key in object) {\n\t\t\t\t\tnext.value = key;\n\t\t\t\t\tnext.done = false;\n\t\t\t\t\treturn next;\n\t\t\t\t}\n\t\t\t}\n\t\t\tnext.done = true;\n\t\t\treturn next;\n\t\t};\n\t}\n\n\tfunction doneResult() {\n\t\treturn { value: undefined, done: true };\n\t}\n\n\tglobal.regeneratorRuntime = {\n\t\tmark: mark,\n\t\twrap: wrap,\n\t\tisGeneratorFunction: isGeneratorFunction,\n\t\tkeys: keys,\n\t\tvalues: values\n\t};\n})(this);\n"),
+	}
+
+	// define dirs
+	dir3 := &embedded.EmbeddedDir{
+		Filename:   "",
+		DirModTime: time.Unix(1539760000, 0),
+		ChildFiles: []*embedded.EmbeddedFile{
+			file4, // "runtime.js"
+
+		},
+	}
+
+	// link ChildDirs
+	dir3.ChildDirs = []*embedded.EmbeddedDir{}
+
+	// register embeddedBox
+	embedded.RegisterEmbeddedBox(`regenerator`, &embedded.EmbeddedBox{
+		Name: `regenerator`,
+		Time: time.Unix(1539760000, 0),
+		Dirs: map[string]*embedded.EmbeddedDir{
+			"": dir3,
+		},
+		Files: map[string]*embedded.EmbeddedFile{
+			"runtime.js": file4,
+		},
+	})
+}
@@ -23,20 +23,28 @@ package modules
 import (
 	"github.com/loadimpact/k6/js/modules/k6"
 	"github.com/loadimpact/k6/js/modules/k6/crypto"
+	"github.com/loadimpact/k6/js/modules/k6/data"
 	"github.com/loadimpact/k6/js/modules/k6/encoding"
+	"github.com/loadimpact/k6/js/modules/k6/execution"
+	"github.com/loadimpact/k6/js/modules/k6/grpc"
 	"github.com/loadimpact/k6/js/modules/k6/html"
 	"github.com/loadimpact/k6/js/modules/k6/http"
 	"github.com/loadimpact/k6/js/modules/k6/metrics"
+	"github.com/loadimpact/k6/js/modules/k6/sse"
 	"github.com/loadimpact/k6/js/modules/k6/ws"
 )
 
 // Index of module implementations.
 var Index = map[string]interface{}{
-	"k6":          k6.New(),
-	"k6/crypto":   crypto.New(),
-	"k6/encoding": encoding.New(),
-	"k6/http":     http.New(),
-	"k6/metrics":  metrics.New(),
-	"k6/html":     html.New(),
-	"k6/ws":       ws.New(),
+	"k6":           k6.New(),
+	"k6/crypto":    crypto.New(),
+	"k6/data":      data.New(),
+	"k6/encoding":  encoding.New(),
+	"k6/execution": execution.New(),
+	"k6/grpc":      grpc.New(),
+	"k6/http":      http.New(),
+	"k6/metrics":   metrics.New(),
+	"k6/html":      html.New(),
+	"k6/sse":       sse.New(),
+	"k6/ws":        ws.New(),
 }
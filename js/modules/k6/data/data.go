@@ -0,0 +1,134 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package data implements the k6/data module, which holds test data that's shared between VUs.
+package data
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/pkg/errors"
+)
+
+type Data struct{}
+
+// SharedArray is a read-only array, created once per test and shared between all VUs. The
+// elements are kept JSON-encoded, and decoded into a fresh object every time they're accessed,
+// so VUs can't modify each other's data. Since the runtime doesn't support proxies, elements are
+// accessed with get() rather than by index, and scripts get it wrapped in sharedArrayShim.
+type SharedArray struct {
+	rt       *goja.Runtime
+	parse    goja.Callable
+	elements []string
+
+	Length int `json:"length"`
+}
+
+// Wraps a bound SharedArray in a frozen object with length, get() and an iterator, so it can be
+// used with for...of and Array.from(). The wrapper's size doesn't depend on the number of elements,
+// which are only decoded when they're accessed.
+var sharedArrayShim = goja.MustCompile("k6/data/shared_array.js", `(function(src) {
+	var arr = { length: src.length, get: function(i) { return src.get(i); } };
+	if (typeof Symbol === "function" && Symbol.iterator) {
+		Object.defineProperty(arr, Symbol.iterator, { value: function() {
+			var i = 0;
+			return { next: function() {
+				return i < src.length ? { value: src.get(i++), done: false } : { value: undefined, done: true };
+			} };
+		} });
+	}
+	return Object.freeze(arr);
+})`, true)
+
+func New() *Data {
+	return &Data{}
+}
+
+// XSharedArray returns the SharedArray with the given name, calling fn to make it if this is the
+// first VU to ask for it. fn runs in the init context, so it can open() files, which then end up
+// in archives as usual.
+func (*Data) XSharedArray(ctx context.Context, name string, fn goja.Value) (interface{}, error) {
+	shared := common.GetSharedObjects(ctx)
+	if shared == nil {
+		return nil, errors.New("SharedArray can only be created in the init context")
+	}
+	if name == "" {
+		return nil, errors.New("SharedArray needs a name")
+	}
+	create, ok := goja.AssertFunction(fn)
+	if !ok {
+		return nil, errors.New("the second argument to SharedArray must be a function")
+	}
+
+	rt := common.GetRuntime(ctx)
+	elements, err := shared.GetOrCreate("k6/data.SharedArray."+name, func() (interface{}, error) {
+		return makeElements(rt, create)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	parse, _ := goja.AssertFunction(rt.Get("JSON").ToObject(rt).Get("parse"))
+	arr := &SharedArray{rt: rt, parse: parse, elements: elements.([]string)}
+	arr.Length = len(arr.elements)
+
+	shim, err := rt.RunProgram(sharedArrayShim)
+	if err != nil {
+		return nil, err
+	}
+	wrap, _ := goja.AssertFunction(shim)
+	return wrap(goja.Undefined(), rt.ToValue(common.Bind(rt, arr, nil)))
+}
+
+// Get returns a copy of the element at index, or undefined if it's out of range.
+func (a *SharedArray) Get(index int) (goja.Value, error) {
+	if index < 0 || index >= len(a.elements) {
+		return goja.Undefined(), nil
+	}
+	return a.parse(goja.Undefined(), a.rt.ToValue(a.elements[index]))
+}
+
+// Calls the user's function and encodes each element of the array it returns.
+func makeElements(rt *goja.Runtime, create goja.Callable) ([]string, error) {
+	v, err := create(goja.Undefined())
+	if err != nil {
+		return nil, err
+	}
+	if goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil, errors.New("the SharedArray function must return an array")
+	}
+	data, err := v.ToObject(rt).MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.New("the SharedArray function must return an array")
+	}
+	elements := make([]string, len(raw))
+	for i, element := range raw {
+		elements[i] = string(element)
+	}
+	return elements, nil
+}
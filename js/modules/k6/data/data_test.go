@@ -0,0 +1,141 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package data
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	jslib "github.com/loadimpact/k6/js/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newInitRuntime(shared *common.SharedObjects) *goja.Runtime {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	if shared != nil {
+		ctx = common.WithSharedObjects(ctx, shared)
+	}
+	rt.Set("data", common.Bind(rt, New(), &ctx))
+	return rt
+}
+
+func TestSharedArray(t *testing.T) {
+	shared := common.NewSharedObjects()
+	calls := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		rt := newInitRuntime(shared)
+		rt.Set("count", func() { calls++ })
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := common.RunString(rt, `
+			let arr = new data.SharedArray("test", function() {
+				count();
+				return [{ name: "a", values: [1, 2] }, "b", 3, null];
+			});
+			if (arr.length !== 4) { throw new Error("unexpected length: " + arr.length); }
+
+			let first = arr.get(0);
+			if (first.name !== "a" || first.values[1] !== 2) { throw new Error("unexpected element: " + JSON.stringify(first)); }
+			first.name = "changed";
+			if (arr.get(0).name !== "a") { throw new Error("element was modified"); }
+
+			if (arr.get(1) !== "b" || arr.get(2) !== 3 || arr.get(3) !== null) { throw new Error("unexpected elements"); }
+			if (arr.get(4) !== undefined || arr.get(-1) !== undefined) { throw new Error("unexpected out of range element"); }
+			`)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, calls)
+
+	t.Run("Names", func(t *testing.T) {
+		rt := newInitRuntime(shared)
+		_, err := common.RunString(rt, `
+		let other = new data.SharedArray("other", function() { return [1, 2]; });
+		if (other.length !== 2) { throw new Error("unexpected length: " + other.length); }
+		let test = new data.SharedArray("test", function() { throw new Error("shouldn't be called"); });
+		if (test.length !== 4) { throw new Error("unexpected length: " + test.length); }
+		`)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Iterator", func(t *testing.T) {
+		rt := newInitRuntime(shared)
+		_, err := rt.RunProgram(jslib.GetCoreJS())
+		require.NoError(t, err)
+		_, err = common.RunString(rt, `
+		"use strict";
+		let arr = new data.SharedArray("test", function() { throw new Error("shouldn't be called"); });
+		let seen = [];
+		for (let v of arr) { seen.push(v); }
+		if (JSON.stringify(seen) !== '[{"name":"a","values":[1,2]},"b",3,null]') {
+			throw new Error("unexpected iteration: " + JSON.stringify(seen));
+		}
+		let types = Array.from(arr).map(function(v) { return typeof v; });
+		if (types.join() !== "object,string,number,object") { throw new Error("unexpected map: " + types); }
+
+		// Nothing is materialized per element, and the wrapper can't be modified.
+		if (Object.keys(arr).join() !== "length,get") { throw new Error("unexpected keys: " + Object.keys(arr)); }
+		for (let fn of [
+			function() { arr[0] = 1; },
+			function() { arr.length = 0; },
+			function() { arr.get = null; },
+		]) {
+			let threw = false;
+			try { fn(); } catch (e) { threw = true; }
+			if (!threw) { throw new Error("array was modified: " + fn); }
+		}
+		if (arr.length !== 4) { throw new Error("unexpected length: " + arr.length); }
+		`)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		testdata := map[string]string{
+			`new data.SharedArray("", function() { return []; })`:          "SharedArray needs a name",
+			`new data.SharedArray("noFunc", [1, 2])`:                       "the second argument to SharedArray must be a function",
+			`new data.SharedArray("object", function() { return {}; })`:    "the SharedArray function must return an array",
+			`new data.SharedArray("undefined", function() {})`:             "the SharedArray function must return an array",
+			`new data.SharedArray("throws", function() { throw "oops"; })`: "oops",
+		}
+		for src, msg := range testdata {
+			t.Run(src, func(t *testing.T) {
+				_, err := common.RunString(newInitRuntime(shared), src)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), msg)
+			})
+		}
+	})
+
+	t.Run("NotInitContext", func(t *testing.T) {
+		_, err := common.RunString(newInitRuntime(nil), `new data.SharedArray("test", function() { return []; })`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "SharedArray can only be created in the init context")
+	})
+}
@@ -0,0 +1,290 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/pkg/errors"
+)
+
+// Row distribution policies for datasets.
+const (
+	PolicyUnique     = "unique"     // Each row is handed out once across the whole test.
+	PolicySequential = "sequential" // Each VU reads all rows in order.
+	PolicyRandom     = "random"     // Each VU reads random rows.
+)
+
+// What to do when a dataset runs out of rows.
+const (
+	ExhaustedWrap = "wrap" // Start over from the first row.
+	ExhaustedStop = "stop" // Abort the test.
+)
+
+// The parsed rows of a dataset, shared between all VUs. Rows are kept JSON-encoded, like a
+// SharedArray's elements.
+type datasetRows struct {
+	rows []string
+
+	// Number of rows handed out so far by the unique policy; accessed atomically.
+	next uint64
+}
+
+// Dataset reads rows from a CSV or JSON file, handing them out to iterations according to a
+// distribution policy. The file is parsed once per test; each VU gets its own handle.
+type Dataset struct {
+	rt    *goja.Runtime
+	parse goja.Callable
+	data  *datasetRows
+
+	policy        string
+	whenExhausted string
+
+	// Per-VU state for the sequential and random policies.
+	seq  int
+	rand *rand.Rand
+
+	Name   string `json:"name"`
+	Length int    `json:"length"`
+}
+
+// XDataset returns a handle for the dataset with the given name, parsing its file if this is the
+// first VU to ask for it. Options are: file (required), format ("csv" or "json", from the file's
+// extension by default), header (whether a CSV file's first row names its columns; default true),
+// delimiter (default ","), policy (unique, sequential or random; default unique) and
+// whenExhausted (wrap or stop; default wrap).
+func (*Data) XDataset(ctxPtr *context.Context, name string, options goja.Value) (interface{}, error) {
+	ctx := *ctxPtr
+	rt := common.GetRuntime(ctx)
+	shared := common.GetSharedObjects(ctx)
+	open := common.GetFileOpener(ctx)
+	if shared == nil || open == nil {
+		return nil, errors.New("Dataset can only be created in the init context")
+	}
+	if name == "" {
+		return nil, errors.New("Dataset needs a name")
+	}
+
+	file, format, delimiter, header := "", "", ",", true
+	policy, whenExhausted := PolicyUnique, ExhaustedWrap
+	if options != nil && !goja.IsUndefined(options) && !goja.IsNull(options) {
+		params := options.ToObject(rt)
+		for _, k := range params.Keys() {
+			v := params.Get(k)
+			if goja.IsUndefined(v) || goja.IsNull(v) {
+				continue
+			}
+			switch k {
+			case "file":
+				file = v.String()
+			case "format":
+				format = strings.ToLower(v.String())
+			case "header":
+				header = v.ToBoolean()
+			case "delimiter":
+				delimiter = v.String()
+			case "policy":
+				policy = v.String()
+			case "whenExhausted":
+				whenExhausted = v.String()
+			}
+		}
+	}
+	if file == "" {
+		return nil, errors.Errorf("dataset '%s' needs a file", name)
+	}
+	if format == "" {
+		format = "csv"
+		if strings.ToLower(filepath.Ext(file)) == ".json" {
+			format = "json"
+		}
+	}
+	switch policy {
+	case PolicyUnique, PolicySequential, PolicyRandom:
+	default:
+		return nil, errors.Errorf("dataset '%s' has an invalid policy: %s", name, policy)
+	}
+	switch whenExhausted {
+	case ExhaustedWrap, ExhaustedStop:
+	default:
+		return nil, errors.Errorf("dataset '%s' has an invalid whenExhausted: %s", name, whenExhausted)
+	}
+
+	data, err := shared.GetOrCreate("k6/data.Dataset."+name, func() (interface{}, error) {
+		src, err := open(file)
+		if err != nil {
+			return nil, err
+		}
+		var rows []string
+		switch format {
+		case "csv":
+			rows, err = parseCSV(src, delimiter, header)
+		case "json":
+			rows, err = parseJSON(src)
+		default:
+			return nil, errors.Errorf("unsupported format: %s", format)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse %s", file)
+		}
+		if len(rows) == 0 {
+			return nil, errors.Errorf("%s has no rows", file)
+		}
+		return &datasetRows{rows: rows}, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "dataset '%s'", name)
+	}
+
+	parse, _ := goja.AssertFunction(rt.Get("JSON").ToObject(rt).Get("parse"))
+	ds := &Dataset{
+		rt:            rt,
+		parse:         parse,
+		data:          data.(*datasetRows),
+		policy:        policy,
+		whenExhausted: whenExhausted,
+		rand:          rand.New(rand.NewSource(rand.Int63())),
+		Name:          name,
+	}
+	ds.Length = len(ds.data.rows)
+	return common.Bind(rt, ds, ctxPtr), nil
+}
+
+// Next returns a copy of the next row. When the dataset is exhausted and whenExhausted is "stop",
+// the test is aborted and an error is returned.
+func (d *Dataset) Next(ctx context.Context) (goja.Value, error) {
+	if common.GetState(ctx) == nil {
+		return nil, errors.New("datasets can't be read in the init context")
+	}
+
+	index, ok := d.nextIndex(lib.GetExecutionSegment(ctx))
+	if !ok {
+		reason := fmt.Sprintf("dataset '%s' is exhausted", d.Name)
+		if abort := lib.GetTestAbort(ctx); abort != nil {
+			abort(reason, 0)
+		}
+		return nil, errors.New(reason)
+	}
+	return d.parse(goja.Undefined(), d.rt.ToValue(d.data.rows[index]))
+}
+
+// Picks the index of the next row, returning false if the dataset is exhausted. The unique
+// policy hands out every seg.Count'th row, starting at seg.Index, so that instances running
+// different segments of the test never use the same row.
+func (d *Dataset) nextIndex(seg lib.ExecutionSegment) (int, bool) {
+	n := len(d.data.rows)
+	switch d.policy {
+	case PolicyRandom:
+		return d.rand.Intn(n), true
+	case PolicySequential:
+		i := d.seq
+		d.seq++
+		if i >= n && d.whenExhausted == ExhaustedStop {
+			return 0, false
+		}
+		return i % n, true
+	default:
+		i := int(atomic.AddUint64(&d.data.next, 1)-1)*seg.Count + seg.Index
+		if i >= n && d.whenExhausted == ExhaustedStop {
+			return 0, false
+		}
+		return i % n, true
+	}
+}
+
+// Parses CSV records into rows; with a header, each row is an object keyed by column name,
+// otherwise it's an array of fields.
+func parseCSV(src []byte, delimiter string, header bool) ([]string, error) {
+	r := csv.NewReader(bytes.NewReader(src))
+	if delimiter != "" {
+		r.Comma = []rune(delimiter)[0]
+	}
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	if header && len(records) > 0 {
+		columns, records = records[0], records[1:]
+	}
+	rows := make([]string, len(records))
+	for i, record := range records {
+		var data []byte
+		if columns == nil {
+			data, err = json.Marshal(record)
+		} else {
+			data, err = marshalRecord(columns, record)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = string(data)
+	}
+	return rows, nil
+}
+
+// Encodes a CSV record as an object, keeping the columns' order.
+func marshalRecord(columns, record []string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(record[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Splits a JSON array into its elements.
+func parseJSON(src []byte) ([]string, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(src, &raw); err != nil {
+		return nil, errors.New("a JSON dataset must be an array")
+	}
+	rows := make([]string, len(raw))
+	for i, row := range raw {
+		rows[i] = string(row)
+	}
+	return rows, nil
+}
@@ -0,0 +1,227 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package data
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFiles = map[string]string{
+	"users.csv":    "name,password\nalice,a1\nbob,b2\ncarol,c3\n",
+	"noheader.csv": "alice;a1\nbob;b2\n",
+	"users.json":   `[{"name": "alice"}, {"name": "bob"}, "carol"]`,
+	"object.json":  `{"name": "alice"}`,
+	"empty.csv":    "name,password\n",
+}
+
+// Returns a runtime in the init context, with testFiles available to open.
+func newDatasetInitRuntime(shared *common.SharedObjects) (*goja.Runtime, *context.Context) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	ctx = common.WithSharedObjects(ctx, shared)
+	ctx = common.WithFileOpener(ctx, func(name string) ([]byte, error) {
+		data, ok := testFiles[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(data), nil
+	})
+	rt.Set("data", common.Bind(rt, New(), &ctx))
+	return rt, &ctx
+}
+
+// Runs src in the init context of a new VU, then switches its context to a running one, which
+// is returned so tests can add to it.
+func newDatasetVU(t *testing.T, shared *common.SharedObjects, src string) (*goja.Runtime, *context.Context) {
+	rt, ctxPtr := newDatasetInitRuntime(shared)
+	_, err := common.RunString(rt, src)
+	require.NoError(t, err)
+
+	*ctxPtr = common.WithState(common.WithRuntime(context.Background(), rt), &common.State{})
+	return rt, ctxPtr
+}
+
+func nextRows(t *testing.T, rt *goja.Runtime, n int) []string {
+	rows := make([]string, n)
+	for i := range rows {
+		v, err := common.RunString(rt, `JSON.stringify(ds.next())`)
+		require.NoError(t, err)
+		rows[i] = v.String()
+	}
+	return rows
+}
+
+func TestDataset(t *testing.T) {
+	t.Run("CSV", func(t *testing.T) {
+		rt, _ := newDatasetVU(t, common.NewSharedObjects(), `let ds = new data.Dataset("users", { file: "users.csv" });`)
+		v, err := common.RunString(rt, `ds.length`)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), v.Export())
+		assert.Equal(t, []string{
+			`{"name":"alice","password":"a1"}`,
+			`{"name":"bob","password":"b2"}`,
+			`{"name":"carol","password":"c3"}`,
+			`{"name":"alice","password":"a1"}`,
+		}, nextRows(t, rt, 4))
+
+		_, err = common.RunString(rt, `
+		let row = ds.next();
+		row.name = "changed";
+		`)
+		require.NoError(t, err)
+		assert.Equal(t, []string{`{"name":"carol","password":"c3"}`}, nextRows(t, rt, 1))
+	})
+
+	t.Run("CSVNoHeader", func(t *testing.T) {
+		rt, _ := newDatasetVU(t, common.NewSharedObjects(),
+			`let ds = new data.Dataset("users", { file: "noheader.csv", header: false, delimiter: ";" });`)
+		assert.Equal(t, []string{`["alice","a1"]`, `["bob","b2"]`}, nextRows(t, rt, 2))
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		rt, _ := newDatasetVU(t, common.NewSharedObjects(), `let ds = new data.Dataset("users", { file: "users.json" });`)
+		assert.Equal(t, []string{`{"name":"alice"}`, `{"name":"bob"}`, `"carol"`}, nextRows(t, rt, 3))
+	})
+
+	t.Run("Unique", func(t *testing.T) {
+		shared := common.NewSharedObjects()
+		rows := make(chan string, 6)
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			rt, _ := newDatasetVU(t, shared, `let ds = new data.Dataset("users", { file: "users.csv", policy: "unique" });`)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, row := range nextRows(t, rt, 2) {
+					rows <- row
+				}
+			}()
+		}
+		wg.Wait()
+		close(rows)
+
+		seen := map[string]int{}
+		for row := range rows {
+			seen[row]++
+		}
+		assert.Equal(t, map[string]int{
+			`{"name":"alice","password":"a1"}`: 2,
+			`{"name":"bob","password":"b2"}`:   2,
+			`{"name":"carol","password":"c3"}`: 2,
+		}, seen)
+	})
+
+	t.Run("Sequential", func(t *testing.T) {
+		shared := common.NewSharedObjects()
+		for i := 0; i < 2; i++ {
+			rt, _ := newDatasetVU(t, shared, `let ds = new data.Dataset("users", { file: "users.json", policy: "sequential" });`)
+			assert.Equal(t, []string{`{"name":"alice"}`, `{"name":"bob"}`, `"carol"`, `{"name":"alice"}`}, nextRows(t, rt, 4))
+		}
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		rt, _ := newDatasetVU(t, common.NewSharedObjects(), `let ds = new data.Dataset("users", { file: "users.json", policy: "random" });`)
+		for _, row := range nextRows(t, rt, 20) {
+			assert.Contains(t, []string{`{"name":"alice"}`, `{"name":"bob"}`, `"carol"`}, row)
+		}
+	})
+
+	t.Run("Segments", func(t *testing.T) {
+		shared := common.NewSharedObjects()
+		for i, expected := range [][]string{
+			{`{"name":"alice"}`, `"carol"`},
+			{`{"name":"bob"}`},
+		} {
+			rt, ctxPtr := newDatasetVU(t, shared,
+				fmt.Sprintf(`let ds = new data.Dataset("users%d", { file: "users.json", whenExhausted: "stop" });`, i))
+			*ctxPtr = lib.WithExecutionSegment(*ctxPtr, lib.ExecutionSegment{Index: i, Count: 2})
+			assert.Equal(t, expected, nextRows(t, rt, len(expected)))
+			_, err := common.RunString(rt, `ds.next()`)
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		for _, policy := range []string{"unique", "sequential"} {
+			t.Run(policy, func(t *testing.T) {
+				rt, ctxPtr := newDatasetVU(t, common.NewSharedObjects(), fmt.Sprintf(
+					`let ds = new data.Dataset("users", { file: "users.csv", policy: "%s", whenExhausted: "stop" });`, policy))
+				var reasons []string
+				*ctxPtr = lib.WithTestAbort(*ctxPtr, func(reason string, exitCode int) {
+					assert.Equal(t, 0, exitCode)
+					reasons = append(reasons, reason)
+				})
+
+				assert.Len(t, nextRows(t, rt, 3), 3)
+				assert.Empty(t, reasons)
+				_, err := common.RunString(rt, `ds.next()`)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "dataset 'users' is exhausted")
+				assert.Equal(t, []string{"dataset 'users' is exhausted"}, reasons)
+			})
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		testdata := map[string]string{
+			`new data.Dataset("", { file: "users.csv" })`:                                  "Dataset needs a name",
+			`new data.Dataset("noFile", {})`:                                               "dataset 'noFile' needs a file",
+			`new data.Dataset("missing", { file: "missing.csv" })`:                         "dataset 'missing'",
+			`new data.Dataset("object", { file: "object.json" })`:                          "a JSON dataset must be an array",
+			`new data.Dataset("empty", { file: "empty.csv" })`:                             "empty.csv has no rows",
+			`new data.Dataset("format", { file: "users.csv", format: "xml" })`:             "unsupported format: xml",
+			`new data.Dataset("policy", { file: "users.csv", policy: "all" })`:             "dataset 'policy' has an invalid policy: all",
+			`new data.Dataset("exhausted", { file: "users.csv", whenExhausted: "never" })`: "dataset 'exhausted' has an invalid whenExhausted: never",
+		}
+		for src, msg := range testdata {
+			t.Run(src, func(t *testing.T) {
+				rt, _ := newDatasetInitRuntime(common.NewSharedObjects())
+				_, err := common.RunString(rt, src)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), msg)
+			})
+		}
+	})
+
+	t.Run("NotInitContext", func(t *testing.T) {
+		rt := newInitRuntime(common.NewSharedObjects())
+		_, err := common.RunString(rt, `new data.Dataset("users", { file: "users.csv" })`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Dataset can only be created in the init context")
+	})
+
+	t.Run("NextInInitContext", func(t *testing.T) {
+		rt, _ := newDatasetInitRuntime(common.NewSharedObjects())
+		_, err := common.RunString(rt, `new data.Dataset("users", { file: "users.csv" }).next()`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "datasets can't be read in the init context")
+	})
+}
@@ -0,0 +1,147 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package execution implements the k6/execution module, which tells scripts about the test
+// they're running, and lets them abort it.
+package execution
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// AbortExitCode is what k6 exits with when a script aborts the test without giving an exit code.
+const AbortExitCode = 104
+
+// ErrExecutionInInitContext is returned when k6/execution is used in the init context.
+var ErrExecutionInInitContext = common.NewInitContextError("Using k6/execution in the init context is not supported")
+
+type Execution struct{}
+
+func New() *Execution {
+	return &Execution{}
+}
+
+// Stage returns the index of the stage the VU's executor is in; with scenarios, that's the VU's
+// scenario. It's -1 if there are no stages, or they're all over.
+func (*Execution) Stage(ctx context.Context) (int, error) {
+	info, err := getInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return lib.StageAt(info.Current.GetStages(), info.Current.GetTime()), nil
+}
+
+// Elapsed returns how long the test has been running for, in milliseconds, not counting pauses.
+func (*Execution) Elapsed(ctx context.Context) (float64, error) {
+	info, err := getInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return stats.D(info.Test.GetTime()), nil
+}
+
+// StartTime returns when the test started, in milliseconds since the Unix epoch, like Date.now().
+func (*Execution) StartTime(ctx context.Context) (int64, error) {
+	info, err := getInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return info.StartTime.UnixNano() / int64(time.Millisecond), nil
+}
+
+// ActiveVUs returns the number of VUs currently running the test. In distributed tests, that's
+// only the ones on the VU's own agent.
+func (*Execution) ActiveVUs(ctx context.Context) (int64, error) {
+	info, err := getInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return info.Test.GetVUs(), nil
+}
+
+// Iteration returns the number of the current iteration among all of the test's, across VUs;
+// unlike __ITER, which counts the VU's own. It's -1 outside of iterations, eg. in setup(). In
+// distributed tests, it only counts the iterations of the VU's own agent.
+func (*Execution) Iteration(ctx context.Context) (int64, error) {
+	state := common.GetState(ctx)
+	if state == nil {
+		return 0, ErrExecutionInInitContext
+	}
+	return state.GlobalIteration, nil
+}
+
+// Options returns the test's options, as they would be exported by a script.
+func (*Execution) Options(ctx context.Context) (goja.Value, error) {
+	state := common.GetState(ctx)
+	if state == nil {
+		return nil, ErrExecutionInInitContext
+	}
+	data, err := json.Marshal(state.Options)
+	if err != nil {
+		return nil, err
+	}
+	var opts map[string]interface{}
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return nil, err
+	}
+	return common.GetRuntime(ctx).ToValue(opts), nil
+}
+
+// Abort ends the test early, as if it ran its course, with teardown() and the end-of-test summary;
+// k6 then exits with the given exit code, or AbortExitCode if there's none. The current iteration
+// is interrupted by throwing an error.
+func (*Execution) Abort(ctx context.Context, reason string, exitCode goja.Value) (goja.Value, error) {
+	if common.GetState(ctx) == nil {
+		return nil, ErrExecutionInInitContext
+	}
+	abort := lib.GetTestAbort(ctx)
+	if abort == nil {
+		return nil, errors.New("the test can't be aborted from here")
+	}
+	code := AbortExitCode
+	if exitCode != nil && !goja.IsUndefined(exitCode) && !goja.IsNull(exitCode) {
+		code = int(exitCode.ToInteger())
+	}
+	if reason == "" {
+		reason = "aborted by the script"
+	}
+	abort(reason, code)
+	return goja.Undefined(), errors.Errorf("test aborted: %s", reason)
+}
+
+// Returns the ExecutionInfo of the test the VU is running.
+func getInfo(ctx context.Context) (*lib.ExecutionInfo, error) {
+	if common.GetState(ctx) == nil {
+		return nil, ErrExecutionInInitContext
+	}
+	info := lib.GetExecutionInfo(ctx)
+	if info == nil {
+		return nil, errors.New("there's no test running")
+	}
+	return info, nil
+}
@@ -0,0 +1,130 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package execution
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Returns a runtime with the module bound to "execution", in the init context.
+func newRuntime() (*goja.Runtime, *context.Context) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("execution", common.Bind(rt, New(), &ctx))
+	return rt, &ctx
+}
+
+func TestExecution(t *testing.T) {
+	t.Run("InitContext", func(t *testing.T) {
+		rt, _ := newRuntime()
+		for _, fn := range []string{"stage", "elapsed", "startTime", "activeVUs", "iteration", "options", "abort"} {
+			_, err := common.RunString(rt, `execution.`+fn+`()`)
+			if assert.Error(t, err, fn) {
+				assert.Contains(t, err.Error(), "Using k6/execution in the init context is not supported", fn)
+			}
+		}
+	})
+
+	t.Run("NoTest", func(t *testing.T) {
+		rt, ctx := newRuntime()
+		*ctx = common.WithState(*ctx, &common.State{GlobalIteration: -1})
+		_, err := common.RunString(rt, `execution.elapsed()`)
+		assert.Contains(t, err.Error(), "there's no test running")
+		_, err = common.RunString(rt, `execution.abort()`)
+		assert.Contains(t, err.Error(), "the test can't be aborted from here")
+
+		v, err := common.RunString(rt, `execution.iteration()`)
+		require.NoError(t, err)
+		assert.Equal(t, int64(-1), v.Export())
+	})
+
+	t.Run("Running", func(t *testing.T) {
+		ex := local.New(nil)
+		require.NoError(t, ex.SetVUsMax(3))
+		require.NoError(t, ex.SetVUs(2))
+		ex.SetStages([]lib.Stage{
+			{Duration: types.NullDurationFrom(10 * time.Second), Target: null.IntFrom(2)},
+		})
+		startTime := time.Unix(1500000000, 0)
+
+		rt, ctx := newRuntime()
+		*ctx = common.WithState(*ctx, &common.State{
+			GlobalIteration: 42,
+			Options:         lib.Options{VUs: null.IntFrom(2), Iterations: null.IntFrom(100)},
+		})
+		*ctx = lib.WithExecutionInfo(*ctx, lib.ExecutionInfo{Test: ex, StartTime: startTime, Current: ex})
+
+		for src, value := range map[string]interface{}{
+			`execution.stage()`:              int64(0),
+			`execution.elapsed()`:            int64(0),
+			`execution.startTime()`:          int64(1500000000000),
+			`execution.activeVUs()`:          int64(2),
+			`execution.iteration()`:          int64(42),
+			`execution.options().vus`:        int64(2),
+			`execution.options().iterations`: int64(100),
+		} {
+			v, err := common.RunString(rt, src)
+			if assert.NoError(t, err, src) {
+				assert.Equal(t, value, v.Export(), src)
+			}
+		}
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		testdata := map[string]struct {
+			Src      string
+			Reason   string
+			ExitCode int
+		}{
+			"default":   {`execution.abort()`, "aborted by the script", AbortExitCode},
+			"reason":    {`execution.abort("enough")`, "enough", AbortExitCode},
+			"exit code": {`execution.abort("enough", 3)`, "enough", 3},
+			"zero":      {`execution.abort("enough", 0)`, "enough", 0},
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				var reason string
+				exitCode := -1
+				rt, ctx := newRuntime()
+				*ctx = common.WithState(*ctx, &common.State{})
+				*ctx = lib.WithTestAbort(*ctx, func(r string, code int) { reason, exitCode = r, code })
+
+				_, err := common.RunString(rt, data.Src)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "test aborted: "+data.Reason)
+				assert.Equal(t, data.Reason, reason)
+				assert.Equal(t, data.ExitCode, exitCode)
+			})
+		}
+	})
+}
@@ -0,0 +1,528 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultConnectTimeout is how long connect() waits for a connection, unless told otherwise.
+const DefaultConnectTimeout = 60 * time.Second
+
+// A Client talks to a single gRPC server at a time, using the services loaded into it.
+type Client struct {
+	methods map[string]*desc.MethodDescriptor
+
+	conn   *grpc.ClientConn
+	scheme string
+	addr   string
+}
+
+// MethodInfo describes a method loaded from a .proto file.
+type MethodInfo struct {
+	Package        string `json:"package"`
+	Service        string `json:"service"`
+	FullMethod     string `json:"full_method"`
+	IsClientStream bool   `json:"is_client_stream"`
+	IsServerStream bool   `json:"is_server_stream"`
+}
+
+// Response is the result of a call.
+type Response struct {
+	Status   int                 `json:"status"`
+	Message  interface{}         `json:"message"`
+	Messages []interface{}       `json:"messages"`
+	Headers  map[string][]string `json:"headers"`
+	Trailers map[string][]string `json:"trailers"`
+	Error    string              `json:"error"`
+}
+
+// Load loads .proto files, and the files they import, so their services can be called. Files are
+// looked up in the import paths, or relative to the script if there are none. It can only be
+// called in the init context, which also means that the files are included in archives.
+func (c *Client) Load(ctx context.Context, importPaths []string, filenames ...string) ([]MethodInfo, error) {
+	open := common.GetFileOpener(ctx)
+	if open == nil {
+		return nil, errors.New("load() can only be called in the init context")
+	}
+
+	parser := protoparse.Parser{
+		ImportPaths:      importPaths,
+		InferImportPaths: len(importPaths) == 0,
+		Accessor: func(filename string) (io.ReadCloser, error) {
+			src, err := open(filename)
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(bytes.NewReader(src)), nil
+		},
+	}
+	files, err := parser.ParseFiles(filenames...)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.methods == nil {
+		c.methods = map[string]*desc.MethodDescriptor{}
+	}
+	var methods []MethodInfo
+	for _, file := range files {
+		c.addMethods(file)
+		for _, sd := range file.GetServices() {
+			for _, md := range sd.GetMethods() {
+				methods = append(methods, MethodInfo{
+					Package:        file.GetPackage(),
+					Service:        sd.GetName(),
+					FullMethod:     fullMethod(md),
+					IsClientStream: md.IsClientStreaming(),
+					IsServerStream: md.IsServerStreaming(),
+				})
+			}
+		}
+	}
+	return methods, nil
+}
+
+// Makes the methods of a file, and of the files it imports, callable.
+func (c *Client) addMethods(file *desc.FileDescriptor) {
+	for _, sd := range file.GetServices() {
+		for _, md := range sd.GetMethods() {
+			c.methods[fullMethod(md)] = md
+		}
+	}
+	for _, dep := range file.GetDependencies() {
+		c.addMethods(dep)
+	}
+}
+
+// Returns the name a method is called by, "/package.Service/Method".
+func fullMethod(md *desc.MethodDescriptor) string {
+	return "/" + md.GetService().GetFullyQualifiedName() + "/" + md.GetName()
+}
+
+// Connect connects to a server at an address ("host:port"), using TLS unless the plaintext param
+// is set. Any previous connection is closed.
+func (c *Client) Connect(ctx context.Context, addr string, params goja.Value) (bool, error) {
+	state := common.GetState(ctx)
+	if state == nil {
+		return false, ErrGRPCInInitContext
+	}
+	rt := common.GetRuntime(ctx)
+
+	plaintext := false
+	timeout := DefaultConnectTimeout
+	if params != nil && !goja.IsUndefined(params) && !goja.IsNull(params) {
+		obj := params.ToObject(rt)
+		for _, k := range obj.Keys() {
+			switch k {
+			case "plaintext":
+				plaintext = obj.Get(k).ToBoolean()
+			case "timeout":
+				var err error
+				if timeout, err = parseTimeout(obj.Get(k)); err != nil {
+					return false, err
+				}
+			default:
+				return false, errors.Errorf("unknown connect param: '%s'", k)
+			}
+		}
+	}
+
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.FailOnNonTempDialError(true),
+		// Reconnects go through the same dialer, so options like blacklistIPs and hosts apply.
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			dialCtx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				dialCtx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			return state.Dialer.DialContext(dialCtx, "tcp", addr)
+		}),
+	}
+	if userAgent := state.Options.UserAgent; userAgent.String != "" {
+		opts = append(opts, grpc.WithUserAgent(userAgent.String))
+	}
+	scheme := "http"
+	if plaintext {
+		opts = append(opts, grpc.WithInsecure())
+	} else {
+		scheme = "https"
+		tlsConfig := &tls.Config{}
+		if state.TLSConfig != nil {
+			tlsConfig = state.TLSConfig.Clone()
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(dialCtx, addr, opts...)
+	if err != nil {
+		return false, err
+	}
+	c.conn = conn
+	c.scheme = scheme
+	c.addr = addr
+	return true, nil
+}
+
+// Close closes the connection, if any.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Invoke makes a unary call, ie. one that sends a single request and receives a single response.
+func (c *Client) Invoke(ctx context.Context, method string, req goja.Value, params goja.Value) (*Response, error) {
+	md, err := c.method(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+	if md.IsClientStreaming() || md.IsServerStreaming() {
+		return nil, errors.Errorf("%s is a streaming method, use stream() to call it", fullMethod(md))
+	}
+
+	msg, err := newMessage(md.GetInputType(), exportValue(req))
+	if err != nil {
+		return nil, err
+	}
+	return c.call(ctx, md, []*dynamic.Message{msg}, params)
+}
+
+// Stream makes a streaming call. For client streaming methods, an array of requests is sent,
+// otherwise a single one. All requests are sent up front, then all responses are read until the
+// server ends the call; they end up in messages.
+func (c *Client) Stream(ctx context.Context, method string, reqs goja.Value, params goja.Value) (*Response, error) {
+	md, err := c.method(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*dynamic.Message
+	if md.IsClientStreaming() {
+		items, ok := exportValue(reqs).([]interface{})
+		if !ok {
+			return nil, errors.Errorf("%s is a client streaming method, it needs an array of requests", fullMethod(md))
+		}
+		for i, item := range items {
+			msg, err := newMessage(md.GetInputType(), item)
+			if err != nil {
+				return nil, errors.Wrapf(err, "request %d", i)
+			}
+			msgs = append(msgs, msg)
+		}
+	} else {
+		msg, err := newMessage(md.GetInputType(), exportValue(reqs))
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return c.call(ctx, md, msgs, params)
+}
+
+func exportValue(v goja.Value) interface{} {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	return v.Export()
+}
+
+// Looks up a method ("package.Service/Method"), and checks that a call can be made.
+func (c *Client) method(ctx context.Context, method string) (*desc.MethodDescriptor, error) {
+	if common.GetState(ctx) == nil {
+		return nil, ErrGRPCInInitContext
+	}
+	if c.conn == nil {
+		return nil, errors.New("no gRPC connection, you must call connect() first")
+	}
+	if !strings.HasPrefix(method, "/") {
+		method = "/" + method
+	}
+	md, ok := c.methods[method]
+	if !ok {
+		return nil, errors.Errorf("method '%s' not found in the loaded .proto files", method)
+	}
+	return md, nil
+}
+
+// Converts a JS value to a message, following protobuf's JSON mapping.
+func newMessage(md *desc.MessageDescriptor, v interface{}) (*dynamic.Message, error) {
+	msg := dynamic.NewMessage(md)
+	if v == nil {
+		return msg, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := msg.UnmarshalJSONPB(&jsonpb.Unmarshaler{}, data); err != nil {
+		return nil, errors.Wrapf(err, "invalid %s", md.GetFullyQualifiedName())
+	}
+	return msg, nil
+}
+
+// Converts a message to a JS-friendly value, following protobuf's JSON mapping. Fields that aren't
+// set are included with their default values, so scripts don't need to check for them.
+func messageValue(msg *dynamic.Message) (interface{}, error) {
+	data, err := msg.MarshalJSONPB(&jsonpb.Marshaler{EmitDefaults: true})
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Params for a call.
+type callParams struct {
+	metadata metadata.MD
+	timeout  time.Duration
+	tags     map[string]string
+}
+
+func parseCallParams(rt *goja.Runtime, params goja.Value) (*callParams, error) {
+	p := &callParams{metadata: metadata.MD{}, tags: map[string]string{}}
+	if params == nil || goja.IsUndefined(params) || goja.IsNull(params) {
+		return p, nil
+	}
+	obj := params.ToObject(rt)
+	for _, k := range obj.Keys() {
+		v := obj.Get(k)
+		switch k {
+		case "metadata":
+			if goja.IsUndefined(v) || goja.IsNull(v) {
+				continue
+			}
+			md := v.ToObject(rt)
+			for _, key := range md.Keys() {
+				name := strings.ToLower(key)
+				if strings.HasPrefix(name, "grpc-") {
+					return nil, errors.Errorf("'%s' is a reserved metadata key", key)
+				}
+				p.metadata.Append(name, md.Get(key).String())
+			}
+		case "timeout":
+			var err error
+			if p.timeout, err = parseTimeout(v); err != nil {
+				return nil, err
+			}
+		case "tags":
+			if goja.IsUndefined(v) || goja.IsNull(v) {
+				continue
+			}
+			tags := v.ToObject(rt)
+			for _, key := range tags.Keys() {
+				p.tags[key] = tags.Get(key).String()
+			}
+		default:
+			return nil, errors.Errorf("unknown param: '%s'", k)
+		}
+	}
+	return p, nil
+}
+
+// Parses a timeout, either a number of milliseconds or a duration string like "10s".
+func parseTimeout(v goja.Value) (time.Duration, error) {
+	if s, ok := v.Export().(string); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, errors.Errorf("invalid timeout '%s'", s)
+		}
+		return d, nil
+	}
+	return time.Duration(v.ToFloat() * float64(time.Millisecond)), nil
+}
+
+func (c *Client) call(
+	ctx context.Context, md *desc.MethodDescriptor, reqs []*dynamic.Message, paramsV goja.Value,
+) (*Response, error) {
+	state := common.GetState(ctx)
+	p, err := parseCallParams(common.GetRuntime(ctx), paramsV)
+	if err != nil {
+		return nil, err
+	}
+
+	reqCtx := metadata.NewOutgoingContext(ctx, p.metadata)
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(reqCtx, p.timeout)
+		defer cancel()
+	}
+
+	startTime := time.Now()
+	res := c.roundTrip(reqCtx, md, reqs)
+	endTime := time.Now()
+
+	// The method tag is the HTTP method for every other protocol, so the gRPC method is only in
+	// the url (and name) tags.
+	reqURL := c.scheme + "://" + c.addr + fullMethod(md)
+	tags := state.Options.RunTags.CloneTags()
+	for k, v := range p.tags {
+		tags[k] = v
+	}
+	if state.Options.SystemTags["proto"] {
+		tags["proto"] = "HTTP/2"
+	}
+	if state.Options.SystemTags["url"] {
+		tags["url"] = reqURL
+	}
+	if _, ok := tags["name"]; !ok && state.Options.SystemTags["name"] {
+		tags["name"] = reqURL
+	}
+	if state.Options.SystemTags["status"] {
+		tags["status"] = strconv.Itoa(res.Status)
+	}
+	if state.Options.SystemTags["error"] && res.Error != "" {
+		tags["error"] = res.Error
+	}
+	if state.Options.SystemTags["group"] {
+		tags["group"] = state.Group.Path
+	}
+	if state.Options.SystemTags["vu"] {
+		tags["vu"] = strconv.FormatInt(state.Vu, 10)
+	}
+	if state.Options.SystemTags["iter"] {
+		tags["iter"] = strconv.FormatInt(state.Iteration, 10)
+	}
+	stats.PushIfNotCancelled(ctx, state.Samples, stats.Sample{
+		Metric: metrics.GRPCReqDuration,
+		Time:   endTime,
+		Tags:   stats.IntoSampleTags(&tags),
+		Value:  stats.D(endTime.Sub(startTime)),
+	})
+
+	return res, nil
+}
+
+// Makes a call, and reads all the responses. Failures are reported in the response's status,
+// like they would be by any other gRPC client.
+func (c *Client) roundTrip(ctx context.Context, md *desc.MethodDescriptor, reqs []*dynamic.Message) *Response {
+	res := &Response{
+		Messages: []interface{}{},
+		Headers:  map[string][]string{},
+		Trailers: map[string][]string{},
+	}
+	streamDesc := &grpc.StreamDesc{
+		StreamName:    md.GetName(),
+		ClientStreams: md.IsClientStreaming(),
+		ServerStreams: md.IsServerStreaming(),
+	}
+
+	err := func() error {
+		stream, err := c.conn.NewStream(ctx, streamDesc, fullMethod(md))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			header, _ := stream.Header()
+			res.Headers = metadataValue(header)
+			res.Trailers = metadataValue(stream.Trailer())
+		}()
+
+		// io.EOF means the server ended the call early, its status is returned by RecvMsg.
+		for _, req := range reqs {
+			if err := stream.SendMsg(req); err != nil {
+				if err != io.EOF {
+					return err
+				}
+				break
+			}
+		}
+		if err := stream.CloseSend(); err != nil {
+			return err
+		}
+		for {
+			msg := dynamic.NewMessage(md.GetOutputType())
+			if err := stream.RecvMsg(msg); err != nil {
+				return err
+			}
+			v, err := messageValue(msg)
+			if err != nil {
+				return err
+			}
+			res.Messages = append(res.Messages, v)
+			if !streamDesc.ServerStreams {
+				return nil
+			}
+		}
+	}()
+	if err == io.EOF {
+		err = nil
+	}
+
+	if len(res.Messages) > 0 {
+		res.Message = res.Messages[0]
+	}
+	s := status.Convert(err)
+	res.Status = int(s.Code())
+	res.Error = s.Message()
+	return res
+}
+
+// Converts gRPC metadata to a JS-friendly value, without the keys gRPC uses for itself.
+func metadataValue(md metadata.MD) map[string][]string {
+	v := make(map[string][]string, len(md))
+	for k, vs := range md {
+		if strings.HasPrefix(k, "grpc-") || k == "content-type" {
+			continue
+		}
+		v[k] = vs
+	}
+	return v
+}
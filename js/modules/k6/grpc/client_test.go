@@ -0,0 +1,480 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	null "gopkg.in/guregu/null.v3"
+)
+
+const testProto = `
+// A service for tests.
+syntax = "proto3";
+
+package test.v1;
+
+import "google/protobuf/empty.proto";
+option go_package = "test";
+
+service Greeter {
+	rpc SayHello (HelloRequest) returns (HelloReply) {}
+	rpc Count (CountRequest) returns (stream CountReply);
+	rpc Sum (stream CountReply) returns (CountRequest);
+	rpc Chat (stream HelloRequest) returns (stream HelloReply) { option deprecated = true; }
+	rpc Ping (.google.protobuf.Empty) returns (google.protobuf.Empty);
+}
+
+message HelloRequest {
+	string name = 1;
+	repeated string greetings = 2;
+	Kind kind = 3;
+	map<string, int64> counts = 4;
+	/* An embedded message. */
+	Nested nested = 5;
+	oneof choice {
+		int32 number = 6;
+		string text = 7 [json_name = "words"];
+	}
+	optional bool flag = 8;
+	reserved 9, 10 to 12;
+	bytes data = 13;
+	repeated sint32 deltas = 14 [packed = false];
+
+	message Nested {
+		double value = 1;
+		Kind kind = 2;
+	}
+}
+
+enum Kind {
+	option allow_alias = true;
+	KIND_UNSPECIFIED = 0;
+	KIND_FRIENDLY = 1;
+	KIND_NICE = 1;
+	KIND_GRUMPY = -2 [deprecated = true];
+}
+
+message HelloReply {
+	string message = 1;
+	HelloRequest.Nested nested = 2;
+}
+
+message CountRequest { uint32 count = 1; }
+message CountReply { int64 number = 1; }
+`
+
+func testFileOpener(files map[string]string) common.FileOpener {
+	return func(name string) ([]byte, error) {
+		if src, ok := files[name]; ok {
+			return []byte(src), nil
+		}
+		return nil, os.ErrNotExist
+	}
+}
+
+func loadTestProto(t *testing.T) map[string]*desc.MethodDescriptor {
+	c := &Client{}
+	ctx := common.WithFileOpener(context.Background(), testFileOpener(map[string]string{"test.proto": testProto}))
+	_, err := c.Load(ctx, nil, "test.proto")
+	require.NoError(t, err)
+	return c.methods
+}
+
+// A test implementation of the Greeter service from testProto, serving whatever method is called.
+type greeter struct {
+	methods map[string]*desc.MethodDescriptor
+}
+
+func (g greeter) handle(_ interface{}, stream grpc.ServerStream) error {
+	name, _ := grpc.MethodFromServerStream(stream)
+	md := g.methods[name]
+	if md == nil {
+		return status.Errorf(codes.Unimplemented, "unknown method %s", name)
+	}
+
+	var reqs []*dynamic.Message
+	for {
+		req := dynamic.NewMessage(md.GetInputType())
+		if err := stream.RecvMsg(req); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		reqs = append(reqs, req)
+		if !md.IsClientStreaming() {
+			break
+		}
+	}
+
+	in, _ := metadata.FromIncomingContext(stream.Context())
+	header := metadata.MD{}
+	for _, k := range []string{"x-test", "x-test-bin"} {
+		if vs := in.Get(k); len(vs) > 0 {
+			header.Set(k, vs...)
+		}
+	}
+	header.Set("x-user-agent", in.Get("user-agent")...)
+	if deadline, ok := stream.Context().Deadline(); ok {
+		header.Set("x-timeout", time.Until(deadline).Round(time.Second).String())
+	}
+
+	var replies []*dynamic.Message
+	reply := func(fields map[string]interface{}) {
+		msg := dynamic.NewMessage(md.GetOutputType())
+		for k, v := range fields {
+			msg.SetFieldByName(k, v)
+		}
+		replies = append(replies, msg)
+	}
+	switch md.GetName() {
+	case "SayHello":
+		switch name := reqs[0].GetFieldByName("name"); name {
+		case "error":
+			// A trailers-only response.
+			return status.Error(codes.NotFound, "no such greeting")
+		case "slow":
+			<-stream.Context().Done()
+			return stream.Context().Err()
+		default:
+			reply(map[string]interface{}{"message": fmt.Sprintf("Hello %s", name)})
+		}
+	case "Count":
+		for i := int64(0); i < int64(reqs[0].GetFieldByName("count").(uint32)); i++ {
+			reply(map[string]interface{}{"number": i})
+		}
+	case "Sum":
+		var sum uint32
+		for _, req := range reqs {
+			sum += uint32(req.GetFieldByName("number").(int64))
+		}
+		reply(map[string]interface{}{"count": sum})
+	}
+
+	if err := stream.SendHeader(header); err != nil {
+		return err
+	}
+	for _, msg := range replies {
+		if err := stream.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+	stream.SetTrailer(metadata.Pairs("x-trailer", "done"))
+	return nil
+}
+
+// Starts a gRPC server for the greeter, using TLS if creds aren't nil.
+func startServer(t *testing.T, g greeter, creds credentials.TransportCredentials) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	opts := []grpc.ServerOption{grpc.UnknownServiceHandler(g.handle)}
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+	srv := grpc.NewServer(opts...)
+	go func() { _ = srv.Serve(l) }()
+	return l.Addr().String(), srv.Stop
+}
+
+func TestClient(t *testing.T) {
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	g := greeter{methods: loadTestProto(t)}
+	addr, stop := startServer(t, g, nil)
+	defer stop()
+
+	// Borrow httptest's certificate for the TLS server.
+	certSrv := httptest.NewTLSServer(nil)
+	cert := certSrv.TLS.Certificates[0]
+	certSrv.Close()
+	tlsAddr, stopTLS := startServer(t, g, credentials.NewServerTLSFromCert(&cert))
+	defer stopTLS()
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	opener := testFileOpener(map[string]string{
+		"test.proto":        testProto,
+		"protos/test.proto": testProto,
+		"a.proto":           `syntax = "proto3"; import "b.proto";`,
+		"b.proto":           `syntax = "proto3"; import "a.proto";`,
+	})
+	ctx := common.WithFileOpener(common.WithRuntime(context.Background(), rt), opener)
+	rt.Set("grpc", common.Bind(rt, New(), &ctx))
+	rt.Set("ADDR", addr)
+	rt.Set("TLS_ADDR", tlsAddr)
+
+	t.Run("InitContext", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		var client = new grpc.Client();
+		var methods = client.load([], "test.proto");
+		if (methods.length != 5) { throw new Error("unexpected methods: " + JSON.stringify(methods)); }
+		var m = methods[1];
+		if (m.full_method != "/test.v1.Greeter/Count" || m.service != "Greeter" || m.package != "test.v1" ||
+			m.is_client_stream || !m.is_server_stream) {
+			throw new Error("unexpected method: " + JSON.stringify(m));
+		}
+		client.load(["nope", "protos"], "test.proto");
+		`)
+		require.NoError(t, err)
+
+		_, err = common.RunString(rt, `new grpc.Client().load(["nope"], "test.proto")`)
+		assert.Contains(t, err.Error(), "test.proto: file does not exist")
+		_, err = common.RunString(rt, `new grpc.Client().load([], "a.proto")`)
+		assert.Contains(t, err.Error(), "cycle found in imports")
+		_, err = common.RunString(rt, `client.connect(ADDR, { plaintext: true })`)
+		assert.Contains(t, err.Error(), "Using gRPC in the init context is not supported")
+	})
+
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &common.State{
+		Group:  root,
+		Dialer: netext.NewDialer(net.Dialer{Timeout: 10 * time.Second}),
+		Options: lib.Options{
+			SystemTags: lib.GetTagSet("url", "proto", "status", "method", "name", "error", "group"),
+		},
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+		Samples:   samples,
+	}
+	ctx = common.WithState(common.WithRuntime(context.Background(), rt), state)
+
+	t.Run("Load", func(t *testing.T) {
+		_, err := common.RunString(rt, `client.load([], "test.proto")`)
+		assert.Contains(t, err.Error(), "load() can only be called in the init context")
+	})
+
+	t.Run("NotConnected", func(t *testing.T) {
+		_, err := common.RunString(rt, `client.invoke("test.v1.Greeter/SayHello", {})`)
+		assert.Contains(t, err.Error(), "no gRPC connection, you must call connect() first")
+	})
+
+	t.Run("Invoke", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		client.connect(ADDR, { plaintext: true });
+		var res = client.invoke("test.v1.Greeter/SayHello", { name: "k6" }, {
+			metadata: { "x-test": "yes", "x-test-bin": "\u0001\u0002" },
+			timeout: "10s",
+		});
+		if (res.status !== grpc.StatusOK) { throw new Error("unexpected status: " + res.status); }
+		if (res.message.message !== "Hello k6") { throw new Error("unexpected message: " + JSON.stringify(res.message)); }
+		if (res.messages.length !== 1) { throw new Error("unexpected messages: " + res.messages.length); }
+		if (res.headers["x-test"][0] !== "yes") { throw new Error("unexpected headers: " + JSON.stringify(res.headers)); }
+		if (res.headers["x-test-bin"][0] !== "\u0001\u0002") { throw new Error("unexpected binary header"); }
+		if (res.headers["x-timeout"][0] !== "10s") { throw new Error("unexpected timeout: " + res.headers["x-timeout"]); }
+		if (res.trailers["x-trailer"][0] !== "done") { throw new Error("unexpected trailers: " + JSON.stringify(res.trailers)); }
+		if (res.error !== "") { throw new Error("unexpected error: " + res.error); }
+		`)
+		require.NoError(t, err)
+
+		bufSamples := stats.GetBufferedSamples(samples)
+		require.Len(t, bufSamples, 1)
+		sample := bufSamples[0].GetSamples()[0]
+		assert.Equal(t, metrics.GRPCReqDuration, sample.Metric)
+		url := "http://" + addr + "/test.v1.Greeter/SayHello"
+		assert.Equal(t, map[string]string{
+			"url":    url,
+			"name":   url,
+			"proto":  "HTTP/2",
+			"status": "0",
+			"group":  "",
+		}, sample.Tags.CloneTags())
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		var res = client.invoke("/test.v1.Greeter/SayHello", { name: "error" }, { tags: { name: "greeting" } });
+		if (res.status !== grpc.StatusNotFound) { throw new Error("unexpected status: " + res.status); }
+		if (res.error !== "no such greeting") { throw new Error("unexpected error: " + res.error); }
+		if (res.message !== null) { throw new Error("unexpected message: " + JSON.stringify(res.message)); }
+
+		res = client.invoke("test.v1.Greeter/SayHello", { name: "slow" }, { timeout: 50 });
+		if (res.status !== grpc.StatusDeadlineExceeded) { throw new Error("unexpected status: " + res.status); }
+		`)
+		require.NoError(t, err)
+
+		bufSamples := stats.GetBufferedSamples(samples)
+		require.Len(t, bufSamples, 2)
+		tags := bufSamples[0].GetSamples()[0].Tags.CloneTags()
+		assert.Equal(t, "greeting", tags["name"])
+		assert.Equal(t, "5", tags["status"])
+		assert.Equal(t, "no such greeting", tags["error"])
+		assert.Equal(t, "4", bufSamples[1].GetSamples()[0].Tags.CloneTags()["status"])
+
+		testdata := map[string]string{
+			`client.invoke("test.v1.Greeter/Hello", {})`:                                          "method '/test.v1.Greeter/Hello' not found in the loaded .proto files",
+			`client.invoke("test.v1.Greeter/Count", {})`:                                          "/test.v1.Greeter/Count is a streaming method, use stream() to call it",
+			`client.invoke("test.v1.Greeter/SayHello", { nmae: "k6" })`:                           "invalid test.v1.HelloRequest: message type test.v1.HelloRequest has no known field named nmae",
+			`client.invoke("test.v1.Greeter/SayHello", {}, { retries: 1 })`:                       "unknown param: 'retries'",
+			`client.invoke("test.v1.Greeter/SayHello", {}, { metadata: { "grpc-status": "0" } })`: "'grpc-status' is a reserved metadata key",
+			`client.stream("test.v1.Greeter/Sum", {})`:                                            "/test.v1.Greeter/Sum is a client streaming method, it needs an array of requests",
+			`client.connect(ADDR, { plaintext: true, retries: 1 })`:                               "unknown connect param: 'retries'",
+		}
+		for code, msg := range testdata {
+			_, err := common.RunString(rt, code)
+			if assert.Error(t, err, code) {
+				assert.Contains(t, err.Error(), msg)
+			}
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		_, err := common.RunString(rt, `
+		client.connect(ADDR, { plaintext: true });
+		var res = client.stream("test.v1.Greeter/Count", { count: 3 });
+		if (res.status !== grpc.StatusOK) { throw new Error("unexpected status: " + res.status); }
+		var numbers = res.messages.map(function(m) { return m.number; });
+		if (JSON.stringify(numbers) !== '["0","1","2"]') { throw new Error("unexpected numbers: " + JSON.stringify(numbers)); }
+
+		res = client.stream("test.v1.Greeter/Sum", [{ number: 1 }, { number: "2" }, { number: 3 }]);
+		if (res.status !== grpc.StatusOK) { throw new Error("unexpected status: " + res.status); }
+		if (res.message.count !== 6) { throw new Error("unexpected sum: " + JSON.stringify(res.message)); }
+		`)
+		require.NoError(t, err)
+		assert.Len(t, stats.GetBufferedSamples(samples), 2)
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		state.Options.UserAgent = null.StringFrom("k6-test")
+		defer func() { state.Options.UserAgent = null.String{} }()
+		_, err := common.RunString(rt, `
+		client.connect(TLS_ADDR, { timeout: "5s" });
+		var res = client.invoke("test.v1.Greeter/SayHello", { name: "TLS" });
+		if (res.status !== grpc.StatusOK) { throw new Error("unexpected status: " + res.status + " " + res.error); }
+		if (res.message.message !== "Hello TLS") { throw new Error("unexpected message: " + JSON.stringify(res.message)); }
+		if (res.headers["x-user-agent"][0].indexOf("k6-test") !== 0) { throw new Error("unexpected user agent: " + res.headers["x-user-agent"]); }
+		client.close();
+		`)
+		require.NoError(t, err)
+		tags := stats.GetBufferedSamples(samples)[0].GetSamples()[0].Tags.CloneTags()
+		assert.Equal(t, "https://"+tlsAddr+"/test.v1.Greeter/SayHello", tags["url"])
+	})
+
+	t.Run("Unavailable", func(t *testing.T) {
+		_, err := common.RunString(rt, `client.connect(TLS_ADDR, { plaintext: true, timeout: 200 })`)
+		assert.Contains(t, err.Error(), "context deadline exceeded")
+
+		addr, stop := startServer(t, g, nil)
+		rt.Set("STOPPED_ADDR", addr)
+		_, err = common.RunString(rt, `client.connect(STOPPED_ADDR, { plaintext: true })`)
+		require.NoError(t, err)
+		stop()
+		_, err = common.RunString(rt, `
+		var res = client.invoke("test.v1.Greeter/SayHello", { name: "k6" });
+		if (res.status !== grpc.StatusUnavailable) { throw new Error("unexpected status: " + res.status + " " + res.error); }
+		`)
+		require.NoError(t, err)
+		stats.GetBufferedSamples(samples)
+	})
+}
+
+func TestMessages(t *testing.T) {
+	req := loadTestProto(t)["/test.v1.Greeter/SayHello"].GetInputType()
+
+	t.Run("Defaults", func(t *testing.T) {
+		msg, err := newMessage(req, nil)
+		require.NoError(t, err)
+		v, err := messageValue(msg)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"name":      "",
+			"greetings": []interface{}{},
+			"kind":      "KIND_UNSPECIFIED",
+			"counts":    map[string]interface{}{},
+			"nested":    nil,
+			"data":      "",
+			"deltas":    []interface{}{},
+		}, v)
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		value := map[string]interface{}{
+			"name":      "hi",
+			"greetings": []interface{}{"a", "b"},
+			"kind":      "KIND_GRUMPY",
+			"counts":    map[string]interface{}{"a": "1", "b": "-2"},
+			"nested":    map[string]interface{}{"value": 1.5, "kind": "KIND_FRIENDLY"},
+			"words":     "text",
+			"flag":      false,
+			"data":      "AQI=",
+			"deltas":    []interface{}{-1.0, 0.0, 1.0},
+		}
+		msg, err := newMessage(req, value)
+		require.NoError(t, err)
+		v, err := messageValue(msg)
+		require.NoError(t, err)
+		assert.Equal(t, value, v)
+	})
+
+	t.Run("Conversions", func(t *testing.T) {
+		// JS numbers and strings are both accepted for integers, enums by name or number.
+		msg, err := newMessage(req, map[string]interface{}{
+			"counts": map[string]interface{}{"a": int64(1), "b": "9007199254740993"},
+			"kind":   int64(1),
+			"text":   "original name",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[interface{}]interface{}{"a": int64(1), "b": int64(9007199254740993)}, msg.GetFieldByName("counts"))
+		assert.Equal(t, int32(1), msg.GetFieldByName("kind"))
+		assert.Equal(t, "original name", msg.GetFieldByName("text"))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		testdata := map[string]interface{}{
+			"NotAnObject":  "hi",
+			"UnknownField": map[string]interface{}{"nmae": "hi"},
+			"String":       map[string]interface{}{"name": int64(1)},
+			"Fraction":     map[string]interface{}{"number": 1.5},
+			"Enum":         map[string]interface{}{"kind": "KIND_ANGRY"},
+			"Bytes":        map[string]interface{}{"data": "!!"},
+		}
+		for name, value := range testdata {
+			t.Run(name, func(t *testing.T) {
+				_, err := newMessage(req, value)
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), "invalid test.v1.HelloRequest")
+				}
+			})
+		}
+	})
+}
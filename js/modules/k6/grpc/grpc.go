@@ -0,0 +1,103 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package grpc implements the k6/grpc module, a gRPC client. Services are described by .proto
+// files loaded in the init context; requests and responses are plain JS objects, following
+// protobuf's JSON mapping, so no generated code is needed.
+package grpc
+
+import (
+	"context"
+
+	"github.com/loadimpact/k6/js/common"
+)
+
+// gRPC status codes, see https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	StatusOK                 = 0
+	StatusCanceled           = 1
+	StatusUnknown            = 2
+	StatusInvalidArgument    = 3
+	StatusDeadlineExceeded   = 4
+	StatusNotFound           = 5
+	StatusAlreadyExists      = 6
+	StatusPermissionDenied   = 7
+	StatusResourceExhausted  = 8
+	StatusFailedPrecondition = 9
+	StatusAborted            = 10
+	StatusOutOfRange         = 11
+	StatusUnimplemented      = 12
+	StatusInternal           = 13
+	StatusUnavailable        = 14
+	StatusDataLoss           = 15
+	StatusUnauthenticated    = 16
+)
+
+// ErrGRPCInInitContext is returned when gRPC calls are made in the init context.
+var ErrGRPCInInitContext = common.NewInitContextError("Using gRPC in the init context is not supported")
+
+type GRPC struct {
+	StatusOK                 int `js:"StatusOK"`
+	StatusCanceled           int `js:"StatusCanceled"`
+	StatusUnknown            int `js:"StatusUnknown"`
+	StatusInvalidArgument    int `js:"StatusInvalidArgument"`
+	StatusDeadlineExceeded   int `js:"StatusDeadlineExceeded"`
+	StatusNotFound           int `js:"StatusNotFound"`
+	StatusAlreadyExists      int `js:"StatusAlreadyExists"`
+	StatusPermissionDenied   int `js:"StatusPermissionDenied"`
+	StatusResourceExhausted  int `js:"StatusResourceExhausted"`
+	StatusFailedPrecondition int `js:"StatusFailedPrecondition"`
+	StatusAborted            int `js:"StatusAborted"`
+	StatusOutOfRange         int `js:"StatusOutOfRange"`
+	StatusUnimplemented      int `js:"StatusUnimplemented"`
+	StatusInternal           int `js:"StatusInternal"`
+	StatusUnavailable        int `js:"StatusUnavailable"`
+	StatusDataLoss           int `js:"StatusDataLoss"`
+	StatusUnauthenticated    int `js:"StatusUnauthenticated"`
+}
+
+func New() *GRPC {
+	return &GRPC{
+		StatusOK:                 StatusOK,
+		StatusCanceled:           StatusCanceled,
+		StatusUnknown:            StatusUnknown,
+		StatusInvalidArgument:    StatusInvalidArgument,
+		StatusDeadlineExceeded:   StatusDeadlineExceeded,
+		StatusNotFound:           StatusNotFound,
+		StatusAlreadyExists:      StatusAlreadyExists,
+		StatusPermissionDenied:   StatusPermissionDenied,
+		StatusResourceExhausted:  StatusResourceExhausted,
+		StatusFailedPrecondition: StatusFailedPrecondition,
+		StatusAborted:            StatusAborted,
+		StatusOutOfRange:         StatusOutOfRange,
+		StatusUnimplemented:      StatusUnimplemented,
+		StatusInternal:           StatusInternal,
+		StatusUnavailable:        StatusUnavailable,
+		StatusDataLoss:           StatusDataLoss,
+		StatusUnauthenticated:    StatusUnauthenticated,
+	}
+}
+
+// XClient creates a new client; it's meant to be created in the init context, where it can load
+// .proto files, and used in the default function.
+func (*GRPC) XClient(ctxPtr *context.Context) interface{} {
+	rt := common.GetRuntime(*ctxPtr)
+	return common.Bind(rt, &Client{}, ctxPtr)
+}
@@ -46,6 +46,7 @@ import (
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib/netext"
 	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	null "gopkg.in/guregu/null.v3"
 )
@@ -120,6 +121,51 @@ func (h *HTTP) Request(ctx context.Context, method string, url goja.Value, args
 	return h.request(ctx, req)
 }
 
+// AsyncRequest makes a request like Request does, but in the background: it returns a promise
+// that resolves to the response, or is rejected with the error, so a VU can have several requests
+// in flight at once. The iteration doesn't end until the request is done.
+func (h *HTTP) AsyncRequest(ctx context.Context, method string, url goja.Value, args ...goja.Value) (*goja.Object, error) {
+	rt := common.GetRuntime(ctx)
+	u, err := ToURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var body interface{}
+	var params goja.Value
+
+	if len(args) > 0 {
+		body = args[0].Export()
+	}
+	if len(args) > 1 {
+		params = args[1]
+	}
+
+	req, err := h.parseRequest(ctx, method, u, body, params)
+	if err != nil {
+		return nil, err
+	}
+	if req.stream != nil && req.stream.onChunk != nil {
+		return nil, errors.New("stream.onChunk isn't supported in http.asyncRequest()")
+	}
+
+	promise, resolve, reject, err := common.NewPromise(rt)
+	if err != nil {
+		return nil, err
+	}
+	queue := common.GetEventLoop(ctx).Reserve()
+	go func() {
+		res, err := h.request(ctx, req)
+		queue(func() error {
+			if err != nil {
+				return reject(rt.NewGoError(err))
+			}
+			return resolve(res)
+		})
+	}()
+	return promise, nil
+}
+
 // ResponseType is used in the request to specify how the response body should be treated
 // The conversion and validation methods are auto-generated with https://github.com/alvaroloes/enumer:
 //go:generate enumer -type=ResponseType -transform=snake -json -text -trimprefix ResponseType -output response_type_gen.go
@@ -152,6 +198,7 @@ type parsedHTTPRequest struct {
 	auth          string
 	throw         bool
 	responseType  ResponseType
+	stream        *streamParams
 	redirects     null.Int
 	activeJar     *cookiejar.Jar
 	cookies       map[string]*HTTPRequestCookie
@@ -375,6 +422,16 @@ func (h *HTTP) parseRequest(ctx context.Context, method string, reqURL URL, body
 					return nil, err
 				}
 				result.responseType = responseType
+			case "stream":
+				streamV := params.Get(k)
+				if goja.IsUndefined(streamV) || goja.IsNull(streamV) {
+					continue
+				}
+				stream, err := parseStreamParams(rt, streamV)
+				if err != nil {
+					return nil, err
+				}
+				result.stream = stream
 			}
 		}
 	}
@@ -411,12 +468,12 @@ func (h *HTTP) request(ctx context.Context, preq *parsedHTTPRequest) (*HTTPRespo
 		tags["method"] = preq.req.Method
 	}
 	if state.Options.SystemTags["url"] {
-		tags["url"] = preq.url.URLString
+		tags["url"] = state.Options.URLNormalization.Normalize(preq.url.URLString)
 	}
 
 	// Only set the name system tag if the user didn't explicitly set it beforehand
 	if _, ok := tags["name"]; !ok && state.Options.SystemTags["name"] {
-		tags["name"] = preq.url.Name
+		tags["name"] = state.Options.URLNormalization.Normalize(preq.url.Name)
 	}
 	if state.Options.SystemTags["group"] {
 		tags["group"] = state.Group.Path
@@ -527,22 +584,39 @@ func (h *HTTP) request(ctx context.Context, preq *parsedHTTPRequest) (*HTTPRespo
 			res.Body, resErr = gzip.NewReader(res.Body)
 		}
 	}
+	var bodyEnd time.Time
+	var streamEx *goja.Exception
 	if resErr == nil && res != nil {
-		if preq.responseType == ResponseTypeNone {
-			_, err := io.Copy(ioutil.Discard, res.Body)
+		if preq.stream != nil {
+			// Streamed bodies only go through the callback and hash, the response has no body
+			size, err := preq.stream.read(common.GetRuntime(ctx), res.Body, preq.responseType)
+			bodyEnd = time.Now()
+			// Exceptions thrown by onChunk are rethrown once the samples are pushed
+			if ex, ok := err.(*goja.Exception); ok {
+				streamEx = ex
+			} else if err != nil {
+				resErr = err
+			}
+			resp.Body = nil
+			resp.BodySize = size
+			resp.BodyHash = preq.stream.digest()
+		} else if preq.responseType == ResponseTypeNone {
+			n, err := io.Copy(ioutil.Discard, res.Body)
 			if err != nil && err != io.EOF {
 				resErr = err
 			}
 			resp.Body = nil
+			resp.BodySize = n
 		} else {
 			// Binary or string
 			buf := state.BPool.Get()
 			buf.Reset()
 			defer state.BPool.Put(buf)
-			_, err := io.Copy(buf, res.Body)
+			n, err := io.Copy(buf, res.Body)
 			if err != nil && err != io.EOF {
 				resErr = err
 			}
+			resp.BodySize = n
 
 			switch preq.responseType {
 			case ResponseTypeText:
@@ -574,6 +648,13 @@ func (h *HTTP) request(ctx context.Context, preq *parsedHTTPRequest) (*HTTPRespo
 		Receiving:      stats.D(trail.Receiving),
 	}
 
+	if preq.stream != nil && !bodyEnd.IsZero() {
+		pushStreamSamples(ctx, state.Samples, trail, bodyEnd, preq.stream.callbackTime, resp.BodySize)
+	}
+	if streamEx != nil {
+		return nil, streamEx
+	}
+
 	if resErr != nil {
 		resp.Error = resErr.Error()
 	} else {
@@ -716,6 +797,9 @@ func (h *HTTP) Batch(ctx context.Context, reqsV goja.Value) (goja.Value, error)
 		if err != nil {
 			return retval, err
 		}
+		if parsedReq.stream != nil && parsedReq.stream.onChunk != nil {
+			return retval, errors.New("stream.onChunk isn't supported in http.batch()")
+		}
 		parsedReqs[key] = parsedReq
 	}
 
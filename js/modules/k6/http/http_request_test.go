@@ -35,6 +35,7 @@ import (
 
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
+	jslib "github.com/loadimpact/k6/js/lib"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/testutils"
@@ -817,6 +818,33 @@ func TestRequestAndBatch(t *testing.T) {
 					}
 				}
 			})
+
+			t.Run("url-normalization", func(t *testing.T) {
+				oldOpts := state.Options
+				defer func() { state.Options = oldOpts }()
+				state.Options.URLNormalization = &lib.URLNormalization{
+					Auto:     null.BoolFrom(true),
+					Patterns: []string{sr("HTTPBIN_URL/get?user=${}")},
+				}
+
+				_, err := common.RunString(rt, sr(`
+				let res = http.get("HTTPBIN_URL/bytes/16?seed=42");
+				if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+				if (res.url != "HTTPBIN_URL/bytes/16?seed=42") { throw new Error("wrong url: " + res.url); }
+				res = http.get("HTTPBIN_URL/get?user=alice");
+				if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+				res = http.get("HTTPBIN_URL/headers", { tags: { name: "headers" } });
+				if (res.status != 200) { throw new Error("wrong status: " + res.status); }
+				`))
+				assert.NoError(t, err)
+
+				bufSamples := stats.GetBufferedSamples(samples)
+				bytesURL := sr("HTTPBIN_URL/bytes/${}?seed=${}")
+				assertRequestMetricsEmitted(t, bufSamples, "GET", bytesURL, bytesURL, 200, "")
+				getURL := sr("HTTPBIN_URL/get?user=${}")
+				assertRequestMetricsEmitted(t, bufSamples, "GET", getURL, getURL, 200, "")
+				assertRequestMetricsEmitted(t, bufSamples, "GET", sr("HTTPBIN_URL/headers"), "headers", 200, "")
+			})
 		})
 	})
 
@@ -1298,3 +1326,63 @@ func TestResponseTypes(t *testing.T) {
 	`))
 	assert.NoError(t, err)
 }
+
+func TestAsyncRequest(t *testing.T) {
+	t.Parallel()
+	tb, _, samples, rt, ctx := newRuntime(t)
+	defer tb.Cleanup()
+	sr := tb.Replacer.Replace
+
+	// Promises need core-js, which schedules their callbacks with setImmediate().
+	loop := common.NewEventLoop()
+	*ctx = common.WithEventLoop(*ctx, loop)
+	rt.Set("setImmediate", func(fn goja.Callable) {
+		loop.Reserve()(func() error {
+			_, err := fn(goja.Undefined())
+			return err
+		})
+	})
+	rt.Set("clearImmediate", func() {})
+	_, err := rt.RunProgram(jslib.GetCoreJS())
+	require.NoError(t, err)
+	run := func(src string) error {
+		return loop.Run(context.Background(), func() error {
+			_, err := common.RunString(rt, sr(src))
+			return err
+		})
+	}
+
+	t.Run("Concurrent", func(t *testing.T) {
+		require.NoError(t, run(`
+		let start = Date.now();
+		Promise.all([
+			http.asyncRequest("GET", "HTTPBIN_URL/delay/1"),
+			http.asyncRequest("GET", "HTTPBIN_URL/delay/1"),
+			http.asyncRequest("POST", "HTTPBIN_URL/post", "data"),
+		]).then(([first, second, posted]) => {
+			if (first.status !== 200 || second.status !== 200) { throw new Error("wrong status"); }
+			if (posted.json().data !== "data") { throw new Error("wrong body: " + posted.body); }
+			if (Date.now() - start >= 1900) { throw new Error("requests didn't run at the same time"); }
+		});
+		`))
+
+		bufSamples := stats.GetBufferedSamples(samples)
+		assertRequestMetricsEmitted(t, bufSamples, "GET", sr("HTTPBIN_URL/delay/1"), "", 200, "")
+		assertRequestMetricsEmitted(t, bufSamples, "POST", sr("HTTPBIN_URL/post"), "", 200, "")
+	})
+	t.Run("Rejected", func(t *testing.T) {
+		require.NoError(t, run(`
+		let rejected = false;
+		http.asyncRequest("GET", "HTTPBIN_URL/delay/10", null, { timeout: 100 }).then(
+			() => { throw new Error("not rejected"); },
+			(e) => { rejected = e.toString(); }
+		);
+		`))
+		assert.Contains(t, rt.Get("rejected").String(), "Client.Timeout exceeded")
+	})
+	t.Run("ParseError", func(t *testing.T) {
+		err := run(`http.asyncRequest("GET", "HTTPBIN_URL/get", null, { stream: { onChunk: () => {} } });`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "stream.onChunk isn't supported in http.asyncRequest()")
+	})
+}
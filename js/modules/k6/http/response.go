@@ -59,6 +59,8 @@ type HTTPResponse struct {
 	Headers        map[string]string        `json:"headers"`
 	Cookies        map[string][]*HTTPCookie `json:"cookies"`
 	Body           interface{}              `json:"body"`
+	BodySize       int64                    `json:"body_size"`
+	BodyHash       string                   `json:"body_hash"`
 	Timings        HTTPResponseTimings      `json:"timings"`
 	TLSVersion     string                   `json:"tls_version"`
 	TLSCipherSuite string                   `json:"tls_cipher_suite"`
@@ -0,0 +1,166 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// The default upper bound of the chunks passed to stream callbacks.
+const defaultStreamChunkSize = 64 * 1024
+
+var streamHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// streamParams describe how a streamed response body is consumed. Streamed bodies are never
+// buffered; they're read chunk by chunk, and each chunk is passed to the callback and/or hash.
+type streamParams struct {
+	onChunk   goja.Callable
+	chunkSize int
+	algorithm string
+	hash      hash.Hash
+
+	// Time spent in onChunk, which isn't part of the body transfer.
+	callbackTime time.Duration
+}
+
+func parseStreamParams(rt *goja.Runtime, v goja.Value) (*streamParams, error) {
+	stream := &streamParams{chunkSize: defaultStreamChunkSize}
+	obj := v.ToObject(rt)
+	for _, k := range obj.Keys() {
+		v := obj.Get(k)
+		if goja.IsUndefined(v) || goja.IsNull(v) {
+			continue
+		}
+		switch k {
+		case "onChunk":
+			fn, ok := goja.AssertFunction(v)
+			if !ok {
+				return nil, errors.New("stream.onChunk must be a function")
+			}
+			stream.onChunk = fn
+		case "chunkSize":
+			stream.chunkSize = int(v.ToInteger())
+			if stream.chunkSize <= 0 {
+				return nil, errors.Errorf("invalid stream.chunkSize %d", stream.chunkSize)
+			}
+		case "hash":
+			stream.algorithm = v.String()
+			newHash, ok := streamHashes[stream.algorithm]
+			if !ok {
+				return nil, errors.Errorf("unsupported stream.hash algorithm '%s'", stream.algorithm)
+			}
+			stream.hash = newHash()
+		}
+	}
+	return stream, nil
+}
+
+// read consumes r until EOF or until the callback returns false, returning the number of bytes
+// read. Exceptions thrown by the callback are returned as they are, so they can be rethrown.
+func (s *streamParams) read(rt *goja.Runtime, r io.Reader, responseType ResponseType) (int64, error) {
+	var size int64
+	buf := make([]byte, s.chunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			size += int64(n)
+			if s.hash != nil {
+				_, _ = s.hash.Write(buf[:n])
+			}
+			if s.onChunk != nil {
+				var chunk goja.Value
+				if responseType == ResponseTypeBinary {
+					chunk = rt.ToValue(append([]byte{}, buf[:n]...))
+				} else {
+					chunk = rt.ToValue(string(buf[:n]))
+				}
+				cbStart := time.Now()
+				ret, cbErr := s.onChunk(goja.Undefined(), chunk)
+				s.callbackTime += time.Since(cbStart)
+				if cbErr != nil {
+					return size, cbErr
+				}
+				if ret.StrictEquals(rt.ToValue(false)) {
+					return size, nil
+				}
+			}
+		}
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+	}
+}
+
+// digest returns the hex-encoded hash of everything read so far, if a hash was requested.
+func (s *streamParams) digest() string {
+	if s.hash == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// pushStreamSamples emits the time to last byte, which unlike http_req_duration includes reading
+// the whole body, and the throughput of the body transfer, in bytes per second. The time spent in
+// the onChunk callback is excluded from both, so slow callbacks don't look like a slow server.
+func pushStreamSamples(
+	ctx context.Context, samples chan<- stats.SampleContainer, trail *netext.Trail,
+	bodyEnd time.Time, callbackTime time.Duration, size int64,
+) {
+	ttlb := bodyEnd.Sub(trail.StartTime) - callbackTime
+	receiving := trail.Receiving + bodyEnd.Sub(trail.EndTime) - callbackTime
+
+	container := stats.ConnectedSamples{
+		Samples: []stats.Sample{
+			{Metric: metrics.HTTPReqTTLB, Time: bodyEnd, Tags: trail.Tags, Value: stats.D(ttlb)},
+		},
+		Tags: trail.Tags,
+		Time: bodyEnd,
+	}
+	if receiving > 0 {
+		container.Samples = append(container.Samples, stats.Sample{
+			Metric: metrics.HTTPReqThroughput, Time: bodyEnd, Tags: trail.Tags, Value: float64(size) / receiving.Seconds(),
+		})
+	}
+	stats.PushIfNotCancelled(ctx, samples, container)
+}
@@ -0,0 +1,204 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamedResponses(t *testing.T) {
+	t.Parallel()
+	tb, _, samples, rt, _ := newRuntime(t)
+	defer tb.Cleanup()
+
+	data := make([]byte, 300*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	sum := sha256.Sum256(data)
+	tb.Mux.HandleFunc("/stream", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < len(data); i += 10 * 1024 {
+			// Some tests stop reading early, so write errors are expected
+			if _, err := w.Write(data[i : i+10*1024]); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+
+	replace := func(s string) string {
+		return strings.NewReplacer(
+			"EXP_SIZE", strconv.Itoa(len(data)),
+			"EXP_HASH", hex.EncodeToString(sum[:]),
+		).Replace(tb.Replacer.Replace(s))
+	}
+
+	t.Run("Hash", func(t *testing.T) {
+		_, err := common.RunString(rt, replace(`
+		let res = http.get("HTTPBIN_URL/stream", { stream: { hash: "sha256" } });
+		if (res.body !== null) { throw new Error("unexpected body"); }
+		if (res.body_size !== EXP_SIZE) { throw new Error("unexpected size: " + res.body_size); }
+		if (res.body_hash !== "EXP_HASH") { throw new Error("unexpected hash: " + res.body_hash); }
+		`))
+		assert.NoError(t, err)
+
+		var seenTTLB, seenThroughput bool
+		for _, container := range stats.GetBufferedSamples(samples) {
+			for _, sample := range container.GetSamples() {
+				switch sample.Metric {
+				case metrics.HTTPReqTTLB:
+					seenTTLB = true
+					assert.True(t, sample.Value > 0)
+				case metrics.HTTPReqThroughput:
+					seenThroughput = true
+					assert.True(t, sample.Value > 0)
+				default:
+					continue
+				}
+				status, _ := sample.Tags.Get("status")
+				assert.Equal(t, "200", status)
+			}
+		}
+		assert.True(t, seenTTLB)
+		assert.True(t, seenThroughput)
+	})
+
+	t.Run("OnChunk", func(t *testing.T) {
+		_, err := common.RunString(rt, replace(`
+		let size = 0, chunks = 0;
+		let res = http.get("HTTPBIN_URL/stream", { responseType: "binary", stream: { chunkSize: 4096, onChunk: function(chunk) {
+			if (chunk.length > 4096) { throw new Error("chunk too large: " + chunk.length); }
+			for (let i = 0; i < chunk.length; i++) {
+				if (chunk[i] !== (size + i) % 256) { throw new Error("unexpected byte at " + (size + i)); }
+			}
+			size += chunk.length;
+			chunks++;
+		} } });
+		if (size !== EXP_SIZE || res.body_size !== EXP_SIZE) { throw new Error("unexpected size: " + size); }
+		if (chunks < EXP_SIZE / 4096) { throw new Error("unexpected chunks: " + chunks); }
+		if (res.body_hash !== "") { throw new Error("unexpected hash: " + res.body_hash); }
+		`))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		_, err := common.RunString(rt, replace(`
+		let res = http.get("HTTPBIN_URL/stream", { stream: { chunkSize: 1000, onChunk: function(chunk) {
+			if (typeof chunk !== "string") { throw new Error("unexpected chunk type"); }
+			return false;
+		} } });
+		if (res.body_size > 1000) { throw new Error("unexpected size: " + res.body_size); }
+		`))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Exception", func(t *testing.T) {
+		stats.GetBufferedSamples(samples)
+		_, err := common.RunString(rt, replace(`
+		http.get("HTTPBIN_URL/stream", { stream: { onChunk: function() { throw new Error("oops"); } } });
+		`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "oops")
+
+		var seenReqs, seenTTLB bool
+		for _, container := range stats.GetBufferedSamples(samples) {
+			for _, sample := range container.GetSamples() {
+				switch sample.Metric {
+				case metrics.HTTPReqs:
+					seenReqs = true
+				case metrics.HTTPReqTTLB:
+					seenTTLB = true
+				}
+			}
+		}
+		assert.True(t, seenReqs)
+		assert.True(t, seenTTLB)
+	})
+
+	t.Run("CallbackTime", func(t *testing.T) {
+		stats.GetBufferedSamples(samples)
+		_, err := common.RunString(rt, replace(`
+		http.get("HTTPBIN_URL/stream", { stream: { onChunk: function() {
+			let end = Date.now() + 500;
+			while (Date.now() < end) {}
+			return false;
+		} } });
+		`))
+		require.NoError(t, err)
+
+		var seenTTLB bool
+		for _, container := range stats.GetBufferedSamples(samples) {
+			for _, sample := range container.GetSamples() {
+				if sample.Metric == metrics.HTTPReqTTLB {
+					seenTTLB = true
+					assert.True(t, sample.Value < 500, "ttlb %f includes the callback", sample.Value)
+				}
+			}
+		}
+		assert.True(t, seenTTLB)
+	})
+
+	t.Run("BodySize", func(t *testing.T) {
+		_, err := common.RunString(rt, replace(`
+		if (http.get("HTTPBIN_URL/stream").body_size !== EXP_SIZE) { throw new Error("unexpected text size"); }
+		if (http.get("HTTPBIN_URL/stream", { responseType: "none" }).body_size !== EXP_SIZE) { throw new Error("unexpected none size"); }
+		`))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		testdata := map[string]string{
+			`{ hash: "crc32" }`:   "unsupported stream.hash algorithm 'crc32'",
+			`{ chunkSize: 0 }`:    "invalid stream.chunkSize 0",
+			`{ onChunk: "nope" }`: "stream.onChunk must be a function",
+		}
+		for params, msg := range testdata {
+			_, err := common.RunString(rt, replace(`http.get("HTTPBIN_URL/stream", { stream: `+params+` });`))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), msg)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		_, err := common.RunString(rt, replace(`
+		let res = http.batch([["GET", "HTTPBIN_URL/stream", null, { stream: { hash: "sha256" } }]]);
+		if (res[0].body_hash !== "EXP_HASH") { throw new Error("unexpected hash: " + res[0].body_hash); }
+		`))
+		assert.NoError(t, err)
+
+		_, err = common.RunString(rt, replace(`
+		http.batch([["GET", "HTTPBIN_URL/stream", null, { stream: { onChunk: function() {} } }]]);
+		`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "stream.onChunk isn't supported in http.batch()")
+	})
+}
@@ -0,0 +1,521 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package sse implements the k6/sse module, a Server-Sent Events client. A stream is opened with
+// sse.open() and consumed through an event loop modelled after k6/ws: the setup function registers
+// handlers and timers, and the call returns once the stream is closed by either side.
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// ErrSSEInInitContext is returned when event streams are opened in the init context.
+var ErrSSEInInitContext = common.NewInitContextError("Using server-sent events in the init context is not supported")
+
+// The longest line we're willing to buffer while waiting for its terminator.
+const maxLineSize = 1024 * 1024
+
+type SSE struct{}
+
+// Client is the JS-facing handle of an open event stream.
+type Client struct {
+	ctx           context.Context
+	body          io.ReadCloser
+	cancel        context.CancelFunc
+	eventHandlers map[string][]goja.Callable
+	scheduled     chan goja.Callable
+	done          chan struct{}
+	closed        bool
+
+	eventTimestamps []time.Time
+}
+
+// Event is a single dispatched event; Name defaults to "message" if the server didn't set one.
+type Event struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Data string `json:"data"`
+}
+
+type SSEHTTPResponse struct {
+	URL     string            `json:"url"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	Error   string            `json:"error"`
+}
+
+func New() *SSE {
+	return &SSE{}
+}
+
+func (*SSE) Open(ctx context.Context, url string, args ...goja.Value) (*SSEHTTPResponse, error) {
+	rt := common.GetRuntime(ctx)
+	state := common.GetState(ctx)
+	if state == nil {
+		return nil, ErrSSEInInitContext
+	}
+
+	// The params argument is optional
+	var callableV, paramsV goja.Value
+	switch len(args) {
+	case 2:
+		paramsV = args[0]
+		callableV = args[1]
+	case 1:
+		paramsV = goja.Undefined()
+		callableV = args[0]
+	default:
+		return nil, errors.New("Invalid number of arguments to sse.open")
+	}
+
+	setupFn, isFunc := goja.AssertFunction(callableV)
+	if !isFunc {
+		return nil, errors.New("Last argument to sse.open must be a function")
+	}
+
+	method := http.MethodGet
+	var body io.Reader
+	header := http.Header{}
+	tags := state.Options.RunTags.CloneTags()
+
+	if !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
+		params := paramsV.ToObject(rt)
+		for _, k := range params.Keys() {
+			v := params.Get(k)
+			if goja.IsUndefined(v) || goja.IsNull(v) {
+				continue
+			}
+			switch k {
+			case "method":
+				method = strings.ToUpper(v.String())
+			case "body":
+				body = strings.NewReader(v.String())
+			case "headers":
+				headersObj := v.ToObject(rt)
+				for _, key := range headersObj.Keys() {
+					header.Set(key, headersObj.Get(key).String())
+				}
+			case "tags":
+				tagObj := v.ToObject(rt)
+				for _, key := range tagObj.Keys() {
+					tags[key] = tagObj.Get(key).String()
+				}
+			}
+		}
+	}
+
+	if state.Options.SystemTags["url"] {
+		tags["url"] = url
+	}
+	if state.Options.SystemTags["group"] {
+		tags["group"] = state.Group.Path
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	req.Header.Set("Cache-Control", "no-cache")
+	if state.Options.UserAgent.Valid && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", state.Options.UserAgent.String)
+	}
+
+	// The request context outlives this call's setup; cancelling it is what unblocks the reader
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tracer := &netext.Tracer{}
+	req = req.WithContext(netext.WithTracer(reqCtx, tracer))
+
+	start := time.Now()
+	httpResponse, connErr := state.Transport.RoundTrip(req)
+	connectionDuration := stats.D(time.Since(start))
+	trail := tracer.Done()
+
+	client := Client{
+		ctx:           ctx,
+		cancel:        cancel,
+		eventHandlers: make(map[string][]goja.Callable),
+		scheduled:     make(chan goja.Callable),
+		done:          make(chan struct{}),
+	}
+
+	if state.Options.SystemTags["ip"] && trail.ConnRemoteAddr != nil {
+		if ip, _, err := net.SplitHostPort(trail.ConnRemoteAddr.String()); err == nil {
+			tags["ip"] = ip
+		}
+	}
+
+	// Run the user-provided set up function
+	if _, err := setupFn(goja.Undefined(), rt.ToValue(&client)); err != nil {
+		if connErr == nil {
+			_ = httpResponse.Body.Close()
+		}
+		return nil, err
+	}
+
+	if connErr != nil {
+		// Pass the error to the user script before exiting immediately
+		client.handleEvent("error", rt.ToValue(connErr))
+
+		return nil, connErr
+	}
+	client.body = httpResponse.Body
+	defer func() { _ = httpResponse.Body.Close() }()
+
+	sseResponse := wrapHTTPResponse(httpResponse)
+	sseResponse.URL = url
+
+	if state.Options.SystemTags["status"] {
+		tags["status"] = strconv.Itoa(httpResponse.StatusCode)
+	}
+
+	// Anything but a 200 with the right content type isn't an event stream, so there's nothing
+	// to consume; the body is handed back to the script to help figure out what went wrong
+	if streamErr := checkResponse(httpResponse); streamErr != nil {
+		if data, err := ioutil.ReadAll(httpResponse.Body); err == nil {
+			sseResponse.Body = string(data)
+		}
+		sseResponse.Error = streamErr.Error()
+		client.handleEvent("error", rt.ToValue(streamErr))
+		client.pushSamples(state.Samples, start, time.Now(), connectionDuration, tags)
+		return sseResponse, nil
+	}
+
+	// The stream is now open, emit the event
+	client.handleEvent("open")
+
+	eventChan := make(chan Event)
+	readErrChan := make(chan error)
+	readCloseChan := make(chan struct{})
+
+	// Parses the stream in the background and feeds events to the main control loop
+	go readPump(httpResponse.Body, client.done, eventChan, readErrChan, readCloseChan)
+	defer func() {
+		// Exceptions thrown by handlers skip closeStream, but the reader still has to be stopped
+		if !client.closed {
+			client.closed = true
+			close(client.done)
+		}
+	}()
+
+	// This is the main control loop. All JS code (including error handlers)
+	// should only be executed by this thread to avoid race conditions
+	for {
+		select {
+		case event := <-eventChan:
+			if client.closed {
+				continue
+			}
+			client.eventTimestamps = append(client.eventTimestamps, time.Now())
+			client.handleEvent("event", rt.ToValue(event))
+
+		case readErr := <-readErrChan:
+			if client.closed {
+				continue
+			}
+			client.handleEvent("error", rt.ToValue(readErr))
+			client.closeStream()
+
+		case <-readCloseChan:
+			// The server ended the stream
+			client.closeStream()
+
+		case scheduledFn := <-client.scheduled:
+			if _, err := scheduledFn(goja.Undefined()); err != nil {
+				return nil, err
+			}
+
+		case <-ctx.Done():
+			// VU is shutting down during an interrupt
+			client.closeStream()
+
+		case <-client.done:
+			// This is the final exit point normally triggered by closeStream
+			client.pushSamples(state.Samples, start, time.Now(), connectionDuration, tags)
+			return sseResponse, nil
+		}
+	}
+}
+
+func (c *Client) On(event string, handler goja.Value) {
+	if handler, ok := goja.AssertFunction(handler); ok {
+		c.eventHandlers[event] = append(c.eventHandlers[event], handler)
+	}
+}
+
+func (c *Client) handleEvent(event string, args ...goja.Value) {
+	if handlers, ok := c.eventHandlers[event]; ok {
+		for _, handler := range handlers {
+			if _, err := handler(goja.Undefined(), args...); err != nil {
+				common.Throw(common.GetRuntime(c.ctx), err)
+			}
+		}
+	}
+}
+
+func (c *Client) SetTimeout(fn goja.Callable, timeoutMs int) {
+	// Starts a goroutine, blocks once on the timeout and pushes the callable
+	// back to the main loop through the scheduled channel
+	go func() {
+		select {
+		case <-time.After(time.Duration(timeoutMs) * time.Millisecond):
+			select {
+			case c.scheduled <- fn:
+			case <-c.done:
+			}
+
+		case <-c.done:
+			return
+		}
+	}()
+}
+
+func (c *Client) SetInterval(fn goja.Callable, intervalMs int) {
+	// Starts a goroutine, blocks forever on the ticker and pushes the callable
+	// back to the main loop through the scheduled channel
+	go func() {
+		ticker := time.NewTicker(time.Duration(intervalMs) * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case c.scheduled <- fn:
+				case <-c.done:
+					return
+				}
+
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+func (c *Client) Close() {
+	c.closeStream()
+}
+
+// Aborts the request, which unblocks the reader, and stops the main control loop.
+func (c *Client) closeStream() {
+	if c.closed || c.body == nil {
+		return
+	}
+	c.closed = true
+
+	c.cancel()
+	_ = c.body.Close()
+
+	c.handleEvent("close")
+	close(c.done)
+}
+
+func (c *Client) pushSamples(samples chan<- stats.SampleContainer, start, end time.Time, connecting float64, tags map[string]string) {
+	sampleTags := stats.IntoSampleTags(&tags)
+
+	stats.PushIfNotCancelled(c.ctx, samples, stats.ConnectedSamples{
+		Samples: []stats.Sample{
+			{Metric: metrics.SSESessions, Time: start, Tags: sampleTags, Value: 1},
+			{Metric: metrics.SSEConnecting, Time: start, Tags: sampleTags, Value: connecting},
+			{Metric: metrics.SSESessionDuration, Time: start, Tags: sampleTags, Value: stats.D(end.Sub(start))},
+		},
+		Tags: sampleTags,
+		Time: start,
+	})
+
+	for i, eventTimestamp := range c.eventTimestamps {
+		stats.PushIfNotCancelled(c.ctx, samples, stats.Sample{
+			Metric: metrics.SSEEventsReceived,
+			Time:   eventTimestamp,
+			Tags:   sampleTags,
+			Value:  1,
+		})
+		if i > 0 {
+			stats.PushIfNotCancelled(c.ctx, samples, stats.Sample{
+				Metric: metrics.SSETimeBetweenEvents,
+				Time:   eventTimestamp,
+				Tags:   sampleTags,
+				Value:  stats.D(eventTimestamp.Sub(c.eventTimestamps[i-1])),
+			})
+		}
+	}
+}
+
+// Reads the stream line by line, sending every complete event to the main loop.
+func readPump(r io.Reader, done <-chan struct{}, eventChan chan<- Event, errorChan chan<- error, closeChan chan<- struct{}) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+	scanner.Split(scanLines)
+
+	var parser eventParser
+	for scanner.Scan() {
+		event, ok := parser.parseLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		select {
+		case eventChan <- event:
+		case <-done:
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		select {
+		case errorChan <- err:
+		case <-done:
+		}
+		return
+	}
+	select {
+	case closeChan <- struct{}{}:
+	case <-done:
+	}
+}
+
+// eventParser implements the event stream interpretation rules from the HTML spec:
+// https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation
+type eventParser struct {
+	started bool
+	lastID  string
+	name    string
+	data    bytes.Buffer
+}
+
+// parseLine consumes a single line (without its terminator), returning an event when the line
+// terminates one. Retry hints are ignored, since streams aren't reconnected automatically.
+func (p *eventParser) parseLine(line string) (Event, bool) {
+	if !p.started {
+		p.started = true
+		line = strings.TrimPrefix(line, "\ufeff")
+	}
+
+	if line == "" {
+		if p.data.Len() == 0 {
+			p.name = ""
+			return Event{}, false
+		}
+		event := Event{ID: p.lastID, Name: p.name, Data: strings.TrimSuffix(p.data.String(), "\n")}
+		if event.Name == "" {
+			event.Name = "message"
+		}
+		p.name = ""
+		p.data.Reset()
+		return event, true
+	}
+
+	if strings.HasPrefix(line, ":") {
+		return Event{}, false
+	}
+
+	field, value := line, ""
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+	}
+	switch field {
+	case "event":
+		p.name = value
+	case "data":
+		p.data.WriteString(value)
+		p.data.WriteByte('\n')
+	case "id":
+		if !strings.ContainsRune(value, 0) {
+			p.lastID = value
+		}
+	}
+	return Event{}, false
+}
+
+// scanLines is a bufio.SplitFunc for event streams, where lines may end in CRLF, LF or a lone CR.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		// A trailing CR may be the first half of a CRLF, so wait for more data
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// Makes sure the response actually is an event stream.
+func checkResponse(res *http.Response) error {
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || mediaType != "text/event-stream" {
+		return errors.Errorf("unexpected content type '%s'", res.Header.Get("Content-Type"))
+	}
+	return nil
+}
+
+// Wrap the raw HTTPResponse we received to a SSEHTTPResponse we can pass to the user
+func wrapHTTPResponse(httpResponse *http.Response) *SSEHTTPResponse {
+	sseResponse := SSEHTTPResponse{
+		Status:  httpResponse.StatusCode,
+		Headers: make(map[string]string, len(httpResponse.Header)),
+	}
+	for k, vs := range httpResponse.Header {
+		sseResponse.Headers[k] = strings.Join(vs, ", ")
+	}
+	return &sseResponse
+}
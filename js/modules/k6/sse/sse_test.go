@@ -0,0 +1,289 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package sse
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/finite", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, ": hello\n\nid: 1\ndata: first\n\nevent: update\ndata: second\ndata: line\n\nid: 3\ndata: third\n\n")
+	})
+	mux.HandleFunc("/endless", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		w.Header().Set("X-Agent", r.Header.Get("User-Agent"))
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, "data: %d\n\n", i); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		body := bufio.NewScanner(r.Body)
+		body.Scan()
+		_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\ndata: %s\n\n", r.Method, r.Header.Get("Accept"), body.Text())
+	})
+	mux.HandleFunc("/notfound", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, "no stream here")
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestRuntime(t *testing.T) (*goja.Runtime, *common.State, chan stats.SampleContainer) {
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	dialer := netext.NewDialer(net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 60 * time.Second,
+		DualStack: true,
+	})
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &common.State{
+		Group:     root,
+		Dialer:    dialer,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		Options: lib.Options{
+			SystemTags: lib.GetTagSet("url", "status", "group"),
+		},
+		Samples: samples,
+	}
+
+	ctx := context.Background()
+	ctx = common.WithState(ctx, state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("sse", common.Bind(rt, New(), &ctx))
+	return rt, state, samples
+}
+
+func countSamples(samples chan stats.SampleContainer) map[*stats.Metric][]stats.Sample {
+	close(samples)
+	seen := make(map[*stats.Metric][]stats.Sample)
+	for container := range samples {
+		for _, sample := range container.GetSamples() {
+			seen[sample.Metric] = append(seen[sample.Metric], sample)
+		}
+	}
+	return seen
+}
+
+func TestOpen(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	t.Run("Finite", func(t *testing.T) {
+		rt, _, samples := newTestRuntime(t)
+		rt.Set("url", srv.URL+"/finite")
+		_, err := common.RunString(rt, `
+		let events = [];
+		let opened = false, closed = false;
+		let res = sse.open(url, function(client) {
+			client.on("open", function() { opened = true; });
+			client.on("event", function(e) { events.push(e.id + "/" + e.name + "/" + e.data); });
+			client.on("close", function() { closed = true; });
+		});
+		if (res.status !== 200) { throw new Error("unexpected status: " + res.status); }
+		if (!opened || !closed) { throw new Error("missing open or close"); }
+		if (events.join(",") !== "1/message/first,1/update/second\nline,3/message/third") {
+			throw new Error("unexpected events: " + JSON.stringify(events));
+		}
+		`)
+		require.NoError(t, err)
+
+		seen := countSamples(samples)
+		require.Len(t, seen[metrics.SSESessions], 1)
+		assert.Len(t, seen[metrics.SSEConnecting], 1)
+		assert.Len(t, seen[metrics.SSESessionDuration], 1)
+		assert.Len(t, seen[metrics.SSEEventsReceived], 3)
+		assert.Len(t, seen[metrics.SSETimeBetweenEvents], 2)
+
+		tags := seen[metrics.SSESessions][0].Tags.CloneTags()
+		assert.Equal(t, srv.URL+"/finite", tags["url"])
+		assert.Equal(t, "200", tags["status"])
+		assert.Equal(t, "", tags["group"])
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		rt, state, samples := newTestRuntime(t)
+		state.Options.UserAgent.String = "TestUserAgent"
+		state.Options.UserAgent.Valid = true
+		rt.Set("url", srv.URL+"/endless")
+		_, err := common.RunString(rt, `
+		let count = 0, closed = false;
+		let res = sse.open(url, { tags: { tag: "value" } }, function(client) {
+			client.on("event", function(e) {
+				if (e.data !== String(count)) { throw new Error("unexpected data: " + e.data); }
+				if (++count == 3) { client.close(); }
+			});
+			client.on("close", function() { closed = true; });
+			client.setTimeout(function() { throw new Error("should have been closed"); }, 5000);
+		});
+		if (count !== 3 || !closed) { throw new Error("unexpected count: " + count); }
+		if (res.headers["X-Agent"] !== "TestUserAgent") { throw new Error("unexpected agent: " + res.headers["X-Agent"]); }
+		`)
+		require.NoError(t, err)
+
+		seen := countSamples(samples)
+		assert.Len(t, seen[metrics.SSEEventsReceived], 3)
+		require.Len(t, seen[metrics.SSESessions], 1)
+		tag, _ := seen[metrics.SSESessions][0].Tags.Get("tag")
+		assert.Equal(t, "value", tag)
+	})
+
+	t.Run("Timers", func(t *testing.T) {
+		rt, _, _ := newTestRuntime(t)
+		rt.Set("url", srv.URL+"/endless")
+		_, err := common.RunString(rt, `
+		let ticks = 0;
+		sse.open(url, function(client) {
+			client.setInterval(function() { ticks++; }, 10);
+			client.setTimeout(function() { client.close(); }, 100);
+		});
+		if (ticks < 2) { throw new Error("interval didn't fire: " + ticks); }
+		`)
+		require.NoError(t, err)
+	})
+
+	t.Run("Params", func(t *testing.T) {
+		rt, _, _ := newTestRuntime(t)
+		rt.Set("url", srv.URL+"/echo")
+		_, err := common.RunString(rt, `
+		let event;
+		sse.open(url, { method: "post", body: "payload", headers: { "Accept": "text/plain" } }, function(client) {
+			client.on("event", function(e) { event = e; });
+		});
+		if (event.name !== "POST" || event.data !== "text/plain\npayload") {
+			throw new Error("unexpected event: " + JSON.stringify(event));
+		}
+		`)
+		require.NoError(t, err)
+	})
+
+	t.Run("NotAStream", func(t *testing.T) {
+		rt, _, samples := newTestRuntime(t)
+		rt.Set("url", srv.URL+"/notfound")
+		_, err := common.RunString(rt, `
+		let error;
+		let res = sse.open(url, function(client) {
+			client.on("open", function() { throw new Error("shouldn't have opened"); });
+			client.on("error", function(e) { error = e; });
+		});
+		if (res.status !== 404 || res.body !== "no stream here") { throw new Error("unexpected response"); }
+		if (res.error !== "unexpected status code 404" || !error) {
+			throw new Error("unexpected error: " + res.error);
+		}
+		`)
+		require.NoError(t, err)
+
+		seen := countSamples(samples)
+		require.Len(t, seen[metrics.SSESessions], 1)
+		status, _ := seen[metrics.SSESessions][0].Tags.Get("status")
+		assert.Equal(t, "404", status)
+	})
+
+	t.Run("ConnectionError", func(t *testing.T) {
+		rt, _, _ := newTestRuntime(t)
+		_, err := common.RunString(rt, `
+		let error;
+		try {
+			sse.open("http://127.0.0.1:1/", function(client) {
+				client.on("error", function(e) { error = e; });
+			});
+		} catch (e) {
+			if (!error) { throw new Error("error event wasn't emitted"); }
+			throw e;
+		}
+		`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "connection refused")
+	})
+}
+
+func TestOpenInitContext(t *testing.T) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("sse", common.Bind(rt, New(), &ctx))
+
+	_, err := common.RunString(rt, `sse.open("http://example.com/", function() {})`)
+	assert.Contains(t, err.Error(), ErrSSEInInitContext.Error())
+}
+
+func TestEventParser(t *testing.T) {
+	testdata := map[string][]Event{
+		"data: a\n\n":                   {{Name: "message", Data: "a"}},
+		"\ufeffdata:a\r\n\r\n":          {{Name: "message", Data: "a"}},
+		"data: a\rdata:  b\r\r":         {{Name: "message", Data: "a\n b"}},
+		"data\n\ndata:\ndata\n\n":       {{Name: "message", Data: ""}, {Name: "message", Data: "\n"}},
+		"event: x\n\ndata: a\n\n":       {{Name: "message", Data: "a"}},
+		"id: 1\ndata: a\n\ndata: b\n\n": {{ID: "1", Name: "message", Data: "a"}, {ID: "1", Name: "message", Data: "b"}},
+		"id: 1\ndata: a\n\nid\ndata: b\n\n": {
+			{ID: "1", Name: "message", Data: "a"}, {Name: "message", Data: "b"},
+		},
+		"event: e\nretry: 10\nfoo: bar\n: comment\ndata: a\n\n": {{Name: "e", Data: "a"}},
+		"data: a\n\ndata: incomplete":                           {{Name: "message", Data: "a"}},
+	}
+	for input, expected := range testdata {
+		t.Run(fmt.Sprintf("%q", input), func(t *testing.T) {
+			scanner := bufio.NewScanner(strings.NewReader(input))
+			scanner.Split(scanLines)
+			var parser eventParser
+			var events []Event
+			for scanner.Scan() {
+				if event, ok := parser.parseLine(scanner.Text()); ok {
+					events = append(events, event)
+				}
+			}
+			require.NoError(t, scanner.Err())
+			assert.Equal(t, expected, events)
+		})
+	}
+}
@@ -28,12 +28,14 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 	"github.com/oxtoacart/bpool"
 	"github.com/pkg/errors"
@@ -46,8 +48,15 @@ import (
 
 var errInterrupt = errors.New("context cancelled")
 
+// How long handleSummary() may run for; unlike setup() and teardown(), it has no option for it.
+const handleSummaryTimeout = 2 * time.Minute
+
+// Running an empty program clears a pending interrupt.
+var noopProgram = goja.MustCompile("", "", false)
+
 // Ensure Runner implements the lib.Runner interface
 var _ lib.Runner = &Runner{}
+var _ lib.SummaryHandler = &Runner{}
 
 type Runner struct {
 	Bundle       *Bundle
@@ -59,6 +68,9 @@ type Runner struct {
 	RPSLimit   *rate.Limiter
 
 	setupData []byte
+
+	// Iterations started by all VUs so far, used to number them across VUs.
+	iterations int64
 }
 
 func New(src *lib.SourceData, fs afero.Fs, rtOpts lib.RuntimeOptions) (*Runner, error) {
@@ -110,9 +122,30 @@ func (r *Runner) NewVU(samplesOut chan<- stats.SampleContainer) (lib.VU, error)
 	return lib.VU(vu), nil
 }
 
+func (r *Runner) NewScenarioVU(name string, sc lib.Scenario, samplesOut chan<- stats.SampleContainer) (lib.VU, error) {
+	vu, err := r.newVUWithEnv(samplesOut, sc.Env)
+	if err != nil {
+		return nil, err
+	}
+	if sc.Exec.Valid {
+		exports := vu.Runtime.Get("exports").ToObject(vu.Runtime)
+		fn, ok := goja.AssertFunction(exports.Get(sc.Exec.String))
+		if !ok {
+			return nil, errors.Errorf("scenario '%s': exported function '%s' not found", name, sc.Exec.String)
+		}
+		vu.exec = fn
+	}
+	vu.runTags = sc.Options(name, r.Bundle.Options).RunTags
+	return lib.VU(vu), nil
+}
+
 func (r *Runner) newVU(samplesOut chan<- stats.SampleContainer) (*VU, error) {
+	return r.newVUWithEnv(samplesOut, nil)
+}
+
+func (r *Runner) newVUWithEnv(samplesOut chan<- stats.SampleContainer, env map[string]string) (*VU, error) {
 	// Instantiate a new bundle, make a VU out of it.
-	bi, err := r.Bundle.Instantiate()
+	bi, err := r.Bundle.InstantiateWithEnv(env)
 	if err != nil {
 		return nil, err
 	}
@@ -182,6 +215,9 @@ func (r *Runner) newVU(samplesOut chan<- stats.SampleContainer) (*VU, error) {
 		Console:        NewConsole(),
 		BPool:          bpool.NewBufferPool(100),
 		Samples:        samplesOut,
+		exec:           bi.Default,
+
+		globalIteration: -1,
 	}
 	vu.Runtime.Set("console", common.Bind(vu.Runtime, vu.Console, vu.Context))
 	common.BindToGlobal(vu.Runtime, map[string]interface{}{
@@ -205,7 +241,7 @@ func (r *Runner) Setup(ctx context.Context, out chan<- stats.SampleContainer) er
 	)
 	defer setupCancel()
 
-	v, err := r.runPart(setupCtx, out, "setup", nil)
+	v, _, err := r.runPart(setupCtx, out, "setup", nil)
 	if err != nil {
 		return errors.Wrap(err, "setup")
 	}
@@ -248,10 +284,60 @@ func (r *Runner) Teardown(ctx context.Context, out chan<- stats.SampleContainer)
 	} else {
 		data = goja.Undefined()
 	}
-	_, err := r.runPart(teardownCtx, out, "teardown", data)
+	_, _, err := r.runPart(teardownCtx, out, "teardown", data)
 	return err
 }
 
+// HandleSummary runs the script's handleSummary() function, if it exports one, with the given
+// JSON-encoded summary. It must return an object of destinations to contents; strings are used
+// as-is, anything else is encoded as JSON.
+func (r *Runner) HandleSummary(ctx context.Context, summary []byte) (map[string][]byte, error) {
+	var data interface{}
+	if err := json.Unmarshal(summary, &data); err != nil {
+		return nil, errors.Wrap(err, "handleSummary")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, handleSummaryTimeout)
+	defer cancel()
+
+	// The engine isn't collecting samples anymore, so any emitted here are simply dropped.
+	out := make(chan stats.SampleContainer, 100)
+	defer close(out)
+	go func() {
+		for range out {
+		}
+	}()
+
+	v, found, err := r.runPart(ctx, out, "handleSummary", data)
+	if err != nil {
+		return nil, errors.Wrap(err, "handleSummary")
+	}
+	if !found {
+		return nil, nil
+	}
+
+	obj, ok := v.Export().(map[string]interface{})
+	if !ok {
+		return nil, errors.New("handleSummary() must return an object of destinations to contents")
+	}
+	reports := make(map[string][]byte, len(obj))
+	for dest, content := range obj {
+		switch content := content.(type) {
+		case nil:
+			continue
+		case string:
+			reports[dest] = []byte(content)
+		default:
+			b, err := json.MarshalIndent(content, "", "    ")
+			if err != nil {
+				return nil, errors.Wrapf(err, "handleSummary: couldn't encode '%s'", dest)
+			}
+			reports[dest] = append(b, '\n')
+		}
+	}
+	return reports, nil
+}
+
 func (r *Runner) GetDefaultGroup() *lib.Group {
 	return r.defaultGroup
 }
@@ -270,19 +356,22 @@ func (r *Runner) SetOptions(opts lib.Options) {
 }
 
 // Runs an exported function in its own temporary VU, optionally with an argument. Execution is
-// interrupted if the context expires. No error is returned if the part does not exist.
-func (r *Runner) runPart(ctx context.Context, out chan<- stats.SampleContainer, name string, arg interface{}) (goja.Value, error) {
+// interrupted if the context expires. No error is returned if the part does not exist, but the
+// second return value tells whether it did.
+func (r *Runner) runPart(
+	ctx context.Context, out chan<- stats.SampleContainer, name string, arg interface{},
+) (goja.Value, bool, error) {
 	vu, err := r.newVU(out)
 	if err != nil {
-		return goja.Undefined(), err
+		return goja.Undefined(), false, err
 	}
 	exp := vu.Runtime.Get("exports").ToObject(vu.Runtime)
 	if exp == nil {
-		return goja.Undefined(), nil
+		return goja.Undefined(), false, nil
 	}
 	fn, ok := goja.AssertFunction(exp.Get(name))
 	if !ok {
-		return goja.Undefined(), nil
+		return goja.Undefined(), false, nil
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -294,21 +383,21 @@ func (r *Runner) runPart(ctx context.Context, out chan<- stats.SampleContainer,
 
 	group, err := lib.NewGroup(name, r.GetDefaultGroup())
 	if err != nil {
-		return goja.Undefined(), err
+		return goja.Undefined(), true, err
 	}
 
-	v, _, err := vu.runFn(ctx, group, fn, vu.Runtime.ToValue(arg))
+	v, _, err := vu.runFn(ctx, group, true, out, fn, vu.Runtime.ToValue(arg))
 
 	// deadline is reached so we have timeouted but this might've not been registered correctly
 	if deadline, ok := ctx.Deadline(); ok && time.Now().After(deadline) {
 		// we could have an error that is not errInterrupt in which case we should return it instead
 		if err, ok := err.(*goja.InterruptedError); ok && v != nil && err.Value() != errInterrupt {
-			return v, err
+			return v, true, err
 		}
 		// otherwise we have timeouted
-		return v, lib.NewTimeoutError(name)
+		return v, true, lib.NewTimeoutError(name)
 	}
-	return v, err
+	return v, true, err
 }
 
 type VU struct {
@@ -322,6 +411,9 @@ type VU struct {
 	ID        int64
 	Iteration int64
 
+	// The number of the running iteration among all of the test's, or -1 outside of iterations.
+	globalIteration int64
+
 	Console *Console
 	BPool   *bpool.BufferPool
 
@@ -329,6 +421,14 @@ type VU struct {
 
 	setupData goja.Value
 
+	// Whether vuSetup() has been run since the VU was last reconfigured.
+	started bool
+
+	// The function RunOnce calls, and the tags applied to the samples it emits; these differ from
+	// the default function and the global run tags for VUs spawned for a scenario.
+	exec    goja.Callable
+	runTags *stats.SampleTags
+
 	// A VU will track the last context it was called with for cancellation.
 	// Note that interruptTrackedCtx is the context that is currently being tracked, while
 	// interruptCancel cancels an unrelated context that terminates the tracking goroutine
@@ -338,6 +438,7 @@ type VU struct {
 	// goroutine per call.
 	interruptTrackedCtx context.Context
 	interruptCancel     context.CancelFunc
+	interruptDone       chan struct{}
 }
 
 // Verify that VU implements lib.VU
@@ -346,6 +447,7 @@ var _ lib.VU = &VU{}
 func (u *VU) Reconfigure(id int64) error {
 	u.ID = id
 	u.Iteration = 0
+	u.started = false
 	u.Runtime.Set("__VU", u.ID)
 	return nil
 }
@@ -357,10 +459,13 @@ func (u *VU) RunOnce(ctx context.Context) error {
 		if u.interruptCancel != nil {
 			u.interruptCancel()
 		}
+		done := make(chan struct{})
 		u.interruptCancel = interCancel
 		u.interruptTrackedCtx = ctx
+		u.interruptDone = done
 		defer interCancel()
 		go func() {
+			defer close(done)
 			select {
 			case <-interCtx.Done():
 			case <-ctx.Done():
@@ -383,12 +488,142 @@ func (u *VU) RunOnce(ctx context.Context) error {
 		}
 	}
 
-	// Call the default function.
-	_, _, err := u.runFn(ctx, u.Runner.defaultGroup, u.Default, u.setupData)
+	if u.exec == nil {
+		return errors.New("script must export a default function")
+	}
+
+	// Run vuSetup() before the VU's first iteration. If it fails, the iteration isn't run, and
+	// it's tried again the next time.
+	if !u.started {
+		if err := u.runHook(ctx, "vuSetup", u.Runner.Bundle.Options.VUSetupTimeout, u.Samples); err != nil {
+			return lib.VUSetupError{Err: err}
+		}
+		u.started = true
+	}
+
+	// Call the default (or scenario) function.
+	u.globalIteration = atomic.AddInt64(&u.Runner.iterations, 1) - 1
+	_, _, err := u.runFn(ctx, u.Runner.defaultGroup, true, u.Samples, u.exec, u.setupData)
+	u.globalIteration = -1
 	return err
 }
 
-func (u *VU) runFn(ctx context.Context, group *lib.Group, fn goja.Callable, args ...goja.Value) (goja.Value, *common.State, error) {
+// TeardownVU runs vuTeardown() if the VU has been started, ie. vuSetup() has run (or there is
+// none) and it's run an iteration since it was last reconfigured.
+func (u *VU) TeardownVU(ctx context.Context, out chan<- stats.SampleContainer) error {
+	if !u.started {
+		return nil
+	}
+	u.started = false
+
+	// The last iteration's context is likely done by now; don't let it interrupt the hook.
+	u.clearInterrupt()
+	return u.runHook(ctx, "vuTeardown", u.Runner.Bundle.Options.VUTeardownTimeout, out)
+}
+
+// Runs vuSetup() or vuTeardown(), if the script exports it. They get the setup data, like the
+// default function, but aren't iterations: they don't bump __ITER or emit iteration_duration,
+// and their samples are tagged with a group of their own, like setup() and teardown().
+func (u *VU) runHook(
+	ctx context.Context, name string, timeout types.NullDuration, out chan<- stats.SampleContainer,
+) error {
+	fn, ok := goja.AssertFunction(u.Runtime.Get("exports").ToObject(u.Runtime).Get(name))
+	if !ok {
+		return nil
+	}
+	group, err := lib.NewGroup(name, u.Runner.GetDefaultGroup())
+	if err != nil {
+		return err
+	}
+	if timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout.Duration))
+		defer cancel()
+	}
+
+	// RunOnce only interrupts JS when the iteration's context is done, so watch this one too.
+	finished, watchDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			u.Runtime.Interrupt(errInterrupt)
+		}
+	}()
+	_, _, err = u.runFn(ctx, group, false, out, fn, u.setupData)
+	close(finished)
+	<-watchDone
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		// Don't leave an interrupt pending for whatever runs next.
+		_, _ = u.Runtime.RunProgram(noopProgram)
+		if ctxErr == context.DeadlineExceeded {
+			return lib.NewTimeoutError(name)
+		}
+	}
+	return errors.Wrap(err, name)
+}
+
+// Calls fn in the VU's event loop, which keeps running until all timers and async operations it
+// started are done. If fn returns a promise, eg. because it's an async function, the value it
+// resolves to is returned instead, and a rejection is returned as an error.
+func (u *VU) runInLoop(ctx context.Context, fn goja.Callable, args ...goja.Value) (goja.Value, error) {
+	var v, reason goja.Value
+	var rejected bool
+	err := u.Loop.Run(ctx, func() error {
+		var err error
+		if v, err = fn(goja.Undefined(), args...); err != nil {
+			return err
+		}
+		obj, ok := v.(*goja.Object)
+		if !ok {
+			return nil
+		}
+		then, ok := goja.AssertFunction(obj.Get("then"))
+		if !ok {
+			return nil
+		}
+		_, err = then(obj,
+			u.Runtime.ToValue(func(value goja.Value) { v = value }),
+			u.Runtime.ToValue(func(value goja.Value) { reason, rejected = value, true }),
+		)
+		return err
+	})
+	if err != nil {
+		u.Timers.reset()
+		if err == ctx.Err() {
+			u.clearInterrupt()
+		}
+		return goja.Undefined(), err
+	}
+	if rejected {
+		if reason == nil {
+			reason = goja.Undefined()
+		}
+		return goja.Undefined(), errors.New(reason.String())
+	}
+	return v, nil
+}
+
+// Stops tracking the current context and clears any interrupt that's pending because it's done.
+// The event loop can be abandoned while no JS is running, which would otherwise leave the interrupt
+// for the next iteration to trip over.
+func (u *VU) clearInterrupt() {
+	if u.interruptCancel != nil {
+		u.interruptCancel()
+		<-u.interruptDone
+	}
+	u.interruptTrackedCtx = nil
+	_, _ = u.Runtime.RunProgram(noopProgram)
+}
+
+// Runs fn with the VU's state, sending samples to out. Iterations bump the VU's iteration
+// counter and, unless cancelled, emit an iteration_duration sample.
+func (u *VU) runFn(
+	ctx context.Context, group *lib.Group, iteration bool, out chan<- stats.SampleContainer,
+	fn goja.Callable, args ...goja.Value,
+) (goja.Value, *common.State, error) {
 	cookieJar, err := cookiejar.New(nil)
 	if err != nil {
 		return goja.Undefined(), nil, err
@@ -398,9 +633,14 @@ func (u *VU) runFn(ctx context.Context, group *lib.Group, fn goja.Callable, args
 		cookieJar = u.CookieJar
 	}
 
+	opts := u.Runner.Bundle.Options
+	if u.runTags != nil {
+		opts.RunTags = u.runTags
+	}
+
 	state := &common.State{
 		Logger:    u.Runner.Logger,
-		Options:   u.Runner.Bundle.Options,
+		Options:   opts,
 		Group:     group,
 		Transport: u.Transport,
 		Dialer:    u.Dialer,
@@ -409,20 +649,25 @@ func (u *VU) runFn(ctx context.Context, group *lib.Group, fn goja.Callable, args
 		RPSLimit:  u.Runner.RPSLimit,
 		BPool:     u.BPool,
 		Vu:        u.ID,
-		Samples:   u.Samples,
+		Samples:   out,
 		Iteration: u.Iteration,
+
+		GlobalIteration: u.globalIteration,
 	}
 
 	newctx := common.WithRuntime(ctx, u.Runtime)
 	newctx = common.WithState(newctx, state)
+	newctx = common.WithEventLoop(newctx, u.Loop)
 	*u.Context = newctx
 
-	u.Runtime.Set("__ITER", u.Iteration)
 	iter := u.Iteration
-	u.Iteration++
+	if iteration {
+		u.Runtime.Set("__ITER", u.Iteration)
+		u.Iteration++
+	}
 
 	startTime := time.Now()
-	v, err := fn(goja.Undefined(), args...) // Actually run the JS script
+	v, err := u.runInLoop(ctx, fn, args...) // Actually run the JS script
 	endTime := time.Now()
 
 	var isFullIteration bool
@@ -430,14 +675,14 @@ func (u *VU) runFn(ctx context.Context, group *lib.Group, fn goja.Callable, args
 	case <-ctx.Done():
 		isFullIteration = false
 	default:
-		isFullIteration = true
+		isFullIteration = iteration
 	}
 
 	tags := state.Options.RunTags.CloneTags()
 	if state.Options.SystemTags["vu"] {
 		tags["vu"] = strconv.FormatInt(u.ID, 10)
 	}
-	if state.Options.SystemTags["iter"] {
+	if state.Options.SystemTags["iter"] && iteration {
 		tags["iter"] = strconv.FormatInt(iter, 10)
 	}
 	if state.Options.SystemTags["group"] {
@@ -31,6 +31,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"testing"
 	"time"
 
@@ -369,6 +370,30 @@ func TestSetupDataReturnValue(t *testing.T) {
 	testSetupDataHelper(t, src)
 }
 
+func TestSetupDataAsync(t *testing.T) {
+	src := &lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+			export let options = { setupTimeout: "1s", teardownTimeout: "1s" };
+			export async function setup() {
+				return await new Promise(resolve => setTimeout(() => resolve(42), 10));
+			}
+			export default function(data) {
+				if (data != 42) {
+					throw new Error("default: wrong data: " + JSON.stringify(data))
+				}
+			};
+
+			export function teardown(data) {
+				if (data != 42) {
+					throw new Error("teardown: wrong data: " + JSON.stringify(data))
+				}
+			};
+		`),
+	}
+	testSetupDataHelper(t, src)
+}
+
 func TestSetupDataNoSetup(t *testing.T) {
 	src := &lib.SourceData{
 		Filename: "/script.js",
@@ -412,6 +437,90 @@ func TestSetupDataNoReturn(t *testing.T) {
 	}
 	testSetupDataHelper(t, src)
 }
+
+func TestHandleSummary(t *testing.T) {
+	summary := []byte(`{"metrics": {"iterations": {"values": {"count": 10}}}, "options": {"vus": 2}}`)
+
+	t.Run("Reports", func(t *testing.T) {
+		r, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+				export default function() {};
+				export function handleSummary(data) {
+					return {
+						"stdout": "iterations: " + data.metrics.iterations.values.count,
+						"summary.json": { vus: data.options.vus },
+						"nothing": undefined,
+					};
+				}
+			`),
+		}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+		require.NoError(t, err)
+
+		reports, err := r.HandleSummary(context.Background(), summary)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{
+			"stdout":       []byte("iterations: 10"),
+			"summary.json": []byte("{\n    \"vus\": 2\n}\n"),
+		}, reports)
+	})
+	t.Run("Async", func(t *testing.T) {
+		r, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+				export default function() {};
+				export async function handleSummary(data) {
+					await new Promise(resolve => setTimeout(resolve, 10));
+					return { "stdout": "done" };
+				}
+			`),
+		}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+		require.NoError(t, err)
+
+		reports, err := r.HandleSummary(context.Background(), summary)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"stdout": []byte("done")}, reports)
+	})
+	t.Run("NotExported", func(t *testing.T) {
+		r, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data:     []byte(`export default function() {};`),
+		}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+		require.NoError(t, err)
+
+		reports, err := r.HandleSummary(context.Background(), summary)
+		assert.NoError(t, err)
+		assert.Nil(t, reports)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data:     []byte(`export default function() {}; export let handleSummary = 1;`),
+		}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+		assert.EqualError(t, err, "exported 'handleSummary' must be a function")
+	})
+	t.Run("Errors", func(t *testing.T) {
+		testdata := map[string]string{
+			`throw new Error("oops");`: "handleSummary: Error: oops",
+			`return "stdout";`:         "handleSummary() must return an object of destinations to contents",
+			`return;`:                  "handleSummary() must return an object of destinations to contents",
+		}
+		for body, msg := range testdata {
+			t.Run(body, func(t *testing.T) {
+				r, err := New(&lib.SourceData{
+					Filename: "/script.js",
+					Data:     []byte(`export default function() {}; export function handleSummary() { ` + body + ` }`),
+				}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+				require.NoError(t, err)
+
+				_, err = r.HandleSummary(context.Background(), summary)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), msg)
+			})
+		}
+	})
+}
+
 func TestRunnerIntegrationImports(t *testing.T) {
 	t.Run("Modules", func(t *testing.T) {
 		modules := []string{
@@ -560,6 +669,132 @@ func TestVURunInterrupt(t *testing.T) {
 	}
 }
 
+func TestVUIntegrationEventLoop(t *testing.T) {
+	testdata := map[string]string{
+		"Timers": `
+			let calls = [];
+			export default function() {
+				calls = [];
+				setTimeout(function(a, b) {
+					calls.push("timeout " + a + b);
+					if (calls.join() !== "immediate,interval 1,interval 2,interval 3,timeout xy") {
+						throw new Error("unexpected calls: " + calls.join());
+					}
+				}, 100, "x", "y");
+				setImmediate(function() { calls.push("immediate"); });
+				let cleared = setTimeout(function() { throw new Error("cleared timeout ran"); }, 1);
+				clearTimeout(cleared);
+				let n = 0;
+				let interval = setInterval(function() {
+					calls.push("interval " + (++n));
+					if (n === 3) {
+						clearInterval(interval);
+					}
+				}, 1);
+			}`,
+		"Async": `
+			function sleep(ms) { return new Promise(resolve => setTimeout(resolve, ms)); }
+			export default async function() {
+				let start = Date.now();
+				let results = await Promise.all([sleep(30).then(() => 1), sleep(20).then(() => 2)]);
+				if (results.join() !== "1,2") { throw new Error("unexpected results: " + results.join()); }
+				if (Date.now() - start >= 50) { throw new Error("sleeps didn't run at the same time"); }
+				try {
+					await Promise.reject(new Error("oops"));
+					throw new Error("not rejected");
+				} catch (e) {
+					if (e.message !== "oops") { throw e; }
+				}
+			}`,
+		"Generators": `
+			function* gen() {
+				yield 1;
+				yield* [2, 3];
+				try { throw new Error("x"); } catch (e) { yield e.message; } finally { yield "f"; }
+			}
+			export default function() {
+				let values = [];
+				for (let v of gen()) { values.push(v); }
+				if (values.join() !== "1,2,3,x,f") { throw new Error("unexpected values: " + values.join()); }
+			}`,
+		"Globals": `
+			export default function() {
+				let timers = [typeof setTimeout, typeof clearTimeout, typeof setInterval,
+					typeof clearInterval, typeof setImmediate, typeof clearImmediate];
+				if (timers.join() !== "function,function,function,function,function,function") {
+					throw new Error("unexpected timer globals: " + timers.join());
+				}
+				if (typeof reset !== "undefined") { throw new Error("reset() is exposed"); }
+			}`,
+		"InitContext": `
+			let resolved = false;
+			Promise.resolve().then(() => { resolved = true; });
+			export default function() {
+				if (!resolved) { throw new Error("promise from the init context wasn't resolved"); }
+			}`,
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			r1, err := New(&lib.SourceData{Filename: "/script.js", Data: []byte(data)}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+			require.NoError(t, err)
+			r2, err := NewFromArchive(r1.MakeArchive(), lib.RuntimeOptions{})
+			require.NoError(t, err)
+
+			for name, r := range map[string]*Runner{"Source": r1, "Archive": r2} {
+				t.Run(name, func(t *testing.T) {
+					vu, err := r.newVU(make(chan stats.SampleContainer, 100))
+					require.NoError(t, err)
+					assert.NoError(t, vu.RunOnce(context.Background()))
+					assert.NoError(t, vu.RunOnce(context.Background()))
+				})
+			}
+		})
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		testdata := map[string]string{
+			"Rejected": `export default async function() { throw new Error("rejected"); }`,
+			"Timeout":  `export default function() { setTimeout(function() { throw new Error("rejected"); }, 1); }`,
+		}
+		for name, data := range testdata {
+			t.Run(name, func(t *testing.T) {
+				r, err := New(&lib.SourceData{Filename: "/script.js", Data: []byte(data)}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+				require.NoError(t, err)
+				vu, err := r.newVU(make(chan stats.SampleContainer, 100))
+				require.NoError(t, err)
+				err = vu.RunOnce(context.Background())
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "rejected")
+			})
+		}
+	})
+
+	t.Run("Interrupted", func(t *testing.T) {
+		r, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+			let calls = 0;
+			export default function() {
+				if (++calls === 1) {
+					setInterval(function() {}, 1);
+					setTimeout(function() { throw new Error("timer from the previous iteration ran"); }, 100);
+				}
+			}`),
+		}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+		require.NoError(t, err)
+		vu, err := r.newVU(make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		// Depending on timing, either an interval callback or the loop itself is interrupted.
+		assert.Error(t, vu.RunOnce(ctx))
+		assert.NoError(t, vu.RunOnce(context.Background()))
+		time.Sleep(100 * time.Millisecond)
+		assert.NoError(t, vu.RunOnce(context.Background()))
+	})
+}
+
 func TestVUIntegrationGroups(t *testing.T) {
 	r1, err := New(&lib.SourceData{
 		Filename: "/script.js",
@@ -622,6 +857,235 @@ func TestVUIntegrationGroups(t *testing.T) {
 	}
 }
 
+func TestVUIntegrationScenario(t *testing.T) {
+	r1, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		export let options = {
+			scenarios: {
+				other: { exec: "other", env: { MYVAR: "scenario" }, tags: { mytag: "value" } },
+			},
+		};
+		export default function() { throw new Error("default called"); }
+		export function other() { check(__ENV.MYVAR); }
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{Env: map[string]string{"MYVAR": "global"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	r1.SetOptions(r1.GetOptions().Apply(lib.Options{SystemTags: lib.GetTagSet("scenario")}))
+
+	r2, err := NewFromArchive(r1.MakeArchive(), lib.RuntimeOptions{Env: map[string]string{"MYVAR": "global"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	r2.SetOptions(r1.GetOptions())
+
+	testdata := map[string]*Runner{"Source": r1, "Archive": r2}
+	for name, r := range testdata {
+		t.Run(name, func(t *testing.T) {
+			sc := r.GetOptions().Scenarios["other"]
+			vu, err := r.NewScenarioVU("other", sc, make(chan stats.SampleContainer, 100))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			called := false
+			vu.(*VU).Runtime.Set("check", func(v string) {
+				called = true
+				assert.Equal(t, "scenario", v)
+				tags := common.GetState(*vu.(*VU).Context).Options.RunTags.CloneTags()
+				assert.Equal(t, map[string]string{"mytag": "value", "scenario": "other"}, tags)
+			})
+			assert.NoError(t, vu.RunOnce(context.Background()))
+			assert.True(t, called, "check() not called")
+
+			_, err = r.NewScenarioVU("nope", lib.Scenario{Exec: null.StringFrom("nope")}, nil)
+			assert.EqualError(t, err, "scenario 'nope': exported function 'nope' not found")
+		})
+	}
+}
+
+func TestVUIntegrationLifecycleHooks(t *testing.T) {
+	r1, err := New(&lib.SourceData{
+		Filename: "/script.js",
+		Data: []byte(`
+		import { Counter } from "k6/metrics";
+		let hooks = new Counter("hooks");
+		let loggedIn = false;
+		let iterations = 0;
+		export function vuSetup() {
+			loggedIn = true;
+			hooks.add(1, { hook: "setup" });
+		}
+		export default function() {
+			if (!loggedIn) { throw new Error("not logged in"); }
+			if (__ITER !== iterations++) { throw new Error("unexpected __ITER: " + __ITER); }
+		}
+		export function vuTeardown() {
+			loggedIn = false;
+			iterations = 0;
+			hooks.add(1, { hook: "teardown" });
+		}
+		`),
+	}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+	r1.SetOptions(r1.GetOptions().Apply(lib.Options{SystemTags: lib.GetTagSet("group", "iter")}))
+
+	r2, err := NewFromArchive(r1.MakeArchive(), lib.RuntimeOptions{})
+	require.NoError(t, err)
+	r2.SetOptions(r1.GetOptions())
+
+	// Counts hook samples by hook, and iteration_duration samples by group.
+	count := func(samples chan stats.SampleContainer) map[string]int {
+		counts := make(map[string]int)
+		for _, sc := range stats.GetBufferedSamples(samples) {
+			for _, s := range sc.GetSamples() {
+				tags := s.Tags.CloneTags()
+				switch s.Metric.Name {
+				case "hooks":
+					counts[tags["hook"]+" "+tags["group"]]++
+					assert.NotContains(t, tags, "iter")
+				case metrics.IterationDuration.Name:
+					counts["iteration "+tags["group"]]++
+				}
+			}
+		}
+		return counts
+	}
+
+	testdata := map[string]*Runner{"Source": r1, "Archive": r2}
+	for name, r := range testdata {
+		t.Run(name, func(t *testing.T) {
+			samples := make(chan stats.SampleContainer, 100)
+			vu, err := r.newVU(samples)
+			require.NoError(t, err)
+
+			assert.NoError(t, vu.RunOnce(context.Background()))
+			assert.NoError(t, vu.RunOnce(context.Background()))
+			assert.Equal(t, map[string]int{"setup ::vuSetup": 1, "iteration ": 2}, count(samples))
+
+			out := make(chan stats.SampleContainer, 100)
+			assert.NoError(t, vu.TeardownVU(context.Background(), out))
+			assert.NoError(t, vu.TeardownVU(context.Background(), out))
+			assert.Equal(t, map[string]int{"teardown ::vuTeardown": 1}, count(out))
+			assert.Empty(t, count(samples))
+
+			// A reconfigured VU is a new one, and gets set up again.
+			assert.NoError(t, vu.Reconfigure(2))
+			assert.NoError(t, vu.RunOnce(context.Background()))
+			assert.Equal(t, map[string]int{"setup ::vuSetup": 1, "iteration ": 1}, count(samples))
+
+			// VUs that haven't run since being reconfigured aren't torn down.
+			assert.NoError(t, vu.Reconfigure(3))
+			assert.NoError(t, vu.TeardownVU(context.Background(), out))
+			assert.Empty(t, count(out))
+		})
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		r, err := New(&lib.SourceData{
+			Filename: "/script.js",
+			Data: []byte(`
+			let tries = 0;
+			export function vuSetup() {
+				tries++;
+				if (tries == 1) { throw new Error("nope"); }
+				if (tries == 2) { while (true) {} }
+			}
+			export default function() {
+				if (tries < 3) { throw new Error("default called"); }
+			}
+			export function vuTeardown() { throw new Error("teardown called"); }
+			`),
+		}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+		require.NoError(t, err)
+		r.SetOptions(r.GetOptions().Apply(lib.Options{VUSetupTimeout: types.NullDurationFrom(100 * time.Millisecond)}))
+
+		vu, err := r.newVU(make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+
+		// A failed vuSetup() skips the iteration, and isn't torn down.
+		err = vu.RunOnce(context.Background())
+		require.Error(t, err)
+		assert.IsType(t, lib.VUSetupError{}, err)
+		assert.Contains(t, err.Error(), "vuSetup: Error: nope")
+		assert.NoError(t, vu.TeardownVU(context.Background(), nil))
+
+		assert.EqualError(t, vu.RunOnce(context.Background()), "Timeout during vuSetup")
+		assert.NoError(t, vu.RunOnce(context.Background()))
+
+		err = vu.TeardownVU(context.Background(), make(chan stats.SampleContainer, 100))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "vuTeardown: Error: teardown called")
+	})
+}
+
+func TestVUIntegrationExecution(t *testing.T) {
+	// Runs the script to completion, returning the engine and the values of its "iters" metric.
+	run := func(t *testing.T, src string) (*core.Engine, []float64) {
+		r, err := New(&lib.SourceData{Filename: "/script.js", Data: []byte(src)}, afero.NewMemMapFs(), lib.RuntimeOptions{})
+		require.NoError(t, err)
+		engine, err := core.NewEngine(local.New(r), r.GetOptions())
+		require.NoError(t, err)
+		logger, _ := logtest.NewNullLogger()
+		engine.SetLogger(logger)
+		collector := &dummy.Collector{}
+		engine.Collectors = []lib.Collector{collector}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		require.NoError(t, engine.Run(ctx))
+		require.NoError(t, ctx.Err(), "test timed out")
+
+		var iters []float64
+		for _, s := range collector.Samples {
+			if s.Metric.Name == "iters" {
+				iters = append(iters, s.Value)
+			}
+		}
+		sort.Float64s(iters)
+		return engine, iters
+	}
+
+	t.Run("iteration", func(t *testing.T) {
+		_, iters := run(t, `
+		import execution from "k6/execution";
+		import { Trend } from "k6/metrics";
+		let iters = new Trend("iters");
+		export let options = { vus: 2, vusMax: 2, iterations: 6 };
+		export default function() {
+			if (execution.activeVUs() !== 2) { throw new Error("wrong VUs: " + execution.activeVUs()); }
+			if (execution.options().iterations !== 6) { throw new Error("wrong options"); }
+			if (execution.startTime() > Date.now()) { throw new Error("wrong start time"); }
+			iters.add(execution.iteration());
+		}
+		`)
+		assert.Equal(t, []float64{0, 1, 2, 3, 4, 5}, iters)
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		engine, iters := run(t, `
+		import execution from "k6/execution";
+		import { Trend } from "k6/metrics";
+		let iters = new Trend("iters");
+		export let options = { vus: 1, vusMax: 1, duration: "10s", teardownTimeout: "1s" };
+		export default function() {
+			if (execution.iteration() == 3) {
+				execution.abort("enough", 3);
+				throw new Error("still running");
+			}
+			iters.add(execution.iteration());
+		}
+		export function teardown() {
+			iters.add(-1);
+		}
+		`)
+		assert.Equal(t, []float64{-1, 0, 1, 2}, iters)
+		assert.Equal(t, 3, engine.GetAbortExitCode())
+	})
+}
+
 func TestVUIntegrationMetrics(t *testing.T) {
 	r1, err := New(&lib.SourceData{
 		Filename: "/script.js",
@@ -0,0 +1,153 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package js
+
+import (
+	"math"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/loadimpact/k6/js/common"
+)
+
+// Timers implements setTimeout() and friends on top of a VU's event loop. It's only used from the
+// VU's goroutine: timers that fire queue their callback in the loop rather than running it.
+type Timers struct {
+	loop   *common.EventLoop
+	lastID int64
+	active map[int64]*timer
+}
+
+type timer struct {
+	t     *time.Timer
+	queue func(func() error)
+}
+
+// NewTimers returns a Timers using the given loop.
+func NewTimers(loop *common.EventLoop) *Timers {
+	return &Timers{loop: loop, active: make(map[int64]*timer)}
+}
+
+// SetTimeout calls fn with args after delay milliseconds; it returns an ID for clearTimeout().
+func (t *Timers) SetTimeout(fn goja.Callable, delay float64, args ...goja.Value) int64 {
+	t.lastID++
+	t.start(t.lastID, fn, delay, args, false)
+	return t.lastID
+}
+
+// ClearTimeout cancels a timeout, if it hasn't run yet.
+func (t *Timers) ClearTimeout(id int64) {
+	t.stop(id)
+}
+
+// SetInterval calls fn with args every delay milliseconds; it returns an ID for clearInterval().
+// The VU's iteration doesn't end until the interval is cleared.
+func (t *Timers) SetInterval(fn goja.Callable, delay float64, args ...goja.Value) int64 {
+	t.lastID++
+	t.start(t.lastID, fn, delay, args, true)
+	return t.lastID
+}
+
+// ClearInterval cancels an interval.
+func (t *Timers) ClearInterval(id int64) {
+	t.stop(id)
+}
+
+// SetImmediate calls fn with args as soon as the callbacks that are already queued have run.
+func (t *Timers) SetImmediate(fn goja.Callable, args ...goja.Value) int64 {
+	t.lastID++
+	id := t.lastID
+	queue := t.loop.Reserve()
+	t.active[id] = &timer{queue: queue}
+	queue(t.callback(id, fn, args, nil))
+	return id
+}
+
+// ClearImmediate cancels a call scheduled with setImmediate(), if it hasn't run yet.
+func (t *Timers) ClearImmediate(id int64) {
+	t.stop(id)
+}
+
+func (t *Timers) start(id int64, fn goja.Callable, delay float64, args []goja.Value, repeat bool) {
+	if math.IsNaN(delay) || delay < 0 {
+		delay = 0
+	}
+	var restart func()
+	if repeat {
+		restart = func() { t.start(id, fn, delay, args, true) }
+	}
+
+	queue := t.loop.Reserve()
+	callback := t.callback(id, fn, args, restart)
+	t.active[id] = &timer{
+		t:     time.AfterFunc(time.Duration(delay*float64(time.Millisecond)), func() { queue(callback) }),
+		queue: queue,
+	}
+}
+
+// Returns the callback for a timer, which does nothing if the timer's been cleared in the
+// meantime. Intervals are restarted before fn is called, so fn can clear them.
+func (t *Timers) callback(id int64, fn goja.Callable, args []goja.Value, restart func()) func() error {
+	return func() error {
+		if _, ok := t.active[id]; !ok {
+			return nil
+		}
+		if restart != nil {
+			restart()
+		} else {
+			delete(t.active, id)
+		}
+		_, err := fn(goja.Undefined(), args...)
+		return err
+	}
+}
+
+func (t *Timers) stop(id int64) {
+	tm, ok := t.active[id]
+	if !ok {
+		return
+	}
+	delete(t.active, id)
+	if tm.t != nil && tm.t.Stop() {
+		tm.queue(nil)
+	}
+}
+
+// Cancels all timers, eg. after the event loop has been abandoned because the iteration was
+// interrupted. It isn't exposed to scripts, which can only clear their own timers.
+func (t *Timers) reset() {
+	for id := range t.active {
+		t.stop(id)
+	}
+}
+
+// Exports returns the timer functions scripts get as globals.
+func (t *Timers) Exports(rt *goja.Runtime) map[string]interface{} {
+	bound := common.Bind(rt, t, nil)
+	exports := make(map[string]interface{}, len(timerGlobals))
+	for _, name := range timerGlobals {
+		exports[name] = bound[name]
+	}
+	return exports
+}
+
+var timerGlobals = []string{
+	"setTimeout", "clearTimeout", "setInterval", "clearInterval", "setImmediate", "clearImmediate",
+}
@@ -0,0 +1,105 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"strings"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// A MetricAggregator aggregates samples into metrics of their own, along with the submetrics that
+// have thresholds, eg. "http_req_duration{status:200}". Trend metrics get the kind of sink that
+// Options.TrendSink asks for. It's not safe for concurrent use, except that different metrics
+// (along with their submetrics) can be added to in parallel.
+type MetricAggregator struct {
+	// The thresholds and submetrics assigned to metrics upon their first sample, by name.
+	Thresholds map[string]stats.Thresholds
+	Submetrics map[string][]*stats.Submetric
+
+	// If set, samples aren't added to the thresholds, which only matters for windowed ones.
+	NoThresholds bool
+
+	trendSink string
+}
+
+// NewMetricAggregator creates a MetricAggregator for the given thresholds, which it takes
+// ownership of, and trend sink (TrendSinkExact or TrendSinkSketch).
+func NewMetricAggregator(thresholds map[string]stats.Thresholds, trendSink string) *MetricAggregator {
+	a := &MetricAggregator{
+		Thresholds: thresholds,
+		Submetrics: make(map[string][]*stats.Submetric),
+		trendSink:  trendSink,
+	}
+	for name := range thresholds {
+		if !strings.Contains(name, "{") {
+			continue
+		}
+
+		parent, sm := stats.NewSubmetric(name)
+		a.Submetrics[parent] = append(a.Submetrics[parent], sm)
+	}
+	return a
+}
+
+// NewMetric creates a metric to aggregate the samples of the given one in, with its thresholds
+// and submetrics.
+func (a *MetricAggregator) NewMetric(like *stats.Metric) *stats.Metric {
+	m := a.newMetric(like.Name, like.Type, like.Contains)
+	m.Thresholds = a.Thresholds[m.Name]
+	m.Submetrics = a.Submetrics[m.Name]
+	return m
+}
+
+func (a *MetricAggregator) newMetric(name string, typ stats.MetricType, contains stats.ValueType) *stats.Metric {
+	m := stats.New(name, typ, contains)
+	if typ == stats.Trend && a.trendSink == TrendSinkSketch {
+		m.Sink = stats.NewSketchTrendSink()
+	}
+	return m
+}
+
+// Add adds a sample to m, which was created by NewMetric, and to its submetrics whose tags it has.
+// Submetrics that get their first sample are created, and appended to added, which is returned.
+func (a *MetricAggregator) Add(m *stats.Metric, sample stats.Sample, added []*stats.Metric) []*stats.Metric {
+	m.Sink.Add(sample)
+	if !a.NoThresholds {
+		m.Thresholds.Add(sample)
+	}
+
+	for _, sm := range m.Submetrics {
+		if !sample.Tags.Contains(sm.Tags) {
+			continue
+		}
+
+		if sm.Metric == nil {
+			sm.Metric = a.newMetric(sm.Name, m.Type, m.Contains)
+			sm.Metric.Sub = *sm
+			sm.Metric.Thresholds = a.Thresholds[sm.Name]
+			added = append(added, sm.Metric)
+		}
+		sm.Metric.Sink.Add(sample)
+		if !a.NoThresholds {
+			sm.Metric.Thresholds.Add(sample)
+		}
+	}
+	return added
+}
@@ -0,0 +1,73 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2019 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricAggregator(t *testing.T) {
+	trend := stats.New("my_trend", stats.Trend, stats.Time)
+	tags := func(status string) *stats.SampleTags {
+		return stats.IntoSampleTags(&map[string]string{"status": status})
+	}
+	newThresholds := func() map[string]stats.Thresholds {
+		ths, err := stats.NewThresholds([]string{"p(95)<500"})
+		require.NoError(t, err)
+		windowed, err := stats.NewThresholds([]string{"p(95) over 1m < 500"})
+		require.NoError(t, err)
+		return map[string]stats.Thresholds{"my_trend": ths, "my_trend{status:200}": windowed}
+	}
+
+	for trendSink, sketch := range map[string]bool{"": false, TrendSinkExact: false, TrendSinkSketch: true} {
+		t.Run(trendSink, func(t *testing.T) {
+			a := NewMetricAggregator(newThresholds(), trendSink)
+			require.Len(t, a.Submetrics["my_trend"], 1)
+
+			m := a.NewMetric(trend)
+			assert.Equal(t, "my_trend", m.Name)
+			assert.Equal(t, stats.Time, m.Contains)
+			assert.Len(t, m.Thresholds.Thresholds, 1)
+			assert.Equal(t, a.Submetrics["my_trend"], m.Submetrics)
+
+			added := a.Add(m, stats.Sample{Metric: trend, Tags: tags("404"), Value: 300}, nil)
+			assert.Empty(t, added)
+			added = a.Add(m, stats.Sample{Metric: trend, Tags: tags("200"), Value: 100}, added)
+			require.Len(t, added, 1)
+			sm := added[0]
+			assert.Equal(t, "my_trend{status:200}", sm.Name)
+			assert.Equal(t, "my_trend{status:200}", sm.Sub.Name)
+			assert.Len(t, sm.Thresholds.Thresholds, 1)
+			assert.Empty(t, a.Add(m, stats.Sample{Metric: trend, Tags: tags("200"), Value: 200}, nil))
+
+			for _, m := range []*stats.Metric{m, sm} {
+				sink := m.Sink.(*stats.TrendSink)
+				assert.Equal(t, sketch, sink.Sketch != nil, m.Name)
+			}
+			assert.Equal(t, uint64(3), m.Sink.(*stats.TrendSink).Count)
+			assert.Equal(t, uint64(2), sm.Sink.(*stats.TrendSink).Count)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package lib
+
+import (
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/pkg/errors"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Possible values for Breakpoint.Mode.
+const (
+	// Load levels are numbers of looping VUs (the default).
+	BreakpointModeVUs = "vus"
+	// Load levels are arrival rates, in iterations per second; see Options.ArrivalRate.
+	BreakpointModeArrivalRate = "arrival-rate"
+)
+
+// A Breakpoint configures a breakpoint test, which searches for the highest load the system under
+// test can sustain: the load is increased step by step, and the thresholds are evaluated at the
+// end of each step, over that step's data only. When a step fails them, the search backs off and
+// bisects between the highest level that passed and the lowest one that failed.
+type Breakpoint struct {
+	// What load levels are; one of the BreakpointMode* constants, "vus" if not set.
+	Mode null.String `json:"mode"`
+
+	// The first level, how much to increase it by after each passing step, and the highest
+	// level to try. Start defaults to Step.
+	Start null.Int `json:"start"`
+	Step  null.Int `json:"step"`
+	Max   null.Int `json:"max"`
+
+	// How long each level is run for; 1 minute if not set.
+	StepDuration types.NullDuration `json:"stepDuration"`
+
+	// The search ends once the highest passing and lowest failing levels are at most this far
+	// apart; a tenth of Step (and at least 1) if not set.
+	Precision null.Int `json:"precision"`
+}
+
+// GetMode returns the breakpoint test's mode, taking the default into account.
+func (b Breakpoint) GetMode() string {
+	if !b.Mode.Valid || b.Mode.String == "" {
+		return BreakpointModeVUs
+	}
+	return b.Mode.String
+}
+
+// Validate checks that the breakpoint test is well-formed.
+func (b Breakpoint) Validate() error {
+	switch b.GetMode() {
+	case BreakpointModeVUs, BreakpointModeArrivalRate:
+	default:
+		return errors.Errorf("unknown breakpoint mode: %s", b.Mode.String)
+	}
+	if !b.Step.Valid || b.Step.Int64 <= 0 {
+		return errors.New("the breakpoint step must be positive")
+	}
+	if !b.Max.Valid || b.Max.Int64 <= 0 {
+		return errors.New("the breakpoint max must be positive")
+	}
+	if b.Start.Valid && (b.Start.Int64 <= 0 || b.Start.Int64 > b.Max.Int64) {
+		return errors.New("the breakpoint start must be positive, and at most max")
+	}
+	if b.StepDuration.Valid && b.StepDuration.Duration <= 0 {
+		return errors.New("the breakpoint stepDuration must be positive")
+	}
+	if b.Precision.Valid && b.Precision.Int64 <= 0 {
+		return errors.New("the breakpoint precision must be positive")
+	}
+	return nil
+}
+
+// WithDefaults returns the breakpoint test with its start, step duration and precision defaults
+// filled in.
+func (b Breakpoint) WithDefaults() Breakpoint {
+	if !b.Start.Valid {
+		b.Start = b.Step
+		if b.Start.Int64 > b.Max.Int64 {
+			b.Start = b.Max
+		}
+	}
+	if !b.StepDuration.Valid {
+		b.StepDuration = types.NullDurationFrom(1 * time.Minute)
+	}
+	if !b.Precision.Valid {
+		b.Precision = null.IntFrom(b.Step.Int64 / 10)
+		if b.Precision.Int64 < 1 {
+			b.Precision = null.IntFrom(1)
+		}
+	}
+	return b
+}
+
+// A BreakpointStep is one of the load levels a breakpoint test has run at.
+type BreakpointStep struct {
+	Level int64 `json:"level"`
+
+	// When the step started, relative to the start of the test, and how long it ran for.
+	StartTime types.Duration `json:"start_time"`
+	Duration  types.Duration `json:"duration"`
+
+	// Whether the thresholds passed over the step, and if not, the ones that failed, eg.
+	// "http_req_duration: p(95)<500".
+	Passed           bool     `json:"passed"`
+	FailedThresholds []string `json:"failed_thresholds"`
+}
+
+// A BreakpointResult is the progress of a breakpoint test.
+type BreakpointResult struct {
+	Mode string `json:"mode"`
+
+	// The steps that have completed so far, in order.
+	Steps []BreakpointStep `json:"steps"`
+
+	// The highest level that passed so far, if any did.
+	Highest null.Int `json:"highest"`
+
+	// Whether the search is over.
+	Done bool `json:"done"`
+}
+
+// A BreakpointReporter is an Executor that runs a breakpoint test, and reports its progress.
+type BreakpointReporter interface {
+	GetBreakpointResult() BreakpointResult
+}
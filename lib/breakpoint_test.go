@@ -0,0 +1,91 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestBreakpointJSON(t *testing.T) {
+	var opts Options
+	require.NoError(t, json.Unmarshal([]byte(`{"breakpoint": {
+		"mode": "arrival-rate", "start": 50, "step": 25, "max": 500, "stepDuration": "2m", "precision": 5
+	}}`), &opts))
+	assert.Equal(t, &Breakpoint{
+		Mode:         null.StringFrom(BreakpointModeArrivalRate),
+		Start:        null.IntFrom(50),
+		Step:         null.IntFrom(25),
+		Max:          null.IntFrom(500),
+		StepDuration: types.NullDurationFrom(2 * time.Minute),
+		Precision:    null.IntFrom(5),
+	}, opts.Breakpoint)
+}
+
+func TestBreakpointValidate(t *testing.T) {
+	valid := Breakpoint{Step: null.IntFrom(10), Max: null.IntFrom(100)}
+	testdata := map[string]struct {
+		bp  func(Breakpoint) Breakpoint
+		err string
+	}{
+		"Valid":        {func(b Breakpoint) Breakpoint { return b }, ""},
+		"ArrivalRate":  {func(b Breakpoint) Breakpoint { b.Mode = null.StringFrom("arrival-rate"); return b }, ""},
+		"UnknownMode":  {func(b Breakpoint) Breakpoint { b.Mode = null.StringFrom("nope"); return b }, "unknown breakpoint mode: nope"},
+		"NoStep":       {func(b Breakpoint) Breakpoint { b.Step = null.Int{}; return b }, "the breakpoint step must be positive"},
+		"NoMax":        {func(b Breakpoint) Breakpoint { b.Max = null.Int{}; return b }, "the breakpoint max must be positive"},
+		"StartOverMax": {func(b Breakpoint) Breakpoint { b.Start = null.IntFrom(200); return b }, "the breakpoint start must be positive, and at most max"},
+		"NoDuration": {
+			func(b Breakpoint) Breakpoint { b.StepDuration = types.NullDurationFrom(0); return b },
+			"the breakpoint stepDuration must be positive",
+		},
+		"NoPrecision": {
+			func(b Breakpoint) Breakpoint { b.Precision = null.IntFrom(0); return b },
+			"the breakpoint precision must be positive",
+		},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			err := data.bp(valid).Validate()
+			if data.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, data.err)
+			}
+		})
+	}
+}
+
+func TestBreakpointWithDefaults(t *testing.T) {
+	bp := Breakpoint{Step: null.IntFrom(50), Max: null.IntFrom(500)}.WithDefaults()
+	assert.Equal(t, BreakpointModeVUs, bp.GetMode())
+	assert.Equal(t, null.IntFrom(50), bp.Start)
+	assert.Equal(t, types.NullDurationFrom(1*time.Minute), bp.StepDuration)
+	assert.Equal(t, null.IntFrom(5), bp.Precision)
+
+	bp = Breakpoint{Step: null.IntFrom(5), Max: null.IntFrom(3)}.WithDefaults()
+	assert.Equal(t, null.IntFrom(3), bp.Start)
+	assert.Equal(t, null.IntFrom(1), bp.Precision)
+}
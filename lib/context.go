@@ -0,0 +1,99 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"context"
+	"time"
+)
+
+type ctxKey int
+
+const (
+	ctxKeyTestAbort ctxKey = iota
+	ctxKeyExecutionSegment
+	ctxKeyExecutionInfo
+)
+
+// A TestAbortFunc ends the test early, as if it ran its course; the reason is logged. Unless the
+// exit code is 0, k6 exits with it once the test is over.
+type TestAbortFunc func(reason string, exitCode int)
+
+// An ExecutionSegment is the part of a test run by one instance of k6, out of all of those that
+// run it: there's only one, unless the test is distributed.
+type ExecutionSegment struct {
+	Index int
+	Count int
+}
+
+// WithTestAbort returns a context in which the running test can be aborted; it's set by whatever
+// runs the Executor, and so is inherited by VUs.
+func WithTestAbort(ctx context.Context, abort TestAbortFunc) context.Context {
+	return context.WithValue(ctx, ctxKeyTestAbort, abort)
+}
+
+// GetTestAbort returns the context's TestAbortFunc, or nil if the test can't be aborted.
+func GetTestAbort(ctx context.Context) TestAbortFunc {
+	v := ctx.Value(ctxKeyTestAbort)
+	if v == nil {
+		return nil
+	}
+	return v.(TestAbortFunc)
+}
+
+// ExecutionInfo is what VUs can find out about the test they're running, eg. through k6/execution.
+type ExecutionInfo struct {
+	// The executor running the whole test, and when it started.
+	Test      Executor
+	StartTime time.Time
+
+	// The executor running the VU; it's the same as Test, unless that's running scenarios.
+	Current Executor
+}
+
+// WithExecutionInfo returns a context for VUs running the given test.
+func WithExecutionInfo(ctx context.Context, info ExecutionInfo) context.Context {
+	return context.WithValue(ctx, ctxKeyExecutionInfo, info)
+}
+
+// GetExecutionInfo returns the context's ExecutionInfo, or nil if no test is running in it.
+func GetExecutionInfo(ctx context.Context) *ExecutionInfo {
+	v := ctx.Value(ctxKeyExecutionInfo)
+	if v == nil {
+		return nil
+	}
+	info := v.(ExecutionInfo)
+	return &info
+}
+
+// WithExecutionSegment returns a context for running the given segment of a test.
+func WithExecutionSegment(ctx context.Context, segment ExecutionSegment) context.Context {
+	return context.WithValue(ctx, ctxKeyExecutionSegment, segment)
+}
+
+// GetExecutionSegment returns the context's ExecutionSegment; unless it's set, it's the whole test.
+func GetExecutionSegment(ctx context.Context) ExecutionSegment {
+	v := ctx.Value(ctxKeyExecutionSegment)
+	if v == nil {
+		return ExecutionSegment{Index: 0, Count: 1}
+	}
+	return v.(ExecutionSegment)
+}
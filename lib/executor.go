@@ -85,3 +85,9 @@ type Executor interface {
 	SetRunSetup(r bool)
 	SetRunTeardown(r bool)
 }
+
+// A GeneratorWarner is an Executor that runs the test on other load generators, eg. the agents of
+// a distributed test, and warns about them having been overloaded, like the Engine does for its own.
+type GeneratorWarner interface {
+	GetGeneratorWarnings() []string
+}
@@ -28,11 +28,22 @@ import (
 
 var (
 	// Engine-emitted.
-	VUs               = stats.New("vus", stats.Gauge)
-	VUsMax            = stats.New("vus_max", stats.Gauge)
-	Iterations        = stats.New("iterations", stats.Counter)
-	IterationDuration = stats.New("iteration_duration", stats.Trend, stats.Time)
-	Errors            = stats.New("errors", stats.Counter)
+	VUs                   = stats.New("vus", stats.Gauge)
+	VUsMax                = stats.New("vus_max", stats.Gauge)
+	Iterations            = stats.New("iterations", stats.Counter)
+	IterationDuration     = stats.New("iteration_duration", stats.Trend, stats.Time)
+	DroppedIterations     = stats.New("dropped_iterations", stats.Counter)
+	InterruptedIterations = stats.New("interrupted_iterations", stats.Counter)
+	Errors                = stats.New("errors", stats.Counter)
+
+	// Engine-emitted, about the load generator, ie. the k6 process itself.
+	GeneratorCPU           = stats.New("generator_cpu", stats.Gauge)
+	GeneratorRSS           = stats.New("generator_rss", stats.Gauge, stats.Data)
+	GeneratorHeap          = stats.New("generator_heap", stats.Gauge, stats.Data)
+	GeneratorGCPause       = stats.New("generator_gc_pause", stats.Trend, stats.Time)
+	GeneratorGoroutines    = stats.New("generator_goroutines", stats.Gauge)
+	GeneratorOpenFDs       = stats.New("generator_open_fds", stats.Gauge)
+	GeneratorSampleBacklog = stats.New("generator_sample_backlog", stats.Gauge)
 
 	// Runner-emitted.
 	Checks        = stats.New("checks", stats.Rate)
@@ -48,6 +59,10 @@ var (
 	HTTPReqWaiting        = stats.New("http_req_waiting", stats.Trend, stats.Time)
 	HTTPReqReceiving      = stats.New("http_req_receiving", stats.Trend, stats.Time)
 
+	// Only emitted for streamed response bodies. The throughput is in bytes per second.
+	HTTPReqTTLB       = stats.New("http_req_ttlb", stats.Trend, stats.Time)
+	HTTPReqThroughput = stats.New("http_req_throughput", stats.Trend)
+
 	// Websocket-related
 	WSSessions         = stats.New("ws_sessions", stats.Counter)
 	WSMessagesSent     = stats.New("ws_msgs_sent", stats.Counter)
@@ -56,6 +71,16 @@ var (
 	WSSessionDuration  = stats.New("ws_session_duration", stats.Trend, stats.Time)
 	WSConnecting       = stats.New("ws_connecting", stats.Trend, stats.Time)
 
+	// Server-Sent Events-related
+	SSESessions          = stats.New("sse_sessions", stats.Counter)
+	SSEEventsReceived    = stats.New("sse_events_received", stats.Counter)
+	SSETimeBetweenEvents = stats.New("sse_time_between_events", stats.Trend, stats.Time)
+	SSESessionDuration   = stats.New("sse_session_duration", stats.Trend, stats.Time)
+	SSEConnecting        = stats.New("sse_connecting", stats.Trend, stats.Time)
+
+	// gRPC-related
+	GRPCReqDuration = stats.New("grpc_req_duration", stats.Trend, stats.Time)
+
 	// Network-related; used for future protocols as well.
 	DataSent     = stats.New("data_sent", stats.Counter, stats.Data)
 	DataReceived = stats.New("data_received", stats.Counter, stats.Data)
@@ -52,8 +52,17 @@ type StageFields struct {
 	// Duration of the stage.
 	Duration types.NullDuration `json:"duration"`
 
-	// If Valid, the VU count will be linearly interpolated towards this value.
+	// If Valid, the VU count will be interpolated towards this value, following the curve.
 	Target null.Int `json:"target"`
+
+	// How to get from the previous stage's end value to the target; linear if empty.
+	Curve StageCurve `json:"curve,omitempty"`
+
+	// For sine curves: the length of a full cycle, defaults to the stage's duration.
+	Period types.Duration `json:"period,omitempty"`
+
+	// For points curves: the values to pass through, relative to the stage's start.
+	Points []StagePoint `json:"points,omitempty"`
 }
 
 // A Stage defines a step in a test's timeline.
@@ -75,7 +84,7 @@ func (s Stage) MarshalJSON() ([]byte, error) {
 
 func (s *Stage) UnmarshalText(b []byte) error {
 	var stage Stage
-	parts := strings.SplitN(string(b), ":", 2)
+	parts := strings.SplitN(string(b), ":", 3)
 	if len(parts) > 0 && parts[0] != "" {
 		d, err := time.ParseDuration(parts[0])
 		if err != nil {
@@ -90,6 +99,12 @@ func (s *Stage) UnmarshalText(b []byte) error {
 		}
 		stage.Target = null.IntFrom(t)
 	}
+	if len(parts) > 2 {
+		stage.Curve = StageCurve(parts[2])
+		if err := stage.Validate(); err != nil {
+			return err
+		}
+	}
 	*s = stage
 	return nil
 }
@@ -182,6 +197,30 @@ func (g *Group) Check(name string) (*Check, error) {
 	return check, nil
 }
 
+// VisitChecks calls fn with every check belonging to this group or any of its children.
+// This is safe to call while checks and groups are being created.
+func (g *Group) VisitChecks(fn func(*Check)) {
+	g.checkMutex.Lock()
+	checks := make([]*Check, 0, len(g.Checks))
+	for _, check := range g.Checks {
+		checks = append(checks, check)
+	}
+	g.checkMutex.Unlock()
+	for _, check := range checks {
+		fn(check)
+	}
+
+	g.groupMutex.Lock()
+	groups := make([]*Group, 0, len(g.Groups))
+	for _, group := range g.Groups {
+		groups = append(groups, group)
+	}
+	g.groupMutex.Unlock()
+	for _, group := range groups {
+		group.VisitChecks(fn)
+	}
+}
+
 // A Check stores a series of successful or failing tests against a value.
 //
 // For more information, refer to the js/modules/k6.K6.Check() function.
@@ -28,6 +28,7 @@ import (
 
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/guregu/null.v3"
 )
 
@@ -88,3 +89,18 @@ func TestDataRaces(t *testing.T) {
 		assert.Equal(t, group1, group2, "Groups are the same")
 	})
 }
+
+func TestGroupVisitChecks(t *testing.T) {
+	root, err := NewGroup("", nil)
+	require.NoError(t, err)
+	_, err = root.Check("a")
+	require.NoError(t, err)
+	inner, err := root.Group("inner")
+	require.NoError(t, err)
+	_, err = inner.Check("b")
+	require.NoError(t, err)
+
+	var paths []string
+	root.VisitChecks(func(c *Check) { paths = append(paths, c.Path) })
+	assert.ElementsMatch(t, []string{"::a", "::inner::b"}, paths)
+}
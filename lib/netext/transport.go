@@ -68,7 +68,7 @@ func (t *Transport) RoundTrip(req *http.Request) (res *http.Response, err error)
 		}
 	} else {
 		if t.options.SystemTags["url"] {
-			tags["url"] = req.URL.String()
+			tags["url"] = t.options.URLNormalization.Normalize(req.URL.String())
 		}
 		if t.options.SystemTags["status"] {
 			tags["status"] = strconv.Itoa(resp.StatusCode)
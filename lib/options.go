@@ -37,8 +37,17 @@ import (
 // Other tags that are not enabled by default include: iter, vu, ocsp_status, ip
 var DefaultSystemTagList = []string{
 	"proto", "subproto", "status", "method", "url", "name", "group", "check", "error", "tls_version",
+	"scenario",
 }
 
+// Possible values for Options.TrendSink.
+const (
+	// Keep every value, for exact percentiles (the default).
+	TrendSinkExact = "exact"
+	// Estimate percentiles in bounded memory; see stats.QuantileSketch.
+	TrendSinkSketch = "sketch"
+)
+
 // TagSet is a string to bool map (for lookup efficiency) that is used to keep track
 // which system tags should be included with with metrics.
 type TagSet map[string]bool
@@ -194,10 +203,34 @@ type Options struct {
 	Iterations null.Int           `json:"iterations" envconfig:"iterations"`
 	Stages     []Stage            `json:"stages" envconfig:"stages"`
 
+	// Start iterations at this rate (per second) instead of having VUs loop over the script.
+	// If set, the targets of any stages are interpreted as rates rather than VU counts.
+	ArrivalRate null.Int `json:"arrivalRate" envconfig:"arrival_rate"`
+
+	// How long iterations still running when the test ends, or when their VU is ramped down, get
+	// to finish before they're interrupted. If unset, they're interrupted right away.
+	GracefulStop     types.NullDuration `json:"gracefulStop" envconfig:"graceful_stop"`
+	GracefulRampDown types.NullDuration `json:"gracefulRampDown" envconfig:"graceful_ramp_down"`
+
+	// Named scenarios to run concurrently, each with its own executor, VUs, timeline and exported
+	// function. If any are specified, the VU, duration, iteration and stage options above are
+	// ignored in favour of the ones specified for each scenario.
+	// Can't be set through env vars.
+	Scenarios map[string]Scenario `json:"scenarios" ignored:"true"`
+
+	// Run a breakpoint test, searching for the highest load the thresholds pass at, rather than
+	// following the VU, duration, iteration and stage options above.
+	// Can't be set through env vars.
+	Breakpoint *Breakpoint `json:"breakpoint" ignored:"true"`
+
 	// Timeouts for the setup() and teardown() functions
 	SetupTimeout    types.NullDuration `json:"setupTimeout" envconfig:"setup_timeout"`
 	TeardownTimeout types.NullDuration `json:"teardownTimeout" envconfig:"teardown_timeout"`
 
+	// Timeouts for each VU's vuSetup() and vuTeardown() functions
+	VUSetupTimeout    types.NullDuration `json:"vuSetupTimeout" envconfig:"vu_setup_timeout"`
+	VUTeardownTimeout types.NullDuration `json:"vuTeardownTimeout" envconfig:"vu_teardown_timeout"`
+
 	// Limit HTTP requests per second.
 	RPS null.Int `json:"rps" envconfig:"rps"`
 
@@ -258,9 +291,17 @@ type Options struct {
 	// Summary time unit for summary metrics (response times) in CLI output
 	SummaryTimeUnit null.String `json:"summaryTimeUnit" envconfig:"summary_time_unit"`
 
+	// How trend metrics store their values: "exact" (the default) keeps all of them, "sketch"
+	// estimates percentiles within 1% in bounded memory, for very long or very large tests
+	TrendSink null.String `json:"trendSink" envconfig:"trend_sink"`
+
 	// Which system tags to include with metrics ("method", "vu" etc.)
 	SystemTags TagSet `json:"systemTags" envconfig:"system_tags"`
 
+	// Collapses the URLs in the "url" and "name" tags of HTTP requests into templated names.
+	// Can't be set through env vars.
+	URLNormalization *URLNormalization `json:"urlNormalization" ignored:"true"`
+
 	// Tags to be applied to all samples for this running
 	RunTags *stats.SampleTags `json:"tags" envconfig:"tags"`
 
@@ -304,12 +345,33 @@ func (o Options) Apply(opts Options) Options {
 			}
 		}
 	}
+	if opts.ArrivalRate.Valid {
+		o.ArrivalRate = opts.ArrivalRate
+	}
+	if opts.GracefulStop.Valid {
+		o.GracefulStop = opts.GracefulStop
+	}
+	if opts.GracefulRampDown.Valid {
+		o.GracefulRampDown = opts.GracefulRampDown
+	}
+	if opts.Scenarios != nil {
+		o.Scenarios = opts.Scenarios
+	}
+	if opts.Breakpoint != nil {
+		o.Breakpoint = opts.Breakpoint
+	}
 	if opts.SetupTimeout.Valid {
 		o.SetupTimeout = opts.SetupTimeout
 	}
 	if opts.TeardownTimeout.Valid {
 		o.TeardownTimeout = opts.TeardownTimeout
 	}
+	if opts.VUSetupTimeout.Valid {
+		o.VUSetupTimeout = opts.VUSetupTimeout
+	}
+	if opts.VUTeardownTimeout.Valid {
+		o.VUTeardownTimeout = opts.VUTeardownTimeout
+	}
 	if opts.RPS.Valid {
 		o.RPS = opts.RPS
 	}
@@ -373,9 +435,15 @@ func (o Options) Apply(opts Options) Options {
 	if opts.SummaryTimeUnit.Valid {
 		o.SummaryTimeUnit = opts.SummaryTimeUnit
 	}
+	if opts.TrendSink.Valid {
+		o.TrendSink = opts.TrendSink
+	}
 	if opts.SystemTags != nil {
 		o.SystemTags = opts.SystemTags
 	}
+	if opts.URLNormalization != nil {
+		o.URLNormalization = opts.URLNormalization
+	}
 	if !opts.RunTags.IsEmpty() {
 		o.RunTags = opts.RunTags
 	}
@@ -86,6 +86,29 @@ func TestOptions(t *testing.T) {
 		assert.Equal(t, oneStage, opts.Apply(Options{Stages: oneStage}).Stages)
 		assert.Equal(t, oneStage, Options{}.Apply(opts).Apply(Options{Stages: oneStage}).Apply(Options{Stages: oneStage}).Stages)
 	})
+	t.Run("ArrivalRate", func(t *testing.T) {
+		opts := Options{}.Apply(Options{ArrivalRate: null.IntFrom(100)})
+		assert.True(t, opts.ArrivalRate.Valid)
+		assert.Equal(t, int64(100), opts.ArrivalRate.Int64)
+	})
+	t.Run("GracefulStop", func(t *testing.T) {
+		opts := Options{}.Apply(Options{GracefulStop: types.NullDurationFrom(30 * time.Second)})
+		assert.True(t, opts.GracefulStop.Valid)
+		assert.Equal(t, "30s", opts.GracefulStop.String())
+	})
+	t.Run("VUSetupTimeout", func(t *testing.T) {
+		opts := Options{}.Apply(Options{
+			VUSetupTimeout:    types.NullDurationFrom(5 * time.Second),
+			VUTeardownTimeout: types.NullDurationFrom(20 * time.Second),
+		})
+		assert.Equal(t, types.NullDurationFrom(5*time.Second), opts.VUSetupTimeout)
+		assert.Equal(t, types.NullDurationFrom(20*time.Second), opts.VUTeardownTimeout)
+	})
+	t.Run("GracefulRampDown", func(t *testing.T) {
+		opts := Options{}.Apply(Options{GracefulRampDown: types.NullDurationFrom(10 * time.Second)})
+		assert.True(t, opts.GracefulRampDown.Valid)
+		assert.Equal(t, "10s", opts.GracefulRampDown.String())
+	})
 	t.Run("RPS", func(t *testing.T) {
 		opts := Options{}.Apply(Options{RPS: null.IntFrom(12345)})
 		assert.True(t, opts.RPS.Valid)
@@ -388,6 +411,23 @@ func TestOptions(t *testing.T) {
 		assert.True(t, opts.DiscardResponseBodies.Valid)
 		assert.True(t, opts.DiscardResponseBodies.Bool)
 	})
+	t.Run("TrendSink", func(t *testing.T) {
+		opts := Options{}.Apply(Options{TrendSink: null.StringFrom("sketch")})
+		assert.True(t, opts.TrendSink.Valid)
+		assert.Equal(t, "sketch", opts.TrendSink.String)
+	})
+	t.Run("Breakpoint", func(t *testing.T) {
+		bp := &Breakpoint{Step: null.IntFrom(10), Max: null.IntFrom(100)}
+		opts := Options{}.Apply(Options{Breakpoint: bp})
+		assert.Equal(t, bp, opts.Breakpoint)
+		assert.Equal(t, bp, opts.Apply(Options{}).Breakpoint)
+	})
+	t.Run("URLNormalization", func(t *testing.T) {
+		n := &URLNormalization{Auto: null.BoolFrom(true)}
+		opts := Options{}.Apply(Options{URLNormalization: n})
+		assert.Equal(t, n, opts.URLNormalization)
+		assert.Equal(t, n, opts.Apply(Options{}).URLNormalization)
+	})
 
 }
 
@@ -427,6 +467,10 @@ func TestOptionsEnv(t *testing.T) {
 				{Duration: types.NullDurationFrom(2 * time.Second), Target: null.IntFrom(100)},
 			},
 		},
+		{"ArrivalRate", "K6_ARRIVAL_RATE"}: {
+			"":    null.Int{},
+			"123": null.IntFrom(123),
+		},
 		{"MaxRedirects", "K6_MAX_REDIRECTS"}: {
 			"":    null.Int{},
 			"123": null.IntFrom(123),
@@ -458,6 +502,10 @@ func TestOptionsEnv(t *testing.T) {
 			"true":  null.BoolFrom(true),
 			"false": null.BoolFrom(false),
 		},
+		{"TrendSink", "K6_TREND_SINK"}: {
+			"":       null.String{},
+			"sketch": null.StringFrom("sketch"),
+		},
 		{"NoCookiesReset", "K6_NO_COOKIES_RESET"}: {
 			"":      null.Bool{},
 			"true":  null.BoolFrom(true),
@@ -29,6 +29,7 @@ import (
 // Ensure mock implementations conform to the interfaces.
 var _ Runner = &MiniRunner{}
 var _ VU = &MiniRunnerVU{}
+var _ VUTeardowner = &MiniRunnerVU{}
 
 // A Runner is a factory for VUs. It should precompute as much as possible upon creation (parse
 // ASTs, load files into memory, etc.), so that spawning VUs becomes as fast as possible.
@@ -46,6 +47,10 @@ type Runner interface {
 	// of a test - RunOnce() may be called hundreds of thousands of times, and must be fast.
 	NewVU(out chan<- stats.SampleContainer) (VU, error)
 
+	// Spawns a new VU for the named scenario. Instead of the default function, it runs the one
+	// the scenario specifies (if any), with the scenario's environment variables and tags.
+	NewScenarioVU(name string, scenario Scenario, out chan<- stats.SampleContainer) (VU, error)
+
 	// Runs pre-test setup, if applicable.
 	Setup(ctx context.Context, out chan<- stats.SampleContainer) error
 
@@ -68,6 +73,13 @@ type Runner interface {
 	SetOptions(opts Options)
 }
 
+// A SummaryHandler is a Runner that can produce its own end-of-test reports. HandleSummary gets
+// the JSON-encoded summary and returns the reports' contents, by destination: "stdout", "stderr"
+// or a file path. A nil map means the runner doesn't handle the summary, so the default one is used.
+type SummaryHandler interface {
+	HandleSummary(ctx context.Context, summary []byte) (map[string][]byte, error)
+}
+
 // A VU is a Virtual User, that can be scheduled by an Executor.
 type VU interface {
 	// Runs the VU once. The VU is responsible for handling the Halting Problem, eg. making sure
@@ -79,12 +91,42 @@ type VU interface {
 	Reconfigure(id int64) error
 }
 
+// A VUTeardowner is a VU with something to do after its last iteration, eg. running the script's
+// vuTeardown() function. Executors call TeardownVU when they're done with a VU, because the test
+// ended or it was scaled down; a VU that's brought back afterwards is Reconfigured as a new one.
+// It should do nothing if the VU hasn't run since it was last Reconfigured. Samples are sent to
+// out, as the VU's own output may be gone by then.
+type VUTeardowner interface {
+	TeardownVU(ctx context.Context, out chan<- stats.SampleContainer) error
+}
+
+// VUSetupError is returned by RunOnce when the VU couldn't be set up for its first iteration, eg.
+// because the script's vuSetup() function failed. No iteration was run, so executors don't count
+// it as one, nor towards the iteration limit.
+type VUSetupError struct {
+	Err error
+}
+
+func (e VUSetupError) Error() string {
+	return e.Err.Error()
+}
+
+// MaxVUSetupFailures is how many times in a row VUs can fail to set up before the test is aborted
+// with VUSetupErrorExitCode; otherwise a test that's only bounded by iterations would never end.
+const MaxVUSetupFailures = 100
+
+// VUSetupErrorExitCode is what k6 exits with when a test is aborted because VUs can't be set up.
+const VUSetupErrorExitCode = 105
+
 // MiniRunner wraps a function in a runner whose VUs will simply call that function.
 type MiniRunner struct {
 	Fn         func(ctx context.Context, out chan<- stats.SampleContainer) error
 	SetupFn    func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error)
 	TeardownFn func(ctx context.Context, out chan<- stats.SampleContainer) error
 
+	// Called when a VU that ran iterations is stopped.
+	VUTeardownFn func(ctx context.Context, out chan<- stats.SampleContainer) error
+
 	setupData []byte
 
 	Group   *Group
@@ -103,6 +145,11 @@ func (r MiniRunner) NewVU(out chan<- stats.SampleContainer) (VU, error) {
 	return r.VU(out), nil
 }
 
+// NewScenarioVU returns a VU that calls Fn, same as NewVU; scenario settings are ignored.
+func (r MiniRunner) NewScenarioVU(name string, scenario Scenario, out chan<- stats.SampleContainer) (VU, error) {
+	return r.VU(out), nil
+}
+
 func (r *MiniRunner) Setup(ctx context.Context, out chan<- stats.SampleContainer) (err error) {
 	if fn := r.SetupFn; fn != nil {
 		r.setupData, err = fn(ctx, out)
@@ -160,3 +207,10 @@ func (vu *MiniRunnerVU) Reconfigure(id int64) error {
 	vu.ID = id
 	return nil
 }
+
+func (vu *MiniRunnerVU) TeardownVU(ctx context.Context, out chan<- stats.SampleContainer) error {
+	if vu.R.VUTeardownFn == nil {
+		return nil
+	}
+	return vu.R.VUTeardownFn(ctx, out)
+}
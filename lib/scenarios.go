@@ -0,0 +1,145 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Possible values for Scenario.Executor.
+const (
+	// VUs loop over the scenario's function as fast as they can (the default).
+	ScenarioExecutorLooping = "looping"
+	// Iterations are started at a fixed rate per second; see Options.ArrivalRate.
+	ScenarioExecutorArrivalRate = "arrival-rate"
+)
+
+// A Scenario is one of several workloads that are executed concurrently in the same test run.
+// Each one has its own executor, VUs and timeline, and runs an exported function of its choosing.
+type Scenario struct {
+	// Type of executor; one of the ScenarioExecutor* constants, "looping" if not set.
+	Executor null.String `json:"executor"`
+
+	// How long after the start of the test the scenario should start.
+	StartTime types.NullDuration `json:"startTime"`
+
+	// Name of the exported function to run; if not set, the default function is used.
+	Exec null.String `json:"exec"`
+
+	// Environment variables, added to (and overriding) the global ones for this scenario's VUs.
+	Env map[string]string `json:"env"`
+
+	// Tags applied to all samples emitted by this scenario, in addition to the global ones.
+	Tags map[string]string `json:"tags"`
+
+	// VUs, duration, iterations, stages and arrival rate work just like the global options of
+	// the same names, but only apply to this scenario.
+	VUs         null.Int           `json:"vus"`
+	VUsMax      null.Int           `json:"vusMax"`
+	Duration    types.NullDuration `json:"duration"`
+	Iterations  null.Int           `json:"iterations"`
+	Stages      []Stage            `json:"stages"`
+	ArrivalRate null.Int           `json:"arrivalRate"`
+
+	// Override the global gracefulStop and gracefulRampDown options for this scenario.
+	GracefulStop     types.NullDuration `json:"gracefulStop"`
+	GracefulRampDown types.NullDuration `json:"gracefulRampDown"`
+}
+
+// GetExecutor returns the scenario's executor type, taking the default into account.
+func (s Scenario) GetExecutor() string {
+	if !s.Executor.Valid || s.Executor.String == "" {
+		return ScenarioExecutorLooping
+	}
+	return s.Executor.String
+}
+
+// Validate checks that the scenario is well-formed.
+func (s Scenario) Validate() error {
+	switch s.GetExecutor() {
+	case ScenarioExecutorLooping:
+		if s.ArrivalRate.Valid {
+			return errors.New("arrivalRate can only be used with the arrival-rate executor")
+		}
+	case ScenarioExecutorArrivalRate:
+		if !s.ArrivalRate.Valid && len(s.Stages) == 0 {
+			return errors.New("the arrival-rate executor needs an arrivalRate or stages")
+		}
+	default:
+		return errors.Errorf("unknown executor: %s", s.Executor.String)
+	}
+	if s.Exec.Valid && s.Exec.String == "" {
+		return errors.New("exec can't be an empty string")
+	}
+	for i, stage := range s.Stages {
+		if err := stage.Validate(); err != nil {
+			return errors.Wrapf(err, "stage #%d", i)
+		}
+	}
+	return nil
+}
+
+// WithDefaults returns the scenario with the VU and iteration defaults filled in: 1 VU, enough
+// allocated VUs for its stages (unless they're rates), and 1 iteration if nothing else ends it.
+func (s Scenario) WithDefaults() Scenario {
+	if !s.VUs.Valid {
+		s.VUs = null.IntFrom(1)
+	}
+	if !s.VUsMax.Valid {
+		s.VUsMax = s.VUs
+		if s.GetExecutor() != ScenarioExecutorArrivalRate {
+			for _, stage := range s.Stages {
+				if max := stage.MaxTarget(); max.Valid && max.Int64 > s.VUsMax.Int64 {
+					s.VUsMax = max
+				}
+			}
+		}
+	}
+	if !s.Duration.Valid && !s.Iterations.Valid && len(s.Stages) == 0 {
+		s.Iterations = null.IntFrom(1)
+	}
+	return s
+}
+
+// Options returns the given global options, adjusted for the VUs of the named scenario: its tags,
+// and a "scenario" tag if that system tag is enabled, are added to the run tags, its arrival rate
+// replaces the global one, and so do its graceful stop timeouts, if set.
+func (s Scenario) Options(name string, opts Options) Options {
+	tags := opts.RunTags.CloneTags()
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	if opts.SystemTags["scenario"] {
+		tags["scenario"] = name
+	}
+	opts.RunTags = stats.IntoSampleTags(&tags)
+	opts.ArrivalRate = s.ArrivalRate
+	if s.GracefulStop.Valid {
+		opts.GracefulStop = s.GracefulStop
+	}
+	if s.GracefulRampDown.Valid {
+		opts.GracefulRampDown = s.GracefulRampDown
+	}
+	return opts
+}
@@ -0,0 +1,100 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestScenarioJSON(t *testing.T) {
+	var opts Options
+	require.NoError(t, json.Unmarshal([]byte(`{"scenarios": {"s": {
+		"executor": "arrival-rate", "startTime": "10s", "exec": "fn",
+		"arrivalRate": 50, "vusMax": 20, "duration": "1m",
+		"env": {"A": "B"}, "tags": {"c": "d"}
+	}}}`), &opts))
+	assert.Equal(t, map[string]Scenario{"s": {
+		Executor:    null.StringFrom(ScenarioExecutorArrivalRate),
+		StartTime:   types.NullDurationFrom(10 * time.Second),
+		Exec:        null.StringFrom("fn"),
+		ArrivalRate: null.IntFrom(50),
+		VUsMax:      null.IntFrom(20),
+		Duration:    types.NullDurationFrom(1 * time.Minute),
+		Env:         map[string]string{"A": "B"},
+		Tags:        map[string]string{"c": "d"},
+	}}, opts.Scenarios)
+}
+
+func TestScenarioValidate(t *testing.T) {
+	testdata := map[string]struct {
+		sc  Scenario
+		err string
+	}{
+		"Default":         {Scenario{}, ""},
+		"Looping":         {Scenario{Executor: null.StringFrom("looping")}, ""},
+		"LoopingRate":     {Scenario{ArrivalRate: null.IntFrom(1)}, "arrivalRate can only be used with the arrival-rate executor"},
+		"ArrivalRate":     {Scenario{Executor: null.StringFrom("arrival-rate"), ArrivalRate: null.IntFrom(1)}, ""},
+		"ArrivalRateNone": {Scenario{Executor: null.StringFrom("arrival-rate")}, "the arrival-rate executor needs an arrivalRate or stages"},
+		"Unknown":         {Scenario{Executor: null.StringFrom("nope")}, "unknown executor: nope"},
+		"EmptyExec":       {Scenario{Exec: null.StringFrom("")}, "exec can't be an empty string"},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			err := data.sc.Validate()
+			if data.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, data.err)
+			}
+		})
+	}
+}
+
+func TestScenarioOptions(t *testing.T) {
+	sc := Scenario{Tags: map[string]string{"b": "scenario", "c": "3"}, ArrivalRate: null.IntFrom(10)}
+	opts := Options{
+		RunTags:    stats.IntoSampleTags(&map[string]string{"a": "1", "b": "2"}),
+		SystemTags: GetTagSet("scenario"),
+	}
+
+	scOpts := sc.Options("s", opts)
+	assert.Equal(t, null.IntFrom(10), scOpts.ArrivalRate)
+	assert.Equal(t, map[string]string{"a": "1", "b": "scenario", "c": "3", "scenario": "s"}, scOpts.RunTags.CloneTags())
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, opts.RunTags.CloneTags())
+
+	opts.SystemTags = GetTagSet()
+	assert.Equal(t, map[string]string{"a": "1", "b": "scenario", "c": "3"}, sc.Options("s", opts).RunTags.CloneTags())
+
+	opts.GracefulStop = types.NullDurationFrom(10 * time.Second)
+	opts.GracefulRampDown = types.NullDurationFrom(10 * time.Second)
+	sc.GracefulStop = types.NullDurationFrom(time.Minute)
+	scOpts = sc.Options("s", opts)
+	assert.Equal(t, types.NullDurationFrom(time.Minute), scOpts.GracefulStop)
+	assert.Equal(t, types.NullDurationFrom(10*time.Second), scOpts.GracefulRampDown)
+}
@@ -0,0 +1,159 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package lib
+
+import (
+	"math"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/pkg/errors"
+	"gopkg.in/guregu/null.v3"
+)
+
+// StageCurve is the shape a stage follows from the previous stage's end value to its target.
+type StageCurve string
+
+const (
+	// StageCurveLinear moves towards the target at a constant pace; this is the default.
+	StageCurveLinear StageCurve = "linear"
+	// StageCurveStep jumps to the target as soon as the stage starts, and holds it.
+	StageCurveStep StageCurve = "step"
+	// StageCurveExponential starts slowly and speeds up, reaching the target at the stage's end.
+	StageCurveExponential StageCurve = "exponential"
+	// StageCurveSine oscillates between the previous value and the target, starting from the
+	// previous value and peaking halfway through each period.
+	StageCurveSine StageCurve = "sine"
+	// StageCurvePoints goes through a list of points, interpolating linearly between them, and
+	// ends on the target, if there is one.
+	StageCurvePoints StageCurve = "points"
+)
+
+// How sharply exponential curves bend; the value is at ~25% of the way at the stage's midpoint.
+const exponentialCurveRate = 2.2
+
+// A StagePoint is a value a points curve passes through, at a time relative to the stage's start.
+type StagePoint struct {
+	At     types.Duration `json:"at"`
+	Target int64          `json:"target"`
+}
+
+// Validate checks that the stage's curve is well-formed.
+func (s Stage) Validate() error {
+	switch s.Curve {
+	case "", StageCurveLinear, StageCurveStep, StageCurveExponential, StageCurveSine:
+		if len(s.Points) > 0 {
+			return errors.New("points can only be used with the points curve")
+		}
+	case StageCurvePoints:
+		if len(s.Points) == 0 {
+			return errors.New("the points curve needs at least one point")
+		}
+	default:
+		return errors.Errorf("unknown stage curve: %s", s.Curve)
+	}
+
+	if s.Period != 0 && s.Curve != StageCurveSine {
+		return errors.New("a period can only be used with the sine curve")
+	}
+	if s.Period < 0 {
+		return errors.New("a sine curve's period must be positive")
+	}
+
+	var last types.Duration
+	for i, p := range s.Points {
+		switch {
+		case p.At < last:
+			return errors.Errorf("point #%d is earlier than the one before it", i)
+		case s.Duration.Valid && p.At > s.Duration.Duration:
+			return errors.Errorf("point #%d is after the end of the stage", i)
+		}
+		last = p.At
+	}
+	return nil
+}
+
+// ValueAt returns the value the stage's curve is at, the given time into the stage, when starting
+// from the previous stage's end value; ok is false if the stage has no target, and so no curve.
+func (s Stage) ValueAt(from int64, elapsed time.Duration) (v int64, ok bool) {
+	if s.Curve == StageCurvePoints {
+		return s.pointsValueAt(from, elapsed), true
+	}
+	if !s.Target.Valid {
+		return from, false
+	}
+	to := s.Target.Int64
+
+	// Sine curves go on for as long as the stage does, even if that's forever.
+	if s.Curve == StageCurveSine {
+		period := time.Duration(s.Period)
+		if period <= 0 {
+			if !s.Duration.Valid || s.Duration.Duration <= 0 {
+				return to, true
+			}
+			period = time.Duration(s.Duration.Duration)
+		}
+		prog := (1 - math.Cos(2*math.Pi*float64(elapsed)/float64(period))) / 2
+		return from + int64(math.Round(prog*float64(to-from))), true
+	}
+
+	// Stages without a duration are at their target immediately.
+	prog := 1.0
+	if s.Duration.Valid && s.Duration.Duration > 0 {
+		prog = Clampf(float64(elapsed)/float64(s.Duration.Duration), 0.0, 1.0)
+	}
+	switch s.Curve {
+	case StageCurveStep:
+		prog = 1.0
+	case StageCurveExponential:
+		prog = math.Expm1(exponentialCurveRate*prog) / math.Expm1(exponentialCurveRate)
+	}
+	return Lerp(from, to, prog), true
+}
+
+// Walks the points, with the stage's start and (if there's a target) end as implicit points.
+func (s Stage) pointsValueAt(from int64, elapsed time.Duration) int64 {
+	points := s.Points
+	if s.Target.Valid && s.Duration.Valid {
+		points = append(points[:len(points):len(points)], StagePoint{At: s.Duration.Duration, Target: s.Target.Int64})
+	}
+
+	var prevAt time.Duration
+	prev := from
+	for _, p := range points {
+		at := time.Duration(p.At)
+		if elapsed < at {
+			return Lerp(prev, p.Target, float64(elapsed-prevAt)/float64(at-prevAt))
+		}
+		prevAt, prev = at, p.Target
+	}
+	return prev
+}
+
+// MaxTarget returns the highest value the stage's curve can reach, if it has one.
+func (s Stage) MaxTarget() null.Int {
+	max := s.Target
+	for _, p := range s.Points {
+		if !max.Valid || p.Target > max.Int64 {
+			max = null.IntFrom(p.Target)
+		}
+	}
+	return max
+}
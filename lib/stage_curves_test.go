@@ -0,0 +1,179 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestStageValidate(t *testing.T) {
+	d := types.NullDurationFrom(10 * time.Second)
+	points := []StagePoint{{At: types.Duration(2 * time.Second), Target: 5}, {At: types.Duration(8 * time.Second), Target: 1}}
+	valid := map[string]Stage{
+		"none":        {Duration: d, Target: null.IntFrom(10)},
+		"linear":      {Duration: d, Curve: StageCurveLinear},
+		"step":        {Duration: d, Curve: StageCurveStep},
+		"exponential": {Duration: d, Curve: StageCurveExponential},
+		"sine":        {Duration: d, Curve: StageCurveSine, Period: types.Duration(time.Second)},
+		"points":      {Duration: d, Curve: StageCurvePoints, Points: points},
+	}
+	for name, stage := range valid {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, stage.Validate())
+		})
+	}
+
+	invalid := map[string]struct {
+		Stage Stage
+		Err   string
+	}{
+		"unknown":   {Stage{Curve: "wobbly"}, "unknown stage curve: wobbly"},
+		"no points": {Stage{Curve: StageCurvePoints}, "the points curve needs at least one point"},
+		"points":    {Stage{Points: points}, "points can only be used with the points curve"},
+		"period":    {Stage{Period: types.Duration(time.Second)}, "a period can only be used with the sine curve"},
+		"negative":  {Stage{Curve: StageCurveSine, Period: types.Duration(-time.Second)}, "a sine curve's period must be positive"},
+		"unordered": {
+			Stage{Curve: StageCurvePoints, Points: []StagePoint{points[1], points[0]}},
+			"point #1 is earlier than the one before it",
+		},
+		"late": {
+			Stage{Duration: types.NullDurationFrom(5 * time.Second), Curve: StageCurvePoints, Points: points},
+			"point #1 is after the end of the stage",
+		},
+	}
+	for name, data := range invalid {
+		t.Run(name, func(t *testing.T) {
+			assert.EqualError(t, data.Stage.Validate(), data.Err)
+		})
+	}
+}
+
+func TestStageValueAt(t *testing.T) {
+	d := types.NullDurationFrom(10 * time.Second)
+	testdata := map[string]struct {
+		Stage  Stage
+		Values map[time.Duration]int64
+	}{
+		"linear": {
+			Stage{Duration: d, Target: null.IntFrom(110)},
+			map[time.Duration]int64{0: 10, 5 * time.Second: 60, 10 * time.Second: 110},
+		},
+		"step": {
+			Stage{Duration: d, Target: null.IntFrom(110), Curve: StageCurveStep},
+			map[time.Duration]int64{0: 110, 5 * time.Second: 110, 10 * time.Second: 110},
+		},
+		"exponential": {
+			Stage{Duration: d, Target: null.IntFrom(110), Curve: StageCurveExponential},
+			map[time.Duration]int64{0: 10, 5 * time.Second: 34, 9 * time.Second: 87, 10 * time.Second: 110},
+		},
+		"exponential/down": {
+			Stage{Duration: d, Target: null.IntFrom(0), Curve: StageCurveExponential},
+			map[time.Duration]int64{0: 10, 5 * time.Second: 8, 10 * time.Second: 0},
+		},
+		"sine": {
+			Stage{Duration: d, Target: null.IntFrom(110), Curve: StageCurveSine},
+			map[time.Duration]int64{0: 10, 2500 * time.Millisecond: 60, 5 * time.Second: 110, 10 * time.Second: 10},
+		},
+		"sine/period": {
+			Stage{Duration: d, Target: null.IntFrom(110), Curve: StageCurveSine, Period: types.Duration(4 * time.Second)},
+			map[time.Duration]int64{0: 10, 2 * time.Second: 110, 4 * time.Second: 10, 10 * time.Second: 110},
+		},
+		"points": {
+			Stage{Duration: d, Curve: StageCurvePoints, Points: []StagePoint{
+				{At: types.Duration(2 * time.Second), Target: 30},
+				{At: types.Duration(4 * time.Second), Target: 30},
+			}},
+			map[time.Duration]int64{0: 10, time.Second: 20, 3 * time.Second: 30, 10 * time.Second: 30},
+		},
+		"points/target": {
+			Stage{Duration: d, Target: null.IntFrom(90), Curve: StageCurvePoints, Points: []StagePoint{
+				{At: types.Duration(4 * time.Second), Target: 30},
+			}},
+			map[time.Duration]int64{0: 10, 4 * time.Second: 30, 7 * time.Second: 60, 10 * time.Second: 90},
+		},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			for elapsed, value := range data.Values {
+				v, ok := data.Stage.ValueAt(10, elapsed)
+				assert.True(t, ok)
+				assert.Equal(t, value, v, "at %s", elapsed)
+			}
+		})
+	}
+
+	t.Run("no target", func(t *testing.T) {
+		v, ok := Stage{Duration: d, Curve: StageCurveExponential}.ValueAt(10, 5*time.Second)
+		assert.False(t, ok)
+		assert.Equal(t, int64(10), v)
+	})
+}
+
+func TestStageMaxTarget(t *testing.T) {
+	assert.Equal(t, null.Int{}, Stage{}.MaxTarget())
+	assert.Equal(t, null.IntFrom(10), Stage{Target: null.IntFrom(10)}.MaxTarget())
+	assert.Equal(t, null.IntFrom(50), Stage{
+		Target: null.IntFrom(10),
+		Curve:  StageCurvePoints,
+		Points: []StagePoint{{Target: 50}, {Target: 20}},
+	}.MaxTarget())
+}
+
+func TestStageCurveJSON(t *testing.T) {
+	s := Stage{
+		Duration: types.NullDurationFrom(10 * time.Second),
+		Target:   null.IntFrom(10),
+		Curve:    StageCurveSine,
+		Period:   types.Duration(5 * time.Second),
+	}
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	assert.Equal(t, `{"duration":"10s","target":10,"curve":"sine","period":"5s"}`, string(data))
+
+	var s2 Stage
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"duration": "10s", "curve": "points", "points": [{"at": "5s", "target": 20}]
+	}`), &s2))
+	assert.Equal(t, Stage{
+		Duration: types.NullDurationFrom(10 * time.Second),
+		Curve:    StageCurvePoints,
+		Points:   []StagePoint{{At: types.Duration(5 * time.Second), Target: 20}},
+	}, s2)
+}
+
+func TestStageCurveText(t *testing.T) {
+	var s Stage
+	require.NoError(t, s.UnmarshalText([]byte("10s:100:exponential")))
+	assert.Equal(t, Stage{
+		Duration: types.NullDurationFrom(10 * time.Second),
+		Target:   null.IntFrom(100),
+		Curve:    StageCurveExponential,
+	}, s)
+
+	assert.EqualError(t, s.UnmarshalText([]byte("10s:100:wobbly")), "unknown stage curve: wobbly")
+	assert.EqualError(t, s.UnmarshalText([]byte("10s:100:points")), "the points curve needs at least one point")
+}
@@ -0,0 +1,156 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// URLWildcard is what the parts of a URL that vary between requests are replaced with in its
+// name, same as in the names of http.url`...` templates.
+const URLWildcard = "${}"
+
+var (
+	uuidRE = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hashRE = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// URLNormalization collapses the URLs that requests are tagged with into templated names, so that
+// eg. /users/123 and /users/124 end up in the same time series, rather than one per user.
+type URLNormalization struct {
+	// Replace path segments and query values that look like IDs, UUIDs or hashes with ${}.
+	Auto null.Bool `json:"auto"`
+
+	// Templates that URLs are matched against, in order, before any automatic normalization; a
+	// ${} in one matches any path segment, or part of one, and the first that matches a URL is used
+	// as its name. Unless a template has a query string, URLs' query strings are ignored when
+	// matching them, and left out of the name.
+	Patterns []string `json:"patterns"`
+
+	compileOnce sync.Once
+	compiled    []*regexp.Regexp
+}
+
+// Normalize returns the name of the given URL. URLs that don't match any pattern, and can't be
+// normalized automatically, are returned as they are; as are all of them if n is nil.
+func (n *URLNormalization) Normalize(u string) string {
+	if n == nil {
+		return u
+	}
+	n.compileOnce.Do(n.compile)
+
+	withoutQuery := u
+	if i := strings.IndexAny(u, "?#"); i != -1 {
+		withoutQuery = u[:i]
+	}
+	for i, re := range n.compiled {
+		if strings.Contains(n.Patterns[i], "?") {
+			if re.MatchString(u) {
+				return n.Patterns[i]
+			}
+		} else if re.MatchString(withoutQuery) {
+			return n.Patterns[i]
+		}
+	}
+
+	if n.Auto.Bool {
+		return normalizeURLAutomatically(u)
+	}
+	return u
+}
+
+// Turns each pattern into a regexp, where wildcards match anything but a path separator, or the
+// start of a query string or fragment; or, in query strings, the start of the next parameter.
+func (n *URLNormalization) compile() {
+	n.compiled = make([]*regexp.Regexp, len(n.Patterns))
+	for i, pattern := range n.Patterns {
+		path, query := pattern, ""
+		if j := strings.Index(pattern, "?"); j != -1 {
+			path, query = pattern[:j], pattern[j:]
+		}
+		n.compiled[i] = regexp.MustCompile(
+			"^" + compileURLTemplate(path, "[^/?#]+") + compileURLTemplate(query, "[^&#]+") + "$")
+	}
+}
+
+// Quotes a template for use in a regexp, with wildcards replaced by the given expression.
+func compileURLTemplate(template, wildcard string) string {
+	parts := strings.Split(template, URLWildcard)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return strings.Join(parts, wildcard)
+}
+
+// Replaces path segments and query values that look like IDs with wildcards. The rest of the URL,
+// including its escaping and the order of the query's parameters, is left alone.
+func normalizeURLAutomatically(u string) string {
+	// Split the URL into the scheme and host, path, query and fragment.
+	var prefix, query, fragment string
+	path := u
+	if i := strings.Index(path, "#"); i != -1 {
+		path, fragment = path[:i], path[i:]
+	}
+	if i := strings.Index(path, "?"); i != -1 {
+		path, query = path[:i], path[i+1:]
+	}
+	if i := strings.Index(path, "://"); i != -1 {
+		prefix, path = path, ""
+		if j := strings.Index(prefix[i+3:], "/"); j != -1 {
+			prefix, path = prefix[:i+3+j], prefix[i+3+j:]
+		}
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if looksLikeID(segment) {
+			segments[i] = URLWildcard
+		}
+	}
+	name := prefix + strings.Join(segments, "/")
+
+	if query != "" {
+		params := strings.Split(query, "&")
+		for i, param := range params {
+			if key, value := SplitKV(param); looksLikeID(value) {
+				params[i] = key + "=" + URLWildcard
+			}
+		}
+		name += "?" + strings.Join(params, "&")
+	}
+	return name + fragment
+}
+
+// Returns whether a part of a URL looks like it identifies something: a number, a UUID, or a hex
+// encoded hash or object ID (with at least one digit in it, so as not to catch actual words).
+func looksLikeID(s string) bool {
+	if s == "" {
+		return false
+	}
+	if strings.Trim(s, "0123456789") == "" {
+		return true
+	}
+	return uuidRE.MatchString(s) || (hashRE.MatchString(s) && strings.ContainsAny(s, "0123456789"))
+}
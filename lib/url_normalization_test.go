@@ -0,0 +1,99 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestURLNormalization(t *testing.T) {
+	t.Run("Nil", func(t *testing.T) {
+		var n *URLNormalization
+		assert.Equal(t, "https://example.com/users/123", n.Normalize("https://example.com/users/123"))
+	})
+
+	t.Run("Auto", func(t *testing.T) {
+		n := &URLNormalization{Auto: null.BoolFrom(true)}
+		testdata := map[string]string{
+			"https://example.com/":                                                   "https://example.com/",
+			"https://example.com/users/123":                                          "https://example.com/users/${}",
+			"https://example.com/users/123/posts/45":                                 "https://example.com/users/${}/posts/${}",
+			"https://example.com/v1/users":                                           "https://example.com/v1/users",
+			"https://example.com/orders/3f2504e0-4f89-11d3-9a0c-0305e82c3301":        "https://example.com/orders/${}",
+			"https://example.com/blobs/d41d8cd98f00b204e9800998ecf8427e":             "https://example.com/blobs/${}",
+			"https://example.com/objects/507f1f77bcf86cd799439011":                   "https://example.com/objects/${}",
+			"https://example.com/facade/deadbeefcafebabe":                            "https://example.com/facade/deadbeefcafebabe",
+			"https://example.com/search?q=shoes&page=2&id=&session=a1b2c3d4e5f60718": "https://example.com/search?q=shoes&page=${}&id=&session=${}",
+			"https://example.com:8080/items/9?id=1#details":                          "https://example.com:8080/items/${}?id=${}#details",
+			"https://example.com/users/%31%32":                                       "https://example.com/users/%31%32",
+			"https://example.com?page=3":                                             "https://example.com?page=${}",
+			"/relative/42":                                                           "/relative/${}",
+			"https://example.com/thing/${}/":                                         "https://example.com/thing/${}/",
+		}
+		for u, name := range testdata {
+			assert.Equal(t, name, n.Normalize(u), u)
+		}
+	})
+
+	t.Run("Patterns", func(t *testing.T) {
+		n := &URLNormalization{Patterns: []string{
+			"https://example.com/users/${}/avatar",
+			"https://example.com/search?q=${}",
+			"https://example.com/static/${}.${}",
+			"https://example.com/static/${}",
+		}}
+		testdata := map[string]string{
+			"https://example.com/users/alice/avatar":           "https://example.com/users/${}/avatar",
+			"https://example.com/users/alice/avatar?size=big":  "https://example.com/users/${}/avatar",
+			"https://example.com/users/alice/profile":          "https://example.com/users/alice/profile",
+			"https://example.com/users/a/b/avatar":             "https://example.com/users/a/b/avatar",
+			"https://example.com/search?q=shoes":               "https://example.com/search?q=${}",
+			"https://example.com/search?q=shoes&page=2":        "https://example.com/search?q=shoes&page=2",
+			"https://example.com/static/app.js":                "https://example.com/static/${}.${}",
+			"https://example.com/static/LICENSE":               "https://example.com/static/${}",
+			"https://example.com/thing/${}/":                   "https://example.com/thing/${}/",
+			"https://example.com/users/123/orders?sort=newest": "https://example.com/users/123/orders?sort=newest",
+		}
+		for u, name := range testdata {
+			assert.Equal(t, name, n.Normalize(u), u)
+		}
+
+		// Patterns take precedence over automatic normalization.
+		n = &URLNormalization{Auto: null.BoolFrom(true), Patterns: []string{"https://example.com/users/${}"}}
+		assert.Equal(t, "https://example.com/users/${}", n.Normalize("https://example.com/users/alice"))
+		assert.Equal(t, "https://example.com/users/${}/orders", n.Normalize("https://example.com/users/123/orders"))
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var opts Options
+		require.NoError(t, json.Unmarshal(
+			[]byte(`{"urlNormalization": {"auto": true, "patterns": ["https://example.com/users/${}"]}}`), &opts))
+		if assert.NotNil(t, opts.URLNormalization) {
+			assert.Equal(t, null.BoolFrom(true), opts.URLNormalization.Auto)
+			assert.Equal(t, []string{"https://example.com/users/${}"}, opts.URLNormalization.Patterns)
+		}
+	})
+}
@@ -22,6 +22,7 @@ package lib
 
 import (
 	"strings"
+	"time"
 
 	"github.com/loadimpact/k6/lib/types"
 )
@@ -37,6 +38,17 @@ func SumStages(stages []Stage) (d types.NullDuration) {
 	return d
 }
 
+// StageAt returns the index of the stage in progress at the given time, or -1 if they're all over.
+func StageAt(stages []Stage, t time.Duration) int {
+	for i, stage := range stages {
+		if !stage.Duration.Valid || t < time.Duration(stage.Duration.Duration) {
+			return i
+		}
+		t -= time.Duration(stage.Duration.Duration)
+	}
+	return -1
+}
+
 // Splits a string in the form "key=value".
 func SplitKV(s string) (key, value string) {
 	parts := strings.SplitN(s, "=", 2)
@@ -60,6 +60,31 @@ func TestSumStages(t *testing.T) {
 	}
 }
 
+func TestStageAt(t *testing.T) {
+	stages := []Stage{
+		{Duration: types.NullDurationFrom(5 * time.Second)},
+		{Duration: types.NullDurationFrom(5 * time.Second)},
+	}
+	testdata := map[string]struct {
+		Stages []Stage
+		Time   time.Duration
+		Index  int
+	}{
+		"Blank":        {[]Stage{}, 0, -1},
+		"Start":        {stages, 0, 0},
+		"First":        {stages, 4 * time.Second, 0},
+		"Second":       {stages, 5 * time.Second, 1},
+		"Over":         {stages, 10 * time.Second, -1},
+		"Infinite":     {[]Stage{{}}, time.Hour, 0},
+		"InfiniteTail": {append(stages, Stage{}), time.Hour, 2},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, data.Index, StageAt(data.Stages, data.Time))
+		})
+	}
+}
+
 func TestSplitKV(t *testing.T) {
 	testdata := map[string]struct {
 		k string
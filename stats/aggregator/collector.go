@@ -0,0 +1,287 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+// Package aggregator rolls up the samples sent to an output into time buckets, so outputs that
+// can't keep up with every raw sample at high request rates only get a few per interval.
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+)
+
+// FlushRate is how often buckets are checked for whether they're ready to be sent.
+const FlushRate = 100 * time.Millisecond
+
+// Percentiles are the percentiles calculated for each bucket of a trend metric.
+var Percentiles = []float64{0.9, 0.95, 0.99}
+
+// Collector aggregates the samples it receives before passing them on to another collector.
+//
+// For each interval and set of kept tags, every metric is turned into a `<metric>_count` and a
+// `<metric>_sum` counter, `<metric>_min` and `<metric>_max` gauges and, for trend metrics, a
+// gauge for each percentile, like `<metric>_p95`. Their samples are timed at the bucket's start.
+type Collector struct {
+	lib.Collector
+
+	config Config
+	tags   map[string]bool // Nil if all tags are kept.
+
+	bucketsLock sync.Mutex
+	buckets     map[int64]map[string]*aggregate
+
+	// The metrics aggregates are emitted as, only used by the flushing goroutine.
+	metrics map[string]*stats.Metric
+}
+
+// Verify that Collector implements lib.Collector
+var _ lib.Collector = &Collector{}
+
+// A metric's samples with the same tags in a bucket.
+type aggregate struct {
+	metric *stats.Metric
+	tags   *stats.SampleTags
+
+	count         uint64
+	sum, min, max float64
+	trend         *stats.TrendSink // Only for trend metrics, in a sketch so the memory use is bounded.
+}
+
+func (a *aggregate) add(s stats.Sample) {
+	if a.trend != nil {
+		a.trend.Add(s)
+		return
+	}
+	if a.count == 0 || s.Value < a.min {
+		a.min = s.Value
+	}
+	if a.count == 0 || s.Value > a.max {
+		a.max = s.Value
+	}
+	a.count++
+	a.sum += s.Value
+}
+
+// New wraps a collector, so it only receives the aggregated samples.
+func New(c lib.Collector, conf Config) (*Collector, error) {
+	if !conf.Enabled() {
+		return nil, errors.New("aggregation interval must be set")
+	}
+
+	var tags map[string]bool
+	if conf.Tags != nil {
+		tags = make(map[string]bool, len(conf.Tags))
+		for _, tag := range conf.Tags {
+			tags[tag] = true
+		}
+		for tag := range c.GetRequiredSystemTags() {
+			if !tags[tag] {
+				return nil, errors.Errorf("tag '%s' is required by the output, it can't be aggregated away", tag)
+			}
+		}
+	}
+
+	return &Collector{
+		Collector: c,
+		config:    conf,
+		tags:      tags,
+		buckets:   make(map[int64]map[string]*aggregate),
+		metrics:   make(map[string]*stats.Metric),
+	}, nil
+}
+
+// Run runs the wrapped collector, and sends it every bucket once its interval and wait period
+// are over. When the context is done, all remaining buckets are sent before it's stopped.
+func (c *Collector) Run(ctx context.Context) {
+	innerCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Collector.Run(innerCtx)
+		close(done)
+	}()
+
+	ticker := time.NewTicker(FlushRate)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.flush(time.Now().Add(-time.Duration(c.config.WaitPeriod.Duration)))
+		case <-ctx.Done():
+			c.flush(time.Time{})
+			cancel()
+			<-done
+			return
+		}
+	}
+}
+
+// Collect sorts the samples into their buckets.
+func (c *Collector) Collect(scs []stats.SampleContainer) {
+	interval := int64(c.config.Interval.Duration)
+
+	c.bucketsLock.Lock()
+	defer c.bucketsLock.Unlock()
+
+	// Samples from the same container usually share their tags.
+	var lastTags, keptTags *stats.SampleTags
+	var lastKey string
+	for _, sc := range scs {
+		for _, s := range sc.GetSamples() {
+			if s.Tags != lastTags {
+				lastTags = s.Tags
+				keptTags, lastKey = c.keep(s.Tags)
+			}
+
+			start := s.Time.UnixNano() / interval * interval
+			bucket, ok := c.buckets[start]
+			if !ok {
+				bucket = make(map[string]*aggregate)
+				c.buckets[start] = bucket
+			}
+
+			key := s.Metric.Name + "|" + lastKey
+			agg, ok := bucket[key]
+			if !ok {
+				agg = &aggregate{metric: s.Metric, tags: keptTags}
+				if s.Metric.Type == stats.Trend {
+					agg.trend = stats.NewSketchTrendSink()
+				}
+				bucket[key] = agg
+			}
+			agg.add(s)
+		}
+	}
+}
+
+// Returns the tags that are kept out of the given ones, and a key identifying them.
+func (c *Collector) keep(tags *stats.SampleTags) (*stats.SampleTags, string) {
+	kept := tags.CloneTags()
+	for k := range kept {
+		if c.tags != nil && !c.tags[k] {
+			delete(kept, k)
+		}
+	}
+
+	keys := make([]string, 0, len(kept))
+	for k := range kept {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var key strings.Builder
+	for _, k := range keys {
+		key.WriteString(k)
+		key.WriteByte('=')
+		key.WriteString(kept[k])
+		key.WriteByte('&')
+	}
+
+	if c.tags == nil {
+		return tags, key.String()
+	}
+	return stats.IntoSampleTags(&kept), key.String()
+}
+
+// Sends every bucket that ended before the given time to the wrapped collector, or all of them
+// if it's zero.
+func (c *Collector) flush(until time.Time) {
+	interval := int64(c.config.Interval.Duration)
+
+	c.bucketsLock.Lock()
+	ready := make(map[int64]map[string]*aggregate)
+	starts := []int64{}
+	for start, bucket := range c.buckets {
+		if !until.IsZero() && start+interval > until.UnixNano() {
+			continue
+		}
+		ready[start] = bucket
+		starts = append(starts, start)
+		delete(c.buckets, start)
+	}
+	c.bucketsLock.Unlock()
+
+	if len(starts) == 0 {
+		return
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	samples := stats.Samples{}
+	for _, start := range starts {
+		t := time.Unix(0, start)
+		bucket := ready[start]
+
+		// Keep the output stable, it's easier to follow.
+		keys := make([]string, 0, len(bucket))
+		for key := range bucket {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			samples = append(samples, c.samples(bucket[key], t)...)
+		}
+	}
+	c.Collector.Collect([]stats.SampleContainer{samples})
+}
+
+// Turns an aggregate into the samples it's emitted as.
+func (c *Collector) samples(a *aggregate, t time.Time) []stats.Sample {
+	count, sum, min, max := a.count, a.sum, a.min, a.max
+	if a.trend != nil {
+		count, sum, min, max = a.trend.Count, a.trend.Sum, a.trend.Min, a.trend.Max
+	}
+
+	samples := []stats.Sample{
+		{Metric: c.metric(a.metric, "count", stats.Counter, stats.Default), Time: t, Tags: a.tags, Value: float64(count)},
+		{Metric: c.metric(a.metric, "sum", stats.Counter, a.metric.Contains), Time: t, Tags: a.tags, Value: sum},
+		{Metric: c.metric(a.metric, "min", stats.Gauge, a.metric.Contains), Time: t, Tags: a.tags, Value: min},
+		{Metric: c.metric(a.metric, "max", stats.Gauge, a.metric.Contains), Time: t, Tags: a.tags, Value: max},
+	}
+	if a.trend != nil {
+		for _, pct := range Percentiles {
+			name := fmt.Sprintf("p%g", math.Round(pct*1000)/10)
+			samples = append(samples, stats.Sample{
+				Metric: c.metric(a.metric, name, stats.Gauge, a.metric.Contains),
+				Time:   t,
+				Tags:   a.tags,
+				Value:  a.trend.P(pct),
+			})
+		}
+	}
+	return samples
+}
+
+// Returns the metric an aggregate of another one is emitted as.
+func (c *Collector) metric(m *stats.Metric, suffix string, typ stats.MetricType, contains stats.ValueType) *stats.Metric {
+	name := m.Name + "_" + suffix
+	am, ok := c.metrics[name]
+	if !ok {
+		am = stats.New(name, typ, contains)
+		c.metrics[name] = am
+	}
+	return am
+}
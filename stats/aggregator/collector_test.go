@@ -0,0 +1,267 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package aggregator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/loadimpact/k6/stats/dummy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type requiringCollector struct {
+	dummy.Collector
+}
+
+func (c *requiringCollector) GetRequiredSystemTags() lib.TagSet {
+	return lib.TagSet{"status": true}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(&dummy.Collector{}, NewConfig())
+	assert.EqualError(t, err, "aggregation interval must be set")
+
+	conf := NewConfig().Apply(Config{Interval: types.NullDurationFrom(time.Second), Tags: []string{"name"}})
+	_, err = New(&requiringCollector{}, conf)
+	assert.EqualError(t, err, "tag 'status' is required by the output, it can't be aggregated away")
+
+	conf.Tags = []string{"name", "status"}
+	_, err = New(&requiringCollector{}, conf)
+	assert.NoError(t, err)
+	conf.Tags = nil
+	_, err = New(&requiringCollector{}, conf)
+	assert.NoError(t, err)
+}
+
+func TestConfigApply(t *testing.T) {
+	conf := NewConfig()
+	assert.False(t, conf.Enabled())
+	assert.Equal(t, types.NullDurationFrom(time.Second), conf.WaitPeriod)
+
+	conf = conf.Apply(Config{Interval: types.NullDurationFrom(10 * time.Second), Tags: []string{}})
+	assert.True(t, conf.Enabled())
+	assert.Equal(t, types.NullDurationFrom(time.Second), conf.WaitPeriod)
+	assert.Equal(t, []string{}, conf.Tags)
+
+	conf = conf.Apply(Config{WaitPeriod: types.NullDurationFrom(0)})
+	assert.Equal(t, types.NullDurationFrom(10*time.Second), conf.Interval)
+	assert.Equal(t, types.NullDurationFrom(0), conf.WaitPeriod)
+	assert.Equal(t, []string{}, conf.Tags)
+}
+
+func TestCollect(t *testing.T) {
+	counter := stats.New("my_counter", stats.Counter)
+	trend := stats.New("my_trend", stats.Trend, stats.Time)
+	tags := func(name, status string) *stats.SampleTags {
+		return stats.IntoSampleTags(&map[string]string{"name": name, "status": status})
+	}
+	start := time.Unix(1500000000, 0)
+
+	newCollector := func(t *testing.T, keep []string) (*Collector, *dummy.Collector) {
+		inner := &dummy.Collector{}
+		c, err := New(inner, NewConfig().Apply(Config{Interval: types.NullDurationFrom(time.Second), Tags: keep}))
+		require.NoError(t, err)
+
+		ok, notFound := tags("a", "200"), tags("a", "404")
+		c.Collect([]stats.SampleContainer{
+			stats.ConnectedSamples{Samples: []stats.Sample{
+				{Metric: counter, Time: start, Tags: ok, Value: 1},
+				{Metric: trend, Time: start, Tags: ok, Value: 100},
+			}},
+			stats.Samples{
+				{Metric: counter, Time: start.Add(500 * time.Millisecond), Tags: notFound, Value: 2},
+				{Metric: trend, Time: start.Add(500 * time.Millisecond), Tags: notFound, Value: 300},
+				{Metric: counter, Time: start.Add(1500 * time.Millisecond), Tags: tags("b", "200"), Value: 5},
+			},
+		})
+		return c, inner
+	}
+
+	values := func(samples []stats.Sample) map[string]float64 {
+		res := map[string]float64{}
+		for _, s := range samples {
+			name, _ := s.Tags.Get("name")
+			status, _ := s.Tags.Get("status")
+			res[s.Time.Sub(start).String()+" "+s.Metric.Name+"{"+name+","+status+"}"] = s.Value
+		}
+		return res
+	}
+
+	t.Run("filtered tags", func(t *testing.T) {
+		c, inner := newCollector(t, []string{"name"})
+
+		c.flush(start.Add(1500 * time.Millisecond))
+		vals := values(inner.Samples)
+		for _, pct := range []string{"p90", "p95", "p99"} {
+			// Percentiles come from a sketch: within its accuracy of the value at their rank.
+			key := "0s my_trend_" + pct + "{a,}"
+			assert.InEpsilon(t, 100, vals[key], stats.DefaultSketchRelativeAccuracy, pct)
+			delete(vals, key)
+		}
+		assert.Equal(t, map[string]float64{
+			"0s my_counter_count{a,}": 2,
+			"0s my_counter_sum{a,}":   3,
+			"0s my_counter_min{a,}":   1,
+			"0s my_counter_max{a,}":   2,
+			"0s my_trend_count{a,}":   2,
+			"0s my_trend_sum{a,}":     400,
+			"0s my_trend_min{a,}":     100,
+			"0s my_trend_max{a,}":     300,
+		}, vals)
+		assert.Len(t, inner.SampleContainers, 1)
+
+		c.flush(time.Time{})
+		assert.Len(t, inner.SampleContainers, 2)
+		assert.Equal(t, map[string]float64{
+			"1s my_counter_count{b,}": 1,
+			"1s my_counter_sum{b,}":   5,
+			"1s my_counter_min{b,}":   5,
+			"1s my_counter_max{b,}":   5,
+		}, values(inner.SampleContainers[1].GetSamples()))
+
+		for _, s := range inner.Samples {
+			switch s.Metric.Name {
+			case "my_counter_count", "my_trend_count":
+				assert.Equal(t, stats.Counter, s.Metric.Type)
+				assert.Equal(t, stats.Default, s.Metric.Contains)
+			case "my_counter_sum", "my_trend_sum":
+				assert.Equal(t, stats.Counter, s.Metric.Type)
+			default:
+				assert.Equal(t, stats.Gauge, s.Metric.Type)
+			}
+			if s.Metric.Name != "my_trend_count" && strings.HasPrefix(s.Metric.Name, "my_trend") {
+				assert.Equal(t, stats.Time, s.Metric.Contains)
+			}
+		}
+	})
+
+	t.Run("all tags", func(t *testing.T) {
+		c, inner := newCollector(t, nil)
+
+		c.flush(time.Time{})
+		assert.Equal(t, map[string]float64{
+			"0s my_counter_count{a,200}": 1,
+			"0s my_counter_sum{a,200}":   1,
+			"0s my_counter_min{a,200}":   1,
+			"0s my_counter_max{a,200}":   1,
+			"0s my_counter_count{a,404}": 1,
+			"0s my_counter_sum{a,404}":   2,
+			"0s my_counter_min{a,404}":   2,
+			"0s my_counter_max{a,404}":   2,
+			"0s my_trend_count{a,200}":   1,
+			"0s my_trend_sum{a,200}":     100,
+			"0s my_trend_min{a,200}":     100,
+			"0s my_trend_max{a,200}":     100,
+			"0s my_trend_p90{a,200}":     100,
+			"0s my_trend_p95{a,200}":     100,
+			"0s my_trend_p99{a,200}":     100,
+			"0s my_trend_count{a,404}":   1,
+			"0s my_trend_sum{a,404}":     300,
+			"0s my_trend_min{a,404}":     300,
+			"0s my_trend_max{a,404}":     300,
+			"0s my_trend_p90{a,404}":     300,
+			"0s my_trend_p95{a,404}":     300,
+			"0s my_trend_p99{a,404}":     300,
+			"1s my_counter_count{b,200}": 1,
+			"1s my_counter_sum{b,200}":   5,
+			"1s my_counter_min{b,200}":   5,
+			"1s my_counter_max{b,200}":   5,
+		}, values(inner.Samples))
+	})
+
+	t.Run("no tags", func(t *testing.T) {
+		c, inner := newCollector(t, []string{})
+
+		c.flush(time.Time{})
+		vals := values(inner.Samples)
+		assert.Equal(t, 3.0, vals["0s my_counter_sum{,}"])
+		assert.Equal(t, 5.0, vals["1s my_counter_sum{,}"])
+		for _, s := range inner.Samples {
+			assert.Nil(t, s.Tags)
+		}
+	})
+}
+
+func TestCollectTrendSketch(t *testing.T) {
+	trend := stats.New("my_trend", stats.Trend, stats.Time)
+	inner := &dummy.Collector{}
+	c, err := New(inner, NewConfig().Apply(Config{Interval: types.NullDurationFrom(time.Second), Tags: []string{}}))
+	require.NoError(t, err)
+
+	// A busy bucket doesn't keep every value around.
+	start := time.Unix(1500000000, 0)
+	samples := make(stats.Samples, 100000)
+	for i := range samples {
+		samples[i] = stats.Sample{Metric: trend, Time: start, Value: float64(i%1000 + 1)}
+	}
+	c.Collect([]stats.SampleContainer{samples})
+	for _, agg := range c.buckets[start.UnixNano()] {
+		assert.Empty(t, agg.trend.Values)
+	}
+
+	c.flush(time.Time{})
+	vals := map[string]float64{}
+	for _, s := range inner.Samples {
+		vals[s.Metric.Name] = s.Value
+	}
+	assert.Equal(t, 100000.0, vals["my_trend_count"])
+	assert.Equal(t, 1.0, vals["my_trend_min"])
+	assert.Equal(t, 1000.0, vals["my_trend_max"])
+	assert.InEpsilon(t, 900, vals["my_trend_p90"], stats.DefaultSketchRelativeAccuracy)
+	assert.InEpsilon(t, 950, vals["my_trend_p95"], stats.DefaultSketchRelativeAccuracy)
+	assert.InEpsilon(t, 990, vals["my_trend_p99"], stats.DefaultSketchRelativeAccuracy)
+}
+
+func TestRun(t *testing.T) {
+	metric := stats.New("my_metric", stats.Counter)
+	inner := &dummy.Collector{}
+	c, err := New(inner, NewConfig().Apply(Config{
+		Interval:   types.NullDurationFrom(time.Second),
+		WaitPeriod: types.NullDurationFrom(time.Hour),
+	}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	c.Collect([]stats.SampleContainer{stats.Sample{Metric: metric, Time: time.Now(), Value: 1}})
+	time.Sleep(2 * FlushRate)
+
+	// Nothing's sent before the wait period is over, except when the test ends.
+	c.bucketsLock.Lock()
+	assert.Len(t, c.buckets, 1)
+	c.bucketsLock.Unlock()
+	cancel()
+	<-done
+
+	assert.Len(t, c.buckets, 0)
+	assert.Len(t, inner.Samples, 4)
+}
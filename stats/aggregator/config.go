@@ -0,0 +1,65 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package aggregator
+
+import (
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+)
+
+// Config is the config for aggregating the samples sent to an output.
+type Config struct {
+	// Length of the time buckets samples are rolled up into; aggregation is off if it's not set.
+	Interval types.NullDuration `json:"interval" envconfig:"INTERVAL"`
+
+	// How long to wait for samples that arrive late before a bucket is sent to the output.
+	WaitPeriod types.NullDuration `json:"waitPeriod" envconfig:"WAIT_PERIOD"`
+
+	// The tags to keep; samples that only differ in the other ones are aggregated together.
+	// If not set, all tags are kept, and samples are only aggregated over time.
+	Tags []string `json:"tags" envconfig:"TAGS"`
+}
+
+// NewConfig creates a new Config instance with default values for some fields.
+func NewConfig() Config {
+	return Config{
+		WaitPeriod: types.NullDurationFrom(1 * time.Second),
+	}
+}
+
+// Apply merges the set fields of another config into this one.
+func (c Config) Apply(cfg Config) Config {
+	if cfg.Interval.Valid {
+		c.Interval = cfg.Interval
+	}
+	if cfg.WaitPeriod.Valid {
+		c.WaitPeriod = cfg.WaitPeriod
+	}
+	if cfg.Tags != nil {
+		c.Tags = cfg.Tags
+	}
+	return c
+}
+
+// Enabled returns whether samples should be aggregated at all.
+func (c Config) Enabled() bool {
+	return c.Interval.Valid && c.Interval.Duration > 0
+}
@@ -0,0 +1,174 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Verify that Collector implements lib.Collector
+var _ lib.Collector = &Collector{}
+
+// Collector exposes metrics to Prometheus, either on a scrape endpoint or by pushing them to a
+// remote write endpoint, depending on the config.
+type Collector struct {
+	Config Config
+	Client *http.Client
+
+	registry *registry
+	listener net.Listener
+}
+
+// New creates an instance of the collector
+func New(conf Config) (*Collector, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return &Collector{
+		Config:   conf,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		registry: newRegistry(conf),
+	}, nil
+}
+
+// Init starts listening on the scrape endpoint, unless metrics are pushed.
+func (c *Collector) Init() error {
+	if c.pushes() {
+		return nil
+	}
+	listener, err := net.Listen("tcp", c.Config.Addr.String)
+	if err != nil {
+		return errors.Wrap(err, "couldn't start the Prometheus scrape endpoint")
+	}
+	c.listener = listener
+	return nil
+}
+
+func (c *Collector) pushes() bool {
+	return c.Config.RemoteURL.String != ""
+}
+
+// Run serves the scrape endpoint or pushes metrics until the context is done.
+func (c *Collector) Run(ctx context.Context) {
+	if !c.pushes() {
+		log.WithField("addr", c.Link()).Debug("Prometheus: Serving metrics")
+		srv := &http.Server{Handler: c}
+		go func() {
+			if err := srv.Serve(c.listener); err != nil && err != http.ErrServerClosed {
+				log.WithError(err).Error("Prometheus: Couldn't serve metrics")
+			}
+		}()
+		<-ctx.Done()
+		_ = srv.Close()
+		return
+	}
+
+	log.Debug("Prometheus: Running!")
+	ticker := time.NewTicker(time.Duration(c.Config.PushInterval.Duration))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.push()
+		case <-ctx.Done():
+			c.push()
+			return
+		}
+	}
+}
+
+// ServeHTTP serves the current values of all metrics in Prometheus' text format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := c.registry.writeText(w); err != nil {
+		log.WithError(err).Debug("Prometheus: Couldn't write metrics")
+	}
+}
+
+func (c *Collector) push() {
+	startTime := time.Now()
+	body := c.registry.writeRequest(startTime)
+
+	req, err := http.NewRequest("POST", c.Config.RemoteURL.String, bytes.NewReader(body))
+	if err != nil {
+		log.WithError(err).Error("Prometheus: Couldn't create a remote write request")
+		return
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "k6")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	res, err := c.Client.Do(req)
+	if err != nil {
+		log.WithError(err).Error("Prometheus: Couldn't push metrics")
+		return
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		log.WithFields(log.Fields{"status": res.StatusCode, "body": string(msg)}).Error("Prometheus: Couldn't push metrics")
+		return
+	}
+	log.WithField("t", time.Since(startTime)).Debug("Prometheus: Metrics pushed!")
+}
+
+// Collect aggregates samples into the series that are exposed or pushed.
+func (c *Collector) Collect(scs []stats.SampleContainer) {
+	for _, sc := range scs {
+		c.registry.add(sc.GetSamples())
+	}
+}
+
+// Link returns the URL metrics are pushed to, or the scrape endpoint's.
+func (c *Collector) Link() string {
+	if c.pushes() {
+		return c.Config.RemoteURL.String
+	}
+	addr := c.Config.Addr.String
+	if c.listener != nil {
+		addr = c.listener.Addr().String()
+	}
+	return "http://" + addr + "/metrics"
+}
+
+// GetRequiredSystemTags returns which sample tags are needed by this collector
+func (c *Collector) GetRequiredSystemTags() lib.TagSet {
+	return lib.TagSet{} // There are no required tags for this collector
+}
+
+// SetRunStatus does nothing in the Prometheus collector
+func (c *Collector) SetRunStatus(status lib.RunStatus) {}
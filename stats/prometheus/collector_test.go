@@ -0,0 +1,259 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func testSamples() []stats.SampleContainer {
+	reqs := stats.New("http_reqs", stats.Counter)
+	duration := stats.New("http_req_duration", stats.Trend, stats.Time)
+	vus := stats.New("vus", stats.Gauge)
+	checks := stats.New("checks", stats.Rate)
+	sent := stats.New("data-sent", stats.Counter, stats.Data)
+
+	tags := func(tags map[string]string) *stats.SampleTags { return stats.IntoSampleTags(&tags) }
+	ok := tags(map[string]string{"name": "a", "status": "200", "url": "http://a\n\"b\""})
+	notFound := tags(map[string]string{"name": "a", "status": "404"})
+	return []stats.SampleContainer{
+		stats.Samples{
+			{Metric: reqs, Tags: ok, Value: 1},
+			{Metric: reqs, Tags: ok, Value: 1},
+			{Metric: reqs, Tags: notFound, Value: 1},
+			{Metric: duration, Tags: notFound, Value: 100},
+			{Metric: duration, Tags: notFound, Value: 200},
+			{Metric: duration, Tags: notFound, Value: 3000},
+			{Metric: vus, Tags: tags(nil), Value: 5},
+			{Metric: vus, Tags: tags(nil), Value: 10},
+		},
+		stats.Sample{Metric: checks, Tags: tags(map[string]string{"check": "ok"}), Value: 1},
+		stats.Sample{Metric: checks, Tags: tags(map[string]string{"check": "ok"}), Value: 0},
+		stats.Sample{Metric: sent, Tags: tags(nil), Value: 1024},
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	t.Run("Summary", func(t *testing.T) {
+		r := newRegistry(NewConfig())
+		for _, sc := range testSamples() {
+			r.add(sc.GetSamples())
+		}
+		var b strings.Builder
+		require.NoError(t, r.writeText(&b))
+		assert.Equal(t, `# HELP k6_checks k6 metric checks
+# TYPE k6_checks gauge
+k6_checks{check="ok"} 0.5
+# HELP k6_data_sent_bytes_total k6 metric data-sent
+# TYPE k6_data_sent_bytes_total counter
+k6_data_sent_bytes_total 1024
+# HELP k6_http_req_duration_seconds k6 metric http_req_duration
+# TYPE k6_http_req_duration_seconds summary
+k6_http_req_duration_seconds{name="a",quantile="0.5",status="404"} 0.1998668923232066
+k6_http_req_duration_seconds{name="a",quantile="0.9",status="404"} 0.1998668923232066
+k6_http_req_duration_seconds{name="a",quantile="0.95",status="404"} 0.1998668923232066
+k6_http_req_duration_seconds{name="a",quantile="0.99",status="404"} 0.1998668923232066
+k6_http_req_duration_seconds_sum{name="a",status="404"} 3.3
+k6_http_req_duration_seconds_count{name="a",status="404"} 3
+# HELP k6_http_reqs_total k6 metric http_reqs
+# TYPE k6_http_reqs_total counter
+k6_http_reqs_total{name="a",status="200",url="http://a\n\"b\""} 2
+k6_http_reqs_total{name="a",status="404"} 1
+# HELP k6_vus k6 metric vus
+# TYPE k6_vus gauge
+k6_vus 10
+`, b.String())
+	})
+
+	t.Run("Histogram", func(t *testing.T) {
+		r := newRegistry(NewConfig().Apply(Config{
+			Namespace: null.StringFrom(""),
+			Tags:      []string{"status"},
+			TrendType: null.StringFrom(TrendHistogram),
+			Buckets:   []float64{0.1, 0.5, 1},
+		}))
+		for _, sc := range testSamples() {
+			r.add(sc.GetSamples())
+		}
+		var b strings.Builder
+		require.NoError(t, r.writeText(&b))
+		assert.Contains(t, b.String(), `# TYPE http_req_duration_seconds histogram
+http_req_duration_seconds_bucket{le="0.1",status="404"} 1
+http_req_duration_seconds_bucket{le="0.5",status="404"} 2
+http_req_duration_seconds_bucket{le="1",status="404"} 2
+http_req_duration_seconds_bucket{le="+Inf",status="404"} 3
+http_req_duration_seconds_sum{status="404"} 3.3
+http_req_duration_seconds_count{status="404"} 3
+`)
+		assert.Contains(t, b.String(), `http_reqs_total{status="200"} 2
+http_reqs_total{status="404"} 1
+`)
+		assert.Contains(t, b.String(), "\nchecks 0.5\n")
+	})
+}
+
+// Messages from Prometheus' remote.proto, to decode write requests.
+type writeRequest struct {
+	Timeseries []*timeSeries `protobuf:"bytes,1,rep,name=timeseries"`
+}
+type timeSeries struct {
+	Labels  []*protoLabel  `protobuf:"bytes,1,rep,name=labels"`
+	Samples []*protoSample `protobuf:"bytes,2,rep,name=samples"`
+}
+type protoLabel struct {
+	Name  string `protobuf:"bytes,1,opt,name=name"`
+	Value string `protobuf:"bytes,2,opt,name=value"`
+}
+type protoSample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp"`
+}
+
+func (m *writeRequest) Reset()         { *m = writeRequest{} }
+func (m *writeRequest) String() string { return proto.CompactTextString(m) }
+func (*writeRequest) ProtoMessage()    {}
+func (m *timeSeries) Reset()           { *m = timeSeries{} }
+func (m *timeSeries) String() string   { return proto.CompactTextString(m) }
+func (*timeSeries) ProtoMessage()      {}
+func (m *protoLabel) Reset()           { *m = protoLabel{} }
+func (m *protoLabel) String() string   { return proto.CompactTextString(m) }
+func (*protoLabel) ProtoMessage()      {}
+func (m *protoSample) Reset()          { *m = protoSample{} }
+func (m *protoSample) String() string  { return proto.CompactTextString(m) }
+func (*protoSample) ProtoMessage()     {}
+
+func TestRemoteWrite(t *testing.T) {
+	var mutex sync.Mutex
+	var reqs []*writeRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		data, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		var req writeRequest
+		require.NoError(t, proto.Unmarshal(data, &req))
+		mutex.Lock()
+		reqs = append(reqs, &req)
+		mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c, err := New(NewConfig().Apply(Config{
+		RemoteURL:    null.StringFrom(srv.URL),
+		PushInterval: types.NullDurationFrom(10 * time.Millisecond),
+		Tags:         []string{"status"},
+	}))
+	require.NoError(t, err)
+	require.NoError(t, c.Init())
+	assert.Equal(t, srv.URL, c.Link())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	c.Collect(testSamples())
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.NotEmpty(t, reqs)
+	last := reqs[len(reqs)-1]
+	require.Len(t, last.Timeseries, 11)
+
+	series := map[string]float64{}
+	for _, ts := range last.Timeseries {
+		require.Len(t, ts.Samples, 1)
+		assert.InDelta(t, time.Now().UnixNano()/int64(time.Millisecond), ts.Samples[0].Timestamp, 10000)
+		key := ""
+		for _, l := range ts.Labels {
+			key += l.Name + "=" + l.Value + ";"
+		}
+		series[key] = ts.Samples[0].Value
+	}
+	assert.Equal(t, 2.0, series["__name__=k6_http_reqs_total;status=200;"])
+	assert.Equal(t, 1.0, series["__name__=k6_http_reqs_total;status=404;"])
+	assert.Equal(t, 3.0, series["__name__=k6_http_req_duration_seconds_count;status=404;"])
+	assert.InDelta(t, 0.2, series["__name__=k6_http_req_duration_seconds;quantile=0.5;status=404;"], 0.01)
+	assert.Equal(t, 10.0, series["__name__=k6_vus;"])
+	assert.Equal(t, 0.5, series["__name__=k6_checks;"])
+}
+
+func TestScrape(t *testing.T) {
+	c, err := New(NewConfig().Apply(Config{Addr: null.StringFrom("127.0.0.1:0")}))
+	require.NoError(t, err)
+	require.NoError(t, c.Init())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	c.Collect(testSamples())
+
+	res, err := http.Get(c.Link())
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "k6_vus 10\n")
+
+	res, err = http.Get(c.Link() + "/nope")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "http_reqs", sanitizeName("http_reqs"))
+	assert.Equal(t, "my_metric_name", sanitizeName("my-metric.name"))
+	assert.Equal(t, "_1st", sanitizeName("1st"))
+	assert.Equal(t, "Caf__", sanitizeName("Café"))
+}
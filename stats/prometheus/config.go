@@ -0,0 +1,172 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kubernetes/helm/pkg/strvals"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Ways trend metrics can be exposed.
+const (
+	TrendSummary   = "summary"
+	TrendHistogram = "histogram"
+)
+
+// DefaultBuckets are the upper bounds of the buckets used for trends exposed as histograms, the
+// same as the Prometheus client libraries' defaults. Time trends are exposed in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Config is the config for the prometheus collector
+type Config struct {
+	// Scrape endpoint; metrics are exposed on it unless they're pushed.
+	Addr null.String `json:"addr" envconfig:"PROMETHEUS_ADDR"`
+
+	// Remote write; metrics are pushed to this URL if it's set.
+	RemoteURL    null.String        `json:"remote_url" envconfig:"PROMETHEUS_REMOTE_URL"`
+	PushInterval types.NullDuration `json:"push_interval" envconfig:"PROMETHEUS_PUSH_INTERVAL"`
+
+	// Samples.
+	Namespace null.String `json:"namespace" envconfig:"PROMETHEUS_NAMESPACE"`
+	Tags      []string    `json:"tags" envconfig:"PROMETHEUS_TAGS"`
+	TrendType null.String `json:"trend_type" envconfig:"PROMETHEUS_TREND_TYPE"`
+	Buckets   []float64   `json:"buckets" envconfig:"PROMETHEUS_BUCKETS"`
+}
+
+// NewConfig creates a new Config instance with default values for some fields.
+func NewConfig() Config {
+	return Config{
+		Addr:         null.NewString("localhost:5656", false),
+		PushInterval: types.NewNullDuration(5*time.Second, false),
+		Namespace:    null.NewString("k6", false),
+		TrendType:    null.NewString(TrendSummary, false),
+		Buckets:      DefaultBuckets,
+	}
+}
+
+func (c Config) Apply(cfg Config) Config {
+	if cfg.Addr.Valid {
+		c.Addr = cfg.Addr
+	}
+	if cfg.RemoteURL.Valid {
+		c.RemoteURL = cfg.RemoteURL
+	}
+	if cfg.PushInterval.Valid {
+		c.PushInterval = cfg.PushInterval
+	}
+	if cfg.Namespace.Valid {
+		c.Namespace = cfg.Namespace
+	}
+	if len(cfg.Tags) > 0 {
+		c.Tags = cfg.Tags
+	}
+	if cfg.TrendType.Valid {
+		c.TrendType = cfg.TrendType
+	}
+	if len(cfg.Buckets) > 0 {
+		c.Buckets = cfg.Buckets
+	}
+	return c
+}
+
+// Validate checks that the config makes sense.
+func (c Config) Validate() error {
+	switch c.TrendType.String {
+	case TrendSummary, TrendHistogram:
+	default:
+		return errors.Errorf("invalid trend_type '%s', it must be '%s' or '%s'",
+			c.TrendType.String, TrendSummary, TrendHistogram)
+	}
+	if c.RemoteURL.String != "" && time.Duration(c.PushInterval.Duration) <= 0 {
+		return errors.New("push_interval must be positive")
+	}
+	for i := 1; i < len(c.Buckets); i++ {
+		if c.Buckets[i] <= c.Buckets[i-1] {
+			return errors.New("buckets must be in increasing order")
+		}
+	}
+	return nil
+}
+
+// ParseArg takes an arg string and converts it to a config, eg.
+// "remote_url=http://localhost:9090/api/v1/write,tags={name,status}".
+func ParseArg(arg string) (Config, error) {
+	c := Config{}
+	params, err := strvals.Parse(arg)
+	if err != nil {
+		return c, err
+	}
+
+	if v, ok := params["tags"].(string); ok {
+		params["tags"] = []string{v}
+	}
+	if v, ok := params["push_interval"].(string); ok {
+		if err := c.PushInterval.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+	delete(params, "push_interval")
+
+	// Bucket bounds can be parsed as strings or numbers, depending on what they look like.
+	if v, ok := params["buckets"]; ok {
+		items, ok := v.([]interface{})
+		if !ok {
+			items = []interface{}{v}
+		}
+		for _, item := range items {
+			bound, err := strconv.ParseFloat(strings.TrimSpace(toString(item)), 64)
+			if err != nil {
+				return c, errors.Errorf("invalid bucket bound '%v'", item)
+			}
+			c.Buckets = append(c.Buckets, bound)
+		}
+	}
+	delete(params, "buckets")
+
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:  types.NullDecoder,
+		Result:      &c,
+		TagName:     "json",
+		ErrorUnused: true,
+	})
+	if err != nil {
+		return c, err
+	}
+	return c, dec.Decode(params)
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return ""
+	}
+}
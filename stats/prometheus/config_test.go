@@ -0,0 +1,85 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestConfigParseArg(t *testing.T) {
+	c, err := ParseArg("addr=0.0.0.0:9000,tags=name,trend_type=histogram")
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		Addr:      null.StringFrom("0.0.0.0:9000"),
+		Tags:      []string{"name"},
+		TrendType: null.StringFrom("histogram"),
+	}, c)
+
+	c, err = ParseArg("remote_url=http://localhost:9090/api/v1/write,push_interval=10s,namespace=test,tags={name,status},buckets={0.1,1,10}")
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		RemoteURL:    null.StringFrom("http://localhost:9090/api/v1/write"),
+		PushInterval: types.NullDurationFrom(10 * time.Second),
+		Namespace:    null.StringFrom("test"),
+		Tags:         []string{"name", "status"},
+		Buckets:      []float64{0.1, 1, 10},
+	}, c)
+
+	_, err = ParseArg("adr=localhost:9000")
+	assert.Error(t, err)
+	_, err = ParseArg("buckets={0.1,a}")
+	assert.EqualError(t, err, "invalid bucket bound 'a'")
+	_, err = ParseArg("push_interval=soon")
+	assert.Error(t, err)
+}
+
+func TestConfigApply(t *testing.T) {
+	c := NewConfig().Apply(Config{Tags: []string{"name"}, TrendType: null.StringFrom("histogram")})
+	assert.Equal(t, "localhost:5656", c.Addr.String)
+	assert.Equal(t, types.NewNullDuration(5*time.Second, false), c.PushInterval)
+	assert.Equal(t, "k6", c.Namespace.String)
+	assert.Equal(t, []string{"name"}, c.Tags)
+	assert.Equal(t, "histogram", c.TrendType.String)
+	assert.Equal(t, DefaultBuckets, c.Buckets)
+	assert.NoError(t, c.Validate())
+}
+
+func TestConfigValidate(t *testing.T) {
+	testdata := map[string]struct {
+		conf Config
+		err  string
+	}{
+		"TrendType": {Config{TrendType: null.StringFrom("average")}, "invalid trend_type 'average', it must be 'summary' or 'histogram'"},
+		"Interval":  {Config{RemoteURL: null.StringFrom("http://localhost"), PushInterval: types.NullDurationFrom(0)}, "push_interval must be positive"},
+		"Buckets":   {Config{Buckets: []float64{1, 0.5}}, "buckets must be in increasing order"},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			assert.EqualError(t, NewConfig().Apply(data.conf).Validate(), data.err)
+		})
+	}
+}
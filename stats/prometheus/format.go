@@ -0,0 +1,119 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Writes the current values of all metrics in Prometheus' text exposition format, see
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+func (r *registry) writeText(w io.Writer) error {
+	var b strings.Builder
+	r.each(func(f *family, typ string, points []point) {
+		b.WriteString("# HELP " + f.name + " k6 metric " + f.metric.Name + "\n")
+		b.WriteString("# TYPE " + f.name + " " + typ + "\n")
+		for _, p := range points {
+			b.WriteString(p.name)
+			if len(p.labels) > 0 {
+				b.WriteByte('{')
+				for i, l := range p.labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					b.WriteString(l.name + `="` + labelValueEscaper.Replace(l.value) + `"`)
+				}
+				b.WriteByte('}')
+			}
+			b.WriteString(" " + formatFloat(p.value) + "\n")
+		}
+	})
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Encodes the current values of all metrics as a snappy-compressed remote write request, see
+// https://github.com/prometheus/prometheus/blob/master/prompb/remote.proto
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func (r *registry) writeRequest(t time.Time) []byte {
+	timestamp := t.UnixNano() / int64(time.Millisecond)
+	var req, ts, msg []byte
+	r.each(func(f *family, typ string, points []point) {
+		for _, p := range points {
+			ts = ts[:0]
+			// Labels must be sorted by name, and __name__ comes before anything else.
+			for _, l := range withLabel(p.labels, "__name__", p.name) {
+				msg = appendString(appendString(msg[:0], 1, l.name), 2, l.value)
+				ts = appendBytes(ts, 1, msg)
+			}
+			msg = append(msg[:0], 1<<3|1) // value, fixed64
+			msg = append(msg, make([]byte, 8)...)
+			binary.LittleEndian.PutUint64(msg[1:], math.Float64bits(p.value))
+			msg = appendVarint(append(msg, 2<<3|0), uint64(timestamp))
+			ts = appendBytes(ts, 2, msg)
+			req = appendBytes(req, 1, ts)
+		}
+	})
+	return snappy.Encode(nil, req)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|2)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	b = appendVarint(b, uint64(field)<<3|2)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
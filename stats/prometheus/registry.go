@@ -0,0 +1,284 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package prometheus
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// Quantiles exposed for trends exposed as summaries.
+var summaryQuantiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+type label struct {
+	name, value string
+}
+
+// A series aggregates all samples of a metric that have the same labels. Prometheus expects
+// cumulative values, so nothing is ever reset.
+type series struct {
+	labels []label
+
+	// Counters and trends.
+	sum   float64
+	count uint64
+	// Gauges.
+	value float64
+	// Rates.
+	nonZero uint64
+	// Trends, depending on the trend type.
+	sketch  *stats.QuantileSketch
+	buckets []uint64
+}
+
+// A family holds all the series of a metric.
+type family struct {
+	name   string
+	metric *stats.Metric
+	series map[string]*series
+}
+
+// A point is a single value, as written to Prometheus.
+type point struct {
+	name   string
+	labels []label
+	value  float64
+}
+
+// A registry aggregates samples into series, and turns them into points on demand.
+type registry struct {
+	namespace string
+	tags      map[string]bool // Tags to keep as labels; all of them if it's empty.
+	trendType string
+	buckets   []float64
+
+	mutex    sync.Mutex
+	families map[string]*family
+}
+
+func newRegistry(conf Config) *registry {
+	r := &registry{
+		namespace: conf.Namespace.String,
+		trendType: conf.TrendType.String,
+		buckets:   conf.Buckets,
+		families:  make(map[string]*family),
+	}
+	if len(conf.Tags) > 0 {
+		r.tags = make(map[string]bool, len(conf.Tags))
+		for _, tag := range conf.Tags {
+			r.tags[tag] = true
+		}
+	}
+	return r
+}
+
+// Name of a metric in Prometheus, following its naming conventions: time values are in seconds,
+// and units are suffixes.
+func (r *registry) metricName(m *stats.Metric) string {
+	name := sanitizeName(m.Name)
+	if r.namespace != "" {
+		name = r.namespace + "_" + name
+	}
+	switch m.Contains {
+	case stats.Time:
+		name += "_seconds"
+	case stats.Data:
+		name += "_bytes"
+	}
+	if m.Type == stats.Counter {
+		name += "_total"
+	}
+	return name
+}
+
+func (r *registry) add(samples []stats.Sample) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, sample := range samples {
+		f, ok := r.families[sample.Metric.Name]
+		if !ok {
+			f = &family{
+				name:   r.metricName(sample.Metric),
+				metric: sample.Metric,
+				series: make(map[string]*series),
+			}
+			r.families[sample.Metric.Name] = f
+		}
+
+		labels := r.labels(sample.Tags)
+		key := seriesKey(labels)
+		s, ok := f.series[key]
+		if !ok {
+			s = &series{labels: labels}
+			if f.metric.Type == stats.Trend {
+				if r.trendType == TrendHistogram {
+					s.buckets = make([]uint64, len(r.buckets))
+				} else {
+					s.sketch = stats.NewQuantileSketch(stats.DefaultSketchRelativeAccuracy)
+				}
+			}
+			f.series[key] = s
+		}
+
+		value := sample.Value
+		if f.metric.Contains == stats.Time {
+			value = stats.ToD(value).Seconds()
+		}
+		s.count++
+		switch f.metric.Type {
+		case stats.Counter:
+			s.sum += value
+		case stats.Gauge:
+			s.value = value
+		case stats.Rate:
+			if value != 0 {
+				s.nonZero++
+			}
+		case stats.Trend:
+			s.sum += value
+			if s.sketch != nil {
+				s.sketch.Add(value)
+			}
+			if i := sort.SearchFloat64s(r.buckets, value); i < len(s.buckets) {
+				s.buckets[i]++
+			}
+		}
+	}
+}
+
+// Turns tags into labels, sorted by name.
+func (r *registry) labels(tags *stats.SampleTags) []label {
+	var labels []label
+	for name, value := range tags.CloneTags() {
+		if r.tags != nil && !r.tags[name] {
+			continue
+		}
+		labels = append(labels, label{sanitizeName(name), value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+func seriesKey(labels []label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.name)
+		b.WriteByte(0)
+		b.WriteString(l.value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// Replaces characters that aren't allowed in metric and label names.
+func sanitizeName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// Calls fn for each family, sorted by name, with the points of its series; these are the
+// families' current values, see the Prometheus exposition formats for how the different metric
+// types are represented.
+func (r *registry) each(fn func(f *family, typ string, points []point)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	for _, f := range families {
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var typ string
+		var points []point
+		for _, key := range keys {
+			s := f.series[key]
+			switch f.metric.Type {
+			case stats.Counter:
+				typ = "counter"
+				points = append(points, point{f.name, s.labels, s.sum})
+			case stats.Gauge:
+				typ = "gauge"
+				points = append(points, point{f.name, s.labels, s.value})
+			case stats.Rate:
+				typ = "gauge"
+				points = append(points, point{f.name, s.labels, float64(s.nonZero) / float64(s.count)})
+			case stats.Trend:
+				if s.sketch != nil {
+					typ = "summary"
+					for _, q := range summaryQuantiles {
+						value := math.NaN()
+						if s.count > 0 {
+							value = s.sketch.Quantile(q)
+						}
+						points = append(points, point{f.name, withLabel(s.labels, "quantile", formatFloat(q)), value})
+					}
+				} else {
+					typ = "histogram"
+					var cumulative uint64
+					for i, bound := range r.buckets {
+						cumulative += s.buckets[i]
+						points = append(points, point{
+							f.name + "_bucket", withLabel(s.labels, "le", formatFloat(bound)), float64(cumulative),
+						})
+					}
+					points = append(points, point{
+						f.name + "_bucket", withLabel(s.labels, "le", "+Inf"), float64(s.count),
+					})
+				}
+				points = append(points,
+					point{f.name + "_sum", s.labels, s.sum},
+					point{f.name + "_count", s.labels, float64(s.count)},
+				)
+			}
+		}
+		fn(f, typ, points)
+	}
+}
+
+// Returns a copy of labels with another one, keeping them sorted.
+func withLabel(labels []label, name, value string) []label {
+	i := sort.Search(len(labels), func(i int) bool { return labels[i].name >= name })
+	res := make([]label, 0, len(labels)+1)
+	res = append(res, labels[:i]...)
+	res = append(res, label{name, value})
+	return append(res, labels[i:]...)
+}
@@ -41,6 +41,76 @@ type Sink interface {
 	Format(t time.Duration) map[string]float64 // Data for thresholds.
 }
 
+// Returns a new, empty sink of the same kind as another one; trend sinks get a sketch with the
+// same accuracy if the other one has one. Returns nil for sinks that can't be aggregated.
+func newSinkLike(like Sink) Sink {
+	switch like := like.(type) {
+	case *CounterSink:
+		return &CounterSink{}
+	case *GaugeSink:
+		return &GaugeSink{}
+	case *TrendSink:
+		if like.Sketch != nil {
+			return &TrendSink{Sketch: NewQuantileSketch(like.Sketch.RelativeAccuracy())}
+		}
+		return &TrendSink{}
+	case *RateSink:
+		return &RateSink{}
+	default:
+		return nil
+	}
+}
+
+// Merges the data of src into dst, which must be a sink of the same kind, as if all of src's
+// samples had been added to it after its own.
+func mergeSink(dst, src Sink) {
+	switch dst := dst.(type) {
+	case *CounterSink:
+		src := src.(*CounterSink)
+		dst.Value += src.Value
+		if dst.First.IsZero() || (!src.First.IsZero() && src.First.Before(dst.First)) {
+			dst.First = src.First
+		}
+	case *GaugeSink:
+		src := src.(*GaugeSink)
+		if !src.minSet {
+			return
+		}
+		dst.Value = src.Value
+		if src.Max > dst.Max {
+			dst.Max = src.Max
+		}
+		if src.Min < dst.Min || !dst.minSet {
+			dst.Min = src.Min
+			dst.minSet = true
+		}
+	case *TrendSink:
+		src := src.(*TrendSink)
+		if src.Count == 0 {
+			return
+		}
+		if dst.Sketch != nil && src.Sketch != nil {
+			dst.Sketch.Merge(src.Sketch)
+		} else {
+			dst.Values = append(dst.Values, src.Values...)
+		}
+		if src.Max > dst.Max {
+			dst.Max = src.Max
+		}
+		if src.Min < dst.Min || dst.Count == 0 {
+			dst.Min = src.Min
+		}
+		dst.jumbled = true
+		dst.Count += src.Count
+		dst.Sum += src.Sum
+		dst.Avg = dst.Sum / float64(dst.Count)
+	case *RateSink:
+		src := src.(*RateSink)
+		dst.Trues += src.Trues
+		dst.Total += src.Total
+	}
+}
+
 type CounterSink struct {
 	Value float64
 	First time.Time
@@ -85,8 +155,11 @@ func (g *GaugeSink) Format(t time.Duration) map[string]float64 {
 	return map[string]float64{"value": g.Value}
 }
 
+// A TrendSink keeps every value it's given, so it can calculate exact percentiles. If it has a
+// Sketch, values go into it instead, and percentiles are estimated in bounded memory.
 type TrendSink struct {
 	Values  []float64
+	Sketch  *QuantileSketch
 	jumbled bool
 
 	Count    uint64
@@ -95,8 +168,18 @@ type TrendSink struct {
 	Med      float64
 }
 
+// NewSketchTrendSink returns a TrendSink that estimates percentiles with a QuantileSketch,
+// using DefaultSketchRelativeAccuracy, rather than keeping every value.
+func NewSketchTrendSink() *TrendSink {
+	return &TrendSink{Sketch: NewQuantileSketch(DefaultSketchRelativeAccuracy)}
+}
+
 func (t *TrendSink) Add(s Sample) {
-	t.Values = append(t.Values, s.Value)
+	if t.Sketch != nil {
+		t.Sketch.Add(s.Value)
+	} else {
+		t.Values = append(t.Values, s.Value)
+	}
 	t.jumbled = true
 	t.Count += 1
 	t.Sum += s.Value
@@ -112,6 +195,10 @@ func (t *TrendSink) Add(s Sample) {
 
 // P calculates the given percentile from sink values.
 func (t *TrendSink) P(pct float64) float64 {
+	if t.Sketch != nil {
+		return t.Sketch.Quantile(pct)
+	}
+
 	switch t.Count {
 	case 0:
 		return 0
@@ -135,6 +222,12 @@ func (t *TrendSink) Calc() {
 		return
 	}
 
+	if t.Sketch != nil {
+		t.Med = t.Sketch.Quantile(0.5)
+		t.jumbled = false
+		return
+	}
+
 	sort.Float64s(t.Values)
 	t.jumbled = false
 
@@ -269,3 +269,35 @@ func TestDummySinkCalcDoesNothing(t *testing.T) {
 func TestDummySinkFormatReturnsItself(t *testing.T) {
 	assert.Equal(t, map[string]float64{"a": 1}, DummySink{"a": 1}.Format(0))
 }
+
+func TestMergeSink(t *testing.T) {
+	// Merging sinks gives the same results as adding all of their samples to one.
+	sinks := map[string]func() Sink{
+		"counter": func() Sink { return &CounterSink{} },
+		"gauge":   func() Sink { return &GaugeSink{} },
+		"trend":   func() Sink { return &TrendSink{} },
+		"sketch":  func() Sink { return NewSketchTrendSink() },
+		"rate":    func() Sink { return &RateSink{} },
+	}
+	start := time.Now()
+	for name, newSink := range sinks {
+		t.Run(name, func(t *testing.T) {
+			all, merged := newSink(), newSinkLike(newSink())
+			var parts []Sink
+			for i, v := range []float64{5, 0, -3, 12, 7, 1, 0, 4} {
+				if i%3 == 0 {
+					parts = append(parts, newSinkLike(all))
+				}
+				s := Sample{Metric: &Metric{}, Time: start.Add(time.Duration(i) * time.Second), Value: v}
+				all.Add(s)
+				parts[len(parts)-1].Add(s)
+			}
+			for _, part := range parts {
+				mergeSink(merged, part)
+			}
+			all.Calc()
+			merged.Calc()
+			assert.Equal(t, all.Format(time.Second), merged.Format(time.Second))
+		})
+	}
+}
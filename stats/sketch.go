@@ -0,0 +1,219 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"math"
+)
+
+const (
+	// DefaultSketchRelativeAccuracy is the relative accuracy of quantiles calculated by sketches
+	// created with NewSketchTrendSink(): a reported p(95) of 100ms means the real one is 99-101ms.
+	DefaultSketchRelativeAccuracy = 0.01
+
+	// Max number of buckets per sign; with 1% accuracy, this covers about 17 orders of magnitude
+	// before the lowest buckets start being collapsed together, which is ~16KB of memory.
+	sketchMaxBuckets = 2048
+
+	// Number of extra buckets to allocate when the store needs to grow downwards.
+	sketchGrowBy = 32
+)
+
+// A QuantileSketch estimates quantiles of a stream of values in bounded memory, with a guaranteed
+// relative error, rather than an absolute or rank error. It works by counting values in buckets
+// whose bounds grow exponentially: a value x lands in bucket ceil(log_γ(x)), with
+// γ = (1+α)/(1-α), and every value in a bucket is within α of the bucket's midpoint.
+//
+// Negative values are counted in a mirrored set of buckets, and zeroes separately. If the range
+// of values gets too wide, the lowest (closest to zero) buckets are merged, so only the accuracy
+// of the lowest quantiles suffers, which are of less interest for things like response times.
+type QuantileSketch struct {
+	gamma, logGamma float64
+
+	pos, neg sketchStore
+	zeros    uint64
+
+	Count    uint64
+	Min, Max float64
+}
+
+// NewQuantileSketch creates a sketch with the given relative accuracy, which must be in (0, 1).
+func NewQuantileSketch(relativeAccuracy float64) *QuantileSketch {
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &QuantileSketch{gamma: gamma, logGamma: math.Log(gamma)}
+}
+
+// RelativeAccuracy returns the relative accuracy the sketch was created with.
+func (s *QuantileSketch) RelativeAccuracy() float64 {
+	return (s.gamma - 1) / (s.gamma + 1)
+}
+
+// Add adds a value to the sketch.
+func (s *QuantileSketch) Add(v float64) {
+	switch {
+	case v > 0:
+		s.pos.add(s.index(v), 1)
+	case v < 0:
+		s.neg.add(s.index(-v), 1)
+	default:
+		s.zeros++
+	}
+
+	s.Count++
+	if v > s.Max || s.Count == 1 {
+		s.Max = v
+	}
+	if v < s.Min || s.Count == 1 {
+		s.Min = v
+	}
+}
+
+// Merge adds all of another sketch's values to this one. Both must have the same accuracy.
+func (s *QuantileSketch) Merge(other *QuantileSketch) {
+	if other.Count == 0 {
+		return
+	}
+	for j, c := range other.pos.counts {
+		if c > 0 {
+			s.pos.add(other.pos.offset+j, c)
+		}
+	}
+	for j, c := range other.neg.counts {
+		if c > 0 {
+			s.neg.add(other.neg.offset+j, c)
+		}
+	}
+	s.zeros += other.zeros
+
+	if other.Max > s.Max || s.Count == 0 {
+		s.Max = other.Max
+	}
+	if other.Min < s.Min || s.Count == 0 {
+		s.Min = other.Min
+	}
+	s.Count += other.Count
+}
+
+// Quantile returns an estimate of the given quantile (0-1) of all added values; the value at
+// rank q*(count-1), within the sketch's relative accuracy.
+func (s *QuantileSketch) Quantile(q float64) float64 {
+	switch {
+	case s.Count == 0:
+		return 0
+	case q <= 0:
+		return s.Min
+	case q >= 1:
+		return s.Max
+	}
+
+	rank := uint64(q * float64(s.Count-1))
+	var v float64
+	if n := s.neg.total(); rank < n {
+		// Negative buckets are ordered by magnitude, so walk them backwards.
+		v = -s.value(s.neg.key(n - 1 - rank))
+	} else if rank < n+s.zeros {
+		v = 0
+	} else {
+		v = s.value(s.pos.key(rank - n - s.zeros))
+	}
+
+	// Estimates can't be outside of the actual range of values.
+	return math.Max(s.Min, math.Min(s.Max, v))
+}
+
+// Returns the bucket index for a positive value.
+func (s *QuantileSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// Returns the value that's representative of a bucket; the one with the lowest relative error
+// from both of its bounds.
+func (s *QuantileSketch) value(i int) float64 {
+	return 2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1)
+}
+
+// A sketchStore is a dense, contiguous set of bucket counters, starting at a given index.
+type sketchStore struct {
+	counts []uint64
+	offset int
+	sum    uint64
+}
+
+func (s *sketchStore) total() uint64 {
+	return s.sum
+}
+
+// Adds n values to bucket i.
+func (s *sketchStore) add(i int, n uint64) {
+	s.sum += n
+	if len(s.counts) == 0 {
+		s.counts = []uint64{n}
+		s.offset = i
+		return
+	}
+
+	lo, hi := s.offset, s.offset+len(s.counts)-1
+	switch {
+	case i > hi && i-lo+1 <= sketchMaxBuckets:
+		s.counts = append(s.counts, make([]uint64, i-hi)...)
+	case i > hi:
+		s.resize(i-sketchMaxBuckets+1, i)
+	case i < lo:
+		// Leave some room below, so values that keep getting lower don't need a copy every time.
+		lo = i - sketchGrowBy
+		if hi-lo+1 > sketchMaxBuckets {
+			lo = hi - sketchMaxBuckets + 1
+		}
+		if lo < s.offset {
+			s.resize(lo, hi)
+		}
+		if i < s.offset {
+			i = s.offset
+		}
+	}
+	s.counts[i-s.offset] += n
+}
+
+// Resizes the store to cover buckets [lo, hi]; buckets below lo are merged into it.
+func (s *sketchStore) resize(lo, hi int) {
+	counts := make([]uint64, hi-lo+1)
+	for j, c := range s.counts {
+		k := s.offset + j
+		if k < lo {
+			k = lo
+		}
+		counts[k-lo] += c
+	}
+	s.counts = counts
+	s.offset = lo
+}
+
+// Returns the index of the bucket holding the value of the given rank, counting from the lowest.
+func (s *sketchStore) key(rank uint64) int {
+	var n uint64
+	for j, c := range s.counts {
+		n += c
+		if n > rank {
+			return s.offset + j
+		}
+	}
+	return s.offset + len(s.counts) - 1
+}
@@ -0,0 +1,165 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sketchQuantiles = []float64{0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.95, 0.99, 0.999}
+
+// Checks the sketch's guarantee against an exact TrendSink fed the same values: every quantile
+// is within the relative accuracy of the value at its rank (rounded down), and thus of the
+// exact, interpolated percentile as well when there are enough values for it not to matter.
+func assertSketchAccuracy(t *testing.T, gen func(r *rand.Rand) float64) {
+	r := rand.New(rand.NewSource(42))
+	exact := TrendSink{}
+	sketch := NewSketchTrendSink()
+	for i := 0; i < 100000; i++ {
+		s := Sample{Metric: &Metric{}, Value: gen(r)}
+		exact.Add(s)
+		sketch.Add(s)
+	}
+	exact.Calc()
+	sketch.Calc()
+
+	alpha := sketch.Sketch.RelativeAccuracy()
+	assert.InDelta(t, DefaultSketchRelativeAccuracy, alpha, 1e-12)
+	for _, q := range sketchQuantiles {
+		v := exact.Values[int(q*float64(exact.Count-1))]
+		p := sketch.P(q)
+		assert.InDelta(t, v, p, alpha*math.Abs(v)+1e-9, "p(%g)", q*100)
+		assert.InDelta(t, exact.P(q), p, 2*alpha*math.Abs(exact.P(q))+1e-9, "p(%g)", q*100)
+	}
+
+	assert.Equal(t, exact.Count, sketch.Count)
+	assert.Equal(t, exact.Min, sketch.Min)
+	assert.Equal(t, exact.Max, sketch.Max)
+	assert.InDelta(t, exact.Avg, sketch.Avg, 1e-6*math.Abs(exact.Avg))
+	assert.InDelta(t, exact.Med, sketch.Med, 2*alpha*math.Abs(exact.Med))
+	assert.Equal(t, exact.Min, sketch.P(0))
+	assert.Equal(t, exact.Max, sketch.P(1))
+	assert.Empty(t, sketch.Values)
+}
+
+func TestQuantileSketchAccuracy(t *testing.T) {
+	testdata := map[string]func(r *rand.Rand) float64{
+		"uniform":     func(r *rand.Rand) float64 { return 1 + r.Float64()*999 },
+		"exponential": func(r *rand.Rand) float64 { return r.ExpFloat64() * 100 },
+		"lognormal":   func(r *rand.Rand) float64 { return math.Exp(r.NormFloat64()*2 + 3) },
+		"bimodal": func(r *rand.Rand) float64 {
+			if r.Intn(10) == 0 {
+				return 3000 + r.NormFloat64()*100
+			}
+			return 20 + r.Float64()*5
+		},
+		"integers": func(r *rand.Rand) float64 { return float64(r.Intn(50)) },
+		"normal":   func(r *rand.Rand) float64 { return r.NormFloat64() * 50 },
+	}
+	for name, gen := range testdata {
+		t.Run(name, func(t *testing.T) {
+			assertSketchAccuracy(t, gen)
+		})
+	}
+}
+
+func TestQuantileSketch(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		s := NewQuantileSketch(0.01)
+		for _, q := range sketchQuantiles {
+			assert.Equal(t, 0.0, s.Quantile(q))
+		}
+	})
+	t.Run("one value", func(t *testing.T) {
+		s := NewQuantileSketch(0.01)
+		s.Add(10)
+		for _, q := range sketchQuantiles {
+			assert.Equal(t, 10.0, s.Quantile(q))
+		}
+	})
+	t.Run("signs", func(t *testing.T) {
+		s := NewQuantileSketch(0.01)
+		for _, v := range []float64{-100, -10, 0, 0, 10, 100} {
+			s.Add(v)
+		}
+		assert.Equal(t, -100.0, s.Quantile(0))
+		assert.InEpsilon(t, -10, s.Quantile(0.2), 0.01)
+		assert.Equal(t, 0.0, s.Quantile(0.5))
+		assert.InEpsilon(t, 10, s.Quantile(0.8), 0.01)
+		assert.Equal(t, 100.0, s.Quantile(1))
+	})
+	t.Run("bounded", func(t *testing.T) {
+		// Values spanning 24 orders of magnitude don't fit, so the lowest buckets get merged; the
+		// memory use stays the same, and only the lowest quantiles are affected.
+		r := rand.New(rand.NewSource(42))
+		exact := TrendSink{}
+		s := NewQuantileSketch(0.01)
+		for i := 0; i < 1000000; i++ {
+			v := math.Pow(10, r.Float64()*24-12)
+			s.Add(v)
+			exact.Add(Sample{Metric: &Metric{}, Value: v})
+			assert.True(t, len(s.pos.counts) <= sketchMaxBuckets)
+		}
+		assert.Equal(t, sketchMaxBuckets, len(s.pos.counts))
+		assert.Len(t, s.neg.counts, 0)
+
+		exact.Calc()
+		for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+			v := exact.Values[int(q*float64(exact.Count-1))]
+			assert.InDelta(t, v, s.Quantile(q), 0.01*v, "p(%g)", q*100)
+		}
+		assert.True(t, s.Quantile(0.01) > exact.Values[int(0.01*float64(exact.Count-1))])
+	})
+	t.Run("merge", func(t *testing.T) {
+		// Merging sketches is the same as adding all of their values to one.
+		r := rand.New(rand.NewSource(42))
+		all, a, b := NewQuantileSketch(0.01), NewQuantileSketch(0.01), NewQuantileSketch(0.01)
+		for i := 0; i < 10000; i++ {
+			v := r.NormFloat64() * 100
+			all.Add(v)
+			if i%3 == 0 {
+				a.Add(v)
+			} else {
+				b.Add(v)
+			}
+		}
+		a.Merge(b)
+		a.Merge(NewQuantileSketch(0.01))
+		assert.Equal(t, all.Count, a.Count)
+		assert.Equal(t, all.Min, a.Min)
+		assert.Equal(t, all.Max, a.Max)
+		for _, q := range sketchQuantiles {
+			assert.Equal(t, all.Quantile(q), a.Quantile(q), "p(%g)", q*100)
+		}
+	})
+	t.Run("decreasing", func(t *testing.T) {
+		s := NewQuantileSketch(0.01)
+		for v := 1e6; v > 1e-6; v *= 0.99 {
+			s.Add(v)
+		}
+		assert.True(t, len(s.pos.counts) <= sketchMaxBuckets)
+		assert.InEpsilon(t, 1, s.Quantile(0.5), 0.02)
+	})
+}
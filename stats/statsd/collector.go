@@ -0,0 +1,223 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package statsd
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Verify that Collector implements lib.Collector
+var _ lib.Collector = &Collector{}
+
+// Collector sends metrics to a StatsD or DogStatsD server over UDP.
+//
+// Counters are sent as counts and gauges as gauges. Trends are sent as timings if they contain
+// times, which k6 measures in milliseconds like StatsD does, or as histograms otherwise. Rates
+// are sent as a pair of counters, `<metric>.total` for every sample and `<metric>.nonzero` for
+// the non-zero ones, so their ratio is the rate.
+type Collector struct {
+	Config Config
+
+	conn net.Conn
+	tags map[string]bool
+
+	// Datagrams waiting to be sent; the last one is still being filled.
+	buffer     [][]byte
+	bufferLock sync.Mutex
+}
+
+// New creates an instance of the collector
+func New(conf Config) (*Collector, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	tags := make(map[string]bool, len(conf.Tags))
+	for _, tag := range conf.Tags {
+		tags[tag] = true
+	}
+	return &Collector{Config: conf, tags: tags}, nil
+}
+
+// Init opens the UDP socket metrics are sent from.
+func (c *Collector) Init() error {
+	conn, err := net.Dial("udp", c.Config.Addr.String)
+	if err != nil {
+		return errors.Wrap(err, "couldn't connect to the StatsD server")
+	}
+	c.conn = conn
+	return nil
+}
+
+// Run sends the buffered metrics every push interval until the context is done.
+func (c *Collector) Run(ctx context.Context) {
+	log.WithField("addr", c.Config.Addr.String).Debug("StatsD: Running!")
+	ticker := time.NewTicker(time.Duration(c.Config.PushInterval.Duration))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.push()
+		case <-ctx.Done():
+			c.push()
+			_ = c.conn.Close()
+			return
+		}
+	}
+}
+
+func (c *Collector) push() {
+	c.bufferLock.Lock()
+	buffer := c.buffer
+	c.buffer = nil
+	c.bufferLock.Unlock()
+
+	failed := 0
+	var lastErr error
+	for _, datagram := range buffer {
+		if _, err := c.conn.Write(datagram); err != nil {
+			failed++
+			lastErr = err
+		}
+	}
+	if failed > 0 {
+		log.WithError(lastErr).WithField("datagrams", failed).Error("StatsD: Couldn't send metrics")
+		return
+	}
+	log.WithField("datagrams", len(buffer)).Debug("StatsD: Metrics sent!")
+}
+
+// Collect formats the samples and batches them into datagrams.
+func (c *Collector) Collect(scs []stats.SampleContainer) {
+	c.bufferLock.Lock()
+	defer c.bufferLock.Unlock()
+
+	// Samples from the same container usually share their tags.
+	var lastTags *stats.SampleTags
+	tags := c.formatTags(nil)
+	for _, sc := range scs {
+		for _, s := range sc.GetSamples() {
+			if s.Tags != lastTags {
+				lastTags = s.Tags
+				tags = c.formatTags(s.Tags)
+			}
+			name := c.Config.Namespace.String + sanitizeName(s.Metric.Name)
+
+			switch s.Metric.Type {
+			case stats.Counter:
+				c.add(name, formatValue(s.Value), "c", tags)
+			case stats.Gauge:
+				// A leading sign means an increment or decrement of a gauge to StatsD.
+				if s.Value < 0 {
+					c.add(name, "0", "g", tags)
+				}
+				c.add(name, formatValue(s.Value), "g", tags)
+			case stats.Trend:
+				if s.Metric.Contains == stats.Time {
+					c.add(name, formatValue(s.Value), "ms", tags)
+				} else {
+					c.add(name, formatValue(s.Value), "h", tags)
+				}
+			case stats.Rate:
+				c.add(name+".total", "1", "c", tags)
+				if s.Value != 0 {
+					c.add(name+".nonzero", "1", "c", tags)
+				}
+			}
+		}
+	}
+}
+
+// Adds a metric to the datagram being filled, or starts a new one if it doesn't fit anymore.
+func (c *Collector) add(name, value, typ, tags string) {
+	line := name + ":" + value + "|" + typ + tags
+	size := int(c.Config.BufferSize.Int64)
+
+	if n := len(c.buffer); n > 0 {
+		last := c.buffer[n-1]
+		if len(last)+1+len(line) <= size {
+			c.buffer[n-1] = append(append(last, '\n'), line...)
+			return
+		}
+	}
+
+	// Lines longer than a datagram get one of their own; it's up to the network to deal with it.
+	datagram := make([]byte, 0, size)
+	c.buffer = append(c.buffer, append(datagram, line...))
+}
+
+// Formats the allowed tags in the DogStatsD format, eg. "|#name:http://example.com,status:200".
+func (c *Collector) formatTags(tags *stats.SampleTags) string {
+	if len(c.tags) == 0 || tags == nil {
+		return ""
+	}
+
+	pairs := []string{}
+	for k, v := range tags.CloneTags() {
+		if c.tags[k] {
+			pairs = append(pairs, sanitizeTag(k)+":"+sanitizeTag(v))
+		}
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	sort.Strings(pairs)
+	return "|#" + strings.Join(pairs, ",")
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+var (
+	nameReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_")
+	tagReplacer  = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+)
+
+func sanitizeName(name string) string {
+	return nameReplacer.Replace(name)
+}
+
+func sanitizeTag(tag string) string {
+	return tagReplacer.Replace(tag)
+}
+
+// Link returns the address metrics are sent to.
+func (c *Collector) Link() string {
+	return c.Config.Addr.String
+}
+
+// GetRequiredSystemTags returns which sample tags are needed by this collector
+func (c *Collector) GetRequiredSystemTags() lib.TagSet {
+	return lib.TagSet{} // There are no required tags for this collector
+}
+
+// SetRunStatus does nothing in the statsd collector
+func (c *Collector) SetRunStatus(status lib.RunStatus) {}
@@ -0,0 +1,147 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package statsd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Runs a collector sending to a local UDP socket until it has collected the given samples, and
+// returns all of the datagrams it sent.
+func runCollector(t *testing.T, conf Config, scs []stats.SampleContainer) []string {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	conf = NewConfig().Apply(conf).Apply(Config{
+		Addr:         null.StringFrom(listener.LocalAddr().String()),
+		PushInterval: types.NullDurationFrom(time.Hour),
+	})
+	c, err := New(conf)
+	require.NoError(t, err)
+	require.NoError(t, c.Init())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	c.Collect(scs)
+	cancel()
+	<-done
+
+	datagrams := []string{}
+	buf := make([]byte, 65536)
+	for {
+		require.NoError(t, listener.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		n, _, err := listener.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		datagrams = append(datagrams, string(buf[:n]))
+	}
+	return datagrams
+}
+
+func TestCollect(t *testing.T) {
+	counter := stats.New("my_counter", stats.Counter)
+	gauge := stats.New("my_gauge", stats.Gauge)
+	timeTrend := stats.New("my_duration", stats.Trend, stats.Time)
+	trend := stats.New("my_trend", stats.Trend)
+	rate := stats.New("my_rate", stats.Rate)
+
+	tags := stats.IntoSampleTags(&map[string]string{
+		"name": "http://example.com/a,b", "status": "200", "vu": "1",
+	})
+	scs := []stats.SampleContainer{
+		stats.ConnectedSamples{Samples: []stats.Sample{
+			{Metric: counter, Tags: tags, Value: 2},
+			{Metric: timeTrend, Tags: tags, Value: 12.5},
+		}},
+		stats.Samples{
+			{Metric: gauge, Value: 3},
+			{Metric: gauge, Value: -1},
+			{Metric: trend, Value: 7},
+			{Metric: rate, Value: 1},
+			{Metric: rate, Value: 0},
+		},
+	}
+
+	t.Run("no tags", func(t *testing.T) {
+		datagrams := runCollector(t, Config{}, scs)
+		assert.Equal(t, []string{strings.Join([]string{
+			"k6.my_counter:2|c",
+			"k6.my_duration:12.5|ms",
+			"k6.my_gauge:3|g",
+			"k6.my_gauge:0|g",
+			"k6.my_gauge:-1|g",
+			"k6.my_trend:7|h",
+			"k6.my_rate.total:1|c",
+			"k6.my_rate.nonzero:1|c",
+			"k6.my_rate.total:1|c",
+		}, "\n")}, datagrams)
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		datagrams := runCollector(t, Config{
+			Namespace: null.StringFrom(""),
+			Tags:      []string{"name", "status"},
+		}, scs[:1])
+		assert.Equal(t, []string{
+			"my_counter:2|c|#name:http://example.com/a_b,status:200\n" +
+				"my_duration:12.5|ms|#name:http://example.com/a_b,status:200",
+		}, datagrams)
+	})
+
+	t.Run("batching", func(t *testing.T) {
+		datagrams := runCollector(t, Config{BufferSize: null.IntFrom(40)}, scs)
+		assert.Equal(t, []string{
+			"k6.my_counter:2|c\nk6.my_duration:12.5|ms",
+			"k6.my_gauge:3|g\nk6.my_gauge:0|g",
+			"k6.my_gauge:-1|g\nk6.my_trend:7|h",
+			"k6.my_rate.total:1|c",
+			"k6.my_rate.nonzero:1|c",
+			"k6.my_rate.total:1|c",
+		}, datagrams)
+		for _, datagram := range datagrams {
+			assert.True(t, len(datagram) <= 40, datagram)
+		}
+	})
+}
+
+func TestInit(t *testing.T) {
+	c, err := New(NewConfig().Apply(Config{Addr: null.StringFrom("localhost:notaport")}))
+	require.NoError(t, err)
+	assert.Error(t, c.Init())
+
+	_, err = New(NewConfig().Apply(Config{BufferSize: null.IntFrom(-1)}))
+	assert.EqualError(t, err, "buffer_size must be positive")
+}
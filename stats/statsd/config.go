@@ -0,0 +1,119 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package statsd
+
+import (
+	"time"
+
+	"github.com/kubernetes/helm/pkg/strvals"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Config is the config for the statsd collector
+type Config struct {
+	// Connection.
+	Addr null.String `json:"addr" envconfig:"STATSD_ADDR"`
+
+	// Batching; metrics are sent in datagrams of at most buffer_size bytes every push_interval.
+	BufferSize   null.Int           `json:"buffer_size" envconfig:"STATSD_BUFFER_SIZE"`
+	PushInterval types.NullDuration `json:"push_interval" envconfig:"STATSD_PUSH_INTERVAL"`
+
+	// Samples. Only the tags in the allow-list are sent, in the DogStatsD format.
+	Namespace null.String `json:"namespace" envconfig:"STATSD_NAMESPACE"`
+	Tags      []string    `json:"tags" envconfig:"STATSD_TAGS"`
+}
+
+// NewConfig creates a new Config instance with default values for some fields.
+func NewConfig() Config {
+	return Config{
+		Addr: null.NewString("localhost:8125", false),
+		// Fits in a single Ethernet frame, along with the IP and UDP headers.
+		BufferSize:   null.NewInt(1432, false),
+		PushInterval: types.NewNullDuration(1*time.Second, false),
+		Namespace:    null.NewString("k6.", false),
+	}
+}
+
+func (c Config) Apply(cfg Config) Config {
+	if cfg.Addr.Valid {
+		c.Addr = cfg.Addr
+	}
+	if cfg.BufferSize.Valid {
+		c.BufferSize = cfg.BufferSize
+	}
+	if cfg.PushInterval.Valid {
+		c.PushInterval = cfg.PushInterval
+	}
+	if cfg.Namespace.Valid {
+		c.Namespace = cfg.Namespace
+	}
+	if len(cfg.Tags) > 0 {
+		c.Tags = cfg.Tags
+	}
+	return c
+}
+
+// Validate checks that the config makes sense.
+func (c Config) Validate() error {
+	if c.Addr.String == "" {
+		return errors.New("addr must be set")
+	}
+	if c.BufferSize.Int64 <= 0 {
+		return errors.New("buffer_size must be positive")
+	}
+	if time.Duration(c.PushInterval.Duration) <= 0 {
+		return errors.New("push_interval must be positive")
+	}
+	return nil
+}
+
+// ParseArg takes an arg string and converts it to a config, eg.
+// "addr=localhost:8125,namespace=loadtest.,tags={name,status}".
+func ParseArg(arg string) (Config, error) {
+	c := Config{}
+	params, err := strvals.Parse(arg)
+	if err != nil {
+		return c, err
+	}
+
+	if v, ok := params["tags"].(string); ok {
+		params["tags"] = []string{v}
+	}
+	if v, ok := params["push_interval"].(string); ok {
+		if err := c.PushInterval.UnmarshalText([]byte(v)); err != nil {
+			return c, err
+		}
+	}
+	delete(params, "push_interval")
+
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:  types.NullDecoder,
+		Result:      &c,
+		TagName:     "json",
+		ErrorUnused: true,
+	})
+	if err != nil {
+		return c, err
+	}
+	return c, dec.Decode(params)
+}
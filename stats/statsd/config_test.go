@@ -0,0 +1,84 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package statsd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestConfigParseArg(t *testing.T) {
+	c, err := ParseArg("addr=localhost:9125,tags=name")
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		Addr: null.StringFrom("localhost:9125"),
+		Tags: []string{"name"},
+	}, c)
+
+	c, err = ParseArg("addr=10.0.0.1:8125,buffer_size=512,push_interval=100ms,namespace=loadtest.,tags={name,status}")
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		Addr:         null.StringFrom("10.0.0.1:8125"),
+		BufferSize:   null.IntFrom(512),
+		PushInterval: types.NullDurationFrom(100 * time.Millisecond),
+		Namespace:    null.StringFrom("loadtest."),
+		Tags:         []string{"name", "status"},
+	}, c)
+
+	_, err = ParseArg("address=localhost:8125")
+	assert.Error(t, err)
+	_, err = ParseArg("buffer_size=big")
+	assert.Error(t, err)
+	_, err = ParseArg("push_interval=soon")
+	assert.Error(t, err)
+}
+
+func TestConfigApply(t *testing.T) {
+	c := NewConfig().Apply(Config{Namespace: null.StringFrom(""), Tags: []string{"name"}})
+	assert.Equal(t, "localhost:8125", c.Addr.String)
+	assert.Equal(t, int64(1432), c.BufferSize.Int64)
+	assert.Equal(t, types.NewNullDuration(1*time.Second, false), c.PushInterval)
+	assert.Equal(t, null.StringFrom(""), c.Namespace)
+	assert.Equal(t, []string{"name"}, c.Tags)
+	assert.NoError(t, c.Validate())
+
+	assert.Equal(t, "k6.", NewConfig().Apply(Config{}).Namespace.String)
+}
+
+func TestConfigValidate(t *testing.T) {
+	testdata := map[string]struct {
+		conf Config
+		err  string
+	}{
+		"Addr":         {Config{Addr: null.StringFrom("")}, "addr must be set"},
+		"BufferSize":   {Config{BufferSize: null.IntFrom(0)}, "buffer_size must be positive"},
+		"PushInterval": {Config{PushInterval: types.NullDurationFrom(0)}, "push_interval must be positive"},
+	}
+	for name, data := range testdata {
+		t.Run(name, func(t *testing.T) {
+			assert.EqualError(t, NewConfig().Apply(data.conf).Validate(), data.err)
+		})
+	}
+}
@@ -22,6 +22,8 @@ package stats
 
 import (
 	"encoding/json"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/dop251/goja"
@@ -56,21 +58,89 @@ type Threshold struct {
 	// AbortGracePeriod is a the minimum amount of time a test should be running before a failing
 	// this threshold will abort the test
 	AbortGracePeriod types.NullDuration
+	// Window is the length of the sliding time window the threshold is evaluated over, eg. 1m for
+	// "p(95) over 1m < 500", or 0 if it's evaluated over all of the metric's data. A windowed
+	// threshold has failed for good as soon as any of its windows fails.
+	Window time.Duration
+	// Worst is the worst window a windowed threshold was evaluated over so far, if any.
+	Worst *ThresholdWindow
 
-	pgm *goja.Program
-	rt  *goja.Runtime
+	expr      string // The source, without its window.
+	direction int    // Whether higher (1) or lower (-1) observed values are worse, if known.
+	pgm       *goja.Program
+	rt        *goja.Runtime
+}
+
+// ThresholdWindow is the result of evaluating a windowed threshold over one of its windows.
+type ThresholdWindow struct {
+	// End is when the window ended, relative to the start of the test.
+	End    time.Duration
+	Failed bool
+	// Values are what the threshold observed in the window, see Threshold.Observed.
+	Values []ObservedValue
+}
+
+// Failing windows are worse than passing ones; otherwise, the one whose first observed value is
+// furthest in the failing direction is.
+func (w *ThresholdWindow) worseThan(other *ThresholdWindow, direction int) bool {
+	if w.Failed != other.Failed {
+		return w.Failed
+	}
+	if direction == 0 || len(w.Values) == 0 || len(other.Values) == 0 {
+		return false
+	}
+	return float64(direction)*(w.Values[0].Value-other.Values[0].Value) > 0
+}
+
+// Matches a threshold's window, eg. " over 1m" in "p(95) over 1m < 500".
+var thresholdWindow = regexp.MustCompile(`\s+over\s+([0-9][0-9.]*[a-zµ]+(?:[0-9.]+[a-zµ]+)*)`)
+
+// Splits a threshold source into the expression to evaluate and its window, if it has one.
+func parseThresholdWindow(src string) (string, time.Duration, error) {
+	locs := thresholdWindow.FindAllStringSubmatchIndex(src, -1)
+	switch len(locs) {
+	case 0:
+		return src, 0, nil
+	case 1:
+	default:
+		return "", 0, errors.Errorf("a threshold can only have one window: %s", src)
+	}
+	loc := locs[0]
+	window, err := time.ParseDuration(src[loc[2]:loc[3]])
+	if err != nil {
+		return "", 0, errors.Wrap(err, "invalid threshold window")
+	}
+	if window <= 0 {
+		return "", 0, errors.Errorf("threshold windows must be positive: %s", src)
+	}
+	return src[:loc[0]] + src[loc[1]:], window, nil
 }
 
 func newThreshold(src string, newThreshold *goja.Runtime, abortOnFail bool, gracePeriod types.NullDuration) (*Threshold, error) {
-	pgm, err := goja.Compile("__threshold__", src, true)
+	expr, window, err := parseThresholdWindow(src)
+	if err != nil {
+		return nil, err
+	}
+	pgm, err := goja.Compile("__threshold__", expr, true)
 	if err != nil {
 		return nil, err
 	}
 
+	direction := 0
+	switch thresholdComparisonOp.FindString(expr) {
+	case "<", "<=":
+		direction = 1
+	case ">", ">=":
+		direction = -1
+	}
+
 	return &Threshold{
 		Source:           src,
 		AbortOnFail:      abortOnFail,
 		AbortGracePeriod: gracePeriod,
+		Window:           window,
+		expr:             expr,
+		direction:        direction,
 		pgm:              pgm,
 		rt:               newThreshold,
 	}, nil
@@ -90,6 +160,58 @@ func (t *Threshold) run() (bool, error) {
 	return b, err
 }
 
+// Evaluates a windowed threshold over the window the runtime was last updated with.
+func (t *Threshold) runWindow(end time.Duration) (bool, error) {
+	b, err := t.runNoTaint()
+	if err != nil {
+		return false, err
+	}
+	if !b {
+		t.LastFailed = true
+	}
+	w := &ThresholdWindow{End: end, Failed: !b, Values: t.Observed()}
+	if t.Worst == nil || w.worseThan(t.Worst, t.direction) {
+		t.Worst = w
+	}
+	return b, nil
+}
+
+// Splits threshold sources into comparisons, and comparisons into their operands.
+var (
+	thresholdLogicalOp    = regexp.MustCompile(`&&|\|\|`)
+	thresholdComparisonOp = regexp.MustCompile(`===?|!==?|<=|>=|<|>`)
+)
+
+// ObservedValue is the value of an expression a threshold compares, eg. "p(95)" in "p(95)<500".
+type ObservedValue struct {
+	Expr  string
+	Value float64
+}
+
+// Observed evaluates the left-hand sides of the threshold's comparisons with the values it was
+// last run with, in the order they appear in; it's meant to explain why a threshold failed.
+// Expressions that can't be evaluated, eg. because the threshold never ran, are left out.
+// For windowed thresholds, see Worst instead.
+func (t *Threshold) Observed() []ObservedValue {
+	var values []ObservedValue
+	for _, part := range thresholdLogicalOp.Split(t.expr, -1) {
+		loc := thresholdComparisonOp.FindStringIndex(part)
+		if loc == nil {
+			continue
+		}
+		expr := strings.TrimSpace(strings.TrimLeft(part[:loc[0]], "( \t"))
+		if expr == "" {
+			continue
+		}
+		v, err := t.rt.RunString(expr)
+		if err != nil {
+			continue
+		}
+		values = append(values, ObservedValue{expr, v.ToFloat()})
+	}
+	return values
+}
+
 type thresholdConfig struct {
 	Threshold        string             `json:"threshold"`
 	AbortOnFail      bool               `json:"abortOnFail"`
@@ -121,6 +243,79 @@ type Thresholds struct {
 	Runtime    *goja.Runtime
 	Thresholds []*Threshold
 	Abort      bool
+
+	recent *recentSamples // Only kept if some thresholds are windowed.
+}
+
+// How much time each of the buckets windowed thresholds are evaluated over covers; windows are
+// only as precise as that.
+const thresholdBucketSize = time.Second
+
+// The data windowed thresholds are evaluated over, up to the longest window. Samples are
+// aggregated into a sink of their metric's kind for every second, and windows are evaluated over
+// the merged buckets they cover; so memory depends on the length of the window rather than on the
+// number of samples, for trends too if their metric uses a sketch.
+type recentSamples struct {
+	length  time.Duration
+	buckets []sampleBucket // In order of start.
+}
+
+type sampleBucket struct {
+	start time.Time
+	sink  Sink
+}
+
+// Adds a sample to the bucket for its time. Samples mostly come in order, so the bucket is looked
+// for from the end.
+func (r *recentSamples) add(s Sample) {
+	if s.Metric == nil {
+		return
+	}
+	start := s.Time.Truncate(thresholdBucketSize)
+	i := len(r.buckets)
+	for i > 0 && r.buckets[i-1].start.After(start) {
+		i--
+	}
+	if i == 0 || !r.buckets[i-1].start.Equal(start) {
+		sink := newSinkLike(s.Metric.Sink)
+		if sink == nil {
+			return
+		}
+		r.buckets = append(r.buckets, sampleBucket{})
+		copy(r.buckets[i+1:], r.buckets[i:])
+		r.buckets[i] = sampleBucket{start: start, sink: sink}
+		i++
+	}
+	r.buckets[i-1].sink.Add(s)
+}
+
+// Drops the buckets that are entirely older than the longest window.
+func (r *recentSamples) expire(now time.Time) {
+	cutoff := now.Add(-r.length)
+	n := 0
+	for n < len(r.buckets) && !r.buckets[n].start.Add(thresholdBucketSize).After(cutoff) {
+		r.buckets[n] = sampleBucket{}
+		n++
+	}
+	if n > 0 {
+		r.buckets = r.buckets[n:]
+	}
+}
+
+// Merges the buckets a window covers into a new sink. Returns nil for empty windows.
+func (r *recentSamples) sink(window time.Duration, now time.Time) Sink {
+	cutoff := now.Add(-window)
+	var sink Sink
+	for _, b := range r.buckets {
+		if !b.start.Add(thresholdBucketSize).After(cutoff) {
+			continue
+		}
+		if sink == nil {
+			sink = newSinkLike(b.sink)
+		}
+		mergeSink(sink, b.sink)
+	}
+	return sink
 }
 
 // NewThresholds returns Thresholds objects representing the provided source strings
@@ -140,15 +335,34 @@ func newThresholdsWithConfig(configs []thresholdConfig) (Thresholds, error) {
 	}
 
 	ts := make([]*Threshold, len(configs))
+	var recent *recentSamples
 	for i, config := range configs {
 		t, err := newThreshold(config.Threshold, rt, config.AbortOnFail, config.AbortGracePeriod)
 		if err != nil {
 			return Thresholds{}, errors.Wrapf(err, "%d", i)
 		}
 		ts[i] = t
+		if t.Window > 0 {
+			if recent == nil {
+				recent = &recentSamples{}
+			}
+			if t.Window > recent.length {
+				recent.length = t.Window
+			}
+		}
 	}
 
-	return Thresholds{rt, ts, false}, nil
+	return Thresholds{Runtime: rt, Thresholds: ts, recent: recent}, nil
+}
+
+// Add aggregates a sample into the data the windowed thresholds are evaluated over, according to
+// its metric's sink; it's a no-op if there are none. Data that's already out of the longest window
+// is dropped, so it stays bounded even if the thresholds are never run.
+func (ts *Thresholds) Add(s Sample) {
+	if ts.recent != nil {
+		ts.recent.add(s)
+		ts.recent.expire(s.Time)
+	}
 }
 
 func (ts *Thresholds) updateVM(sink Sink, t time.Duration) error {
@@ -160,34 +374,81 @@ func (ts *Thresholds) updateVM(sink Sink, t time.Duration) error {
 	return nil
 }
 
+func (ts *Thresholds) abortOnFail(th *Threshold, t time.Duration) {
+	if ts.Abort || !th.AbortOnFail {
+		return
+	}
+	ts.Abort = !th.AbortGracePeriod.Valid ||
+		th.AbortGracePeriod.Duration < types.Duration(t)
+}
+
 func (ts *Thresholds) runAll(t time.Duration) (bool, error) {
 	succ := true
 	for i, th := range ts.Thresholds {
+		if th.Window > 0 {
+			continue
+		}
 		b, err := th.run()
 		if err != nil {
 			return false, errors.Wrapf(err, "%d", i)
 		}
 		if !b {
 			succ = false
+			ts.abortOnFail(th, t)
+		}
+	}
+	return succ, nil
+}
 
-			if ts.Abort || !th.AbortOnFail {
-				continue
-			}
+// Evaluates the windowed thresholds, each over the samples in the window that ends now. Windows
+// without any samples are skipped, so their thresholds keep their results.
+func (ts *Thresholds) runWindows(t time.Duration, now time.Time) (bool, error) {
+	if ts.recent == nil {
+		return true, nil
+	}
+	ts.recent.expire(now)
 
-			ts.Abort = !th.AbortGracePeriod.Valid ||
-				th.AbortGracePeriod.Duration < types.Duration(t)
+	succ := true
+	for i, th := range ts.Thresholds {
+		if th.Window == 0 {
+			continue
+		}
+		if sink := ts.recent.sink(th.Window, now); sink != nil {
+			// Rates are per second of the window, or of the test if it's shorter.
+			period := th.Window
+			if t > 0 && t < period {
+				period = t
+			}
+			if err := ts.updateVM(sink, period); err != nil {
+				return false, err
+			}
+			b, err := th.runWindow(t)
+			if err != nil {
+				return false, errors.Wrapf(err, "%d", i)
+			}
+			if !b {
+				ts.abortOnFail(th, t)
+			}
+		}
+		if th.LastFailed {
+			succ = false
 		}
 	}
 	return succ, nil
 }
 
 // Run processes all the thresholds with the provided Sink at the provided time and returns if any
-// of them fails
+// of them fails. Windowed thresholds are evaluated over the samples given to Add instead.
 func (ts *Thresholds) Run(sink Sink, t time.Duration) (bool, error) {
+	windowSucc, err := ts.runWindows(t, time.Now())
+	if err != nil {
+		return false, err
+	}
 	if err := ts.updateVM(sink, t); err != nil {
 		return false, err
 	}
-	return ts.runAll(t)
+	succ, err := ts.runAll(t)
+	return succ && windowSucc, err
 }
 
 // UnmarshalJSON is implementation of json.Unmarshaler
@@ -28,6 +28,7 @@ import (
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewThreshold(t *testing.T) {
@@ -216,6 +217,218 @@ func TestThresholdsRun(t *testing.T) {
 	})
 }
 
+func TestThresholdObserved(t *testing.T) {
+	ts, err := NewThresholds([]string{"p(95)<500", "(avg < 200) && max<=1000 || med === 0", "true"})
+	assert.NoError(t, err)
+	assert.Empty(t, ts.Thresholds[0].Observed())
+
+	sink := &TrendSink{}
+	for i := 0; i <= 100; i++ {
+		sink.Add(Sample{Value: float64(i * 10)})
+	}
+	_, err = ts.Run(sink, 0)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []ObservedValue{{"p(95)", 950}}, ts.Thresholds[0].Observed())
+	assert.Equal(t, []ObservedValue{{"avg", 500}, {"max", 1000}, {"med", 500}}, ts.Thresholds[1].Observed())
+	assert.Empty(t, ts.Thresholds[2].Observed())
+}
+
+func TestParseThresholdWindow(t *testing.T) {
+	testdata := map[string]struct {
+		expr   string
+		window time.Duration
+	}{
+		"p(95)<500":                 {"p(95)<500", 0},
+		"p(95) over 1m < 500":       {"p(95) < 500", time.Minute},
+		"rate over 1m30s>0.95":      {"rate>0.95", 90 * time.Second},
+		"avg over 500ms<1 && max<2": {"avg<1 && max<2", 500 * time.Millisecond},
+	}
+	for src, data := range testdata {
+		t.Run(src, func(t *testing.T) {
+			expr, window, err := parseThresholdWindow(src)
+			require.NoError(t, err)
+			assert.Equal(t, data.expr, expr)
+			assert.Equal(t, data.window, window)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		for _, src := range []string{"p(95) over 1x < 500", "avg over 1m < 1 && max over 2m < 2", "avg over 0s < 1"} {
+			_, _, err := parseThresholdWindow(src)
+			assert.Error(t, err, src)
+		}
+	})
+}
+
+func TestThresholdsRunWindows(t *testing.T) {
+	ts, err := NewThresholds([]string{"max over 1m < 500", "max < 1000"})
+	require.NoError(t, err)
+	windowed := ts.Thresholds[0]
+	assert.Equal(t, time.Minute, windowed.Window)
+	assert.Equal(t, time.Duration(0), ts.Thresholds[1].Window)
+
+	start := time.Now()
+	m := New("m", Trend)
+	sink := &TrendSink{}
+	add := func(offset time.Duration, value float64) {
+		s := Sample{Metric: m, Time: start.Add(offset), Value: value}
+		sink.Add(s)
+		ts.Add(s)
+	}
+
+	// A spike, then some steady values.
+	add(0, 100)
+	add(10*time.Second, 700)
+	add(20*time.Second, 100)
+
+	b, err := ts.runWindows(30*time.Second, start.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.False(t, b)
+	assert.True(t, windowed.LastFailed)
+	assert.Equal(t, &ThresholdWindow{
+		End: 30 * time.Second, Failed: true, Values: []ObservedValue{{"max", 700}},
+	}, windowed.Worst)
+
+	// The spike has left the window, but the threshold stays failed and keeps its worst window.
+	add(90*time.Second, 200)
+	b, err = ts.runWindows(100*time.Second, start.Add(100*time.Second))
+	require.NoError(t, err)
+	assert.False(t, b)
+	assert.True(t, windowed.LastFailed)
+	assert.Equal(t, 30*time.Second, windowed.Worst.End)
+	assert.Len(t, ts.recent.buckets, 1)
+
+	// Windows without samples are skipped.
+	b, err = ts.runWindows(200*time.Second, start.Add(200*time.Second))
+	require.NoError(t, err)
+	assert.False(t, b)
+	assert.Empty(t, ts.recent.buckets)
+
+	// Thresholds over all of the data are still evaluated as usual.
+	b, err = ts.runAll(200 * time.Second)
+	require.NoError(t, err)
+	assert.True(t, b)
+	assert.False(t, ts.Thresholds[1].LastFailed)
+}
+
+func TestThresholdsAddExpires(t *testing.T) {
+	ts, err := NewThresholds([]string{"p(95) over 1m < 500", "max over 10s < 500"})
+	require.NoError(t, err)
+
+	// An hour of samples, one every 100ms, without the thresholds ever running; they're kept in
+	// a bucket per second of the longest window, with the samples they cover.
+	m := New("m", Trend)
+	start := time.Now()
+	for i := 0; i < 36000; i++ {
+		ts.Add(Sample{Metric: m, Time: start.Add(time.Duration(i) * 100 * time.Millisecond), Value: 1})
+		require.True(t, len(ts.recent.buckets) <= 61, "%d buckets after %d", len(ts.recent.buckets), i)
+	}
+	last := start.Add(59*time.Minute + 59*time.Second + 900*time.Millisecond)
+	buckets := ts.recent.buckets
+	assert.Equal(t, last.Truncate(time.Second), buckets[len(buckets)-1].start)
+	assert.True(t, buckets[0].start.Add(time.Second).After(last.Add(-time.Minute)))
+	var n uint64
+	for _, b := range buckets {
+		n += b.sink.(*TrendSink).Count
+	}
+	assert.True(t, n >= 600 && n <= 610, "%d samples", n)
+
+	// Without windowed thresholds, nothing's kept.
+	ts, err = NewThresholds([]string{"p(95) < 500"})
+	require.NoError(t, err)
+	ts.Add(Sample{Metric: m, Time: start, Value: 1})
+	assert.Nil(t, ts.recent)
+}
+
+func TestThresholdsRunWindowsWorst(t *testing.T) {
+	ts, err := NewThresholds([]string{"avg over 10s < 500"})
+	require.NoError(t, err)
+	th := ts.Thresholds[0]
+
+	start := time.Now()
+	m := New("m", Trend)
+	sink := &TrendSink{}
+	for i, value := range []float64{300, 400, 200} {
+		s := Sample{Metric: m, Time: start.Add(time.Duration(i) * 20 * time.Second), Value: value}
+		sink.Add(s)
+		ts.Add(s)
+		b, err := ts.runWindows(time.Duration(i)*20*time.Second, s.Time)
+		require.NoError(t, err)
+		assert.True(t, b)
+	}
+	assert.False(t, th.LastFailed)
+	assert.Equal(t, &ThresholdWindow{
+		End: 20 * time.Second, Failed: false, Values: []ObservedValue{{"avg", 400}},
+	}, th.Worst)
+}
+
+func TestThresholdsRunWindowsAbort(t *testing.T) {
+	ts, err := newThresholdsWithConfig([]thresholdConfig{
+		{"rate over 10s > 0.5", true, types.NullDurationFrom(time.Minute)},
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	m := New("m", Rate)
+	ts.Add(Sample{Metric: m, Time: start, Value: 0})
+	b, err := ts.runWindows(30*time.Second, start)
+	require.NoError(t, err)
+	assert.False(t, b)
+	assert.False(t, ts.Abort, "still in the grace period")
+
+	ts.Add(Sample{Metric: m, Time: start.Add(time.Minute), Value: 0})
+	b, err = ts.runWindows(90*time.Second, start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, b)
+	assert.True(t, ts.Abort)
+}
+
+func TestThresholdsRunWindowsCounterRate(t *testing.T) {
+	ts, err := NewThresholds([]string{"rate over 10s >= 2", "rate over 1m < 2"})
+	require.NoError(t, err)
+
+	start := time.Now()
+	m := New("m", Counter)
+	for i := 0; i < 20; i++ {
+		ts.Add(Sample{Metric: m, Time: start.Add(time.Duration(i) * 500 * time.Millisecond), Value: 1})
+	}
+	now := start.Add(10 * time.Second)
+	b, err := ts.runWindows(10*time.Second, now)
+	require.NoError(t, err)
+	assert.False(t, b)
+	assert.Equal(t, []ObservedValue{{"rate", 2}}, ts.Thresholds[0].Worst.Values)
+	assert.False(t, ts.Thresholds[0].LastFailed)
+	// The second window is longer than the test so far, so its rate is per second of the test.
+	assert.Equal(t, []ObservedValue{{"rate", 2}}, ts.Thresholds[1].Worst.Values)
+	assert.True(t, ts.Thresholds[1].LastFailed)
+}
+
+func TestThresholdsRunWindowsSketch(t *testing.T) {
+	ts, err := NewThresholds([]string{"p(95) over 10s < 500"})
+	require.NoError(t, err)
+
+	// Trend metrics that use a sketch are kept in sketches for their windows too.
+	m := New("m", Trend)
+	m.Sink = NewSketchTrendSink()
+	start := time.Now()
+	for i := 0; i < 10000; i++ {
+		ts.Add(Sample{Metric: m, Time: start.Add(time.Duration(i) * time.Millisecond), Value: float64(i % 1000)})
+	}
+	for _, b := range ts.recent.buckets {
+		require.NotNil(t, b.sink.(*TrendSink).Sketch)
+		assert.Empty(t, b.sink.(*TrendSink).Values)
+	}
+	sink := ts.recent.sink(10*time.Second, start.Add(10*time.Second)).(*TrendSink)
+	require.NotNil(t, sink.Sketch)
+	assert.Equal(t, uint64(10000), sink.Count)
+	assert.InEpsilon(t, 949, sink.P(0.95), DefaultSketchRelativeAccuracy)
+
+	b, err := ts.runWindows(10*time.Second, start.Add(10*time.Second))
+	require.NoError(t, err)
+	assert.False(t, b)
+}
+
 func TestThresholdsJSON(t *testing.T) {
 	var testdata = []struct {
 		JSON        string
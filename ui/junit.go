@@ -0,0 +1,174 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+// JUnit XML, as understood by most CI servers; see https://llg.cubic.org/docs/junit/
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func (s *junitTestSuite) add(c junitTestCase) {
+	s.Cases = append(s.Cases, c)
+	s.Tests++
+	if c.Failure != nil {
+		s.Failures++
+	}
+	if c.Skipped != nil {
+		s.Skipped++
+	}
+}
+
+// ExportJUnit writes a JUnit XML report of a test run: every threshold is a test case in the
+// "thresholds" suite, and every check one in the "checks" suite, so failures show up in CI.
+func ExportJUnit(w io.Writer, data SummaryData) error {
+	suites := []junitTestSuite{
+		junitThresholds(data.Metrics, data.Opts.SummaryTimeUnit.String),
+		junitChecks(data.Root),
+	}
+	report := junitTestSuites{
+		Name:   "k6",
+		Time:   fmt.Sprintf("%.3f", data.Time.Seconds()),
+		Suites: suites,
+	}
+	for _, suite := range suites {
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+	}
+
+	b, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header+string(b)+"\n")
+	return err
+}
+
+func junitThresholds(metrics map[string]*stats.Metric, timeUnit string) junitTestSuite {
+	suite := junitTestSuite{Name: "thresholds", Cases: []junitTestCase{}}
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := metrics[name]
+		for _, threshold := range m.Thresholds.Thresholds {
+			c := junitTestCase{Name: threshold.Source, ClassName: name}
+			switch {
+			case !m.Tainted.Valid:
+				// Thresholds weren't run, either because they're disabled or the metric has no data.
+				c.Skipped = &junitSkipped{Message: "the threshold wasn't evaluated"}
+			case threshold.LastFailed:
+				message := fmt.Sprintf("%s failed for %s", threshold.Source, name)
+				if threshold.Worst != nil {
+					message += ", " + describeWorstWindow(m, threshold, timeUnit)
+				} else if observed := threshold.Observed(); len(observed) > 0 {
+					message += ", with " + formatObserved(m, observed, timeUnit)
+				}
+				c.Failure = &junitFailure{Message: message, Type: "threshold", Text: message}
+			}
+			suite.add(c)
+		}
+	}
+	return suite
+}
+
+func junitChecks(root *lib.Group) junitTestSuite {
+	suite := junitTestSuite{Name: "checks", Cases: []junitTestCase{}}
+	if root == nil {
+		return suite
+	}
+
+	var walk func(group *lib.Group)
+	walk = func(group *lib.Group) {
+		checkNames := make([]string, 0, len(group.Checks))
+		for name := range group.Checks {
+			checkNames = append(checkNames, name)
+		}
+		sort.Strings(checkNames)
+		for _, name := range checkNames {
+			check := group.Checks[name]
+			c := junitTestCase{Name: check.Name, ClassName: "checks" + group.Path}
+			if check.Fails > 0 {
+				total := check.Passes + check.Fails
+				message := fmt.Sprintf("%d of %d checks failed (%d%% passed): %s %d / %s %d",
+					check.Fails, total, 100*check.Passes/total, SuccMark, check.Passes, FailMark, check.Fails)
+				c.Failure = &junitFailure{Message: message, Type: "check", Text: message}
+			}
+			suite.add(c)
+		}
+
+		groupNames := make([]string, 0, len(group.Groups))
+		for name := range group.Groups {
+			groupNames = append(groupNames, name)
+		}
+		sort.Strings(groupNames)
+		for _, name := range groupNames {
+			walk(group.Groups[name])
+		}
+	}
+	walk(root)
+	return suite
+}
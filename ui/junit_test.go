@@ -0,0 +1,88 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2018 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestExportJUnit(t *testing.T) {
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+	check, err := root.Check("status is 200")
+	require.NoError(t, err)
+	check.Passes, check.Fails = 9, 1
+	group, err := root.Group("child")
+	require.NoError(t, err)
+	check, err = group.Check("body & headers")
+	require.NoError(t, err)
+	check.Passes = 10
+
+	duration := stats.New("http_req_duration", stats.Trend, stats.Time)
+	duration.Sink = createTestTrendSink(101)
+	duration.Thresholds, err = stats.NewThresholds([]string{"p(95)<100", "max<90 && avg<10"})
+	require.NoError(t, err)
+	_, err = duration.Thresholds.Run(duration.Sink, 0)
+	require.NoError(t, err)
+	duration.Tainted = null.BoolFrom(true)
+	failed := stats.New("http_req_failed", stats.Rate)
+	failed.Thresholds, err = stats.NewThresholds([]string{"rate<0.01"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, ExportJUnit(&buf, SummaryData{
+		Root: root,
+		Metrics: map[string]*stats.Metric{
+			"http_req_duration": duration,
+			"http_req_failed":   failed,
+			"vus":               stats.New("vus", stats.Gauge),
+		},
+		Opts: lib.Options{SummaryTimeUnit: null.StringFrom("ms")},
+		Time: 1500 * time.Millisecond,
+	}))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="k6" tests="5" failures="2" skipped="1" time="1.500">
+  <testsuite name="thresholds" tests="3" failures="1" skipped="1">
+    <testcase name="p(95)&lt;100" classname="http_req_duration"></testcase>
+    <testcase name="max&lt;90 &amp;&amp; avg&lt;10" classname="http_req_duration">
+      <failure message="max&lt;90 &amp;&amp; avg&lt;10 failed for http_req_duration, with max=100.00ms, avg=50.00ms" type="threshold">max&lt;90 &amp;&amp; avg&lt;10 failed for http_req_duration, with max=100.00ms, avg=50.00ms</failure>
+    </testcase>
+    <testcase name="rate&lt;0.01" classname="http_req_failed">
+      <skipped message="the threshold wasn&#39;t evaluated"></skipped>
+    </testcase>
+  </testsuite>
+  <testsuite name="checks" tests="2" failures="1" skipped="0">
+    <testcase name="status is 200" classname="checks">
+      <failure message="1 of 10 checks failed (90% passed): ✓ 9 / ✗ 1" type="check">1 of 10 checks failed (90% passed): ✓ 9 / ✗ 1</failure>
+    </testcase>
+    <testcase name="body &amp; headers" classname="checks::child"></testcase>
+  </testsuite>
+</testsuites>
+`, buf.String())
+}
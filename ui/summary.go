@@ -21,6 +21,7 @@
 package ui
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -32,6 +33,7 @@ import (
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/stats"
 	"golang.org/x/text/unicode/norm"
+	null "gopkg.in/guregu/null.v3"
 )
 
 const (
@@ -40,6 +42,7 @@ const (
 
 	SuccMark = "✓"
 	FailMark = "✗"
+	WarnMark = "!"
 )
 
 var (
@@ -163,6 +166,12 @@ type SummaryData struct {
 	Root    *lib.Group
 	Metrics map[string]*stats.Metric
 	Time    time.Duration
+
+	// Only set for breakpoint tests.
+	Breakpoint *lib.BreakpointResult
+
+	// Things that may have skewed the results, eg. the load generator being overloaded.
+	Warnings []string
 }
 
 func SummarizeCheck(w io.Writer, indent string, check *lib.Check) {
@@ -347,7 +356,38 @@ func SummarizeMetrics(w io.Writer, indent string, t time.Duration, timeUnit stri
 			}
 		}
 		_, _ = fmt.Fprint(w, indent+fmtIndent+markColor.Sprint(mark)+" "+fmtName+" "+fmtData+"\n")
+
+		for _, threshold := range m.Thresholds.Thresholds {
+			if threshold.Worst == nil {
+				continue
+			}
+			color := SuccColor
+			if threshold.Worst.Failed {
+				color = FailColor
+			}
+			_, _ = fmt.Fprint(w, indent+fmtIndent+"  "+color.Sprint(DetailsPrefix+" "+threshold.Source)+
+				ExtraColor.Sprint(": "+describeWorstWindow(m, threshold, timeUnit))+"\n")
+		}
+	}
+}
+
+// Formats the values a threshold observed, eg. "p(95)=612.34ms, avg=180ms".
+func formatObserved(m *stats.Metric, observed []stats.ObservedValue, timeUnit string) string {
+	values := make([]string, len(observed))
+	for i, v := range observed {
+		values[i] = v.Expr + "=" + m.HumanizeValue(v.Value, timeUnit)
+	}
+	return strings.Join(values, ", ")
+}
+
+// Describes the worst window of a windowed threshold, eg. "worst window ended at 1m30s, with
+// p(95)=612.34ms".
+func describeWorstWindow(m *stats.Metric, threshold *stats.Threshold, timeUnit string) string {
+	desc := "worst window ended at " + threshold.Worst.End.Round(time.Second).String()
+	if len(threshold.Worst.Values) > 0 {
+		desc += ", with " + formatObserved(m, threshold.Worst.Values, timeUnit)
 	}
+	return desc
 }
 
 // Summarizes a dataset and returns whether the test run was considered a success.
@@ -356,4 +396,262 @@ func Summarize(w io.Writer, indent string, data SummaryData) {
 		SummarizeGroup(w, indent+"    ", data.Root)
 	}
 	SummarizeMetrics(w, indent+"  ", data.Time, data.Opts.SummaryTimeUnit.String, data.Metrics)
+	if data.Breakpoint != nil {
+		_, _ = fmt.Fprint(w, "\n")
+		SummarizeBreakpoint(w, indent+"    ", *data.Breakpoint)
+	}
+	if len(data.Warnings) > 0 {
+		_, _ = fmt.Fprint(w, "\n")
+		for _, warning := range data.Warnings {
+			_, _ = fmt.Fprintf(w, "%s    %s %s\n", indent, FailColor.Sprint(WarnMark), warning)
+		}
+	}
+}
+
+// SummarizeBreakpoint writes the progression of a breakpoint test: the highest level that passed,
+// and every step with the thresholds that failed over it.
+func SummarizeBreakpoint(w io.Writer, indent string, result lib.BreakpointResult) {
+	unit := " VUs"
+	if result.Mode == lib.BreakpointModeArrivalRate {
+		unit = " iterations/s"
+	}
+
+	highest := FailColor.Sprint("no level passed")
+	if result.Highest.Valid {
+		highest = ValueColor.Sprint(strconv.FormatInt(result.Highest.Int64, 10) + unit)
+	}
+	if !result.Done {
+		highest += ExtraColor.Sprint(" (the search didn't finish)")
+	}
+	_, _ = fmt.Fprintf(w, "%sbreakpoint: %s\n", indent, highest)
+
+	for _, step := range result.Steps {
+		mark, markColor := SuccMark, SuccColor
+		if !step.Passed {
+			mark, markColor = FailMark, FailColor
+		}
+		_, _ = fmt.Fprintf(w, "%s  %s %s %s\n", indent, markColor.Sprint(mark),
+			ValueColor.Sprint(strconv.FormatInt(step.Level, 10)+unit),
+			ExtraColor.Sprint("for "+step.Duration.String()))
+		for _, failed := range step.FailedThresholds {
+			_, _ = fmt.Fprintf(w, "%s    %s %s\n", indent, DetailsPrefix, failed)
+		}
+	}
+}
+
+// SummaryExport is the machine-readable version of the end-of-test summary, as written by
+// ExportSummary. Its JSON schema is meant to be stable: fields may be added, but not changed.
+type SummaryExport struct {
+	// Every metric and submetric, by name, eg. "http_req_duration{status:200}".
+	Metrics map[string]MetricSummary `json:"metrics"`
+	// The root group, which contains all other groups and checks.
+	RootGroup GroupSummary `json:"root_group"`
+	// How long the test ran for, in milliseconds.
+	TestRunDuration float64 `json:"test_run_duration_ms"`
+	// The progression of a breakpoint test, if it was one.
+	Breakpoint *BreakpointSummary `json:"breakpoint,omitempty"`
+	// Things that may have skewed the results, eg. the load generator being overloaded.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// BreakpointSummary holds the progression of a breakpoint test.
+type BreakpointSummary struct {
+	Mode string `json:"mode"` // "vus" or "arrival-rate"
+	// The highest level the thresholds passed at, or null if none did.
+	Highest null.Int `json:"highest"`
+	// Whether the search finished, rather than the test being stopped or running out of time.
+	Done  bool                    `json:"done"`
+	Steps []BreakpointStepSummary `json:"steps"`
+}
+
+// BreakpointStepSummary holds one of the levels a breakpoint test ran at.
+type BreakpointStepSummary struct {
+	Level int64 `json:"level"`
+	// When the step started, since the start of the test, and how long it ran for, in milliseconds.
+	StartTime float64 `json:"start_time_ms"`
+	Duration  float64 `json:"duration_ms"`
+	// Whether the thresholds passed over the step, and the ones that didn't, eg.
+	// "http_req_duration: p(95)<500".
+	Passed           bool     `json:"passed"`
+	FailedThresholds []string `json:"failed_thresholds"`
+}
+
+// MetricSummary holds a metric's values at the end of the test.
+type MetricSummary struct {
+	Type     stats.MetricType `json:"type"`
+	Contains stats.ValueType  `json:"contains"`
+
+	// The values shown in the summary, unformatted; times are in milliseconds and data amounts
+	// in bytes. Counters have "count" and "rate" (per second), gauges "value", "min" and "max",
+	// rates "rate", "passes" and "fails", and trends have the trend columns, eg. "avg" and
+	// "p(95)". Metrics without any data have no values.
+	Values map[string]float64 `json:"values"`
+
+	// Thresholds defined on the metric, by source, and whether they passed.
+	Thresholds map[string]ThresholdSummary `json:"thresholds,omitempty"`
+}
+
+// ThresholdSummary holds the result of a threshold.
+type ThresholdSummary struct {
+	OK bool `json:"ok"`
+
+	// The worst window of thresholds evaluated over a sliding window, eg. "p(95) over 1m < 500".
+	WorstWindow *WindowSummary `json:"worst_window,omitempty"`
+}
+
+// WindowSummary holds the result of a windowed threshold over one of its windows.
+type WindowSummary struct {
+	// When the window ended, in milliseconds since the start of the test.
+	End float64 `json:"end_ms"`
+	OK  bool    `json:"ok"`
+	// The values the threshold observed in the window, by expression, eg. "p(95)".
+	Values map[string]float64 `json:"values"`
+}
+
+// GroupSummary holds a group, with its subgroups and checks sorted by name.
+type GroupSummary struct {
+	Name   string         `json:"name"`
+	Path   string         `json:"path"`
+	ID     string         `json:"id"`
+	Groups []GroupSummary `json:"groups"`
+	Checks []CheckSummary `json:"checks"`
+}
+
+// CheckSummary holds the results of a check.
+type CheckSummary struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	ID     string `json:"id"`
+	Passes int64  `json:"passes"`
+	Fails  int64  `json:"fails"`
+}
+
+// NewSummaryExport creates a machine-readable summary from summary data.
+func NewSummaryExport(data SummaryData) SummaryExport {
+	export := SummaryExport{
+		Metrics:         make(map[string]MetricSummary, len(data.Metrics)),
+		TestRunDuration: stats.D(data.Time),
+		Warnings:        data.Warnings,
+	}
+	for name, m := range data.Metrics {
+		export.Metrics[name] = summarizeMetric(data.Time, m)
+	}
+	if data.Root != nil {
+		export.RootGroup = summarizeGroup(data.Root)
+	}
+	if bp := data.Breakpoint; bp != nil {
+		export.Breakpoint = &BreakpointSummary{
+			Mode:    bp.Mode,
+			Highest: bp.Highest,
+			Done:    bp.Done,
+			Steps:   make([]BreakpointStepSummary, len(bp.Steps)),
+		}
+		for i, step := range bp.Steps {
+			export.Breakpoint.Steps[i] = BreakpointStepSummary{
+				Level:            step.Level,
+				StartTime:        stats.D(time.Duration(step.StartTime)),
+				Duration:         stats.D(time.Duration(step.Duration)),
+				Passed:           step.Passed,
+				FailedThresholds: step.FailedThresholds,
+			}
+		}
+	}
+	return export
+}
+
+func summarizeMetric(t time.Duration, m *stats.Metric) MetricSummary {
+	summary := MetricSummary{Type: m.Type, Contains: m.Contains, Values: map[string]float64{}}
+
+	m.Sink.Calc()
+	switch sink := m.Sink.(type) {
+	case *stats.CounterSink:
+		rate := 0.0
+		if t > 0 {
+			rate = sink.Value / (float64(t) / float64(time.Second))
+		}
+		summary.Values["count"] = sink.Value
+		summary.Values["rate"] = rate
+	case *stats.GaugeSink:
+		summary.Values["value"] = sink.Value
+		summary.Values["min"] = sink.Min
+		summary.Values["max"] = sink.Max
+	case *stats.RateSink:
+		rate := 0.0
+		if sink.Total > 0 {
+			rate = float64(sink.Trues) / float64(sink.Total)
+		}
+		summary.Values["rate"] = rate
+		summary.Values["passes"] = float64(sink.Trues)
+		summary.Values["fails"] = float64(sink.Total - sink.Trues)
+	case *stats.TrendSink:
+		for _, col := range TrendColumns {
+			summary.Values[col.Key] = col.Get(sink)
+		}
+	}
+
+	if len(m.Thresholds.Thresholds) > 0 {
+		summary.Thresholds = make(map[string]ThresholdSummary, len(m.Thresholds.Thresholds))
+		for _, threshold := range m.Thresholds.Thresholds {
+			ts := ThresholdSummary{OK: !threshold.LastFailed}
+			if worst := threshold.Worst; worst != nil {
+				ts.WorstWindow = &WindowSummary{
+					End:    stats.D(worst.End),
+					OK:     !worst.Failed,
+					Values: make(map[string]float64, len(worst.Values)),
+				}
+				for _, v := range worst.Values {
+					ts.WorstWindow.Values[v.Expr] = v.Value
+				}
+			}
+			summary.Thresholds[threshold.Source] = ts
+		}
+	}
+	return summary
+}
+
+func summarizeGroup(group *lib.Group) GroupSummary {
+	summary := GroupSummary{
+		Name:   group.Name,
+		Path:   group.Path,
+		ID:     group.ID,
+		Groups: []GroupSummary{},
+		Checks: []CheckSummary{},
+	}
+	for _, grp := range group.Groups {
+		summary.Groups = append(summary.Groups, summarizeGroup(grp))
+	}
+	sort.Slice(summary.Groups, func(i, j int) bool { return summary.Groups[i].Name < summary.Groups[j].Name })
+	for _, check := range group.Checks {
+		summary.Checks = append(summary.Checks, CheckSummary{
+			Name:   check.Name,
+			Path:   check.Path,
+			ID:     check.ID,
+			Passes: check.Passes,
+			Fails:  check.Fails,
+		})
+	}
+	sort.Slice(summary.Checks, func(i, j int) bool { return summary.Checks[i].Name < summary.Checks[j].Name })
+	return summary
+}
+
+// ExportSummary writes a machine-readable summary as JSON, see SummaryExport.
+func ExportSummary(w io.Writer, data SummaryData) error {
+	b, err := json.MarshalIndent(NewSummaryExport(data), "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// ScriptSummary is the summary handed to a script's handleSummary() callback: the machine-readable
+// summary, along with the options the test ran with.
+type ScriptSummary struct {
+	SummaryExport
+	Options lib.Options `json:"options"`
+}
+
+// NewScriptSummary creates the summary passed to handleSummary() from summary data.
+func NewScriptSummary(data SummaryData) ScriptSummary {
+	return ScriptSummary{SummaryExport: NewSummaryExport(data), Options: data.Opts}
 }
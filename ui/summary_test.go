@@ -21,10 +21,18 @@
 package ui
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
 )
 
 var verifyTests = []struct {
@@ -158,3 +166,195 @@ func TestGeneratePercentileTrendColumn(t *testing.T) {
 		assert.Exactly(t, err, ErrPercentileStatInvalidValue)
 	})
 }
+
+func TestExportSummary(t *testing.T) {
+	TrendColumns = defaultTrendColumns
+
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+	group, err := root.Group("child")
+	require.NoError(t, err)
+	check, err := group.Check("status is 200")
+	require.NoError(t, err)
+	check.Passes, check.Fails = 9, 1
+
+	duration := stats.New("http_req_duration", stats.Trend, stats.Time)
+	duration.Sink = createTestTrendSink(101)
+	duration.Thresholds, err = stats.NewThresholds([]string{"p(95)<100", "max<90"})
+	require.NoError(t, err)
+	duration.Thresholds.Thresholds[1].LastFailed = true
+	reqs := stats.New("http_reqs", stats.Counter)
+	reqs.Sink.Add(stats.Sample{Value: 20})
+	vus := stats.New("vus", stats.Gauge)
+	vus.Sink.Add(stats.Sample{Value: 5})
+	vus.Sink.Add(stats.Sample{Value: 2})
+	checks := stats.New("checks", stats.Rate)
+	checks.Sink = &stats.RateSink{Trues: 9, Total: 10}
+	empty := stats.New("empty", stats.Rate)
+
+	var buf bytes.Buffer
+	require.NoError(t, ExportSummary(&buf, SummaryData{
+		Root: root,
+		Metrics: map[string]*stats.Metric{
+			"http_req_duration": duration,
+			"http_reqs":         reqs,
+			"vus":               vus,
+			"checks":            checks,
+			"empty":             empty,
+		},
+		Time: 10 * time.Second,
+	}))
+	assert.JSONEq(t, fmt.Sprintf(`{
+		"metrics": {
+			"http_req_duration": {
+				"type": "trend",
+				"contains": "time",
+				"values": {"avg": 50, "min": 0, "med": 50, "max": 100, "p(90)": 90, "p(95)": 95},
+				"thresholds": {"p(95)<100": {"ok": true}, "max<90": {"ok": false}}
+			},
+			"http_reqs": {"type": "counter", "contains": "default", "values": {"count": 20, "rate": 2}},
+			"vus": {"type": "gauge", "contains": "default", "values": {"value": 2, "min": 2, "max": 5}},
+			"checks": {"type": "rate", "contains": "default", "values": {"rate": 0.9, "passes": 9, "fails": 1}},
+			"empty": {"type": "rate", "contains": "default", "values": {"rate": 0, "passes": 0, "fails": 0}}
+		},
+		"root_group": {
+			"name": "", "path": "", "id": "%s",
+			"groups": [{
+				"name": "child", "path": "::child", "id": "%s",
+				"groups": [],
+				"checks": [{"name": "status is 200", "path": "::child::status is 200", "id": "%s", "passes": 9, "fails": 1}]
+			}],
+			"checks": []
+		},
+		"test_run_duration_ms": 10000
+	}`, root.ID, group.ID, check.ID), buf.String())
+}
+
+func TestNewScriptSummary(t *testing.T) {
+	reqs := stats.New("http_reqs", stats.Counter)
+	reqs.Sink.Add(stats.Sample{Value: 20})
+
+	summary := NewScriptSummary(SummaryData{
+		Opts:    lib.Options{VUs: null.IntFrom(10)},
+		Metrics: map[string]*stats.Metric{"http_reqs": reqs},
+		Time:    10 * time.Second,
+	})
+	assert.Equal(t, map[string]float64{"count": 20, "rate": 2}, summary.Metrics["http_reqs"].Values)
+	assert.Equal(t, 10000.0, summary.TestRunDuration)
+
+	data, err := json.Marshal(summary)
+	require.NoError(t, err)
+	var raw map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.Contains(t, raw, "metrics")
+	assert.Contains(t, raw, "root_group")
+	assert.Contains(t, raw, "test_run_duration_ms")
+
+	var opts lib.Options
+	require.NoError(t, json.Unmarshal(raw["options"], &opts))
+	assert.Equal(t, null.IntFrom(10), opts.VUs)
+}
+
+func TestSummarizeWorstWindow(t *testing.T) {
+	duration := stats.New("http_req_duration", stats.Trend, stats.Time)
+	duration.Sink = createTestTrendSink(101)
+	var err error
+	duration.Thresholds, err = stats.NewThresholds([]string{"max over 1m<500", "p(95)<100"})
+	require.NoError(t, err)
+	windowed := duration.Thresholds.Thresholds[0]
+	windowed.LastFailed = true
+	windowed.Worst = &stats.ThresholdWindow{
+		End: 90 * time.Second, Failed: true, Values: []stats.ObservedValue{{Expr: "max", Value: 700}},
+	}
+	duration.Tainted = null.BoolFrom(true)
+	data := SummaryData{
+		Metrics: map[string]*stats.Metric{"http_req_duration": duration},
+		Opts:    lib.Options{SummaryTimeUnit: null.StringFrom("ms")},
+		Time:    2 * time.Minute,
+	}
+
+	t.Run("Summarize", func(t *testing.T) {
+		var buf bytes.Buffer
+		Summarize(&buf, "", data)
+		assert.Contains(t, buf.String(), "max over 1m<500")
+		assert.Contains(t, buf.String(), ": worst window ended at 1m30s, with max=700.00ms")
+		assert.NotContains(t, buf.String(), "p(95)<100")
+	})
+	t.Run("Export", func(t *testing.T) {
+		summary := NewSummaryExport(data)
+		assert.Equal(t, map[string]ThresholdSummary{
+			"max over 1m<500": {OK: false, WorstWindow: &WindowSummary{
+				End: 90000, OK: false, Values: map[string]float64{"max": 700},
+			}},
+			"p(95)<100": {OK: true},
+		}, summary.Metrics["http_req_duration"].Thresholds)
+	})
+	t.Run("JUnit", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, ExportJUnit(&buf, data))
+		assert.Contains(t, buf.String(),
+			`failed for http_req_duration, worst window ended at 1m30s, with max=700.00ms`)
+	})
+}
+
+func TestSummarizeBreakpoint(t *testing.T) {
+	data := SummaryData{
+		Metrics: map[string]*stats.Metric{},
+		Breakpoint: &lib.BreakpointResult{
+			Mode: lib.BreakpointModeVUs,
+			Steps: []lib.BreakpointStep{
+				{Level: 10, Duration: types.Duration(time.Minute), Passed: true},
+				{
+					Level: 20, StartTime: types.Duration(time.Minute), Duration: types.Duration(time.Minute),
+					FailedThresholds: []string{"http_req_duration: p(95)<500"},
+				},
+			},
+			Highest: null.IntFrom(10),
+			Done:    true,
+		},
+	}
+
+	t.Run("Summarize", func(t *testing.T) {
+		var buf bytes.Buffer
+		Summarize(&buf, "", data)
+		assert.Contains(t, buf.String(), "breakpoint: 10 VUs\n")
+		assert.Contains(t, buf.String(), "20 VUs")
+		assert.Contains(t, buf.String(), DetailsPrefix+" http_req_duration: p(95)<500\n")
+	})
+	t.Run("Export", func(t *testing.T) {
+		b, err := json.Marshal(NewSummaryExport(data).Breakpoint)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"mode": "vus", "highest": 10, "done": true,
+			"steps": [
+				{"level": 10, "start_time_ms": 0, "duration_ms": 60000, "passed": true, "failed_thresholds": null},
+				{"level": 20, "start_time_ms": 60000, "duration_ms": 60000, "passed": false,
+				 "failed_thresholds": ["http_req_duration: p(95)<500"]}
+			]
+		}`, string(b))
+		assert.Nil(t, NewSummaryExport(SummaryData{}).Breakpoint)
+	})
+}
+
+func TestSummarizeWarnings(t *testing.T) {
+	data := SummaryData{
+		Metrics:  map[string]*stats.Metric{},
+		Warnings: []string{"the load generator was CPU-bound"},
+	}
+
+	t.Run("Summarize", func(t *testing.T) {
+		var buf bytes.Buffer
+		Summarize(&buf, "", data)
+		assert.Contains(t, buf.String(), WarnMark+" the load generator was CPU-bound\n")
+
+		buf.Reset()
+		Summarize(&buf, "", SummaryData{Metrics: map[string]*stats.Metric{}})
+		assert.NotContains(t, buf.String(), WarnMark)
+	})
+	t.Run("Export", func(t *testing.T) {
+		assert.Equal(t, data.Warnings, NewSummaryExport(data).Warnings)
+		b, err := json.Marshal(NewSummaryExport(SummaryData{}))
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), "warnings")
+	})
+}